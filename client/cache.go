@@ -0,0 +1,131 @@
+package client
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Cache keeps the values read by a Client for a TTL, evicting the least
+// recently used ones beyond its size. A cached value is served without asking
+// the store, so it can be stale: a change made by another client shows up
+// once the value expires, up to the TTL later. Writes made through the
+// caching client invalidate their key straight away. Invalidate drops a key
+// known to have changed. A Cache is safe for concurrent use.
+type Cache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	entries map[string]*list.Element
+	lru     *list.List
+	stats   CacheStats
+
+	now func() time.Time
+}
+
+// CacheStats count the lookups of a Cache.
+type CacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+}
+
+type cacheEntry struct {
+	key       string
+	value     string
+	expiresAt time.Time
+}
+
+// NewCache returns a Cache holding up to size values, each for ttl.
+func NewCache(size int, ttl time.Duration) *Cache {
+	return &Cache{
+		size:    size,
+		ttl:     ttl,
+		entries: make(map[string]*list.Element, size),
+		lru:     list.New(),
+		now:     time.Now,
+	}
+}
+
+// get returns the value cached for key, if it hasn't expired.
+func (c *Cache) get(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		c.stats.Misses++
+		return "", false
+	}
+
+	e := el.Value.(*cacheEntry)
+	if !c.now().Before(e.expiresAt) {
+		c.lru.Remove(el)
+		delete(c.entries, key)
+		c.stats.Misses++
+
+		return "", false
+	}
+
+	c.lru.MoveToFront(el)
+	c.stats.Hits++
+
+	return e.value, true
+}
+
+// set caches value for key, evicting the least recently used value if the
+// cache is full.
+func (c *Cache) set(key, value string) {
+	if c.size <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expiresAt := c.now().Add(c.ttl)
+	if el, ok := c.entries[key]; ok {
+		e := el.Value.(*cacheEntry)
+		e.value, e.expiresAt = value, expiresAt
+		c.lru.MoveToFront(el)
+
+		return
+	}
+
+	if c.lru.Len() >= c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+		c.stats.Evictions++
+	}
+	c.entries[key] = c.lru.PushFront(&cacheEntry{key: key, value: value, expiresAt: expiresAt})
+}
+
+// Invalidate drops the value cached for key, the next Get reads it from the
+// store.
+func (c *Cache) Invalidate(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		c.lru.Remove(el)
+		delete(c.entries, key)
+	}
+}
+
+// Len returns the number of values cached, expired ones included until they
+// are looked up or evicted.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.lru.Len()
+}
+
+// Stats returns the counts of hits, misses and evictions so far.
+func (c *Cache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.stats
+}
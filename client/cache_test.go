@@ -0,0 +1,79 @@
+package client
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCacheTTL(t *testing.T) {
+	now := time.Unix(0, 0)
+	c := NewCache(10, time.Minute)
+	c.now = func() time.Time { return now }
+
+	c.set("k", "v")
+	if v, ok := c.get("k"); !ok || v != "v" {
+		t.Errorf("get(k) = %q, %t, want the cached value", v, ok)
+	}
+
+	now = now.Add(time.Minute)
+	if _, ok := c.get("k"); ok {
+		t.Errorf("get(k) returned a value past its TTL")
+	}
+
+	if expected := (CacheStats{Hits: 1, Misses: 1}); c.Stats() != expected {
+		t.Errorf("Got stats %+v, expected %+v", c.Stats(), expected)
+	}
+}
+
+func TestCacheLRU(t *testing.T) {
+	c := NewCache(2, time.Minute)
+
+	c.set("a", "1")
+	c.set("b", "2")
+	c.get("a")
+	c.set("c", "3")
+
+	if _, ok := c.get("b"); ok {
+		t.Errorf("the least recently used key wasn't evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := c.get(key); !ok {
+			t.Errorf("%s was evicted", key)
+		}
+	}
+	if c.Len() != 2 || c.Stats().Evictions != 1 {
+		t.Errorf("Got %d values and stats %+v, expected 2 values and 1 eviction", c.Len(), c.Stats())
+	}
+
+	c.Invalidate("a")
+	if _, ok := c.get("a"); ok {
+		t.Errorf("get(a) returned an invalidated value")
+	}
+}
+
+func TestCacheConcurrent(t *testing.T) {
+	c := NewCache(8, time.Minute)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				key := strconv.Itoa((i + j) % 16)
+				c.set(key, key)
+				if v, ok := c.get(key); ok && v != key {
+					t.Errorf("get(%s) = %q", key, v)
+				}
+				c.Invalidate(strconv.Itoa(j % 16))
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if c.Len() > 8 {
+		t.Errorf("the cache holds %d values, more than its size", c.Len())
+	}
+}
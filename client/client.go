@@ -0,0 +1,513 @@
+// Package client is a Go client for the HTTP API of the key-value store.
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// leaderHeader names the leader on the answers of followers sending clients
+// to it, like store.LeaderHeader.
+const leaderHeader = "X-Raft-Leader"
+
+// maxEventSize bounds the lines of a watch stream, room for the largest
+// value, 8 MiB, escaped in JSON.
+const maxEventSize = 32 << 20
+
+// Client sends requests to the nodes of the store. Followers forward them to
+// the leader, or send the client to it depending on their follower mode: the
+// client then resends the request to the leader, and sends the following ones
+// straight to it. A Client is safe for concurrent use.
+type Client struct {
+	endpoints []string
+	http      *http.Client
+	cache     *Cache
+	token     string
+	timeout   time.Duration
+	retries   int
+	backoff   time.Duration
+
+	mu sync.Mutex
+	// next is the index in endpoints of the node requests go to while no
+	// leader is known.
+	next   int
+	leader string
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHTTPClient sends the requests with hc instead of http.DefaultClient.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.http = hc
+	}
+}
+
+// WithTLSConfig sends the requests with an HTTP client using tc, to reach
+// nodes serving HTTPS with a certificate of a private authority or asking
+// for a client certificate. It replaces the client of WithHTTPClient.
+func WithTLSConfig(tc *tls.Config) Option {
+	return func(c *Client) {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tc
+		c.http = &http.Client{Transport: transport}
+	}
+}
+
+// WithCache caches the values read by Get, see Cache.
+func WithCache(size int, ttl time.Duration) Option {
+	return func(c *Client) {
+		c.cache = NewCache(size, ttl)
+	}
+}
+
+// WithToken authenticates the requests with the bearer token, for the nodes
+// requiring one.
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithEndpoints adds nodes to send requests to when the others can't be
+// reached.
+func WithEndpoints(addrs ...string) Option {
+	return func(c *Client) {
+		for _, addr := range addrs {
+			c.endpoints = append(c.endpoints, strings.TrimSuffix(addr, "/"))
+		}
+	}
+}
+
+// WithTimeout bounds each attempt of a request to d, zero, the default,
+// meaning no bound but the one of the context. Watches aren't bounded.
+func WithTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		c.timeout = d
+	}
+}
+
+// WithRetries sets how many times a request is resent when the node it went
+// to isn't the leader, or couldn't be reached, 3 by default. While the
+// cluster elects a leader, the client waits between the attempts, twice as
+// long each time from backoff.
+func WithRetries(n int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.retries, c.backoff = n, backoff
+	}
+}
+
+// New returns a Client for the node at addr, such as http://localhost:8080.
+func New(addr string, opts ...Option) *Client {
+	c := &Client{
+		endpoints: []string{strings.TrimSuffix(addr, "/")},
+		http:      http.DefaultClient,
+		retries:   3,
+		backoff:   100 * time.Millisecond,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// Error is an error answered by the store.
+type Error struct {
+	Status  int
+	Code    string `json:"code"`
+	Message string `json:"error"`
+
+	// Leader is the HTTP address of the leader on not_leader errors, when
+	// one is known.
+	Leader string `json:"leader"`
+}
+
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("status %d: %s", e.Status, e.Message)
+	}
+
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// Event is a change of a key streamed by Watch.
+type Event struct {
+	// Action is set, delete or expire.
+	Action    string    `json:"action"`
+	Key       string    `json:"key"`
+	Value     string    `json:"value"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Get returns the value of key, empty when it holds none. With a cache, the
+// value may be served from it, see Cache.
+func (c *Client) Get(ctx context.Context, key string) (string, error) {
+	if c.cache != nil {
+		if value, ok := c.cache.get(key); ok {
+			return value, nil
+		}
+	}
+
+	b, err := c.do(ctx, http.MethodGet, keyPath(key), nil)
+	var apiErr *Error
+	if errors.As(err, &apiErr) && apiErr.Code == "not_found" {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if c.cache != nil {
+		c.cache.set(key, string(b))
+	}
+
+	return string(b), nil
+}
+
+// Set stores value at key.
+func (c *Client) Set(ctx context.Context, key, value string) error {
+	if _, err := c.do(ctx, http.MethodPost, keyPath(key), []byte(value)); err != nil {
+		return err
+	}
+
+	if c.cache != nil {
+		c.cache.Invalidate(key)
+	}
+
+	return nil
+}
+
+// Delete removes key.
+func (c *Client) Delete(ctx context.Context, key string) error {
+	if _, err := c.do(ctx, http.MethodDelete, keyPath(key), nil); err != nil {
+		return err
+	}
+
+	if c.cache != nil {
+		c.cache.Invalidate(key)
+	}
+
+	return nil
+}
+
+// Incr adds delta, which may be negative, to the integer at key, a missing
+// key counting from 0, and returns the new value. It posts to
+// /key-ops/incr/, nodes serving increments under /key/ aren't supported.
+func (c *Client) Incr(ctx context.Context, key string, delta int64) (int64, error) {
+	path := "/key-ops/incr/" + url.PathEscape(key) + "?delta=" + strconv.FormatInt(delta, 10)
+	b, err := c.do(ctx, http.MethodPost, path, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	if c.cache != nil {
+		c.cache.Invalidate(key)
+	}
+
+	var res struct {
+		Value int64 `json:"value"`
+	}
+	if err := json.Unmarshal(b, &res); err != nil {
+		return 0, fmt.Errorf("decoding the value: %w", err)
+	}
+
+	return res.Value, nil
+}
+
+// GrantLease grants a lease expiring after ttl unless it is kept alive, and
+// returns its ID.
+func (c *Client) GrantLease(ctx context.Context, ttl time.Duration) (uint64, error) {
+	body, err := json.Marshal(map[string]string{"ttl": ttl.String()})
+	if err != nil {
+		return 0, err
+	}
+	b, err := c.do(ctx, http.MethodPost, "/lease", body)
+	if err != nil {
+		return 0, err
+	}
+
+	var res struct {
+		ID uint64 `json:"id"`
+	}
+	if err := json.Unmarshal(b, &res); err != nil {
+		return 0, fmt.Errorf("decoding the lease: %w", err)
+	}
+
+	return res.ID, nil
+}
+
+// KeepAlive renews the lease id for its TTL, with the keys and locks
+// attached to it.
+func (c *Client) KeepAlive(ctx context.Context, id uint64) error {
+	_, err := c.do(ctx, http.MethodPost, "/lease/"+strconv.FormatUint(id, 10)+"/keepalive", nil)
+	return err
+}
+
+// RevokeLease revokes the lease id, deleting its keys and releasing its
+// locks.
+func (c *Client) RevokeLease(ctx context.Context, id uint64) error {
+	_, err := c.do(ctx, http.MethodDelete, "/lease/"+strconv.FormatUint(id, 10), nil)
+	return err
+}
+
+// Lock acquires the lock name for the lease id and returns the revision at
+// which the lease acquired it, to be used as a fencing token. It fails with
+// an *Error with the lock_held code when another lease holds the lock.
+func (c *Client) Lock(ctx context.Context, name string, id uint64) (uint64, error) {
+	b, err := c.do(ctx, http.MethodPost, lockPath(name, id), nil)
+	if err != nil {
+		return 0, err
+	}
+
+	var res struct {
+		Revision uint64 `json:"revision"`
+	}
+	if err := json.Unmarshal(b, &res); err != nil {
+		return 0, fmt.Errorf("decoding the lock: %w", err)
+	}
+
+	return res.Revision, nil
+}
+
+// Unlock releases the lock name held by the lease id.
+func (c *Client) Unlock(ctx context.Context, name string, id uint64) error {
+	_, err := c.do(ctx, http.MethodDelete, lockPath(name, id), nil)
+	return err
+}
+
+// List returns, in order, the keys starting with prefix. It reads them a
+// page at a time, so keys written while listing may or may not be listed.
+func (c *Client) List(ctx context.Context, prefix string) ([]string, error) {
+	keys := []string{}
+	cursor := ""
+	for {
+		q := url.Values{"prefix": {prefix}, "limit": {"1000"}}
+		if cursor != "" {
+			q.Set("cursor", cursor)
+		}
+		b, err := c.do(ctx, http.MethodGet, "/keys?"+q.Encode(), nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var page struct {
+			Keys []string `json:"keys"`
+			Next string   `json:"next"`
+		}
+		if err := json.Unmarshal(b, &page); err != nil {
+			return nil, fmt.Errorf("decoding the keys: %w", err)
+		}
+		keys = append(keys, page.Keys...)
+
+		if page.Next == "" {
+			return keys, nil
+		}
+		cursor = page.Next
+	}
+}
+
+// Watch streams the changes to key, or to the keys it prefixes with prefix
+// set, from the moment it returns. The channel is closed when ctx is done or
+// the node ends the stream, as it shuts down: watch again to carry on,
+// changes made in between are missed.
+func (c *Client) Watch(ctx context.Context, key string, prefix bool) (<-chan Event, error) {
+	path := "/watch/" + url.PathEscape(key)
+	if prefix {
+		path += "?prefix=true"
+	}
+	resp, err := c.send(ctx, http.MethodGet, c.target(), path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		defer resp.Body.Close()
+		return nil, readError(resp)
+	}
+
+	events := make(chan Event)
+	go func() {
+		defer close(events)
+		defer resp.Body.Close()
+
+		// Server-sent events, the data line of each holding the JSON event
+		var data []byte
+		r := bufio.NewScanner(resp.Body)
+		r.Buffer(nil, maxEventSize)
+		for r.Scan() {
+			line := r.Bytes()
+			switch {
+			case bytes.HasPrefix(line, []byte("data:")):
+				data = append(data[:0], bytes.TrimSpace(line[len("data:"):])...)
+			case len(line) == 0 && data != nil:
+				var ev Event
+				if json.Unmarshal(data, &ev) == nil {
+					select {
+					case events <- ev:
+					case <-ctx.Done():
+						return
+					}
+				}
+				data = nil
+			}
+		}
+	}()
+
+	return events, nil
+}
+
+// Cache returns the cache of the client, nil when it has none.
+func (c *Client) Cache() *Cache {
+	return c.cache
+}
+
+// Leader returns the HTTP address of the leader the client sends its
+// requests to, empty until a node names it.
+func (c *Client) Leader() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.leader
+}
+
+// do sends a request for path, resending it to the leader named by a
+// follower, to the next endpoint when a node can't be reached, and after a
+// backoff while no leader is known. Error statuses are turned into an Error.
+// It returns the body of the answer.
+func (c *Client) do(ctx context.Context, method, path string, body []byte) ([]byte, error) {
+	backoff := c.backoff
+	for attempt := 0; ; attempt++ {
+		target := c.target()
+		b, err := c.attempt(ctx, method, target, path, body)
+
+		var apiErr *Error
+		switch {
+		case err == nil:
+			return b, nil
+		case attempt >= c.retries || ctx.Err() != nil:
+			return nil, err
+		case errors.As(err, &apiErr) && apiErr.Code == "not_leader" && apiErr.Leader != "":
+			c.setLeader(apiErr.Leader)
+			continue
+		case errors.As(err, &apiErr) && apiErr.Code == "not_leader":
+			// A leader is being elected
+		case errors.As(err, &apiErr):
+			return nil, err
+		default:
+			c.unreachable(target)
+		}
+
+		select {
+		case <-time.After(backoff):
+			backoff *= 2
+		case <-ctx.Done():
+			return nil, err
+		}
+	}
+}
+
+// attempt sends a request to the node at target, within the timeout of the
+// client, and reads the answer.
+func (c *Client) attempt(ctx context.Context, method, target, path string, body []byte) ([]byte, error) {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	resp, err := c.send(ctx, method, target, path, body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, readError(resp)
+	}
+	if leader := resp.Header.Get(leaderHeader); leader != "" {
+		c.setLeader(leader)
+	}
+
+	return ioutil.ReadAll(resp.Body)
+}
+
+// send sends a request to the node at target.
+func (c *Client) send(ctx context.Context, method, target, path string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	return c.http.Do(req)
+}
+
+// target returns the address of the node to send a request to: the leader
+// when it is known, an endpoint otherwise.
+func (c *Client) target() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.leader != "" {
+		return c.leader
+	}
+
+	return c.endpoints[c.next]
+}
+
+func (c *Client) setLeader(leader string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.leader = strings.TrimSuffix(leader, "/")
+}
+
+// unreachable records the node at target couldn't be reached: the leader is
+// forgotten, or the next endpoint is tried.
+func (c *Client) unreachable(target string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.leader == target {
+		c.leader = ""
+		return
+	}
+	if c.endpoints[c.next] == target {
+		c.next = (c.next + 1) % len(c.endpoints)
+	}
+}
+
+// readError reads the Error of an answer with an error status.
+func readError(resp *http.Response) error {
+	apiErr := &Error{Status: resp.StatusCode}
+	b, _ := ioutil.ReadAll(resp.Body)
+	if json.Unmarshal(b, apiErr) != nil {
+		apiErr.Message = strings.TrimSpace(string(b))
+	}
+
+	return apiErr
+}
+
+func keyPath(key string) string {
+	return "/key/" + url.PathEscape(key)
+}
+
+// lockPath returns the path of the lock name held by the lease id.
+func lockPath(name string, id uint64) string {
+	return "/lock/" + url.PathEscape(name) + "?lease=" + strconv.FormatUint(id, 10)
+}
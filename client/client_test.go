@@ -0,0 +1,241 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeNode serves the /key endpoints from a map, counting the reads.
+func fakeNode(t *testing.T) (*httptest.Server, *int64) {
+	var mu sync.Mutex
+	var reads int64
+	data := map[string]string{}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		key := r.URL.Path[len("/key/"):]
+		switch r.Method {
+		case http.MethodGet:
+			atomic.AddInt64(&reads, 1)
+			value, ok := data[key]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(`{"code": "not_found", "error": "key not found"}`))
+				return
+			}
+			w.Write([]byte(value))
+		case http.MethodPost:
+			b, _ := ioutil.ReadAll(r.Body)
+			if len(b) == 0 {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"code": "empty_value", "error": "the value is empty"}`))
+				return
+			}
+			data[key] = string(b)
+		case http.MethodDelete:
+			delete(data, key)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, &reads
+}
+
+func TestClientCache(t *testing.T) {
+	ctx := context.Background()
+	srv, reads := fakeNode(t)
+	c := New(srv.URL, WithCache(10, time.Minute))
+
+	if err := c.Set(ctx, "a/b", "v1"); err != nil {
+		t.Fatalf("Set returned unexpected error: %s", err)
+	}
+	for i := 0; i < 3; i++ {
+		if v, err := c.Get(ctx, "a/b"); err != nil || v != "v1" {
+			t.Fatalf("Get = %q, %v, want v1", v, err)
+		}
+	}
+	if got := atomic.LoadInt64(reads); got != 1 {
+		t.Errorf("the store got %d reads, expected 1", got)
+	}
+
+	// Writes of the client invalidate the cached value
+	c.Set(ctx, "a/b", "v2")
+	if v, _ := c.Get(ctx, "a/b"); v != "v2" {
+		t.Errorf("Get after Set = %q, want v2", v)
+	}
+	c.Delete(ctx, "a/b")
+	if v, _ := c.Get(ctx, "a/b"); v != "" {
+		t.Errorf("Get after Delete = %q, want an empty value", v)
+	}
+
+	if stats := c.Cache().Stats(); stats.Hits != 2 || stats.Misses != 3 {
+		t.Errorf("Got stats %+v, expected 2 hits and 3 misses", stats)
+	}
+}
+
+func TestClientError(t *testing.T) {
+	srv, _ := fakeNode(t)
+
+	err := New(srv.URL).Set(context.Background(), "k", "")
+
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusBadRequest || apiErr.Code != "empty_value" {
+		t.Errorf("Got error %#v, expected an empty_value error", err)
+	}
+}
+
+func TestClientToken(t *testing.T) {
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("Authorization")
+	}))
+	t.Cleanup(srv.Close)
+
+	if _, err := New(srv.URL, WithToken("secret")).Get(context.Background(), "k"); err != nil {
+		t.Fatalf("Get returned unexpected error: %s", err)
+	}
+	if got != "Bearer secret" {
+		t.Errorf("Sent Authorization %q, want Bearer secret", got)
+	}
+}
+
+func TestClientIncr(t *testing.T) {
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Method + " " + r.URL.RequestURI()
+		w.Write([]byte(`{"status": "success", "value": 5}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	n, err := New(srv.URL).Incr(context.Background(), "app/hits", 5)
+	if err != nil || n != 5 {
+		t.Fatalf("Incr returned %d, %v, want 5", n, err)
+	}
+	if want := "POST /key-ops/incr/app%2Fhits?delta=5"; got != want {
+		t.Errorf("Sent %s, want %s", got, want)
+	}
+}
+
+func TestClientNotLeader(t *testing.T) {
+	leader, _ := fakeNode(t)
+	var misdirected int64
+	follower := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&misdirected, 1)
+		w.Header().Set(leaderHeader, leader.URL)
+		w.WriteHeader(http.StatusMisdirectedRequest)
+		fmt.Fprintf(w, `{"code": "not_leader", "error": "not leader", "leader": %q}`, leader.URL)
+	}))
+	t.Cleanup(follower.Close)
+
+	// The first endpoint doesn't answer at all
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	ctx := context.Background()
+	c := New(down.URL, WithEndpoints(follower.URL), WithRetries(3, time.Millisecond))
+	for i := 0; i < 2; i++ {
+		if err := c.Set(ctx, "k", "v"); err != nil {
+			t.Fatalf("Set returned unexpected error: %s", err)
+		}
+	}
+	if got := atomic.LoadInt64(&misdirected); got != 1 {
+		t.Errorf("the follower got %d requests, expected 1", got)
+	}
+	if c.Leader() != leader.URL {
+		t.Errorf("Leader() = %q, want %q", c.Leader(), leader.URL)
+	}
+	if v, err := c.Get(ctx, "k"); err != nil || v != "v" {
+		t.Errorf("Get = %q, %v, want v", v, err)
+	}
+}
+
+func TestClientElection(t *testing.T) {
+	var attempts int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&attempts, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"code": "not_leader", "error": "not leader"}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	err := New(srv.URL, WithRetries(2, time.Millisecond)).Set(context.Background(), "k", "v")
+
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.Code != "not_leader" {
+		t.Errorf("Got error %v, expected not_leader", err)
+	}
+	if got := atomic.LoadInt64(&attempts); got != 3 {
+		t.Errorf("Sent %d attempts, expected 3", got)
+	}
+}
+
+func TestClientTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	t.Cleanup(srv.Close)
+
+	_, err := New(srv.URL, WithTimeout(10*time.Millisecond), WithRetries(0, 0)).Get(context.Background(), "k")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Got error %v, expected the deadline exceeded", err)
+	}
+}
+
+func TestClientList(t *testing.T) {
+	pages := map[string]string{
+		"":      `{"keys": ["app/a", "app/b"], "next": "app/b"}`,
+		"app/b": `{"keys": ["app/c"]}`,
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/keys" || r.URL.Query().Get("prefix") != "app/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(pages[r.URL.Query().Get("cursor")]))
+	}))
+	t.Cleanup(srv.Close)
+
+	keys, err := New(srv.URL).List(context.Background(), "app/")
+	if err != nil {
+		t.Fatalf("List returned unexpected error: %s", err)
+	}
+	if len(keys) != 3 || keys[0] != "app/a" || keys[2] != "app/c" {
+		t.Errorf("List = %v, want app/a, app/b and app/c", keys)
+	}
+}
+
+func TestClientWatch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/watch/app/" || r.URL.Query().Get("prefix") != "true" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, ": keep-alive\n\n")
+		fmt.Fprint(w, "event: set\ndata: {\"action\": \"set\", \"key\": \"app/a\", \"value\": \"1\"}\n\n")
+		fmt.Fprint(w, "event: delete\ndata: {\"action\": \"delete\", \"key\": \"app/b\"}\n\n")
+	}))
+	t.Cleanup(srv.Close)
+
+	events, err := New(srv.URL).Watch(context.Background(), "app/", true)
+	if err != nil {
+		t.Fatalf("Watch returned unexpected error: %s", err)
+	}
+	var got []Event
+	for ev := range events {
+		got = append(got, ev)
+	}
+	if len(got) != 2 || got[0].Key != "app/a" || got[0].Value != "1" || got[1].Action != "delete" {
+		t.Errorf("Watch streamed %+v, expected the set of app/a and the delete of app/b", got)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultConfigFiles are the configuration files read from the working
+// directory when CONFIG_FILE isn't set, the first one found.
+var defaultConfigFiles = []string{"kv.yaml", "kv.yml", "kv.toml"}
+
+// settings are the environment variables a configuration file can set.
+var settings = map[string]bool{
+	"ADVERTISE_HTTP_ADDR": true, "ADVERTISE_RAFT_ADDR": true,
+	"AUDIT_LOG": true, "AUDIT_LOG_MAX_SIZE": true,
+	"AUTH_ADMIN_TOKEN": true, "AUTH_HMAC_SECRET": true, "AUTH_TOKENS": true,
+	"CLUSTER_CA_FILE": true, "COMPACTION_INTERVAL": true, "DATA_FILE": true,
+	"DISCOVERY_DNS": true, "DISCOVERY_EXPECT": true, "DISCOVERY_SRV": true,
+	"ENCRYPTION_KEYS": true, "ENCRYPTION_KEYS_FILE": true,
+	"FOLLOWER_MODE": true, "FOLLOWER_READS": true, "GRPC_PORT": true, "GZIP_MIN_SIZE": true,
+	"HISTORY_VERSIONS": true, "HOT_KEYS": true,
+	"HTTP_DIAL_TIMEOUT": true, "HTTP_RESPONSE_TIMEOUT": true, "JOIN_TIMEOUT": true,
+	"KEY_ALLOCATOR": true, "KEY_SEPARATOR": true, "LEAVE_ON_SHUTDOWN": true,
+	"LOG_FORMAT": true, "LOG_LEVEL": true, "LOG_STORE_PATH": true,
+	"MAX_INFLIGHT_APPLIES": true, "MAX_KEYS_PER_NAMESPACE": true, "MAX_NAMESPACES": true,
+	"MISSING_KEY_STATUS": true, "NAMESPACE_QUOTAS": true, "NODE_ID": true, "NON_VOTER": true,
+	"OTEL_EXPORTER_OTLP_ENDPOINT": true, "OTEL_EXPORTER_OTLP_PROTOCOL": true,
+	"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT": true, "OTEL_EXPORTER_OTLP_TRACES_PROTOCOL": true,
+	"OTEL_SERVICE_NAME": true, "OTEL_RESOURCE_ATTRIBUTES": true,
+	"PERSISTENCE": true, "PERSIST_INTERVAL": true, "PORT": true,
+	"RAFT_ADDRESS": true, "RAFT_BIND_ADDRESS": true, "RAFT_LEADER": true, "RAFT_PORT": true,
+	"RAFT_PRE_VOTE": true, "RAFT_TRANSPORT_MAX_POOL": true, "RAFT_TRANSPORT_TIMEOUT": true,
+	"RAFT_HEARTBEAT_TIMEOUT": true, "RAFT_ELECTION_TIMEOUT": true,
+	"RAFT_LEADER_LEASE_TIMEOUT": true, "RAFT_COMMIT_TIMEOUT": true,
+	"READS_WAIT_READY": true, "READ_REPLICA": true, "REJECT_EMPTY_VALUES": true,
+	"RESERVED_PREFIX": true, "RESP_PORT": true, "SEEDS": true, "SHUTDOWN_TIMEOUT": true,
+	"SNAPSHOT_INTERVAL": true, "SNAPSHOT_PATH": true, "SNAPSHOT_THRESHOLD": true,
+	"STABLE_STORE_PATH": true, "STANDALONE": true, "STORAGE_BACKEND": true,
+	"STORAGE_FORMAT": true, "STORAGE_PATH": true,
+	"TLS_CERT_FILE": true, "TLS_KEY_FILE": true, "WEBHOOK_URL": true, "WRITE_POLICIES": true,
+}
+
+// loadConfigFile sets the environment variables the configuration file at
+// path sets, unless they are set already: the environment overrides the
+// file. Without a path, the first of defaultConfigFiles found is read, if
+// any. It returns the path of the file read.
+func loadConfigFile(path string) (string, error) {
+	if path == "" {
+		for _, name := range defaultConfigFiles {
+			if _, err := os.Stat(name); err == nil {
+				path = name
+				break
+			}
+		}
+		if path == "" {
+			return "", nil
+		}
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	values, err := parseConfig(filepath.Ext(path), b)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", path, err)
+	}
+
+	for name, value := range values {
+		if _, ok := os.LookupEnv(name); !ok {
+			os.Setenv(name, value)
+		}
+	}
+
+	return path, nil
+}
+
+// parseConfig parses a YAML, or TOML with the .toml ext, configuration. Its
+// keys name the settings in lower case, nested keys joining their parents
+// with an underscore, so
+//
+//	raft:
+//	  port: 8081
+//
+// sets RAFT_PORT. Lists are joined with commas.
+func parseConfig(ext string, b []byte) (map[string]string, error) {
+	var doc map[string]interface{}
+	switch ext {
+	case ".toml":
+		if err := toml.Unmarshal(b, &doc); err != nil {
+			return nil, err
+		}
+	case ".yaml", ".yml", "":
+		if err := yaml.Unmarshal(b, &doc); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown configuration format %q, expected .yaml, .yml or .toml", ext)
+	}
+
+	values := map[string]string{}
+	if err := flattenConfig("", doc, values); err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+func flattenConfig(prefix string, doc map[string]interface{}, values map[string]string) error {
+	keys := make([]string, 0, len(doc))
+	for key := range doc {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		name := strings.ToUpper(strings.ReplaceAll(key, "-", "_"))
+		if prefix != "" {
+			name = prefix + "_" + name
+		}
+
+		switch v := doc[key].(type) {
+		case map[string]interface{}:
+			if err := flattenConfig(name, v, values); err != nil {
+				return err
+			}
+			continue
+		case []interface{}:
+			items := make([]string, len(v))
+			for i, item := range v {
+				items[i] = fmt.Sprint(item)
+			}
+			values[name] = strings.Join(items, ",")
+		case nil:
+			values[name] = ""
+		default:
+			values[name] = fmt.Sprint(v)
+		}
+
+		if !settings[name] {
+			return fmt.Errorf("unknown setting %s", name)
+		}
+	}
+
+	return nil
+}
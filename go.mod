@@ -3,13 +3,23 @@ module github.com/maelfosso/key-value-store
 go 1.16
 
 require (
+	github.com/BurntSushi/toml v1.3.2
 	github.com/go-chi/chi/v5 v5.0.2
-	github.com/gofrs/flock v0.8.0 // indirect
-	github.com/google/uuid v1.2.0 // indirect
-	github.com/hashicorp/go-hclog v0.16.0 // indirect
-	github.com/hashicorp/raft v1.2.0 // indirect
-	github.com/hashicorp/raft-boltdb v0.0.0-20210409134258-03c10cc3d4ea // indirect
-	github.com/konsorten/go-windows-terminal-sequences v1.0.3 // indirect
-	github.com/sirupsen/logrus v1.8.1 // indirect
-	golang.org/x/sys v0.0.0-20210415045647-66c3f260301c // indirect
+	github.com/gofrs/flock v0.8.0
+	github.com/google/uuid v1.3.0
+	github.com/hashicorp/go-hclog v1.6.2
+	github.com/hashicorp/raft v1.7.1
+	github.com/hashicorp/raft-boltdb/v2 v2.3.0
+	go.etcd.io/bbolt v1.3.5
+	go.etcd.io/etcd/api/v3 v3.5.9
+	go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp v0.42.0
+	go.opentelemetry.io/otel v1.16.0
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace v1.16.0
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc v1.16.0
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp v1.16.0
+	go.opentelemetry.io/otel/sdk v1.16.0
+	go.opentelemetry.io/otel/trace v1.16.0
+	google.golang.org/grpc v1.56.3
+	google.golang.org/protobuf v1.31.0
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -0,0 +1,5 @@
+// Package kvpb holds the gRPC API of the key/value store, generated from
+// kv.proto.
+package kvpb
+
+//go:generate protoc -I .. --go_out=.. --go_opt=paths=source_relative --go-grpc_out=.. --go-grpc_opt=paths=source_relative kvpb/kv.proto
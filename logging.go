@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+// newLogger builds the logger of the server from the LOG_LEVEL and
+// LOG_FORMAT settings, empty values defaulting to info and text.
+func newLogger(level, format string) (hclog.Logger, error) {
+	opts := &hclog.LoggerOptions{Name: "kv", Level: hclog.Info, Output: os.Stderr}
+
+	if level != "" {
+		opts.Level = hclog.LevelFromString(level)
+		if opts.Level == hclog.NoLevel {
+			return nil, fmt.Errorf("unknown log level %q", level)
+		}
+	}
+
+	switch format {
+	case "", "text":
+	case "json":
+		opts.JSONFormat = true
+	default:
+		return nil, fmt.Errorf("unknown log format %q, expected text or json", format)
+	}
+
+	return hclog.New(opts), nil
+}
@@ -0,0 +1,662 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/maelfosso/key-value-store/server"
+	"github.com/maelfosso/key-value-store/store"
+)
+
+// defaultShutdownTimeout is how long the requests in flight have to complete
+// on SIGTERM or SIGINT when SHUTDOWN_TIMEOUT isn't set.
+const defaultShutdownTimeout = 30 * time.Second
+
+func main() {
+	log := hclog.Default()
+	configFile, err := loadConfigFile(os.Getenv("CONFIG_FILE"))
+	if err != nil {
+		log.Error("invalid CONFIG_FILE", "error", err)
+		os.Exit(1)
+	}
+
+	logger, err := newLogger(os.Getenv("LOG_LEVEL"), os.Getenv("LOG_FORMAT"))
+	if err != nil {
+		log.Error("invalid logging settings", "error", err)
+		os.Exit(1)
+	}
+	log = logger
+	if configFile != "" {
+		log.Info("read configuration file", "path", configFile)
+	}
+
+	shutdownTracing, err := setupTracing(context.Background())
+	if err != nil {
+		log.Error("invalid tracing settings", "error", err)
+		os.Exit(1)
+	}
+	if shutdownTracing != nil {
+		defer shutdownTracing(context.Background())
+	}
+
+	shutdownTimeout := defaultShutdownTimeout
+	if fromEnv := os.Getenv("SHUTDOWN_TIMEOUT"); fromEnv != "" {
+		shutdownTimeout, err = time.ParseDuration(fromEnv)
+		if err != nil {
+			log.Error("invalid SHUTDOWN_TIMEOUT", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	serverOpts := []server.Option{server.WithLogger(log)}
+	if fromEnv := os.Getenv("PORT"); fromEnv != "" {
+		serverOpts = append(serverOpts, server.WithListenAddr(":"+fromEnv))
+	}
+
+	if fromEnv := os.Getenv("ADVERTISE_HTTP_ADDR"); fromEnv != "" {
+		serverOpts = append(serverOpts, server.WithAdvertiseAddr(fromEnv))
+	}
+
+	if fromEnv := os.Getenv("GRPC_PORT"); fromEnv != "" {
+		serverOpts = append(serverOpts, server.WithGRPCAddr(":"+fromEnv))
+	}
+
+	// The RESP listener is off unless a port is given
+	if fromEnv := os.Getenv("RESP_PORT"); fromEnv != "" {
+		serverOpts = append(serverOpts, server.WithRESPAddr(":"+fromEnv))
+	}
+
+	if fromEnv := os.Getenv("STORAGE_PATH"); fromEnv != "" {
+		serverOpts = append(serverOpts, server.WithStoragePath(fromEnv))
+	}
+
+	raftHost, raftPort := server.DefaultRaftHost, server.DefaultRaftPort
+	if fromEnv := os.Getenv("RAFT_ADDRESS"); fromEnv != "" {
+		raftHost = fromEnv
+	}
+	if fromEnv := os.Getenv("RAFT_PORT"); fromEnv != "" {
+		raftPort = fromEnv
+	}
+	serverOpts = append(serverOpts, server.WithRaftAddress(raftHost, raftPort))
+
+	if fromEnv := os.Getenv("RAFT_LEADER"); fromEnv != "" {
+		serverOpts = append(serverOpts, server.WithRaftLeader(fromEnv))
+	}
+
+	var opts []store.Option
+	if fromEnv := os.Getenv("WEBHOOK_URL"); fromEnv != "" {
+		opts = append(opts, store.WithWebhook(fromEnv))
+	}
+
+	if fromEnv := os.Getenv("AUDIT_LOG"); fromEnv != "" {
+		var maxSize int64
+		if size := os.Getenv("AUDIT_LOG_MAX_SIZE"); size != "" {
+			maxSize, err = strconv.ParseInt(size, 10, 64)
+			if err != nil {
+				log.Error("invalid AUDIT_LOG_MAX_SIZE", "error", err)
+				os.Exit(1)
+			}
+		}
+
+		if fromEnv == "log" {
+			opts = append(opts, store.WithAuditLogger(log.Named("audit")))
+		} else {
+			opts = append(opts, store.WithAuditFile(fromEnv, maxSize))
+		}
+	}
+
+	if fromEnv := os.Getenv("STORAGE_FORMAT"); fromEnv != "" {
+		format, err := store.ParseFormat(fromEnv)
+		if err != nil {
+			log.Error("invalid STORAGE_FORMAT", "error", err)
+			os.Exit(1)
+		}
+		opts = append(opts, store.WithStorageFormat(format))
+	}
+
+	if fromEnv := os.Getenv("STORAGE_BACKEND"); fromEnv != "" {
+		backend, err := store.ParseBackend(fromEnv)
+		if err != nil {
+			log.Error("invalid STORAGE_BACKEND", "error", err)
+			os.Exit(1)
+		}
+		opts = append(opts, store.WithBackend(backend))
+	}
+
+	encryptionKeys := os.Getenv("ENCRYPTION_KEYS")
+	if fromEnv := os.Getenv("ENCRYPTION_KEYS_FILE"); fromEnv != "" {
+		b, err := os.ReadFile(fromEnv)
+		if err != nil {
+			log.Error("invalid ENCRYPTION_KEYS_FILE", "error", err)
+			os.Exit(1)
+		}
+		encryptionKeys = string(b)
+	}
+	if encryptionKeys != "" {
+		keys, err := store.ParseEncryptionKeys(encryptionKeys)
+		if err == nil {
+			var keyring *store.Keyring
+			if keyring, err = store.NewKeyring(keys); err == nil {
+				opts = append(opts, store.WithEncryption(keyring))
+			}
+		}
+		if err != nil {
+			log.Error("invalid ENCRYPTION_KEYS", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	if os.Getenv("PERSISTENCE") != "" || os.Getenv("PERSIST_INTERVAL") != "" {
+		persistence := store.PersistPeriodic
+		if fromEnv := os.Getenv("PERSISTENCE"); fromEnv != "" {
+			if persistence, err = store.ParsePersistence(fromEnv); err != nil {
+				log.Error("invalid PERSISTENCE", "error", err)
+				os.Exit(1)
+			}
+		}
+
+		var interval time.Duration
+		if fromEnv := os.Getenv("PERSIST_INTERVAL"); fromEnv != "" {
+			if interval, err = time.ParseDuration(fromEnv); err != nil {
+				log.Error("invalid PERSIST_INTERVAL", "error", err)
+				os.Exit(1)
+			}
+		}
+		opts = append(opts, store.WithPersistence(persistence, interval))
+	}
+
+	if fromEnv := os.Getenv("COMPACTION_INTERVAL"); fromEnv != "" {
+		interval, err := time.ParseDuration(fromEnv)
+		if err != nil {
+			log.Error("invalid COMPACTION_INTERVAL", "error", err)
+			os.Exit(1)
+		}
+		opts = append(opts, store.WithCompactionInterval(interval))
+	}
+
+	if fromEnv := os.Getenv("STABLE_STORE_PATH"); fromEnv != "" {
+		opts = append(opts, store.WithStableStorePath(fromEnv))
+	}
+
+	if fromEnv := os.Getenv("LOG_STORE_PATH"); fromEnv != "" {
+		opts = append(opts, store.WithLogStorePath(fromEnv))
+	}
+
+	if fromEnv := os.Getenv("SNAPSHOT_PATH"); fromEnv != "" {
+		opts = append(opts, store.WithSnapshotPath(fromEnv))
+	}
+
+	if fromEnv := os.Getenv("DATA_FILE"); fromEnv != "" {
+		opts = append(opts, store.WithDataFile(fromEnv))
+	}
+
+	timeouts := []struct {
+		env    string
+		option func(time.Duration) store.Option
+	}{
+		{"RAFT_HEARTBEAT_TIMEOUT", store.WithHeartbeatTimeout},
+		{"RAFT_ELECTION_TIMEOUT", store.WithElectionTimeout},
+		{"RAFT_LEADER_LEASE_TIMEOUT", store.WithLeaderLeaseTimeout},
+		{"RAFT_COMMIT_TIMEOUT", store.WithCommitTimeout},
+	}
+	for _, timeout := range timeouts {
+		if fromEnv := os.Getenv(timeout.env); fromEnv != "" {
+			d, err := time.ParseDuration(fromEnv)
+			if err != nil {
+				log.Error("invalid "+timeout.env, "error", err)
+				os.Exit(1)
+			}
+			opts = append(opts, timeout.option(d))
+		}
+	}
+
+	if fromEnv := os.Getenv("SNAPSHOT_INTERVAL"); fromEnv != "" {
+		d, err := time.ParseDuration(fromEnv)
+		if err != nil {
+			log.Error("invalid SNAPSHOT_INTERVAL", "error", err)
+			os.Exit(1)
+		}
+		opts = append(opts, store.WithSnapshotInterval(d))
+	}
+
+	if fromEnv := os.Getenv("SNAPSHOT_THRESHOLD"); fromEnv != "" {
+		n, err := strconv.ParseUint(fromEnv, 10, 64)
+		if err != nil {
+			log.Error("invalid SNAPSHOT_THRESHOLD", "error", err)
+			os.Exit(1)
+		}
+		opts = append(opts, store.WithSnapshotThreshold(n))
+	}
+
+	if fromEnv := os.Getenv("RAFT_PRE_VOTE"); fromEnv != "" {
+		enabled, err := strconv.ParseBool(fromEnv)
+		if err != nil {
+			log.Error("invalid RAFT_PRE_VOTE", "error", err)
+			os.Exit(1)
+		}
+		opts = append(opts, store.WithPreVote(enabled))
+	}
+
+	if fromEnv := os.Getenv("WRITE_POLICIES"); fromEnv != "" {
+		policies, err := store.ParseWritePolicies(fromEnv)
+		if err != nil {
+			log.Error("invalid WRITE_POLICIES", "error", err)
+			os.Exit(1)
+		}
+		opts = append(opts, store.WithWritePolicies(policies))
+	}
+
+	if fromEnv := os.Getenv("KEY_SEPARATOR"); fromEnv != "" {
+		opts = append(opts, store.WithKeySeparator(fromEnv))
+	}
+
+	if fromEnv := os.Getenv("RESERVED_PREFIX"); fromEnv != "" {
+		opts = append(opts, store.WithReservedPrefix(fromEnv))
+	}
+
+	if fromEnv := os.Getenv("RAFT_BIND_ADDRESS"); fromEnv != "" {
+		opts = append(opts, store.WithRaftBindAddress(fromEnv))
+	}
+
+	if fromEnv := os.Getenv("ADVERTISE_RAFT_ADDR"); fromEnv != "" {
+		if _, _, err := net.SplitHostPort(fromEnv); err != nil {
+			log.Error("invalid ADVERTISE_RAFT_ADDR", "error", err)
+			os.Exit(1)
+		}
+		opts = append(opts, store.WithRaftAdvertiseAddress(fromEnv))
+	}
+
+	discoverer, err := newDiscoverer(os.Getenv("SEEDS"), os.Getenv("DISCOVERY_DNS"), os.Getenv("DISCOVERY_SRV"))
+	if err != nil {
+		log.Error("invalid discovery settings", "error", err)
+		os.Exit(1)
+	}
+	if discoverer != nil {
+		expect := 1
+		if fromEnv := os.Getenv("DISCOVERY_EXPECT"); fromEnv != "" {
+			if expect, err = strconv.Atoi(fromEnv); err != nil || expect < 1 {
+				log.Error("invalid DISCOVERY_EXPECT", "value", fromEnv)
+				os.Exit(1)
+			}
+		}
+		opts = append(opts, store.WithDiscovery(discoverer, expect))
+	}
+
+	if fromEnv := os.Getenv("RAFT_TRANSPORT_MAX_POOL"); fromEnv != "" {
+		n, err := strconv.Atoi(fromEnv)
+		if err != nil {
+			log.Error("invalid RAFT_TRANSPORT_MAX_POOL", "error", err)
+			os.Exit(1)
+		}
+		opts = append(opts, store.WithTransportMaxPool(n))
+	}
+
+	if fromEnv := os.Getenv("RAFT_TRANSPORT_TIMEOUT"); fromEnv != "" {
+		d, err := time.ParseDuration(fromEnv)
+		if err != nil {
+			log.Error("invalid RAFT_TRANSPORT_TIMEOUT", "error", err)
+			os.Exit(1)
+		}
+		opts = append(opts, store.WithTransportTimeout(d))
+	}
+
+	var clusterCAs *x509.CertPool
+	if fromEnv := os.Getenv("CLUSTER_CA_FILE"); fromEnv != "" {
+		clusterCAs, err = loadCertPool(fromEnv)
+		if err != nil {
+			log.Error("invalid CLUSTER_CA_FILE", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	certFile, keyFile := os.Getenv("TLS_CERT_FILE"), os.Getenv("TLS_KEY_FILE")
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			log.Error("invalid TLS_CERT_FILE or TLS_KEY_FILE", "error", err)
+			os.Exit(1)
+		}
+		serverOpts = append(serverOpts, server.WithTLS(cert))
+
+		// The peers authenticate each other with the certificates of
+		// their API
+		opts = append(opts, store.WithHTTPS(), store.WithRaftTLS(&tls.Config{
+			Certificates: []tls.Certificate{cert},
+			RootCAs:      clusterCAs,
+			ClientCAs:    clusterCAs,
+		}))
+	}
+
+	if fromEnv := os.Getenv("AUTH_ADMIN_TOKEN"); fromEnv != "" {
+		opts = append(opts, store.WithAdminToken(fromEnv))
+	}
+
+	if fromEnv := os.Getenv("AUTH_TOKENS"); fromEnv != "" {
+		tokens, err := store.ParseTokens(fromEnv)
+		if err != nil {
+			log.Error("invalid AUTH_TOKENS", "error", err)
+			os.Exit(1)
+		}
+		opts = append(opts, store.WithStaticTokens(tokens))
+	}
+
+	if fromEnv := os.Getenv("AUTH_HMAC_SECRET"); fromEnv != "" {
+		opts = append(opts, store.WithHMACSecret([]byte(fromEnv)))
+	}
+
+	if os.Getenv("HTTP_DIAL_TIMEOUT") != "" || os.Getenv("HTTP_RESPONSE_TIMEOUT") != "" || clusterCAs != nil {
+		dial, response := store.DefaultDialTimeout, store.DefaultResponseTimeout
+		for _, timeout := range []struct {
+			env string
+			d   *time.Duration
+		}{
+			{"HTTP_DIAL_TIMEOUT", &dial},
+			{"HTTP_RESPONSE_TIMEOUT", &response},
+		} {
+			fromEnv := os.Getenv(timeout.env)
+			if fromEnv == "" {
+				continue
+			}
+			if *timeout.d, err = time.ParseDuration(fromEnv); err != nil {
+				log.Error("invalid "+timeout.env, "error", err)
+				os.Exit(1)
+			}
+		}
+
+		var tlsConfig *tls.Config
+		if clusterCAs != nil {
+			tlsConfig = &tls.Config{RootCAs: clusterCAs}
+		}
+		opts = append(opts, store.WithHTTPClient(store.NewHTTPClient(dial, response, tlsConfig)))
+	}
+
+	if fromEnv := os.Getenv("MAX_INFLIGHT_APPLIES"); fromEnv != "" {
+		n, err := strconv.Atoi(fromEnv)
+		if err != nil {
+			log.Error("invalid MAX_INFLIGHT_APPLIES", "error", err)
+			os.Exit(1)
+		}
+		opts = append(opts, store.WithMaxInflightApplies(n))
+	}
+
+	if fromEnv := os.Getenv("HISTORY_VERSIONS"); fromEnv != "" {
+		n, err := strconv.Atoi(fromEnv)
+		if err != nil {
+			log.Error("invalid HISTORY_VERSIONS", "error", err)
+			os.Exit(1)
+		}
+		opts = append(opts, store.WithHistory(n))
+	}
+
+	if fromEnv := os.Getenv("READ_REPLICA"); fromEnv != "" {
+		replica, err := strconv.ParseBool(fromEnv)
+		if err != nil {
+			log.Error("invalid READ_REPLICA", "error", err)
+			os.Exit(1)
+		}
+		if replica {
+			opts = append(opts, store.WithReadReplica())
+		}
+	}
+
+	if fromEnv := os.Getenv("NON_VOTER"); fromEnv != "" {
+		nonVoter, err := strconv.ParseBool(fromEnv)
+		if err != nil {
+			log.Error("invalid NON_VOTER", "error", err)
+			os.Exit(1)
+		}
+		if nonVoter {
+			opts = append(opts, store.WithNonVoter())
+		}
+	}
+
+	if fromEnv := os.Getenv("READS_WAIT_READY"); fromEnv != "" {
+		wait, err := strconv.ParseBool(fromEnv)
+		if err != nil {
+			log.Error("invalid READS_WAIT_READY", "error", err)
+			os.Exit(1)
+		}
+		if wait {
+			opts = append(opts, store.WithReadsWaitReady())
+		}
+	}
+
+	if fromEnv := os.Getenv("NODE_ID"); fromEnv != "" {
+		opts = append(opts, store.WithNodeID(fromEnv))
+	}
+
+	if fromEnv := os.Getenv("JOIN_TIMEOUT"); fromEnv != "" {
+		d, err := time.ParseDuration(fromEnv)
+		if err != nil {
+			log.Error("invalid JOIN_TIMEOUT", "error", err)
+			os.Exit(1)
+		}
+		opts = append(opts, store.WithJoinTimeout(d))
+	}
+
+	if fromEnv := os.Getenv("LEAVE_ON_SHUTDOWN"); fromEnv != "" {
+		leave, err := strconv.ParseBool(fromEnv)
+		if err != nil {
+			log.Error("invalid LEAVE_ON_SHUTDOWN", "error", err)
+			os.Exit(1)
+		}
+		if leave {
+			opts = append(opts, store.WithLeaveOnShutdown())
+		}
+	}
+
+	if fromEnv := os.Getenv("FOLLOWER_MODE"); fromEnv != "" {
+		mode, err := store.ParseFollowerMode(fromEnv)
+		if err != nil {
+			log.Error("invalid FOLLOWER_MODE", "error", err)
+			os.Exit(1)
+		}
+		opts = append(opts, store.WithFollowerMode(mode))
+	}
+
+	if fromEnv := os.Getenv("FOLLOWER_READS"); fromEnv != "" {
+		followerReads, err := strconv.ParseBool(fromEnv)
+		if err != nil {
+			log.Error("invalid FOLLOWER_READS", "error", err)
+			os.Exit(1)
+		}
+		if followerReads {
+			opts = append(opts, store.WithFollowerReads())
+		}
+	}
+
+	if fromEnv := os.Getenv("KEY_ALLOCATOR"); fromEnv != "" {
+		allocator, err := store.ParseKeyAllocator(fromEnv)
+		if err != nil {
+			log.Error("invalid KEY_ALLOCATOR", "error", err)
+			os.Exit(1)
+		}
+		opts = append(opts, store.WithKeyAllocator(allocator))
+	}
+
+	if fromEnv := os.Getenv("NAMESPACE_QUOTAS"); fromEnv != "" {
+		quotas, err := store.ParseQuotas(fromEnv)
+		if err != nil {
+			log.Error("invalid NAMESPACE_QUOTAS", "error", err)
+			os.Exit(1)
+		}
+		opts = append(opts, store.WithNamespaceQuotas(quotas))
+	}
+
+	if os.Getenv("MAX_NAMESPACES") != "" || os.Getenv("MAX_KEYS_PER_NAMESPACE") != "" {
+		var limits store.NamespaceLimits
+		for _, limit := range []struct {
+			env string
+			max *int
+		}{
+			{"MAX_NAMESPACES", &limits.MaxNamespaces},
+			{"MAX_KEYS_PER_NAMESPACE", &limits.MaxKeysPerNamespace},
+		} {
+			fromEnv := os.Getenv(limit.env)
+			if fromEnv == "" {
+				continue
+			}
+			n, err := strconv.Atoi(fromEnv)
+			if err == nil && n < 0 {
+				err = fmt.Errorf("%d is negative", n)
+			}
+			if err != nil {
+				log.Error("invalid "+limit.env, "error", err)
+				os.Exit(1)
+			}
+			*limit.max = n
+		}
+		opts = append(opts, store.WithNamespaceLimits(limits))
+	}
+
+	if fromEnv := os.Getenv("HOT_KEYS"); fromEnv != "" {
+		capacity, err := strconv.Atoi(fromEnv)
+		if err != nil {
+			log.Error("invalid HOT_KEYS", "error", err)
+			os.Exit(1)
+		}
+		opts = append(opts, store.WithHotKeys(capacity))
+	}
+
+	if fromEnv := os.Getenv("MISSING_KEY_STATUS"); fromEnv != "" {
+		status, err := server.ParseMissingKeyStatus(fromEnv)
+		if err != nil {
+			log.Error("invalid MISSING_KEY_STATUS", "error", err)
+			os.Exit(1)
+		}
+		serverOpts = append(serverOpts, server.WithMissingKeyStatus(status))
+	}
+
+	if fromEnv := os.Getenv("REJECT_EMPTY_VALUES"); fromEnv != "" {
+		reject, err := strconv.ParseBool(fromEnv)
+		if err != nil {
+			log.Error("invalid REJECT_EMPTY_VALUES", "error", err)
+			os.Exit(1)
+		}
+		if reject {
+			serverOpts = append(serverOpts, server.WithRejectEmptyValues())
+		}
+	}
+
+	if fromEnv := os.Getenv("GZIP_MIN_SIZE"); fromEnv != "" {
+		size, err := strconv.Atoi(fromEnv)
+		if err == nil && size < 0 {
+			err = fmt.Errorf("%d is negative", size)
+		}
+		if err != nil {
+			log.Error("invalid GZIP_MIN_SIZE", "error", err)
+			os.Exit(1)
+		}
+		serverOpts = append(serverOpts, server.WithGzipMinSize(size))
+	}
+
+	if fromEnv := os.Getenv("STANDALONE"); fromEnv != "" {
+		standalone, err := strconv.ParseBool(fromEnv)
+		if err != nil {
+			log.Error("invalid STANDALONE", "error", err)
+			os.Exit(1)
+		}
+		if standalone {
+			serverOpts = append(serverOpts, server.WithStandalone())
+		}
+	}
+
+	srv, err := server.New(append(serverOpts, server.WithStoreOptions(opts...))...)
+	if err != nil {
+		log.Error("couldn't set up the node", "error", err)
+		os.Exit(1)
+	}
+	if err := srv.Start(); err != nil {
+		log.Error("couldn't start the node", "error", err)
+		os.Exit(1)
+	}
+
+	// The node shuts down on SIGTERM or SIGINT, or when it can't serve HTTP
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	failed := false
+	select {
+	case err := <-srv.Err():
+		log.Error("couldn't serve HTTP", "error", err)
+		failed = true
+	case <-ctx.Done():
+		log.Info("shutting down")
+	}
+	stop()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	err = srv.Stop(shutdownCtx)
+	cancel()
+	if err != nil {
+		log.Error("couldn't shut the node down cleanly", "error", err)
+		failed = true
+	}
+	if failed {
+		os.Exit(1)
+	}
+	log.Info("shut down")
+}
+
+// loadCertPool returns the pool of the PEM encoded certificates of the file at
+// path.
+func loadCertPool(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no PEM certificate in %s", path)
+	}
+
+	return pool, nil
+}
+
+// newDiscoverer returns the store.Discoverer finding the other nodes through
+// the comma separated list of seeds, the addresses dns resolves to, given as
+// host:port, or the SRV records of srv. It returns nil when all are empty,
+// and fails when more than one is set.
+func newDiscoverer(seeds, dns, srv string) (store.Discoverer, error) {
+	var set []string
+	for name, value := range map[string]string{"SEEDS": seeds, "DISCOVERY_DNS": dns, "DISCOVERY_SRV": srv} {
+		if value != "" {
+			set = append(set, name)
+		}
+	}
+	if len(set) > 1 {
+		sort.Strings(set)
+		return nil, fmt.Errorf("only one of %s can be set", strings.Join(set, ", "))
+	}
+
+	switch {
+	case seeds != "":
+		var list store.StaticSeeds
+		for _, seed := range strings.Split(seeds, ",") {
+			if seed = strings.TrimSpace(seed); seed != "" {
+				list = append(list, seed)
+			}
+		}
+		return list, nil
+	case dns != "":
+		host, port, err := net.SplitHostPort(dns)
+		if err != nil {
+			return nil, fmt.Errorf("DISCOVERY_DNS: %w", err)
+		}
+		return store.DNSDiscoverer{Name: host, Port: port}, nil
+	case srv != "":
+		return store.SRVDiscoverer{Name: srv}, nil
+	default:
+		return nil, nil
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/maelfosso/key-value-store/store"
+)
+
+func TestNewLogger(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		level, format string
+		valid         bool
+	}{
+		{"", "", true},
+		{"debug", "json", true},
+		{"WARN", "text", true},
+		{"loud", "", false},
+		{"", "xml", false},
+	}
+
+	for _, test := range testCases {
+		if _, err := newLogger(test.level, test.format); (err == nil) != test.valid {
+			t.Errorf("newLogger(%q, %q) returned %v", test.level, test.format, err)
+		}
+	}
+}
+
+func TestParseConfig(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		ext, doc string
+	}{
+		{".yaml", `
+port: 9080
+storage_path: /var/lib/kv
+log_level: debug
+raft:
+  port: 9081
+  leader: http://node1:8080
+tls:
+  cert_file: /etc/kv/cert.pem
+snapshot:
+  interval: 2m
+  threshold: 8192
+auth_tokens: [abc:read, def:write]
+standalone: false
+`},
+		{".toml", `
+port = 9080
+storage_path = "/var/lib/kv"
+log_level = "debug"
+auth_tokens = ["abc:read", "def:write"]
+standalone = false
+
+[raft]
+port = 9081
+leader = "http://node1:8080"
+
+[tls]
+cert_file = "/etc/kv/cert.pem"
+
+[snapshot]
+interval = "2m"
+threshold = 8192
+`},
+	}
+	want := map[string]string{
+		"PORT":               "9080",
+		"STORAGE_PATH":       "/var/lib/kv",
+		"LOG_LEVEL":          "debug",
+		"RAFT_PORT":          "9081",
+		"RAFT_LEADER":        "http://node1:8080",
+		"TLS_CERT_FILE":      "/etc/kv/cert.pem",
+		"SNAPSHOT_INTERVAL":  "2m",
+		"SNAPSHOT_THRESHOLD": "8192",
+		"AUTH_TOKENS":        "abc:read,def:write",
+		"STANDALONE":         "false",
+	}
+	for _, test := range testCases {
+		values, err := parseConfig(test.ext, []byte(test.doc))
+		if err != nil {
+			t.Fatalf("parseConfig(%s) returned unexpected error: %s", test.ext, err)
+		}
+		if !reflect.DeepEqual(values, want) {
+			t.Errorf("parseConfig(%s) = %v, want %v", test.ext, values, want)
+		}
+	}
+
+	if _, err := parseConfig(".yaml", []byte("raft:\n  prot: 9081\n")); err == nil || !strings.Contains(err.Error(), "RAFT_PROT") {
+		t.Errorf("parseConfig of a misspelt setting returned %v, expected an unknown setting error", err)
+	}
+	if _, err := parseConfig(".json", []byte("{}")); err == nil {
+		t.Error("parseConfig of a .json file succeeded, expected an error")
+	}
+}
+
+func TestNewDiscoverer(t *testing.T) {
+	d, err := newDiscoverer(" node1:8080, ,node2:8080", "", "")
+	if seeds, ok := d.(store.StaticSeeds); err != nil || !ok || len(seeds) != 2 || seeds[0] != "node1:8080" {
+		t.Errorf("newDiscoverer of SEEDS = %#v, %v, want the two seeds", d, err)
+	}
+
+	d, err = newDiscoverer("", "kv-headless.default.svc:8080", "")
+	if dns, ok := d.(store.DNSDiscoverer); err != nil || !ok || dns.Name != "kv-headless.default.svc" || dns.Port != "8080" {
+		t.Errorf("newDiscoverer of DISCOVERY_DNS = %#v, %v", d, err)
+	}
+
+	if d, err := newDiscoverer("", "", ""); d != nil || err != nil {
+		t.Errorf("newDiscoverer without settings = %#v, %v, want nothing", d, err)
+	}
+	if _, err := newDiscoverer("", "kv-headless", ""); err == nil {
+		t.Error("newDiscoverer accepted DISCOVERY_DNS without port")
+	}
+	if _, err := newDiscoverer("node1:8080", "", "_http._tcp.kv"); err == nil {
+		t.Error("newDiscoverer accepted both SEEDS and DISCOVERY_SRV")
+	}
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kv.yaml")
+	if err := os.WriteFile(path, []byte("grpc_port: 9082\nresp_port: 9079\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The environment overrides the file
+	os.Setenv("GRPC_PORT", "7082")
+	os.Unsetenv("RESP_PORT")
+	defer os.Unsetenv("GRPC_PORT")
+	defer os.Unsetenv("RESP_PORT")
+
+	if _, err := loadConfigFile(path); err != nil {
+		t.Fatalf("loadConfigFile returned unexpected error: %s", err)
+	}
+	if got := os.Getenv("GRPC_PORT"); got != "7082" {
+		t.Errorf("GRPC_PORT = %s, want the 7082 of the environment", got)
+	}
+	if got := os.Getenv("RESP_PORT"); got != "9079" {
+		t.Errorf("RESP_PORT = %s, want the 9079 of the file", got)
+	}
+}
@@ -0,0 +1,22 @@
+package server
+
+import (
+	"embed"
+	"net/http"
+)
+
+//go:embed admin/index.html
+var adminFiles embed.FS
+
+// AdminUIHandler serves the admin dashboard, a single page talking to the
+// JSON API from the browser.
+func AdminUIHandler(w http.ResponseWriter, r *http.Request) {
+	page, err := adminFiles.ReadFile("admin/index.html")
+	if err != nil {
+		Error(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(page)
+}
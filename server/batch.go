@@ -0,0 +1,147 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/maelfosso/key-value-store/store"
+)
+
+// batchMediaType is the content type of a batch of keys to write sent to
+// POST /keys, whose body is otherwise the value of the key to create.
+const batchMediaType = "application/vnd.kv.batch+json"
+
+// batchHandler writes the batch of keys of the request body as one Raft log
+// entry, see parseBatch.
+func (s *Server) batchHandler() http.HandlerFunc {
+	config := s.config
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			Error(w, &APIError{Status: http.StatusBadRequest, Code: CodeInvalidBody, Message: err.Error()})
+			return
+		}
+
+		entries, err := parseBatch(body)
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		if err := config.CheckAccess(r.Context(), store.AccessWrite, batchKeys(entries)...); err != nil {
+			Error(w, err)
+			return
+		}
+
+		index, err := config.SetBatchEntries(r.Context(), entries)
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		writeSuccess(w, index, config.Term())
+	}
+}
+
+// batchValue is a value of a batch request written as an object, to give it a
+// TTL.
+type batchValue struct {
+	Value *string `json:"value"`
+	TTL   string  `json:"ttl"`
+}
+
+// parseBatch parses a batch request body: a JSON object mapping keys either to
+// their value or to {"value": "...", "ttl": "60s"}. A single invalid entry
+// fails the whole batch.
+func parseBatch(body []byte) (map[string]store.BatchEntry, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, &APIError{Status: http.StatusBadRequest, Code: CodeInvalidBody, Message: err.Error()}
+	}
+
+	entries := make(map[string]store.BatchEntry, len(raw))
+	for key, value := range raw {
+		value = bytes.TrimSpace(value)
+		if len(value) > 0 && value[0] == '"' {
+			var s string
+			if err := json.Unmarshal(value, &s); err != nil {
+				return nil, &APIError{Status: http.StatusBadRequest, Code: CodeInvalidBody, Message: err.Error()}
+			}
+			entries[key] = store.BatchEntry{Value: s}
+			continue
+		}
+
+		var bv batchValue
+		if err := json.Unmarshal(value, &bv); err != nil || bv.Value == nil {
+			return nil, &APIError{
+				Status:  http.StatusBadRequest,
+				Code:    CodeInvalidBody,
+				Message: fmt.Sprintf("%q must be a string or an object with a value", key),
+			}
+		}
+
+		e := store.BatchEntry{Value: *bv.Value}
+		if bv.TTL != "" {
+			ttl, err := time.ParseDuration(bv.TTL)
+			if err != nil || ttl <= 0 {
+				return nil, &APIError{
+					Status:  http.StatusBadRequest,
+					Code:    CodeInvalidTTL,
+					Message: fmt.Sprintf("invalid TTL %q for %q", bv.TTL, key),
+				}
+			}
+			e.TTL = ttl
+		}
+		entries[key] = e
+	}
+
+	return entries, nil
+}
+
+// conditionalBatch is the body of a conditional batch request.
+type conditionalBatch struct {
+	If *struct {
+		Key      string `json:"key"`
+		Expected string `json:"expected"`
+		Next     string `json:"next"`
+	} `json:"if"`
+	Entries json.RawMessage `json:"entries"`
+}
+
+// batchKeys returns the keys written by a batch.
+func batchKeys(entries map[string]store.BatchEntry) []string {
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+// parseConditionalBatch parses a conditional batch request body: the
+// precondition under "if" and the entries, as parseBatch takes them, under
+// "entries".
+func parseConditionalBatch(body []byte) (store.Precondition, map[string]store.BatchEntry, error) {
+	var cb conditionalBatch
+	if err := json.Unmarshal(body, &cb); err != nil {
+		return store.Precondition{}, nil, &APIError{Status: http.StatusBadRequest, Code: CodeInvalidBody, Message: err.Error()}
+	}
+
+	if cb.If == nil || cb.If.Key == "" {
+		return store.Precondition{}, nil, &APIError{Status: http.StatusBadRequest, Code: CodeInvalidBody, Message: "missing the key of the precondition"}
+	}
+	if len(cb.Entries) == 0 {
+		return store.Precondition{}, nil, &APIError{Status: http.StatusBadRequest, Code: CodeInvalidBody, Message: "missing entries"}
+	}
+
+	entries, err := parseBatch(cb.Entries)
+	if err != nil {
+		return store.Precondition{}, nil, err
+	}
+
+	return store.Precondition{Key: cb.If.Key, Expected: cb.If.Expected, Next: cb.If.Next}, entries, nil
+}
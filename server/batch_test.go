@@ -0,0 +1,69 @@
+package server
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/maelfosso/key-value-store/store"
+)
+
+func TestParseBatch(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		in   string
+		out  map[string]store.BatchEntry
+		code string
+	}{
+		{`{"k1": "v1", "k2": ""}`, map[string]store.BatchEntry{"k1": {Value: "v1"}, "k2": {Value: ""}}, ""},
+		{
+			`{"k1": "v1", "session": {"value": "abc", "ttl": "60s"}}`,
+			map[string]store.BatchEntry{"k1": {Value: "v1"}, "session": {Value: "abc", TTL: time.Minute}},
+			"",
+		},
+		{`{"k": {"value": "v"}}`, map[string]store.BatchEntry{"k": {Value: "v"}}, ""},
+		{`{"k1": "v1", "k2": {"value": "v", "ttl": "soon"}}`, nil, CodeInvalidTTL},
+		{`{"k": {"value": "v", "ttl": "-1s"}}`, nil, CodeInvalidTTL},
+		{`{"k": {"ttl": "1s"}}`, nil, CodeInvalidBody},
+		{`{"k": 12}`, nil, CodeInvalidBody},
+		{`["k"]`, nil, CodeInvalidBody},
+	}
+
+	for _, test := range testCases {
+		got, err := parseBatch([]byte(test.in))
+
+		var apiErr *APIError
+		if errors.As(err, &apiErr) != (test.code != "") || (apiErr != nil && apiErr.Code != test.code) {
+			t.Errorf("parseBatch(%s): Got error %v, expected code %q", test.in, err, test.code)
+			continue
+		}
+
+		if test.code == "" && !reflect.DeepEqual(got, test.out) {
+			t.Errorf("parseBatch(%s): Got %v, expected %v", test.in, got, test.out)
+		}
+	}
+}
+
+func TestParseConditionalBatch(t *testing.T) {
+	t.Parallel()
+
+	pre, entries, err := parseConditionalBatch([]byte(`{"if": {"key": "version", "expected": "41"}, "entries": {"k": "v"}}`))
+	if err != nil {
+		t.Fatalf("parseConditionalBatch returned unexpected error: %s", err)
+	}
+	if expected := (store.Precondition{Key: "version", Expected: "41"}); pre != expected {
+		t.Errorf("Got precondition %+v, expected %+v", pre, expected)
+	}
+	if !reflect.DeepEqual(entries, map[string]store.BatchEntry{"k": {Value: "v"}}) {
+		t.Errorf("Got entries %v", entries)
+	}
+
+	for _, in := range []string{`{"entries": {"k": "v"}}`, `{"if": {"key": "version"}}`, `{"if": {"key": "version"}, "entries": {"k": 1}}`} {
+		var apiErr *APIError
+		if _, _, err := parseConditionalBatch([]byte(in)); !errors.As(err, &apiErr) || apiErr.Code != CodeInvalidBody {
+			t.Errorf("parseConditionalBatch(%s): Got error %v, expected code %q", in, err, CodeInvalidBody)
+		}
+	}
+}
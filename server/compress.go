@@ -0,0 +1,79 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// defaultGzipMinSize is the size from which values are gzip compressed for
+// the clients accepting it.
+const defaultGzipMinSize = 1024
+
+// acceptsGzip reports whether the Accept-Encoding header of r lists gzip, or
+// *, with a non zero quality.
+func acceptsGzip(r *http.Request) bool {
+	for _, header := range r.Header.Values("Accept-Encoding") {
+		for _, coding := range strings.Split(header, ",") {
+			name, params := coding, ""
+			if i := strings.Index(coding, ";"); i >= 0 {
+				name, params = coding[:i], coding[i+1:]
+			}
+
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name != "gzip" && name != "*" {
+				continue
+			}
+
+			q := 1.0
+			if params = strings.TrimSpace(params); strings.HasPrefix(params, "q=") {
+				var err error
+				if q, err = strconv.ParseFloat(params[len("q="):], 64); err != nil {
+					continue
+				}
+			}
+			if q > 0 {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// gzipBytes returns b gzip compressed.
+func gzipBytes(b []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(b); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// writeBody writes body as the response, gzip compressed when it is at least
+// the gzip min size long and r accepts it. The body is compressed before
+// anything is sent, so Content-Length is always the size of what a GET
+// receives, and of what a HEAD would have.
+func (s *Server) writeBody(w http.ResponseWriter, r *http.Request, body []byte) {
+	if s.gzipMinSize > 0 && len(body) >= s.gzipMinSize {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if acceptsGzip(r) {
+			if compressed, err := gzipBytes(body); err == nil {
+				w.Header().Set("Content-Encoding", "gzip")
+				body = compressed
+			} else {
+				s.logger.Warn("couldn't compress value, sending it as is", "error", err)
+			}
+		}
+	}
+
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.Write(body)
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/maelfosso/key-value-store/store"
+)
+
+func TestWriteEntryGzip(t *testing.T) {
+	t.Parallel()
+
+	value := strings.Repeat("a large text value ", 200)
+	s := &Server{options: newOptions(nil)}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.writeEntry(w, r, store.Entry{Value: value, ContentType: "text/plain"})
+	}))
+	defer server.Close()
+
+	// Compression is left to the test, the transport would undo it
+	client := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+	request := func(method, acceptEncoding string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(method, server.URL+"/key/k", nil)
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("%s returned unexpected error: %s", method, err)
+		}
+		return resp
+	}
+
+	resp := request(http.MethodGet, "deflate, gzip;q=0.5")
+	defer resp.Body.Close()
+	if got := resp.Header.Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("Got Content-Encoding %q, expected gzip", got)
+	}
+	zr, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatalf("gzip.NewReader returned unexpected error: %s", err)
+	}
+	body, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("Reading the body returned unexpected error: %s", err)
+	}
+	if string(body) != value {
+		t.Errorf("Got value %q after decompressing, expected %q", body, value)
+	}
+	if resp.ContentLength <= 0 || resp.ContentLength >= int64(len(value)) {
+		t.Errorf("Got Content-Length %d, expected the compressed size", resp.ContentLength)
+	}
+
+	head := request(http.MethodHead, "gzip")
+	head.Body.Close()
+	if head.ContentLength != resp.ContentLength || head.Header.Get("Content-Encoding") != "gzip" {
+		t.Errorf("HEAD got Content-Length %d and Content-Encoding %q, expected those of GET", head.ContentLength, head.Header.Get("Content-Encoding"))
+	}
+
+	for _, acceptEncoding := range []string{"", "deflate", "gzip;q=0"} {
+		plain := request(http.MethodGet, acceptEncoding)
+		body, _ := io.ReadAll(plain.Body)
+		plain.Body.Close()
+		if plain.Header.Get("Content-Encoding") != "" || string(body) != value {
+			t.Errorf("Accept-Encoding %q: Got Content-Encoding %q and %d bytes, expected the value as is", acceptEncoding, plain.Header.Get("Content-Encoding"), len(body))
+		}
+	}
+}
+
+func TestWriteEntrySmallValueUncompressed(t *testing.T) {
+	t.Parallel()
+
+	req := httptest.NewRequest(http.MethodGet, "/key/k", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	recorder := httptest.NewRecorder()
+	s := &Server{options: newOptions(nil)}
+	s.writeEntry(recorder, req, store.Entry{Value: "small"})
+
+	if got := recorder.Header().Get("Content-Encoding"); got != "" {
+		t.Errorf("Got Content-Encoding %q for a small value", got)
+	}
+	if recorder.Body.String() != "small" || recorder.Header().Get("Content-Length") != "5" {
+		t.Errorf("Got body %q with Content-Length %q", recorder.Body.String(), recorder.Header().Get("Content-Length"))
+	}
+}
@@ -0,0 +1,214 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/maelfosso/key-value-store/store"
+)
+
+// Error codes returned in the "code" field of JSON error responses. They are
+// part of the API and must not change once released.
+const (
+	CodeBucketExists         = "bucket_exists"
+	CodeBucketNotFound       = "bucket_not_found"
+	CodeConditionFailed      = "condition_failed"
+	CodeEmptyValue           = "empty_value"
+	CodeForbidden            = "forbidden"
+	CodeIndexTimeout         = "index_timeout"
+	CodeInternal             = "internal"
+	CodeInvalidACL           = "invalid_acl"
+	CodeInvalidBody          = "invalid_body"
+	CodeInvalidEncoding      = "invalid_encoding"
+	CodeInvalidKey           = "invalid_key"
+	CodeInvalidMetadata      = "invalid_metadata"
+	CodeInvalidParameter     = "invalid_parameter"
+	CodeInvalidPatch         = "invalid_patch"
+	CodeInvalidPrecondition  = "invalid_precondition"
+	CodeInvalidTTL           = "invalid_ttl"
+	CodeInvalidToken         = "invalid_token"
+	CodeInvalidTxn           = "invalid_txn"
+	CodeKeyExists            = "key_exists"
+	CodeKeysExist            = "keys_exist"
+	CodeLeaseNotFound        = "lease_not_found"
+	CodeLockHeld             = "lock_held"
+	CodeLockNotHeld          = "lock_not_held"
+	CodeNamespaceLimit       = "namespace_limit"
+	CodeNoHMACSecret         = "no_hmac_secret"
+	CodeNotFound             = "not_found"
+	CodeNotInteger           = "not_integer"
+	CodeNotJSON              = "not_json"
+	CodeNotLeader            = "not_leader"
+	CodeNotReady             = "not_ready"
+	CodeOverflow             = "overflow"
+	CodePolicyViolation      = "policy_violation"
+	CodeQuotaExceeded        = "quota_exceeded"
+	CodeReadOnly             = "read_only"
+	CodeReadReplica          = "read_replica"
+	CodeReservedKey          = "reserved_key"
+	CodeRevisionNotFound     = "revision_not_found"
+	CodeStandalone           = "standalone"
+	CodeStoreLocked          = "store_locked"
+	CodeTooManyWrites        = "too_many_writes"
+	CodeUnauthorized         = "unauthorized"
+	CodeUnsupportedMediaType = "unsupported_media_type"
+	CodeValueTooLarge        = "value_too_large"
+	CodeWaitTimeout          = "wait_timeout"
+)
+
+// APIError is an error reported to HTTP clients, carrying the response status
+// and a stable machine-readable code.
+type APIError struct {
+	Status  int    `json:"-"`
+	Code    string `json:"code"`
+	Message string `json:"error"`
+
+	// Leader is the HTTP address of the cluster leader, set on not_leader
+	// errors when a leader is known.
+	Leader string `json:"leader,omitempty"`
+
+	// Keys are the conflicting keys of a keys_exist error.
+	Keys []string `json:"keys,omitempty"`
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+// toAPIError maps err to the APIError describing it to clients.
+func toAPIError(err error) *APIError {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+
+	var notLeader *store.NotLeaderError
+	if errors.As(err, &notLeader) && notLeader.Leader != "" {
+		// The client can retry against the leader straight away
+		return &APIError{
+			Status:  http.StatusMisdirectedRequest,
+			Code:    CodeNotLeader,
+			Message: err.Error(),
+			Leader:  notLeader.Leader,
+		}
+	}
+
+	var keysExist *store.KeysExistError
+	if errors.As(err, &keysExist) {
+		return &APIError{
+			Status:  http.StatusPreconditionFailed,
+			Code:    CodeKeysExist,
+			Message: err.Error(),
+			Keys:    keysExist.Keys,
+		}
+	}
+
+	status, code := http.StatusInternalServerError, CodeInternal
+	switch {
+	case errors.Is(err, store.ErrNotLeader):
+		status, code = http.StatusServiceUnavailable, CodeNotLeader
+	case errors.Is(err, store.ErrNotFound):
+		status, code = http.StatusNotFound, CodeNotFound
+	case errors.Is(err, store.ErrKeyExists):
+		status, code = http.StatusConflict, CodeKeyExists
+	case errors.Is(err, store.ErrInvalidPatch):
+		status, code = http.StatusBadRequest, CodeInvalidPatch
+	case errors.Is(err, store.ErrNotJSON):
+		status, code = http.StatusConflict, CodeNotJSON
+	case errors.Is(err, store.ErrNotInteger):
+		status, code = http.StatusConflict, CodeNotInteger
+	case errors.Is(err, store.ErrOverflow):
+		status, code = http.StatusConflict, CodeOverflow
+	case errors.Is(err, store.ErrNotReady):
+		status, code = http.StatusServiceUnavailable, CodeNotReady
+	case errors.Is(err, store.ErrIndexTimeout):
+		status, code = http.StatusServiceUnavailable, CodeIndexTimeout
+	case errors.Is(err, store.ErrWaitTimeout):
+		status, code = http.StatusGatewayTimeout, CodeWaitTimeout
+	case errors.Is(err, store.ErrInvalidTTL):
+		status, code = http.StatusBadRequest, CodeInvalidTTL
+	case errors.Is(err, store.ErrInvalidLimit):
+		status, code = http.StatusBadRequest, CodeInvalidParameter
+	case errors.Is(err, store.ErrPolicyViolation):
+		status, code = http.StatusUnprocessableEntity, CodePolicyViolation
+	case errors.Is(err, store.ErrReadOnly):
+		status, code = http.StatusForbidden, CodeReadOnly
+	case errors.Is(err, store.ErrTooManyWrites):
+		status, code = http.StatusTooManyRequests, CodeTooManyWrites
+	case errors.Is(err, store.ErrQuotaExceeded):
+		status, code = http.StatusInsufficientStorage, CodeQuotaExceeded
+	case errors.Is(err, store.ErrConditionFailed):
+		status, code = http.StatusConflict, CodeConditionFailed
+	case errors.Is(err, store.ErrInvalidPrecondition):
+		status, code = http.StatusBadRequest, CodeInvalidPrecondition
+	case errors.Is(err, store.ErrNamespaceLimit):
+		status, code = http.StatusInsufficientStorage, CodeNamespaceLimit
+	case errors.Is(err, store.ErrStoreLocked):
+		status, code = http.StatusServiceUnavailable, CodeStoreLocked
+	case errors.Is(err, store.ErrInvalidKey):
+		status, code = http.StatusBadRequest, CodeInvalidKey
+	case errors.Is(err, store.ErrReservedKey):
+		status, code = http.StatusForbidden, CodeReservedKey
+	case errors.Is(err, store.ErrValueTooLarge):
+		status, code = http.StatusRequestEntityTooLarge, CodeValueTooLarge
+	case errors.Is(err, store.ErrUnauthorized):
+		status, code = http.StatusUnauthorized, CodeUnauthorized
+	case errors.Is(err, store.ErrForbidden):
+		status, code = http.StatusForbidden, CodeForbidden
+	case errors.Is(err, store.ErrInvalidToken):
+		status, code = http.StatusBadRequest, CodeInvalidToken
+	case errors.Is(err, store.ErrInvalidACL):
+		status, code = http.StatusBadRequest, CodeInvalidACL
+	case errors.Is(err, store.ErrNoHMACSecret):
+		status, code = http.StatusConflict, CodeNoHMACSecret
+	case errors.Is(err, store.ErrStandalone):
+		status, code = http.StatusConflict, CodeStandalone
+	case errors.Is(err, store.ErrReadReplica):
+		status, code = http.StatusConflict, CodeReadReplica
+	case errors.Is(err, store.ErrInvalidTxn):
+		status, code = http.StatusBadRequest, CodeInvalidTxn
+	case errors.Is(err, store.ErrRevisionNotFound):
+		status, code = http.StatusNotFound, CodeRevisionNotFound
+	case errors.Is(err, store.ErrBucketNotFound):
+		status, code = http.StatusNotFound, CodeBucketNotFound
+	case errors.Is(err, store.ErrBucketExists):
+		status, code = http.StatusConflict, CodeBucketExists
+	case errors.Is(err, store.ErrLeaseNotFound):
+		status, code = http.StatusNotFound, CodeLeaseNotFound
+	case errors.Is(err, store.ErrLockHeld):
+		status, code = http.StatusConflict, CodeLockHeld
+	case errors.Is(err, store.ErrLockNotHeld):
+		status, code = http.StatusConflict, CodeLockNotHeld
+	case errors.Is(err, store.ErrInvalidMetadata):
+		status, code = http.StatusBadRequest, CodeInvalidMetadata
+	}
+
+	return &APIError{Status: status, Code: code, Message: err.Error()}
+}
+
+// invalidParameter reports a query parameter that couldn't be parsed.
+func invalidParameter(name string, err error) *APIError {
+	return &APIError{
+		Status:  http.StatusBadRequest,
+		Code:    CodeInvalidParameter,
+		Message: fmt.Sprintf("invalid %s: %s", name, err),
+	}
+}
+
+// Error writes err to the http response as a JSON body with the matching
+// status code
+func Error(w http.ResponseWriter, err error) {
+	apiErr := toAPIError(err)
+
+	b, err := json.Marshal(apiErr)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(apiErr.Status)
+	w.Write(b)
+}
@@ -0,0 +1,380 @@
+package server
+
+import (
+	"context"
+	"hash/fnv"
+
+	"github.com/maelfosso/key-value-store/store"
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// etcdKV serves the KV service of the etcd v3 API, so etcdctl and the etcd
+// client libraries can read and write the store. The store keeps no
+// revisions: every key is at version 1 and the revisions of the responses
+// are Raft indexes. Leases, revision reads and compaction are unimplemented,
+// and so are writes sent to a follower, like the rest of the gRPC API.
+type etcdKV struct {
+	etcdserverpb.UnimplementedKVServer
+	config *store.Config
+}
+
+func (s *etcdKV) Range(ctx context.Context, req *etcdserverpb.RangeRequest) (*etcdserverpb.RangeResponse, error) {
+	if s.config.Draining() {
+		return nil, status.Error(codes.Unavailable, store.ErrDraining.Error())
+	}
+
+	op, err := etcdRangeOp(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.config.CheckAccess(ctx, store.AccessRead, etcdRangePrefix(op.Key, op.End)); err != nil {
+		return nil, grpcError(ctx, err)
+	}
+
+	if !req.Serializable {
+		if err := s.config.Consistent(ctx, store.ConsistencyLinearizable); err != nil {
+			return nil, grpcError(ctx, err)
+		}
+	}
+
+	// A descending read needs the whole range to find its last keys
+	limit := op.Limit
+	if req.SortOrder == etcdserverpb.RangeRequest_DESCEND {
+		limit = 0
+	}
+	result, index, err := s.config.Range(ctx, op.Key, op.End, limit)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+
+	resp := etcdRangeResponse(req, result)
+	resp.Header = s.header(index)
+	return resp, nil
+}
+
+func (s *etcdKV) Put(ctx context.Context, req *etcdserverpb.PutRequest) (*etcdserverpb.PutResponse, error) {
+	op, err := etcdPutOp(req)
+	if err != nil {
+		return nil, err
+	}
+
+	result, index, err := s.txn(ctx, nil, []store.TxnOp{op}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := etcdPutResponse(req, result.Results[0])
+	resp.Header = s.header(index)
+	return resp, nil
+}
+
+func (s *etcdKV) DeleteRange(ctx context.Context, req *etcdserverpb.DeleteRangeRequest) (*etcdserverpb.DeleteRangeResponse, error) {
+	result, index, err := s.txn(ctx, nil, []store.TxnOp{etcdDeleteOp(req)}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := etcdDeleteResponse(req, result.Results[0])
+	resp.Header = s.header(index)
+	return resp, nil
+}
+
+func (s *etcdKV) Txn(ctx context.Context, req *etcdserverpb.TxnRequest) (*etcdserverpb.TxnResponse, error) {
+	var compares []store.TxnCompare
+	for _, c := range req.Compare {
+		compare, err := etcdCompare(c)
+		if err != nil {
+			return nil, err
+		}
+		compares = append(compares, compare)
+	}
+	success, err := etcdTxnOps(req.Success)
+	if err != nil {
+		return nil, err
+	}
+	failure, err := etcdTxnOps(req.Failure)
+	if err != nil {
+		return nil, err
+	}
+
+	result, index, err := s.txn(ctx, compares, success, failure)
+	if err != nil {
+		return nil, err
+	}
+
+	requests := req.Success
+	if !result.Succeeded {
+		requests = req.Failure
+	}
+	resp := &etcdserverpb.TxnResponse{Header: s.header(index), Succeeded: result.Succeeded}
+	for i, r := range requests {
+		var op etcdserverpb.ResponseOp
+		switch r := r.Request.(type) {
+		case *etcdserverpb.RequestOp_RequestRange:
+			rr := etcdRangeResponse(r.RequestRange, result.Results[i])
+			rr.Header = s.header(index)
+			op.Response = &etcdserverpb.ResponseOp_ResponseRange{ResponseRange: rr}
+		case *etcdserverpb.RequestOp_RequestPut:
+			pr := etcdPutResponse(r.RequestPut, result.Results[i])
+			pr.Header = s.header(index)
+			op.Response = &etcdserverpb.ResponseOp_ResponsePut{ResponsePut: pr}
+		case *etcdserverpb.RequestOp_RequestDeleteRange:
+			dr := etcdDeleteResponse(r.RequestDeleteRange, result.Results[i])
+			dr.Header = s.header(index)
+			op.Response = &etcdserverpb.ResponseOp_ResponseDeleteRange{ResponseDeleteRange: dr}
+		}
+		resp.Responses = append(resp.Responses, &op)
+	}
+
+	return resp, nil
+}
+
+// txn checks the access the compares and operations need and runs them as a
+// store transaction.
+func (s *etcdKV) txn(ctx context.Context, compares []store.TxnCompare, success, failure []store.TxnOp) (store.TxnResult, uint64, error) {
+	if s.config.Draining() {
+		return store.TxnResult{}, 0, status.Error(codes.Unavailable, store.ErrDraining.Error())
+	}
+
+	for _, c := range compares {
+		if err := s.config.CheckAccess(ctx, store.AccessRead, c.Key); err != nil {
+			return store.TxnResult{}, 0, grpcError(ctx, err)
+		}
+	}
+	for _, op := range append(append([]store.TxnOp{}, success...), failure...) {
+		access := store.AccessWrite
+		if op.Action == store.TxnGet {
+			access = store.AccessRead
+		}
+		if err := s.config.CheckAccess(ctx, access, etcdRangePrefix(op.Key, op.End)); err != nil {
+			return store.TxnResult{}, 0, grpcError(ctx, err)
+		}
+	}
+
+	result, index, err := s.config.Txn(ctx, compares, success, failure)
+	if err != nil {
+		return store.TxnResult{}, 0, grpcError(ctx, err)
+	}
+
+	return result, index, nil
+}
+
+// header returns the header of a response at the Raft index.
+func (s *etcdKV) header(index uint64) *etcdserverpb.ResponseHeader {
+	h := fnv.New64a()
+	h.Write([]byte(s.config.Status().ID))
+
+	return &etcdserverpb.ResponseHeader{
+		MemberId: h.Sum64(),
+		Revision: int64(index),
+		RaftTerm: s.config.Term(),
+	}
+}
+
+// etcdRangeOp converts a range request to a store get, failing with
+// Unimplemented on the options relying on revisions.
+func etcdRangeOp(req *etcdserverpb.RangeRequest) (store.TxnOp, error) {
+	switch {
+	case req.Revision != 0:
+		return store.TxnOp{}, status.Error(codes.Unimplemented, "reading at a revision is not supported, the store keeps no history")
+	case req.MinModRevision != 0 || req.MaxModRevision != 0 || req.MinCreateRevision != 0 || req.MaxCreateRevision != 0:
+		return store.TxnOp{}, status.Error(codes.Unimplemented, "filtering on revisions is not supported, the store keeps no history")
+	case req.SortOrder != etcdserverpb.RangeRequest_NONE && req.SortTarget != etcdserverpb.RangeRequest_KEY:
+		return store.TxnOp{}, status.Errorf(codes.Unimplemented, "sorting by %s is not supported, only by key", req.SortTarget)
+	}
+
+	return store.TxnOp{
+		Action: store.TxnGet,
+		Key:    string(req.Key),
+		End:    etcdRangeEnd(req.RangeEnd),
+		Limit:  int(req.Limit),
+	}, nil
+}
+
+// etcdPutOp converts a put request to a store put, failing with
+// Unimplemented on leases.
+func etcdPutOp(req *etcdserverpb.PutRequest) (store.TxnOp, error) {
+	if req.Lease != 0 || req.IgnoreLease || req.IgnoreValue {
+		return store.TxnOp{}, status.Error(codes.Unimplemented, "leases are not supported")
+	}
+
+	return store.TxnOp{Action: store.TxnPut, Key: string(req.Key), Value: req.Value}, nil
+}
+
+func etcdDeleteOp(req *etcdserverpb.DeleteRangeRequest) store.TxnOp {
+	return store.TxnOp{Action: store.TxnDelete, Key: string(req.Key), End: etcdRangeEnd(req.RangeEnd)}
+}
+
+// etcdTxnOps converts the operations of a transaction, failing with
+// Unimplemented on nested transactions.
+func etcdTxnOps(requests []*etcdserverpb.RequestOp) ([]store.TxnOp, error) {
+	var ops []store.TxnOp
+	for _, r := range requests {
+		switch r := r.Request.(type) {
+		case *etcdserverpb.RequestOp_RequestRange:
+			op, err := etcdRangeOp(r.RequestRange)
+			if err != nil {
+				return nil, err
+			}
+			if r.RequestRange.SortOrder == etcdserverpb.RangeRequest_DESCEND {
+				op.Limit = 0
+			}
+			ops = append(ops, op)
+		case *etcdserverpb.RequestOp_RequestPut:
+			op, err := etcdPutOp(r.RequestPut)
+			if err != nil {
+				return nil, err
+			}
+			ops = append(ops, op)
+		case *etcdserverpb.RequestOp_RequestDeleteRange:
+			ops = append(ops, etcdDeleteOp(r.RequestDeleteRange))
+		case *etcdserverpb.RequestOp_RequestTxn:
+			return nil, status.Error(codes.Unimplemented, "nested transactions are not supported")
+		default:
+			return nil, status.Error(codes.InvalidArgument, "empty transaction operation")
+		}
+	}
+
+	return ops, nil
+}
+
+// etcdCompare converts a compare of a transaction. Values compare as etcd
+// does. As every key is at version 1, a version compares with 0 to check
+// whether the key exists, other versions and the other targets are
+// unimplemented.
+func etcdCompare(c *etcdserverpb.Compare) (store.TxnCompare, error) {
+	if len(c.RangeEnd) > 0 {
+		return store.TxnCompare{}, status.Error(codes.Unimplemented, "compares on a range are not supported")
+	}
+	compare := store.TxnCompare{Key: string(c.Key)}
+
+	switch c.Target {
+	case etcdserverpb.Compare_VALUE:
+		compare.Value = c.GetValue()
+		switch c.Result {
+		case etcdserverpb.Compare_EQUAL:
+			compare.Op = store.CompareEqual
+		case etcdserverpb.Compare_NOT_EQUAL:
+			compare.Op = store.CompareNotEqual
+		case etcdserverpb.Compare_LESS:
+			compare.Op = store.CompareLess
+		case etcdserverpb.Compare_GREATER:
+			compare.Op = store.CompareGreater
+		}
+	case etcdserverpb.Compare_VERSION:
+		if c.GetVersion() != 0 {
+			return store.TxnCompare{}, status.Error(codes.Unimplemented, "versions only compare with 0, the store keeps no history")
+		}
+		switch c.Result {
+		case etcdserverpb.Compare_EQUAL:
+			compare.Op = store.CompareMissing
+		case etcdserverpb.Compare_NOT_EQUAL, etcdserverpb.Compare_GREATER:
+			compare.Op = store.CompareExists
+		default:
+			return store.TxnCompare{}, status.Error(codes.Unimplemented, "no version is less than 0")
+		}
+	default:
+		return store.TxnCompare{}, status.Errorf(codes.Unimplemented, "comparing the %s is not supported, the store keeps no revisions or leases", c.Target)
+	}
+
+	return compare, nil
+}
+
+func etcdRangeResponse(req *etcdserverpb.RangeRequest, r store.OpResult) *etcdserverpb.RangeResponse {
+	entries := r.Entries
+	if req.SortOrder == etcdserverpb.RangeRequest_DESCEND {
+		reversed := make([]store.KeyEntry, 0, len(entries))
+		for i := len(entries) - 1; i >= 0; i-- {
+			reversed = append(reversed, entries[i])
+		}
+		entries = reversed
+		if req.Limit > 0 && len(entries) > int(req.Limit) {
+			entries, r.More = entries[:req.Limit], true
+		}
+	}
+
+	resp := &etcdserverpb.RangeResponse{Count: int64(r.Count), More: r.More}
+	if req.CountOnly {
+		return resp
+	}
+	for _, e := range entries {
+		kv := etcdKeyValue(e)
+		if req.KeysOnly {
+			kv.Value = nil
+		}
+		resp.Kvs = append(resp.Kvs, kv)
+	}
+
+	return resp
+}
+
+func etcdPutResponse(req *etcdserverpb.PutRequest, r store.OpResult) *etcdserverpb.PutResponse {
+	resp := &etcdserverpb.PutResponse{}
+	if req.PrevKv && len(r.Prev) > 0 {
+		resp.PrevKv = etcdKeyValue(r.Prev[0])
+	}
+
+	return resp
+}
+
+func etcdDeleteResponse(req *etcdserverpb.DeleteRangeRequest, r store.OpResult) *etcdserverpb.DeleteRangeResponse {
+	resp := &etcdserverpb.DeleteRangeResponse{Deleted: int64(len(r.Prev))}
+	if req.PrevKv {
+		for _, e := range r.Prev {
+			resp.PrevKvs = append(resp.PrevKvs, etcdKeyValue(e))
+		}
+	}
+
+	return resp
+}
+
+func etcdKeyValue(e store.KeyEntry) *mvccpb.KeyValue {
+	return &mvccpb.KeyValue{Key: []byte(e.Key), Value: []byte(e.Value), ModRevision: int64(e.Revision), Version: 1}
+}
+
+// etcdRangeEnd converts the range_end of etcd, "\x00" running the range to
+// the last key.
+func etcdRangeEnd(end []byte) string {
+	if string(end) == "\x00" {
+		return store.EndOfKeys
+	}
+
+	return string(end)
+}
+
+// etcdRangePrefix returns the prefix CheckAccess checks for the keys from key
+// up to end: the key itself for a single key or a prefix range, as etcdctl
+// sends with --prefix, and the prefix key and end share otherwise.
+func etcdRangePrefix(key, end string) string {
+	switch {
+	case end == "":
+		return key
+	case end == store.EndOfKeys:
+		return ""
+	case end == etcdPrefixEnd(key):
+		return key
+	}
+
+	i := 0
+	for i < len(key) && i < len(end) && key[i] == end[i] {
+		i++
+	}
+	return key[:i]
+}
+
+// etcdPrefixEnd returns the end of the range of the keys prefixed by key, as
+// the etcd clients compute it.
+func etcdPrefixEnd(key string) string {
+	end := []byte(key)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return string(end[:i+1])
+		}
+	}
+
+	return store.EndOfKeys
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/maelfosso/key-value-store/store"
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestEtcdKV(t *testing.T) {
+	ctx := context.Background()
+	config, err := store.NewStandalone(t.TempDir(), store.WithLogger(hclog.NewNullLogger()))
+	if err != nil {
+		t.Fatalf("NewStandalone returned unexpected error: %s", err)
+	}
+
+	lis := bufconn.Listen(1 << 20)
+	server := newGRPCServer(config)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.DialContext(ctx, "bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("Couldn't dial the gRPC server: %s", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	kv := etcdserverpb.NewKVClient(conn)
+
+	for _, key := range []string{"app/a", "app/b", "other"} {
+		if _, err := kv.Put(ctx, &etcdserverpb.PutRequest{Key: []byte(key), Value: []byte("v-" + key)}); err != nil {
+			t.Fatalf("Put(%s) returned unexpected error: %s", key, err)
+		}
+	}
+	put, err := kv.Put(ctx, &etcdserverpb.PutRequest{Key: []byte("app/a"), Value: []byte("new"), PrevKv: true})
+	if err != nil {
+		t.Fatalf("Put returned unexpected error: %s", err)
+	}
+	if put.PrevKv == nil || string(put.PrevKv.Value) != "v-app/a" || put.Header.Revision == 0 {
+		t.Errorf("Put = %v, expected the previous value and a revision", put)
+	}
+
+	// etcdctl get --prefix app/ --sort-order=DESCEND --limit=1
+	got, err := kv.Range(ctx, &etcdserverpb.RangeRequest{
+		Key:       []byte("app/"),
+		RangeEnd:  []byte("app0"),
+		Limit:     1,
+		SortOrder: etcdserverpb.RangeRequest_DESCEND,
+	})
+	if err != nil {
+		t.Fatalf("Range returned unexpected error: %s", err)
+	}
+	if got.Count != 2 || !got.More || len(got.Kvs) != 1 || string(got.Kvs[0].Key) != "app/b" {
+		t.Errorf("Range = %v, expected app/b of 2 keys", got)
+	}
+
+	txn, err := kv.Txn(ctx, &etcdserverpb.TxnRequest{
+		Compare: []*etcdserverpb.Compare{{
+			Key:         []byte("lock"),
+			Target:      etcdserverpb.Compare_VERSION,
+			Result:      etcdserverpb.Compare_EQUAL,
+			TargetUnion: &etcdserverpb.Compare_Version{Version: 0},
+		}},
+		Success: []*etcdserverpb.RequestOp{{Request: &etcdserverpb.RequestOp_RequestPut{
+			RequestPut: &etcdserverpb.PutRequest{Key: []byte("lock"), Value: []byte("held")},
+		}}},
+		Failure: []*etcdserverpb.RequestOp{{Request: &etcdserverpb.RequestOp_RequestRange{
+			RequestRange: &etcdserverpb.RangeRequest{Key: []byte("lock")},
+		}}},
+	})
+	if err != nil {
+		t.Fatalf("Txn returned unexpected error: %s", err)
+	}
+	if !txn.Succeeded || txn.Responses[0].GetResponsePut() == nil {
+		t.Errorf("Txn = %v, expected the lock taken", txn)
+	}
+
+	deleted, err := kv.DeleteRange(ctx, &etcdserverpb.DeleteRangeRequest{Key: []byte("\x00"), RangeEnd: []byte("\x00")})
+	if err != nil {
+		t.Fatalf("DeleteRange returned unexpected error: %s", err)
+	}
+	if deleted.Deleted != 4 {
+		t.Errorf("DeleteRange deleted %d keys, expected 4", deleted.Deleted)
+	}
+
+	if _, err := kv.Range(ctx, &etcdserverpb.RangeRequest{Key: []byte("a"), Revision: 3}); status.Code(err) != codes.Unimplemented {
+		t.Errorf("Range at a revision returned %v, expected Unimplemented", err)
+	}
+	if _, err := kv.Put(ctx, &etcdserverpb.PutRequest{Key: []byte("a"), Lease: 7}); status.Code(err) != codes.Unimplemented {
+		t.Errorf("Put with a lease returned %v, expected Unimplemented", err)
+	}
+}
+
+func TestEtcdRangePrefix(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		key, end, prefix string
+	}{
+		{"app/a", "", "app/a"},
+		{"app/", "app0", "app/"},
+		{"\x00", store.EndOfKeys, ""},
+		{"app/a", "app/m", "app/"},
+	}
+	for _, tc := range testCases {
+		if got := etcdRangePrefix(tc.key, tc.end); got != tc.prefix {
+			t.Errorf("etcdRangePrefix(%q, %q) = %q, want %q", tc.key, tc.end, got, tc.prefix)
+		}
+	}
+}
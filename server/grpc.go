@@ -0,0 +1,417 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/hashicorp/raft"
+	"github.com/maelfosso/key-value-store/kvpb"
+	"github.com/maelfosso/key-value-store/store"
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// newGRPCServer returns a gRPC server serving the KV and Admin services of
+// kvpb, and the KV service of etcd, from config. When authentication is on,
+// calls carry their token in the authorization metadata, as
+// "Bearer <token>", or in the token metadata etcd clients send.
+func newGRPCServer(config *store.Config, opts ...grpc.ServerOption) *grpc.Server {
+	opts = append(opts,
+		grpc.ChainUnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			ctx, err := authorize(ctx, config, info.FullMethod)
+			if err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.ChainStreamInterceptor(func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			ctx, err := authorize(ss.Context(), config, info.FullMethod)
+			if err != nil {
+				return err
+			}
+			return handler(srv, &authorizedStream{ServerStream: ss, ctx: ctx})
+		}),
+	)
+
+	s := grpc.NewServer(opts...)
+	kvpb.RegisterKVServer(s, &kvService{config: config})
+	kvpb.RegisterAdminServer(s, &adminService{config: config})
+	etcdserverpb.RegisterKVServer(s, &etcdKV{config: config})
+
+	return s
+}
+
+// kvService serves the key/value operations over gRPC. Unlike the HTTP API,
+// writes sent to a follower aren't forwarded: they fail with not_leader and
+// the leader in the kv-leader trailer.
+type kvService struct {
+	kvpb.UnimplementedKVServer
+	config *store.Config
+}
+
+func (s *kvService) Get(ctx context.Context, req *kvpb.GetRequest) (*kvpb.Entry, error) {
+	if err := s.checkDraining(); err != nil {
+		return nil, err
+	}
+
+	if err := s.config.CheckAccess(ctx, store.AccessRead, req.Key); err != nil {
+		return nil, grpcError(ctx, err)
+	}
+
+	if err := consistent(ctx, s.config, req.Consistency); err != nil {
+		return nil, err
+	}
+
+	e, found, err := s.config.LookupEntry(ctx, req.Key)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	if !found {
+		return nil, status.Errorf(codes.NotFound, "%q not found", req.Key)
+	}
+
+	return protoEntry(req.Key, e), nil
+}
+
+func (s *kvService) Set(ctx context.Context, req *kvpb.SetRequest) (*kvpb.WriteResponse, error) {
+	if err := s.checkDraining(); err != nil {
+		return nil, err
+	}
+
+	if err := s.config.CheckAccess(ctx, store.AccessWrite, req.Key); err != nil {
+		return nil, grpcError(ctx, err)
+	}
+
+	index, err := s.config.SetEntry(ctx, req.Key, store.Entry{
+		Value:       string(req.Value),
+		ContentType: req.ContentType,
+		Metadata:    req.Metadata,
+	})
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+
+	return &kvpb.WriteResponse{Index: index, Term: s.config.Term()}, nil
+}
+
+func (s *kvService) Delete(ctx context.Context, req *kvpb.DeleteRequest) (*kvpb.DeleteResponse, error) {
+	if err := s.checkDraining(); err != nil {
+		return nil, err
+	}
+
+	if err := s.config.CheckAccess(ctx, store.AccessWrite, req.Key); err != nil {
+		return nil, grpcError(ctx, err)
+	}
+
+	e, index, err := s.config.DeleteAndGet(ctx, req.Key)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+
+	return &kvpb.DeleteResponse{Entry: protoEntry(req.Key, e), Index: index, Term: s.config.Term()}, nil
+}
+
+func (s *kvService) List(req *kvpb.ListRequest, stream kvpb.KV_ListServer) error {
+	if err := s.checkDraining(); err != nil {
+		return err
+	}
+
+	if err := s.config.CheckAccess(stream.Context(), store.AccessRead, req.Prefix); err != nil {
+		return grpcError(stream.Context(), err)
+	}
+
+	if err := consistent(stream.Context(), s.config, req.Consistency); err != nil {
+		return err
+	}
+
+	cursor := ""
+	for {
+		page, err := s.config.List(stream.Context(), req.Prefix, cursor, store.MaxListLimit)
+		if err != nil {
+			return grpcError(stream.Context(), err)
+		}
+
+		// Keys deleted since the page was listed are skipped
+		entries, err := s.config.GetMany(stream.Context(), page.Keys)
+		if err != nil {
+			return grpcError(stream.Context(), err)
+		}
+		for _, key := range page.Keys {
+			e, ok := entries[key]
+			if !ok {
+				continue
+			}
+			if err := stream.Send(protoEntry(key, e)); err != nil {
+				return err
+			}
+		}
+
+		if page.Next == "" {
+			break
+		}
+		cursor = page.Next
+	}
+
+	return nil
+}
+
+// checkDraining rejects the requests sent to a draining node, like the HTTP
+// API does.
+func (s *kvService) checkDraining() error {
+	if s.config.Draining() {
+		return status.Error(codes.Unavailable, store.ErrDraining.Error())
+	}
+
+	return nil
+}
+
+// consistent returns once config can serve a read with the consistency
+// named c.
+func consistent(ctx context.Context, config *store.Config, c string) error {
+	consistency, err := store.ParseConsistency(c)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := config.Consistent(ctx, consistency); err != nil {
+		return grpcError(ctx, err)
+	}
+
+	return nil
+}
+
+// adminService serves the cluster administration over gRPC. Its calls aren't
+// forwarded either, they are answered by the node they are sent to.
+type adminService struct {
+	kvpb.UnimplementedAdminServer
+	config *store.Config
+}
+
+func (s *adminService) Status(ctx context.Context, req *kvpb.StatusRequest) (*kvpb.StatusResponse, error) {
+	st := s.config.Status()
+
+	resp := &kvpb.StatusResponse{
+		Id:           st.ID,
+		State:        st.State,
+		Leader:       st.Leader,
+		LeaderId:     st.LeaderID,
+		ReadOnly:     st.ReadOnly,
+		Draining:     st.Draining,
+		Ready:        st.Ready,
+		Term:         st.Term,
+		CommitIndex:  st.CommitIndex,
+		AppliedIndex: st.AppliedIndex,
+		LastIndex:    st.LastIndex,
+	}
+	if st.LastLeaderContact != nil {
+		resp.LastLeaderContact = timestamppb.New(*st.LastLeaderContact)
+	}
+	for _, p := range st.Peers {
+		resp.Peers = append(resp.Peers, &kvpb.Peer{
+			Id:          p.ID,
+			Address:     p.Address,
+			RaftAddress: p.RaftAddress,
+			Voter:       p.Voter,
+			Leader:      p.Leader,
+		})
+	}
+
+	return resp, nil
+}
+
+func (s *adminService) AddServer(ctx context.Context, req *kvpb.AddServerRequest) (*kvpb.AddServerResponse, error) {
+	if req.Id == "" || req.Address == "" {
+		return nil, status.Error(codes.InvalidArgument, "the id and the address of the node are required")
+	}
+
+	err := s.config.AddServer(raft.ServerID(req.Id), raft.ServerAddress(req.Address), req.NonVoter)
+	if errors.Is(err, raft.ErrNotLeader) {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	} else if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &kvpb.AddServerResponse{}, nil
+}
+
+func (s *adminService) RemoveServer(ctx context.Context, req *kvpb.RemoveServerRequest) (*kvpb.RemoveServerResponse, error) {
+	if req.Id == "" {
+		return nil, status.Error(codes.InvalidArgument, "the id of the node is required")
+	}
+
+	if err := s.config.RemoveServer(raft.ServerID(req.Id)); err != nil {
+		return nil, grpcError(ctx, err)
+	}
+
+	return &kvpb.RemoveServerResponse{}, nil
+}
+
+func (s *adminService) PromoteServer(ctx context.Context, req *kvpb.PromoteServerRequest) (*kvpb.PromoteServerResponse, error) {
+	if req.Id == "" {
+		return nil, status.Error(codes.InvalidArgument, "the id of the node is required")
+	}
+
+	if err := s.config.PromoteServer(raft.ServerID(req.Id)); err != nil {
+		return nil, grpcError(ctx, err)
+	}
+
+	return &kvpb.PromoteServerResponse{}, nil
+}
+
+func (s *adminService) DemoteServer(ctx context.Context, req *kvpb.DemoteServerRequest) (*kvpb.DemoteServerResponse, error) {
+	if req.Id == "" {
+		return nil, status.Error(codes.InvalidArgument, "the id of the node is required")
+	}
+
+	if err := s.config.DemoteServer(raft.ServerID(req.Id)); err != nil {
+		return nil, grpcError(ctx, err)
+	}
+
+	return &kvpb.DemoteServerResponse{}, nil
+}
+
+func (s *adminService) Compact(ctx context.Context, req *kvpb.CompactRequest) (*kvpb.CompactResponse, error) {
+	result, err := s.config.Compact()
+	if errors.Is(err, store.ErrNothingToCompact) {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	} else if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &kvpb.CompactResponse{
+		At:               timestamppb.New(result.At),
+		Index:            result.Index,
+		CompactedEntries: result.CompactedEntries,
+		ReclaimedBytes:   result.ReclaimedBytes,
+	}, nil
+}
+
+func (s *adminService) Drain(ctx context.Context, req *kvpb.DrainRequest) (*kvpb.DrainResponse, error) {
+	s.config.Drain()
+	return &kvpb.DrainResponse{}, nil
+}
+
+func (s *adminService) Undrain(ctx context.Context, req *kvpb.DrainRequest) (*kvpb.DrainResponse, error) {
+	s.config.Undrain()
+	return &kvpb.DrainResponse{}, nil
+}
+
+// grpcRoles are the roles the gRPC methods require, the methods not listed
+// require store.RoleAdmin.
+var grpcRoles = map[string]store.Role{
+	kvpb.KV_Get_FullMethodName:       store.RoleRead,
+	kvpb.KV_List_FullMethodName:      store.RoleRead,
+	kvpb.KV_Set_FullMethodName:       store.RoleWrite,
+	kvpb.KV_Delete_FullMethodName:    store.RoleWrite,
+	kvpb.Admin_Status_FullMethodName: store.RoleRead,
+
+	"/etcdserverpb.KV/Range":       store.RoleRead,
+	"/etcdserverpb.KV/Put":         store.RoleWrite,
+	"/etcdserverpb.KV/DeleteRange": store.RoleWrite,
+	"/etcdserverpb.KV/Txn":         store.RoleWrite,
+}
+
+// authorize checks the bearer token of the authorization metadata of ctx
+// allows method, and returns ctx carrying its principal.
+func authorize(ctx context.Context, config *store.Config, method string) (context.Context, error) {
+	if !config.AuthEnabled() {
+		return ctx, nil
+	}
+
+	required, ok := grpcRoles[method]
+	if !ok {
+		required = store.RoleAdmin
+	}
+
+	var token string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("authorization"); len(values) > 0 {
+			if fields := strings.Fields(values[0]); len(fields) == 2 && strings.EqualFold(fields[0], "Bearer") {
+				token = fields[1]
+			}
+		} else if values := md.Get("token"); len(values) > 0 {
+			token = values[0]
+		}
+	}
+
+	p, err := config.Authorize(ctx, token, required)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+
+	return store.WithPrincipal(ctx, p), nil
+}
+
+// authorizedStream is a stream whose context carries the principal of the
+// call.
+type authorizedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authorizedStream) Context() context.Context {
+	return s.ctx
+}
+
+// protoEntry converts the entry e at key to its kvpb message.
+func protoEntry(key string, e store.Entry) *kvpb.Entry {
+	pe := &kvpb.Entry{Key: key, Value: []byte(e.Value), ContentType: e.ContentType, Metadata: e.Metadata, Revision: e.Revision}
+	if !e.ExpiresAt.IsZero() {
+		pe.ExpiresAt = timestamppb.New(e.ExpiresAt)
+	}
+
+	return pe
+}
+
+// grpcError maps err to the gRPC status describing it, setting the
+// kv-error-code trailer to the code the HTTP API would answer with, and the
+// kv-leader trailer to the leader of not_leader errors.
+func grpcError(ctx context.Context, err error) error {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	}
+
+	apiErr := toAPIError(err)
+	md := metadata.Pairs("kv-error-code", apiErr.Code)
+	if apiErr.Leader != "" {
+		md.Append("kv-leader", apiErr.Leader)
+	}
+	grpc.SetTrailer(ctx, md)
+
+	return status.Error(grpcCode(apiErr), apiErr.Message)
+}
+
+// grpcCode returns the gRPC code matching the HTTP status of err.
+func grpcCode(err *APIError) codes.Code {
+	switch err.Status {
+	case http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType, http.StatusUnprocessableEntity:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict, http.StatusPreconditionFailed:
+		if err.Code == CodeKeyExists || err.Code == CodeKeysExist {
+			return codes.AlreadyExists
+		}
+		return codes.FailedPrecondition
+	case http.StatusTooManyRequests, http.StatusInsufficientStorage:
+		return codes.ResourceExhausted
+	case http.StatusMisdirectedRequest, http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	default:
+		return codes.Internal
+	}
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/maelfosso/key-value-store/kvpb"
+	"github.com/maelfosso/key-value-store/store"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestGRPC(t *testing.T) {
+	ctx := context.Background()
+	config, err := store.NewStandalone(t.TempDir(), store.WithLogger(hclog.NewNullLogger()))
+	if err != nil {
+		t.Fatalf("NewStandalone returned unexpected error: %s", err)
+	}
+
+	lis := bufconn.Listen(1 << 20)
+	server := newGRPCServer(config)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.DialContext(ctx, "bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("Couldn't dial the gRPC server: %s", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	kv, admin := kvpb.NewKVClient(conn), kvpb.NewAdminClient(conn)
+
+	for _, key := range []string{"b", "a", "other"} {
+		if _, err := kv.Set(ctx, &kvpb.SetRequest{Key: key, Value: []byte("v-" + key), ContentType: "text/plain"}); err != nil {
+			t.Fatalf("Set(%s) returned unexpected error: %s", key, err)
+		}
+	}
+
+	e, err := kv.Get(ctx, &kvpb.GetRequest{Key: "a"})
+	if err != nil {
+		t.Fatalf("Get returned unexpected error: %s", err)
+	}
+	if string(e.Value) != "v-a" || e.ContentType != "text/plain" {
+		t.Errorf("Get(a) = %q %q, want v-a text/plain", e.Value, e.ContentType)
+	}
+
+	stream, err := kv.List(ctx, &kvpb.ListRequest{Prefix: ""})
+	if err != nil {
+		t.Fatalf("List returned unexpected error: %s", err)
+	}
+	var keys []string
+	for {
+		e, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("List stream failed: %s", err)
+		}
+		keys = append(keys, e.Key)
+	}
+	if len(keys) != 3 || keys[0] != "a" || keys[1] != "b" || keys[2] != "other" {
+		t.Errorf("List streamed %v, want a, b and other in order", keys)
+	}
+
+	deleted, err := kv.Delete(ctx, &kvpb.DeleteRequest{Key: "a"})
+	if err != nil {
+		t.Fatalf("Delete returned unexpected error: %s", err)
+	}
+	if string(deleted.Entry.Value) != "v-a" {
+		t.Errorf("Delete returned %q, want the deleted value", deleted.Entry.Value)
+	}
+
+	var trailer metadata.MD
+	_, err = kv.Delete(ctx, &kvpb.DeleteRequest{Key: "a"}, grpc.Trailer(&trailer))
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("Deleting a missing key returned %v, want NotFound", err)
+	}
+	if got := trailer.Get("kv-error-code"); len(got) != 1 || got[0] != CodeNotFound {
+		t.Errorf("kv-error-code trailer is %v, want %s", got, CodeNotFound)
+	}
+
+	if _, err := admin.Drain(ctx, &kvpb.DrainRequest{}); err != nil {
+		t.Fatalf("Drain returned unexpected error: %s", err)
+	}
+	if st, err := admin.Status(ctx, &kvpb.StatusRequest{}); err != nil || !st.Draining {
+		t.Errorf("Status after Drain = %v, %v, want draining", st, err)
+	}
+	if _, err := kv.Get(ctx, &kvpb.GetRequest{Key: "b"}); status.Code(err) != codes.Unavailable {
+		t.Errorf("Get on a draining node returned %v, want Unavailable", err)
+	}
+}
+
+func TestGRPCCode(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		err  error
+		code codes.Code
+	}{
+		{store.ErrNotFound, codes.NotFound},
+		{store.ErrKeyExists, codes.AlreadyExists},
+		{store.ErrConditionFailed, codes.FailedPrecondition},
+		{store.ErrInvalidKey, codes.InvalidArgument},
+		{store.ErrReadOnly, codes.PermissionDenied},
+		{store.ErrTooManyWrites, codes.ResourceExhausted},
+		{store.ErrNotLeader, codes.Unavailable},
+		{io.ErrUnexpectedEOF, codes.Internal},
+	}
+
+	for _, test := range testCases {
+		if got := grpcCode(toAPIError(test.err)); got != test.code {
+			t.Errorf("grpcCode(%v) = %s, want %s", test.err, got, test.code)
+		}
+	}
+}
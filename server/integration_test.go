@@ -0,0 +1,261 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/maelfosso/key-value-store/store"
+)
+
+// testNode is a node started with Raft and its HTTP API listening, so
+// requests go the whole way a client's do: through the handlers, Raft and
+// the FSM.
+type testNode struct {
+	*Server
+	url string
+}
+
+// startTestNode starts a node bootstrapping a cluster of its own, and waits
+// for it to lead.
+func startTestNode(t *testing.T) *testNode {
+	t.Helper()
+
+	n := newTestNode(t, freePort(t), "")
+	n.waitForState(t, "Leader")
+
+	return n
+}
+
+// joinTestNode starts a node joining the cluster of leader with the store
+// options opts, and waits for it to follow.
+func joinTestNode(t *testing.T, leader *testNode, opts ...store.Option) *testNode {
+	t.Helper()
+
+	n := newTestNode(t, freePort(t), leader.url, opts...)
+	n.waitForState(t, "Follower")
+
+	return n
+}
+
+// newTestNode starts a node joining the cluster through raftLeader, or
+// bootstrapping one when it is empty, with the store options opts. Its HTTP
+// API listens on port, known before it starts, so it records it in the
+// cluster.
+func newTestNode(t *testing.T, port, raftLeader string, opts ...store.Option) *testNode {
+	t.Helper()
+
+	s, err := New(
+		WithStoragePath(t.TempDir()),
+		WithRaftAddress("127.0.0.1", freePort(t)),
+		WithListenAddr("127.0.0.1:"+port),
+		WithRaftLeader(raftLeader),
+		WithGRPCAddr("127.0.0.1:0"),
+		WithLogger(hclog.NewNullLogger()),
+		WithStoreOptions(append([]store.Option{
+			store.WithHeartbeatTimeout(50 * time.Millisecond),
+			store.WithElectionTimeout(50 * time.Millisecond),
+			store.WithLeaderLeaseTimeout(50 * time.Millisecond),
+		}, opts...)...),
+	)
+	if err != nil {
+		t.Fatalf("New returned unexpected error: %s", err)
+	}
+	if err := s.Start(); err != nil {
+		t.Fatalf("Start returned unexpected error: %s", err)
+	}
+	t.Cleanup(func() { s.Stop(context.Background()) })
+
+	return &testNode{Server: s, url: "http://" + s.Addr().String()}
+}
+
+// waitForState waits for the node to be in the Raft state.
+func (n *testNode) waitForState(t *testing.T, state string) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for n.Config().Status().State != state {
+		if time.Now().After(deadline) {
+			t.Fatalf("The node isn't %s in time", state)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// freePort returns a TCP port nothing listens on.
+func freePort(t *testing.T) string {
+	t.Helper()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Couldn't find a free port: %s", err)
+	}
+	defer lis.Close()
+
+	_, port, _ := net.SplitHostPort(lis.Addr().String())
+	return port
+}
+
+// do sends a request to the node and returns the status and body of the
+// answer.
+func (n *testNode) do(t *testing.T, method, path, body string) (int, string) {
+	t.Helper()
+
+	req, err := http.NewRequest(method, n.url+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Couldn't build the request: %s", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s failed: %s", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Couldn't read the answer to %s %s: %s", method, path, err)
+	}
+
+	return resp.StatusCode, string(b)
+}
+
+func TestIntegrationSetGetDelete(t *testing.T) {
+	n := startTestNode(t)
+
+	steps := []struct {
+		method, path, body string
+		status             int
+		response           string
+	}{
+		{http.MethodPost, "/key/foo", "bar", http.StatusOK, `"status":"success"`},
+		{http.MethodPost, "/key/other", "kept", http.StatusOK, `"status":"success"`},
+		{http.MethodGet, "/key/foo", "", http.StatusOK, "bar"},
+		{http.MethodDelete, "/key/foo", "", http.StatusOK, `"status":"success"`},
+		{http.MethodGet, "/key/foo", "", http.StatusNotFound, `"code":"not_found"`},
+		{http.MethodHead, "/key/foo", "", http.StatusNotFound, ""},
+		{http.MethodGet, "/key/other", "", http.StatusOK, "kept"},
+		{http.MethodHead, "/key/other", "", http.StatusOK, ""},
+		{http.MethodPost, "/key/empty", "", http.StatusOK, `"status":"success"`},
+		{http.MethodGet, "/key/empty", "", http.StatusOK, ""},
+	}
+	for _, step := range steps {
+		status, body := n.do(t, step.method, step.path, step.body)
+		// Reads answer the value itself, the others a JSON result
+		matches := strings.Contains(body, step.response)
+		if step.method != http.MethodPost && step.method != http.MethodDelete && status == http.StatusOK {
+			matches = body == step.response
+		}
+		if status != step.status || !matches {
+			t.Errorf("%s %s: Got %d %s, expected %d with %s", step.method, step.path, status, body, step.status, step.response)
+		}
+	}
+
+	// The FSM itself no longer holds the key
+	if e, err := n.Config().GetEntry(context.Background(), "foo"); err != nil || e.Value != "" {
+		t.Errorf("Got %q, %v from the store once deleted, expected nothing", e.Value, err)
+	}
+}
+
+func TestIntegrationForwardToLeader(t *testing.T) {
+	leader := startTestNode(t)
+	follower := joinTestNode(t, leader)
+	reader := joinTestNode(t, leader, store.WithFollowerReads())
+
+	if status, body := follower.do(t, http.MethodPost, "/key/foo", "bar"); status != http.StatusOK {
+		t.Fatalf("Got %d %s writing through a follower, expected the write forwarded", status, body)
+	}
+	if v, _ := leader.Config().Get(context.Background(), "foo"); v != "bar" {
+		t.Errorf("Got %q from the leader, expected the forwarded write", v)
+	}
+	if status, body := follower.do(t, http.MethodGet, "/key/foo", ""); status != http.StatusOK || body != "bar" {
+		t.Errorf("Got %d %s reading through a follower, expected bar", status, body)
+	}
+
+	// The status of the followers names the HTTP address the leader recorded
+	if got := follower.Config().Status().Leader; got != leader.url {
+		t.Errorf("Got leader %s, expected %s", got, leader.url)
+	}
+
+	// A node with follower reads answers reads itself, once it applied the
+	// write
+	index := follower.Config().Status().CommitIndex
+	if err := reader.Config().WaitForIndex(context.Background(), index, 5*time.Second); err != nil {
+		t.Fatalf("WaitForIndex returned unexpected error: %s", err)
+	}
+	leader.Config().Set(context.Background(), "foo", "from leader")
+	if status, body := reader.do(t, http.MethodGet, "/key/foo", ""); status != http.StatusOK || (body != "bar" && body != "from leader") {
+		t.Errorf("Got %d %s reading from a follower, expected a value of foo", status, body)
+	}
+	if status, body := reader.do(t, http.MethodGet, "/key/foo?consistency=linearizable", ""); status != http.StatusOK || body != "from leader" {
+		t.Errorf("Got %d %s for a linearizable read, expected the latest value", status, body)
+	}
+}
+
+func TestIntegrationAdvertisedRaftAddress(t *testing.T) {
+	leader := startTestNode(t)
+
+	// The transport listens on 127.0.0.1, the other nodes dial localhost
+	port := freePort(t)
+	follower := joinTestNode(t, leader, store.WithRaftBindAddress("127.0.0.1:"+port), store.WithRaftAdvertiseAddress("localhost:"+port))
+
+	var found bool
+	for _, p := range leader.Config().Status().Peers {
+		if p.ID == follower.Config().Status().ID {
+			found = true
+			if p.RaftAddress != "localhost:"+port || p.Address != follower.url {
+				t.Errorf("Got peer %+v, expected Raft address localhost:%s and HTTP address %s", p, port, follower.url)
+			}
+		}
+	}
+	if !found {
+		t.Fatal("The leader doesn't list the follower")
+	}
+
+	if status, body := follower.do(t, http.MethodPost, "/key/foo", "bar"); status != http.StatusOK {
+		t.Errorf("Got %d %s writing through the follower, expected the write forwarded", status, body)
+	}
+}
+
+func TestIntegrationDiscovery(t *testing.T) {
+	var ports []string
+	var seeds store.StaticSeeds
+	for i := 0; i < 3; i++ {
+		port := freePort(t)
+		ports = append(ports, port)
+		seeds = append(seeds, "127.0.0.1:"+port)
+	}
+
+	// Every node is started the same way, none is told who to join
+	var nodes []*testNode
+	for _, port := range ports {
+		nodes = append(nodes, newTestNode(t, port, "", store.WithDiscovery(seeds, len(seeds))))
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for _, n := range nodes {
+		for n.Config().Status().Leader == "" || len(n.Config().Status().Peers) != len(nodes) {
+			if time.Now().After(deadline) {
+				t.Fatalf("Node %s isn't in a cluster of %d in time: %+v", n.url, len(nodes), n.Config().Status())
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	// A single cluster of every node, not clusters bootstrapped apart
+	for _, n := range nodes {
+		ids := make(map[string]bool)
+		for _, p := range n.Config().Status().Peers {
+			ids[p.ID] = true
+		}
+		for _, other := range nodes {
+			if id := other.Config().Status().ID; !ids[id] {
+				t.Errorf("Node %s doesn't list %s among its peers", n.url, id)
+			}
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package server
+
+import (
+	"crypto/tls"
+	"net/http"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/maelfosso/key-value-store/store"
+)
+
+// Defaults of the options of a Server.
+const (
+	DefaultStoragePath = "/tmp/kv"
+	DefaultListenAddr  = ":8080"
+	DefaultGRPCAddr    = ":8082"
+	DefaultRaftHost    = "localhost"
+	DefaultRaftPort    = "8081"
+)
+
+// Option configures a Server built by New.
+type Option func(*options)
+
+type options struct {
+	storagePath string
+	listenAddr  string
+	advertise   string
+	grpcAddr    string
+	respAddr    string
+	raftHost    string
+	raftPort    string
+	raftLeader  string
+	standalone  bool
+	certificate *tls.Certificate
+	logger      hclog.Logger
+	storeOpts   []store.Option
+
+	missingKeyStatus  int
+	rejectEmptyValues bool
+	gzipMinSize       int
+}
+
+// WithStoragePath keeps the data of the node under path, DefaultStoragePath
+// by default.
+func WithStoragePath(path string) Option {
+	return func(o *options) {
+		o.storagePath = path
+	}
+}
+
+// WithListenAddr serves the HTTP API on addr, DefaultListenAddr by default.
+func WithListenAddr(addr string) Option {
+	return func(o *options) {
+		o.listenAddr = addr
+	}
+}
+
+// WithAdvertiseAddr has the other nodes reach the HTTP API at addr, a URL or
+// a host and port, when it differs from the listen address, like behind NAT
+// or a container port mapping. By default nodes advertise the listen address,
+// on the Raft host when it listens on every interface.
+func WithAdvertiseAddr(addr string) Option {
+	return func(o *options) {
+		o.advertise = addr
+	}
+}
+
+// WithGRPCAddr serves the gRPC API on addr, DefaultGRPCAddr by default.
+func WithGRPCAddr(addr string) Option {
+	return func(o *options) {
+		o.grpcAddr = addr
+	}
+}
+
+// WithRESPAddr serves the subset of the Redis protocol on addr, it is off by
+// default.
+func WithRESPAddr(addr string) Option {
+	return func(o *options) {
+		o.respAddr = addr
+	}
+}
+
+// WithRaftAddress has the node reach its peers, and be reached by them, on
+// host and port, DefaultRaftHost and DefaultRaftPort by default.
+func WithRaftAddress(host, port string) Option {
+	return func(o *options) {
+		o.raftHost, o.raftPort = host, port
+	}
+}
+
+// WithRaftLeader joins the cluster of the node whose HTTP API is at addr,
+// instead of bootstrapping a new one.
+func WithRaftLeader(addr string) Option {
+	return func(o *options) {
+		o.raftLeader = addr
+	}
+}
+
+// WithStandalone runs a single node without Raft, see store.NewStandalone.
+func WithStandalone() Option {
+	return func(o *options) {
+		o.standalone = true
+	}
+}
+
+// WithTLS serves the HTTP and gRPC APIs over TLS with cert.
+func WithTLS(cert tls.Certificate) Option {
+	return func(o *options) {
+		o.certificate = &cert
+	}
+}
+
+// WithLogger logs through logger instead of hclog.Default(). The store logs
+// through it too, unless WithStoreOptions sets its own.
+func WithLogger(logger hclog.Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// WithStoreOptions configures the store of the node with opts.
+func WithStoreOptions(opts ...store.Option) Option {
+	return func(o *options) {
+		o.storeOpts = append(o.storeOpts, opts...)
+	}
+}
+
+// WithMissingKeyStatus answers a GET of a missing key with status, see
+// ParseMissingKeyStatus, 404 and a not_found error by default.
+func WithMissingKeyStatus(status int) Option {
+	return func(o *options) {
+		o.missingKeyStatus = status
+	}
+}
+
+// WithRejectEmptyValues rejects the writes of an empty value unless they set
+// allowempty=true.
+func WithRejectEmptyValues() Option {
+	return func(o *options) {
+		o.rejectEmptyValues = true
+	}
+}
+
+// WithGzipMinSize compresses the values from size bytes for the clients
+// accepting gzip, 1024 by default, zero turning compression off.
+func WithGzipMinSize(size int) Option {
+	return func(o *options) {
+		o.gzipMinSize = size
+	}
+}
+
+func newOptions(opts []Option) options {
+	o := options{
+		storagePath:      DefaultStoragePath,
+		listenAddr:       DefaultListenAddr,
+		grpcAddr:         DefaultGRPCAddr,
+		raftHost:         DefaultRaftHost,
+		raftPort:         DefaultRaftPort,
+		logger:           hclog.Default(),
+		missingKeyStatus: http.StatusNotFound,
+		gzipMinSize:      defaultGzipMinSize,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return o
+}
@@ -0,0 +1,610 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/maelfosso/key-value-store/store"
+)
+
+const (
+	// respBufferSize is the read buffer of a RESP connection, which bounds
+	// the length of a line: an inline command or the header of a bulk string.
+	respBufferSize = 64 << 10
+
+	// respMaxArgs is the most arguments a RESP command can have.
+	respMaxArgs = 1 << 16
+)
+
+// errRESPProtocol is returned when a RESP client sends something that isn't
+// a command, the connection can't be read any further.
+var errRESPProtocol = errors.New("protocol error")
+
+// respServer serves a subset of the Redis protocol, RESP, so Redis clients and
+// tools can use the store: GET, SET with EX, PX and NX, DEL, EXISTS, KEYS and
+// TTL, along with PING, ECHO, SELECT 0, AUTH and QUIT. Like over gRPC, reads
+// are served from the data of the node and writes sent to a follower aren't
+// forwarded: they fail with NOT_LEADER and the address of the leader.
+type respServer struct {
+	config *store.Config
+	lis    net.Listener
+
+	mu     sync.Mutex
+	conns  map[net.Conn]struct{}
+	closed bool
+}
+
+func newRESPServer(config *store.Config, lis net.Listener) *respServer {
+	return &respServer{config: config, lis: lis, conns: map[net.Conn]struct{}{}}
+}
+
+// Serve accepts connections until Close is called.
+func (s *respServer) Serve() error {
+	for {
+		conn, err := s.lis.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return nil
+			}
+
+			return err
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return nil
+		}
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		go s.serveConn(conn)
+	}
+}
+
+// Close stops accepting connections and closes the open ones, cutting short
+// the commands they run: a write already submitted is still applied.
+func (s *respServer) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	for conn := range s.conns {
+		conn.Close()
+	}
+
+	return s.lis.Close()
+}
+
+// respConn is a client connection, with the token it authenticated with.
+type respConn struct {
+	r     *bufio.Reader
+	w     *bufio.Writer
+	token string
+}
+
+func (s *respServer) serveConn(conn net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	c := &respConn{r: bufio.NewReaderSize(conn, respBufferSize), w: bufio.NewWriter(conn)}
+	for {
+		args, err := readRESPCommand(c.r)
+		if errors.Is(err, errRESPProtocol) {
+			c.writeError("ERR", err.Error())
+			c.w.Flush()
+			return
+		} else if err != nil {
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		quit := s.exec(c, args)
+
+		// Replies to pipelined commands are sent together
+		if quit || c.r.Buffered() == 0 {
+			if err := c.w.Flush(); err != nil || quit {
+				return
+			}
+		}
+	}
+}
+
+// respCommand is a command of respServer taking between minArgs and maxArgs
+// arguments, as many as it is given when maxArgs is negative. Commands with a
+// role need a token allowing it when authentication is on.
+type respCommand struct {
+	minArgs, maxArgs int
+	role             store.Role
+	run              func(s *respServer, ctx context.Context, c *respConn, args []string) error
+}
+
+var respCommands = map[string]respCommand{
+	"PING":   {0, 1, "", respPing},
+	"ECHO":   {1, 1, "", respEcho},
+	"QUIT":   {0, 0, "", respQuit},
+	"SELECT": {1, 1, "", respSelect},
+	"AUTH":   {1, 2, "", respAuth},
+	"GET":    {1, 1, store.RoleRead, respGet},
+	"EXISTS": {1, -1, store.RoleRead, respExists},
+	"KEYS":   {1, 1, store.RoleRead, respKeys},
+	"TTL":    {1, 1, store.RoleRead, respTTL},
+	"SET":    {2, 7, store.RoleWrite, respSet},
+	"DEL":    {1, -1, store.RoleWrite, respDel},
+	"INCR":   {1, 1, store.RoleWrite, respIncr},
+	"INCRBY": {2, 2, store.RoleWrite, respIncr},
+	"DECR":   {1, 1, store.RoleWrite, respDecr},
+	"DECRBY": {2, 2, store.RoleWrite, respDecr},
+}
+
+// exec runs the command args and reports whether the client quits.
+func (s *respServer) exec(c *respConn, args []string) bool {
+	name := strings.ToUpper(args[0])
+	cmd, ok := respCommands[name]
+	if !ok {
+		c.writeError("ERR", fmt.Sprintf("unknown command '%s'", args[0]))
+		return false
+	}
+
+	args = args[1:]
+	if len(args) < cmd.minArgs || (cmd.maxArgs >= 0 && len(args) > cmd.maxArgs) {
+		c.writeError("ERR", fmt.Sprintf("wrong number of arguments for '%s' command", strings.ToLower(name)))
+		return false
+	}
+
+	ctx := context.Background()
+	if cmd.role != "" {
+		if s.config.Draining() {
+			c.writeStoreError(store.ErrDraining)
+			return false
+		}
+
+		p, err := s.config.Authorize(ctx, c.token, cmd.role)
+		if err != nil {
+			c.writeStoreError(err)
+			return false
+		}
+		ctx = store.WithPrincipal(ctx, p)
+	}
+
+	if err := cmd.run(s, ctx, c, args); err != nil {
+		c.writeStoreError(err)
+	}
+
+	return name == "QUIT"
+}
+
+func respPing(s *respServer, ctx context.Context, c *respConn, args []string) error {
+	if len(args) == 1 {
+		c.writeBulk(args[0])
+		return nil
+	}
+
+	c.writeSimple("PONG")
+	return nil
+}
+
+func respEcho(s *respServer, ctx context.Context, c *respConn, args []string) error {
+	c.writeBulk(args[0])
+	return nil
+}
+
+func respQuit(s *respServer, ctx context.Context, c *respConn, args []string) error {
+	c.writeSimple("OK")
+	return nil
+}
+
+// respSelect accepts the only database, 0, which clients select on connect.
+func respSelect(s *respServer, ctx context.Context, c *respConn, args []string) error {
+	if args[0] != "0" {
+		c.writeError("ERR", "DB index is out of range")
+		return nil
+	}
+
+	c.writeSimple("OK")
+	return nil
+}
+
+// respAuth authenticates the connection with a token, given as the password:
+// AUTH <token>, or AUTH <user> <token> where the user is ignored.
+func respAuth(s *respServer, ctx context.Context, c *respConn, args []string) error {
+	token := args[len(args)-1]
+	if _, err := s.config.Authorize(ctx, token, store.RoleRead); err != nil {
+		return err
+	}
+
+	c.token = token
+	c.writeSimple("OK")
+	return nil
+}
+
+func respGet(s *respServer, ctx context.Context, c *respConn, args []string) error {
+	if err := s.config.CheckAccess(ctx, store.AccessRead, args[0]); err != nil {
+		return err
+	}
+
+	e, found, err := s.config.LookupEntry(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	if !found {
+		c.writeNull()
+		return nil
+	}
+
+	c.writeBulk(e.Value)
+	return nil
+}
+
+func respExists(s *respServer, ctx context.Context, c *respConn, args []string) error {
+	if err := s.config.CheckAccess(ctx, store.AccessRead, args...); err != nil {
+		return err
+	}
+
+	exists, err := s.config.Exists(ctx, args)
+	if err != nil {
+		return err
+	}
+
+	// A key given twice is counted twice
+	n := 0
+	for _, key := range args {
+		if exists[key] {
+			n++
+		}
+	}
+
+	c.writeInteger(int64(n))
+	return nil
+}
+
+// respKeys lists the keys matching a glob pattern, reading the keys that
+// start with the pattern up to its first wildcard.
+func respKeys(s *respServer, ctx context.Context, c *respConn, args []string) error {
+	pattern, err := globRegexp(args[0])
+	if err != nil {
+		c.writeError("ERR", fmt.Sprintf("invalid pattern: %s", err))
+		return nil
+	}
+
+	prefix := args[0]
+	if i := strings.IndexAny(prefix, `*?[\`); i >= 0 {
+		prefix = prefix[:i]
+	}
+	if err := s.config.CheckAccess(ctx, store.AccessRead, prefix); err != nil {
+		return err
+	}
+
+	keys := []string{}
+	cursor := ""
+	for {
+		page, err := s.config.List(ctx, prefix, cursor, store.MaxListLimit)
+		if err != nil {
+			return err
+		}
+		for _, key := range page.Keys {
+			if pattern.MatchString(key) {
+				keys = append(keys, key)
+			}
+		}
+
+		if page.Next == "" {
+			break
+		}
+		cursor = page.Next
+	}
+
+	c.writeArray(keys)
+	return nil
+}
+
+// respTTL answers the seconds left before a key expires, -1 for a key that
+// never does and -2 for a missing key.
+func respTTL(s *respServer, ctx context.Context, c *respConn, args []string) error {
+	if err := s.config.CheckAccess(ctx, store.AccessRead, args[0]); err != nil {
+		return err
+	}
+
+	e, found, err := s.config.LookupEntry(ctx, args[0])
+	if err != nil {
+		return err
+	}
+
+	switch left := time.Until(e.ExpiresAt); {
+	case !found:
+		c.writeInteger(-2)
+	case e.ExpiresAt.IsZero():
+		c.writeInteger(-1)
+	case left <= 0:
+		c.writeInteger(-2)
+	default:
+		c.writeInteger(int64(math.Round(left.Seconds())))
+	}
+
+	return nil
+}
+
+// respSet writes a key: SET <key> <value> [EX <seconds> | PX <milliseconds>]
+// [NX]. With NX, the key is only written if it is missing, the reply is then
+// null when it isn't.
+func respSet(s *respServer, ctx context.Context, c *respConn, args []string) error {
+	key, value := args[0], args[1]
+
+	var (
+		ttl time.Duration
+		nx  bool
+	)
+	for i := 2; i < len(args); i++ {
+		switch option := strings.ToUpper(args[i]); {
+		case option == "NX":
+			nx = true
+		case (option == "EX" || option == "PX") && ttl == 0 && i+1 < len(args):
+			n, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil || n <= 0 {
+				c.writeError("ERR", "invalid expire time in 'set' command")
+				return nil
+			}
+			unit := time.Second
+			if option == "PX" {
+				unit = time.Millisecond
+			}
+			ttl = time.Duration(n) * unit
+			i++
+		default:
+			c.writeError("ERR", "syntax error")
+			return nil
+		}
+	}
+
+	if err := s.config.CheckAccess(ctx, store.AccessWrite, key); err != nil {
+		return err
+	}
+
+	var err error
+	switch {
+	case nx:
+		_, err = s.config.SetBatchIfAbsent(ctx, map[string]store.BatchEntry{key: {Value: value, TTL: ttl}})
+		if errors.Is(err, store.ErrKeyExists) {
+			c.writeNull()
+			return nil
+		}
+	case ttl > 0:
+		_, err = s.config.SetBatchEntries(ctx, map[string]store.BatchEntry{key: {Value: value, TTL: ttl}})
+	default:
+		_, err = s.config.SetEntry(ctx, key, store.Entry{Value: value})
+	}
+	if err != nil {
+		return err
+	}
+
+	c.writeSimple("OK")
+	return nil
+}
+
+// respDel deletes keys and answers how many existed. Each key is deleted by
+// a write of its own.
+func respDel(s *respServer, ctx context.Context, c *respConn, args []string) error {
+	if err := s.config.CheckAccess(ctx, store.AccessWrite, args...); err != nil {
+		return err
+	}
+
+	n := 0
+	for _, key := range args {
+		_, _, err := s.config.DeleteAndGet(ctx, key)
+		if errors.Is(err, store.ErrNotFound) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		n++
+	}
+
+	c.writeInteger(int64(n))
+	return nil
+}
+
+// respIncr runs INCR key and INCRBY key delta.
+func respIncr(s *respServer, ctx context.Context, c *respConn, args []string) error {
+	return s.increment(ctx, c, args, 1)
+}
+
+// respDecr runs DECR key and DECRBY key delta.
+func respDecr(s *respServer, ctx context.Context, c *respConn, args []string) error {
+	return s.increment(ctx, c, args, -1)
+}
+
+// increment adds sign times the delta of args, 1 when they have none, to
+// the integer at their key and writes the result.
+func (s *respServer) increment(ctx context.Context, c *respConn, args []string, sign int64) error {
+	if err := s.config.CheckAccess(ctx, store.AccessWrite, args[0]); err != nil {
+		return err
+	}
+
+	delta := int64(1)
+	if len(args) == 2 {
+		n, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil || n == math.MinInt64 {
+			c.writeError("ERR", "value is not an integer or out of range")
+			return nil
+		}
+		delta = n
+	}
+
+	n, _, err := s.config.Increment(ctx, args[0], sign*delta)
+	if err != nil {
+		return err
+	}
+
+	c.writeInteger(n)
+	return nil
+}
+
+// readRESPCommand reads the next command, an array of bulk strings or an
+// inline command, split on spaces, as telnet sends.
+func readRESPCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readRESPLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		return strings.Fields(line), nil
+	}
+
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n > respMaxArgs {
+		return nil, fmt.Errorf("%w: invalid multibulk length", errRESPProtocol)
+	}
+	if n <= 0 {
+		return nil, nil
+	}
+
+	args := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		line, err := readRESPLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(line, "$") {
+			return nil, fmt.Errorf("%w: expected '$', got '%s'", errRESPProtocol, line)
+		}
+
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 || size > store.MaxValueSize {
+			return nil, fmt.Errorf("%w: invalid bulk length", errRESPProtocol)
+		}
+
+		bulk := make([]byte, size+2)
+		if _, err := io.ReadFull(r, bulk); err != nil {
+			return nil, err
+		}
+		if bulk[size] != '\r' || bulk[size+1] != '\n' {
+			return nil, fmt.Errorf("%w: bulk string isn't terminated by CRLF", errRESPProtocol)
+		}
+		args = append(args, string(bulk[:size]))
+	}
+
+	return args, nil
+}
+
+// readRESPLine reads a line, without its line ending.
+func readRESPLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		return "", fmt.Errorf("%w: too big inline request", errRESPProtocol)
+	} else if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(string(line), "\r\n"), nil
+}
+
+// globRegexp compiles the glob pattern of KEYS: * matches any run of
+// characters, ? any one, [abc], [^abc] and [a-z] one of a set and \ escapes
+// the next character.
+func globRegexp(pattern string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+
+	runes := []rune(pattern)
+	for i := 0; i < len(runes); i++ {
+		switch r := runes[i]; r {
+		case '*':
+			b.WriteString("(?s:.*)")
+		case '?':
+			b.WriteString("(?s:.)")
+		case '\\':
+			if i+1 < len(runes) {
+				i++
+			}
+			b.WriteString(regexp.QuoteMeta(string(runes[i])))
+		case '[':
+			b.WriteString("[")
+			i++
+			if i < len(runes) && runes[i] == '^' {
+				b.WriteString("^")
+				i++
+			}
+			for ; i < len(runes) && runes[i] != ']'; i++ {
+				switch {
+				case runes[i] == '-':
+					b.WriteString("-")
+				case runes[i] == '\\' && i+1 < len(runes):
+					i++
+					b.WriteString(regexp.QuoteMeta(string(runes[i])))
+				default:
+					b.WriteString(regexp.QuoteMeta(string(runes[i])))
+				}
+			}
+			if i == len(runes) {
+				return nil, errors.New("unterminated [")
+			}
+			b.WriteString("]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+func (c *respConn) writeSimple(s string) {
+	fmt.Fprintf(c.w, "+%s\r\n", s)
+}
+
+// writeError writes an error reply, starting with its code like Redis does.
+func (c *respConn) writeError(code, msg string) {
+	msg = strings.NewReplacer("\r", " ", "\n", " ").Replace(msg)
+	fmt.Fprintf(c.w, "-%s %s\r\n", code, msg)
+}
+
+// writeStoreError writes err with the code of the HTTP API in upper case, and
+// the leader a not_leader error names.
+func (c *respConn) writeStoreError(err error) {
+	apiErr := toAPIError(err)
+	msg := apiErr.Message
+	if apiErr.Leader != "" {
+		msg += ", leader at " + apiErr.Leader
+	}
+
+	c.writeError(strings.ToUpper(apiErr.Code), msg)
+}
+
+func (c *respConn) writeInteger(n int64) {
+	fmt.Fprintf(c.w, ":%d\r\n", n)
+}
+
+func (c *respConn) writeBulk(s string) {
+	fmt.Fprintf(c.w, "$%d\r\n%s\r\n", len(s), s)
+}
+
+func (c *respConn) writeNull() {
+	c.w.WriteString("$-1\r\n")
+}
+
+func (c *respConn) writeArray(values []string) {
+	fmt.Fprintf(c.w, "*%d\r\n", len(values))
+	for _, v := range values {
+		c.writeBulk(v)
+	}
+}
@@ -0,0 +1,184 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/maelfosso/key-value-store/store"
+)
+
+func TestRESP(t *testing.T) {
+	config, err := store.NewStandalone(t.TempDir(), store.WithLogger(hclog.NewNullLogger()))
+	if err != nil {
+		t.Fatalf("NewStandalone returned unexpected error: %s", err)
+	}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Couldn't listen: %s", err)
+	}
+	server := newRESPServer(config, lis)
+	go server.Serve()
+	t.Cleanup(func() { server.Close() })
+
+	conn, err := net.Dial("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatalf("Couldn't dial the RESP server: %s", err)
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	testCases := []struct {
+		command []string
+		reply   string
+	}{
+		{[]string{"PING"}, "+PONG\r\n"},
+		{[]string{"ping", "hi"}, "$2\r\nhi\r\n"},
+		{[]string{"GET", "k"}, "$-1\r\n"},
+		{[]string{"SET", "k", "hello world"}, "+OK\r\n"},
+		{[]string{"GET", "k"}, "$11\r\nhello world\r\n"},
+		{[]string{"SET", "k", "v", "NX"}, "$-1\r\n"},
+		{[]string{"SET", "session", "abc", "EX", "60"}, "+OK\r\n"},
+		{[]string{"SET", "session", "abc", "EX", "soon"}, "-ERR invalid expire time in 'set' command\r\n"},
+		{[]string{"SET", "k", "v", "KEEPTTL"}, "-ERR syntax error\r\n"},
+		{[]string{"TTL", "session"}, ":60\r\n"},
+		{[]string{"TTL", "k"}, ":-1\r\n"},
+		{[]string{"TTL", "missing"}, ":-2\r\n"},
+		{[]string{"EXISTS", "k", "missing", "k"}, ":2\r\n"},
+		{[]string{"KEYS", "*"}, "*2\r\n$1\r\nk\r\n$7\r\nsession\r\n"},
+		{[]string{"KEYS", "s?ss*"}, "*1\r\n$7\r\nsession\r\n"},
+		{[]string{"INCR", "counter"}, ":1\r\n"},
+		{[]string{"INCRBY", "counter", "5"}, ":6\r\n"},
+		{[]string{"DECRBY", "counter", "10"}, ":-4\r\n"},
+		{[]string{"DECR", "counter"}, ":-5\r\n"},
+		{[]string{"INCRBY", "counter", "many"}, "-ERR value is not an integer or out of range\r\n"},
+		{[]string{"DEL", "counter"}, ":1\r\n"},
+		{[]string{"DEL", "k", "missing"}, ":1\r\n"},
+		{[]string{"GET", "k"}, "$-1\r\n"},
+		{[]string{"GET"}, "-ERR wrong number of arguments for 'get' command\r\n"},
+		{[]string{"FLUSHALL"}, "-ERR unknown command 'FLUSHALL'\r\n"},
+		{[]string{"SELECT", "1"}, "-ERR DB index is out of range\r\n"},
+		{[]string{"QUIT"}, "+OK\r\n"},
+	}
+	for _, tc := range testCases {
+		fmt.Fprintf(conn, "*%d\r\n", len(tc.command))
+		for _, arg := range tc.command {
+			fmt.Fprintf(conn, "$%d\r\n%s\r\n", len(arg), arg)
+		}
+
+		reply, err := readReply(r)
+		if err != nil {
+			t.Fatalf("Couldn't read the reply to %v: %s", tc.command, err)
+		}
+		if reply != tc.reply {
+			t.Errorf("Got %q for %v, expected %q", reply, tc.command, tc.reply)
+		}
+	}
+
+	if _, err := r.ReadByte(); err != io.EOF {
+		t.Errorf("Got %v reading after QUIT, expected the connection closed", err)
+	}
+}
+
+func TestRESPInline(t *testing.T) {
+	config, err := store.NewStandalone(t.TempDir(), store.WithLogger(hclog.NewNullLogger()))
+	if err != nil {
+		t.Fatalf("NewStandalone returned unexpected error: %s", err)
+	}
+
+	client, conn := net.Pipe()
+	defer client.Close()
+	server := &respServer{config: config, conns: map[net.Conn]struct{}{}}
+	go server.serveConn(conn)
+
+	// Inline commands, as telnet sends, and pipelined ones
+	go fmt.Fprint(client, "SET k v\r\nGET k\r\n")
+	r := bufio.NewReader(client)
+	for _, want := range []string{"+OK\r\n", "$1\r\nv\r\n"} {
+		reply, err := readReply(r)
+		if err != nil {
+			t.Fatalf("Couldn't read reply: %s", err)
+		}
+		if reply != want {
+			t.Errorf("Got %q, expected %q", reply, want)
+		}
+	}
+}
+
+func TestGlobRegexp(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		pattern string
+		key     string
+		match   bool
+	}{
+		{"*", "any/key", true},
+		{"user:*", "user:1", true},
+		{"user:*", "users", false},
+		{"h?llo", "hello", true},
+		{"h?llo", "heello", false},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-c]llo", "hbllo", true},
+		{`h\*llo`, "h*llo", true},
+		{`h\*llo`, "hello", false},
+		{"a.b", "axb", false},
+	}
+	for _, tc := range testCases {
+		re, err := globRegexp(tc.pattern)
+		if err != nil {
+			t.Fatalf("globRegexp(%q) returned unexpected error: %s", tc.pattern, err)
+		}
+		if got := re.MatchString(tc.key); got != tc.match {
+			t.Errorf("%q matching %q = %t, want %t", tc.pattern, tc.key, got, tc.match)
+		}
+	}
+
+	if _, err := globRegexp("h[ello"); err == nil {
+		t.Error("globRegexp of an unterminated set succeeded, expected an error")
+	}
+}
+
+// readReply reads a RESP reply and returns it as it was sent.
+func readReply(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+
+	switch line[0] {
+	case '$':
+		n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+		if err != nil || n < 0 {
+			return line, err
+		}
+		bulk := make([]byte, n+2)
+		if _, err := io.ReadFull(r, bulk); err != nil {
+			return "", err
+		}
+		return line + string(bulk), nil
+	case '*':
+		n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+		if err != nil {
+			return "", err
+		}
+		for i := 0; i < n; i++ {
+			item, err := readReply(r)
+			if err != nil {
+				return "", err
+			}
+			line += item
+		}
+	}
+
+	return line, nil
+}
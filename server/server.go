@@ -0,0 +1,1596 @@
+// Package server serves a node of the key-value store: the HTTP API, the gRPC
+// API and the subset of the Redis protocol, on top of a store.Config. The
+// command at the root of the module is a Server configured from the
+// environment; other programs can embed one.
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/hashicorp/raft"
+	"github.com/maelfosso/key-value-store/store"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// defaultMinIndexTimeout is how long a read with a minindex waits for the
+// node to catch up when the request doesn't set a timeout.
+const defaultMinIndexTimeout = 5 * time.Second
+
+// defaultWaitTimeout is how long a read with wait=true waits for the key to
+// be created when the request doesn't set a timeout.
+const defaultWaitTimeout = 30 * time.Second
+
+// revisionHeader carries the revision of the value read, see
+// store.Entry.Revision.
+const revisionHeader = "X-Revision"
+
+// metadataHeaderPrefix starts the names of the headers carrying the user
+// metadata of a value, X-Meta-Owner setting its owner.
+const metadataHeaderPrefix = "X-Meta-"
+
+// Server is a node of the store serving its APIs. New sets it up, Start
+// serves it and Stop shuts it down.
+type Server struct {
+	options
+	config *store.Config
+
+	httpServer *http.Server
+	grpcServer *grpc.Server
+	resp       *respServer
+	addr       net.Addr
+	errs       chan error
+
+	// watchStop ends the watches, which never end on their own, as the
+	// server shuts down.
+	watchStop chan struct{}
+}
+
+// New sets up the store of the node, joining or bootstrapping its cluster,
+// and the servers of its APIs. Nothing is served until Start.
+func New(opts ...Option) (*Server, error) {
+	s := &Server{
+		options:   newOptions(opts),
+		errs:      make(chan error, 1),
+		watchStop: make(chan struct{}),
+	}
+
+	storeOpts := []store.Option{store.WithLogger(s.logger)}
+	addr, err := s.httpAddress()
+	if err != nil {
+		return nil, err
+	}
+	if addr != "" {
+		storeOpts = append(storeOpts, store.WithHTTPAddress(addr))
+	}
+	storeOpts = append(storeOpts, s.storeOpts...)
+	if s.standalone {
+		if s.config, err = store.NewStandalone(s.storagePath, storeOpts...); err != nil {
+			return nil, fmt.Errorf("setting up standalone store: %w", err)
+		}
+	} else {
+		if s.config, err = store.NewRaftSetup(s.storagePath, s.raftHost, s.raftPort, s.raftLeader, storeOpts...); err != nil {
+			return nil, fmt.Errorf("setting up Raft: %w", err)
+		}
+	}
+
+	s.httpServer = &http.Server{Addr: s.listenAddr, Handler: otelhttp.NewHandler(s.routes(), "http.request")}
+	s.httpServer.RegisterOnShutdown(func() { close(s.watchStop) })
+
+	var grpcOpts []grpc.ServerOption
+	if s.certificate != nil {
+		s.httpServer.TLSConfig = &tls.Config{Certificates: []tls.Certificate{*s.certificate}}
+		grpcOpts = append(grpcOpts, grpc.Creds(credentials.NewServerTLSFromCert(s.certificate)))
+	}
+	s.grpcServer = newGRPCServer(s.config, grpcOpts...)
+
+	return s, nil
+}
+
+// httpAddress returns the URL the other nodes reach the HTTP API at, see
+// WithAdvertiseAddr. It is empty when the port is only picked as the API
+// starts listening.
+func (s *Server) httpAddress() (string, error) {
+	scheme := "http"
+	if s.certificate != nil {
+		scheme = "https"
+	}
+
+	if s.advertise != "" {
+		addr := s.advertise
+		if !strings.Contains(addr, "://") {
+			addr = scheme + "://" + addr
+		}
+		u, err := url.Parse(addr)
+		if err != nil || u.Host == "" {
+			return "", fmt.Errorf("invalid advertised HTTP address %q", s.advertise)
+		}
+
+		return u.String(), nil
+	}
+
+	host, port, err := net.SplitHostPort(s.listenAddr)
+	if err != nil || port == "" || port == "0" {
+		return "", nil
+	}
+	if unspecified(host) {
+		host = s.raftHost
+	}
+	if unspecified(host) {
+		return "", nil
+	}
+
+	return scheme + "://" + net.JoinHostPort(host, port), nil
+}
+
+// unspecified reports whether host listens on every interface, which the
+// other nodes can't dial.
+func unspecified(host string) bool {
+	ip := net.ParseIP(host)
+	return host == "" || ip != nil && ip.IsUnspecified()
+}
+
+// Config returns the store of the node.
+func (s *Server) Config() *store.Config {
+	return s.config
+}
+
+// Handler returns the handler of the HTTP API.
+func (s *Server) Handler() http.Handler {
+	return s.httpServer.Handler
+}
+
+// Addr returns the address the HTTP API is served on, nil until Start.
+func (s *Server) Addr() net.Addr {
+	return s.addr
+}
+
+// Err returns a channel receiving the error the HTTP server fails with, if
+// it does before Stop.
+func (s *Server) Err() <-chan error {
+	return s.errs
+}
+
+// Start listens on the addresses of the APIs and serves them in the
+// background.
+func (s *Server) Start() error {
+	lis, err := net.Listen("tcp", s.listenAddr)
+	if err != nil {
+		return fmt.Errorf("listening for HTTP: %w", err)
+	}
+	grpcLis, err := net.Listen("tcp", s.grpcAddr)
+	if err != nil {
+		lis.Close()
+		return fmt.Errorf("listening for gRPC: %w", err)
+	}
+	if s.respAddr != "" {
+		respLis, err := net.Listen("tcp", s.respAddr)
+		if err != nil {
+			lis.Close()
+			grpcLis.Close()
+			return fmt.Errorf("listening for RESP: %w", err)
+		}
+		s.resp = newRESPServer(s.config, respLis)
+	}
+	s.addr = lis.Addr()
+
+	scheme := "http"
+	if s.certificate != nil {
+		scheme = "https"
+	}
+	s.logger.Info(fmt.Sprintf("Starting up on %s://%s", scheme, lis.Addr()))
+	go func() {
+		var err error
+		if s.certificate != nil {
+			err = s.httpServer.ServeTLS(lis, "", "")
+		} else {
+			err = s.httpServer.Serve(lis)
+		}
+		if !errors.Is(err, http.ErrServerClosed) {
+			s.errs <- err
+		}
+	}()
+
+	s.logger.Info(fmt.Sprintf("Serving gRPC on %s", grpcLis.Addr()))
+	go func() {
+		if err := s.grpcServer.Serve(grpcLis); err != nil {
+			s.logger.Error("couldn't serve gRPC", "error", err)
+		}
+	}()
+
+	if s.resp != nil {
+		s.logger.Info(fmt.Sprintf("Serving RESP on %s", s.resp.lis.Addr()))
+		go func() {
+			if err := s.resp.Serve(); err != nil {
+				s.logger.Error("couldn't serve RESP", "error", err)
+			}
+		}()
+	}
+
+	return nil
+}
+
+// routes returns the router of the HTTP API.
+func (s *Server) routes() http.Handler {
+	config := s.config
+	r := chi.NewRouter()
+
+	r.Use(nameSpan)
+	r.Use(config.Middleware)
+
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		jw := json.NewEncoder(w)
+		jw.Encode(map[string]string{"hello": "world"})
+	})
+
+	r.Post("/raft/add", config.AddHandler())
+	r.Delete("/raft/node/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if err := config.RemoveServer(raft.ServerID(chi.URLParam(r, "id"))); err != nil {
+			Error(w, err)
+			return
+		}
+
+		JSON(w, map[string]string{"status": "success"})
+	})
+	r.Post("/raft/node/{id}/promote", func(w http.ResponseWriter, r *http.Request) {
+		if err := config.PromoteServer(raft.ServerID(chi.URLParam(r, "id"))); err != nil {
+			Error(w, err)
+			return
+		}
+
+		JSON(w, map[string]string{"status": "success"})
+	})
+	r.Post("/raft/node/{id}/demote", func(w http.ResponseWriter, r *http.Request) {
+		if err := config.DemoteServer(raft.ServerID(chi.URLParam(r, "id"))); err != nil {
+			Error(w, err)
+			return
+		}
+
+		JSON(w, map[string]string{"status": "success"})
+	})
+	r.Get("/raft/boltstats", config.BoltStatsHandler())
+	r.Get("/raft/status", config.StatusHandler())
+	r.Get("/healthz", config.HealthHandler())
+	r.Get("/readyz", config.ReadyHandler())
+	r.Get("/raft/snapshots", config.SnapshotsHandler())
+	r.Post("/raft/snapshot", config.SnapshotHandler())
+	r.Get("/metrics", config.MetricsHandler())
+	r.Get("/stats/hotkeys", config.HotKeysHandler())
+	r.Get("/stats/ops", config.OpStatsHandler())
+
+	r.Get("/admin/ui", AdminUIHandler)
+	r.Get("/admin/dump", config.DumpHandler())
+	r.Post("/admin/compact", config.CompactHandler())
+	r.Post("/admin/drain", config.DrainHandler(true))
+	r.Post("/admin/undrain", config.DrainHandler(false))
+
+	r.Get("/admin/tokens", func(w http.ResponseWriter, r *http.Request) {
+		tokens, err := config.Tokens(r.Context())
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		JSON(w, tokens)
+	})
+
+	r.Post("/admin/tokens", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Name     string     `json:"name"`
+			Role     store.Role `json:"role"`
+			Policies []string   `json:"policies"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			Error(w, &APIError{Status: http.StatusBadRequest, Code: CodeInvalidBody, Message: err.Error()})
+			return
+		}
+
+		token, t, index, err := config.CreateToken(r.Context(), body.Name, body.Role, body.Policies)
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		// The token is only ever shown here
+		setIndexHeader(w, index)
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(struct {
+			store.Token
+			Secret string `json:"token"`
+		}{t, token})
+	})
+
+	r.Delete("/admin/tokens/{id}", func(w http.ResponseWriter, r *http.Request) {
+		index, err := config.RevokeToken(r.Context(), chi.URLParam(r, "id"))
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		writeSuccess(w, index, config.Term())
+	})
+
+	r.Post("/admin/tokens/sign", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Subject  string     `json:"subject"`
+			Role     store.Role `json:"role"`
+			Policies []string   `json:"policies"`
+			TTL      string     `json:"ttl"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			Error(w, &APIError{Status: http.StatusBadRequest, Code: CodeInvalidBody, Message: err.Error()})
+			return
+		}
+
+		ttl := time.Hour
+		if body.TTL != "" {
+			var err error
+			if ttl, err = time.ParseDuration(body.TTL); err != nil || ttl <= 0 {
+				Error(w, &APIError{Status: http.StatusBadRequest, Code: CodeInvalidTTL, Message: fmt.Sprintf("invalid ttl %q", body.TTL)})
+				return
+			}
+		}
+
+		expiresAt := time.Now().Add(ttl).Truncate(time.Second)
+		token, err := config.SignToken(r.Context(), body.Subject, body.Role, body.Policies, expiresAt)
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		JSON(w, map[string]interface{}{"token": token, "expires_at": expiresAt.UTC()})
+	})
+
+	r.Get("/admin/acl", func(w http.ResponseWriter, r *http.Request) {
+		policies, err := config.ACLPolicies(r.Context())
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		JSON(w, policies)
+	})
+
+	r.Put("/admin/acl/{name}", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Rules []store.ACLRule `json:"rules"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			Error(w, &APIError{Status: http.StatusBadRequest, Code: CodeInvalidBody, Message: err.Error()})
+			return
+		}
+
+		index, err := config.SetACLPolicy(r.Context(), store.ACLPolicy{Name: chi.URLParam(r, "name"), Rules: body.Rules})
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		writeSuccess(w, index, config.Term())
+	})
+
+	r.Delete("/admin/acl/{name}", func(w http.ResponseWriter, r *http.Request) {
+		index, err := config.DeleteACLPolicy(r.Context(), chi.URLParam(r, "name"))
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		writeSuccess(w, index, config.Term())
+	})
+
+	getKey := func(w http.ResponseWriter, r *http.Request) {
+		key, err := keyParam(r)
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		if err := config.CheckAccess(r.Context(), store.AccessRead, key); err != nil {
+			Error(w, err)
+			return
+		}
+
+		if err := checkConsistency(config, r); err != nil {
+			Error(w, err)
+			return
+		}
+
+		if minIndex := r.URL.Query().Get("minindex"); minIndex != "" {
+			index, err := strconv.ParseUint(minIndex, 10, 64)
+			if err != nil {
+				Error(w, invalidParameter("minindex", err))
+				return
+			}
+
+			timeout, err := durationParam(r, "timeout", defaultMinIndexTimeout)
+			if err != nil {
+				Error(w, err)
+				return
+			}
+
+			if err := config.WaitForIndex(r.Context(), index, timeout); err != nil {
+				Error(w, err)
+				return
+			}
+		}
+
+		if rev := r.URL.Query().Get("rev"); rev != "" {
+			revision, err := strconv.ParseUint(rev, 10, 64)
+			if err != nil {
+				Error(w, invalidParameter("rev", err))
+				return
+			}
+
+			e, err := config.GetRevision(r.Context(), key, revision)
+			if err != nil {
+				Error(w, err)
+				return
+			}
+
+			s.writeEntry(w, r, e)
+			return
+		}
+
+		wait, err := boolParam(r, "wait")
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		var (
+			e     store.Entry
+			found bool
+		)
+		if wait {
+			timeout, err := durationParam(r, "timeout", defaultWaitTimeout)
+			if err != nil {
+				Error(w, err)
+				return
+			}
+
+			e, err = config.WaitForKey(r.Context(), key, timeout)
+			found = err == nil
+		} else {
+			e, found, err = config.LookupEntry(r.Context(), key)
+		}
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		if !found {
+			s.writeMissing(w, r, key)
+			return
+		}
+
+		s.writeEntry(w, r, e)
+	}
+	r.Get("/key/*", getKey)
+	r.Head("/key/*", getKey)
+
+	getHistory := func(w http.ResponseWriter, r *http.Request) {
+		key, err := keyParam(r)
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		if err := config.CheckAccess(r.Context(), store.AccessRead, key); err != nil {
+			Error(w, err)
+			return
+		}
+
+		if err := checkEncoding(r); err != nil {
+			Error(w, err)
+			return
+		}
+
+		if err := checkConsistency(config, r); err != nil {
+			Error(w, err)
+			return
+		}
+
+		versions, err := config.History(r.Context(), key)
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		JSON(w, newHistoryResult(key, versions, r.URL.Query().Get("encoding") == "base64"))
+	}
+	// The operations on a key other than reads and writes are served under
+	// /key-ops/, so that no key of /key/ is taken for one. The README lists
+	// the routes of both
+	r.Get("/key-ops/history/*", getHistory)
+
+	deleteKey := func(w http.ResponseWriter, r *http.Request) {
+		key, err := keyParam(r)
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		if err := config.CheckAccess(r.Context(), store.AccessWrite, key); err != nil {
+			Error(w, err)
+			return
+		}
+
+		ret, err := boolParam(r, "return")
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		if ret {
+			if err := checkEncoding(r); err != nil {
+				Error(w, err)
+				return
+			}
+
+			e, index, err := config.DeleteAndGet(r.Context(), key)
+			if err != nil {
+				Error(w, err)
+				return
+			}
+
+			setIndexHeader(w, index)
+			s.writeEntry(w, r, e)
+			return
+		}
+
+		index, err := config.Delete(r.Context(), key)
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		writeSuccess(w, index, config.Term())
+	}
+	r.Delete("/key/*", deleteKey)
+
+	setKey := func(w http.ResponseWriter, r *http.Request) {
+		key, err := keyParam(r)
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		if err := config.CheckAccess(r.Context(), store.AccessWrite, key); err != nil {
+			Error(w, err)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			Error(w, &APIError{Status: http.StatusBadRequest, Code: CodeInvalidBody, Message: err.Error()})
+			return
+		}
+
+		if s.rejectEmptyValues {
+			if err := checkEmptyValue(r, body); err != nil {
+				Error(w, err)
+				return
+			}
+		}
+
+		e := store.Entry{
+			Value:       string(body),
+			ContentType: r.Header.Get("Content-Type"),
+			Metadata:    readMetadata(r),
+		}
+		var index uint64
+		if lease := r.URL.Query().Get("lease"); lease != "" {
+			var id uint64
+			if id, err = leaseParam(lease); err != nil {
+				Error(w, err)
+				return
+			}
+			index, err = config.SetWithLease(r.Context(), key, e, id)
+		} else {
+			index, err = config.SetEntry(r.Context(), key, e)
+		}
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		writeSuccess(w, index, config.Term())
+	}
+	r.Post("/key/*", setKey)
+
+	patchKey := func(w http.ResponseWriter, r *http.Request) {
+		key, err := keyParam(r)
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		if err := config.CheckAccess(r.Context(), store.AccessWrite, key); err != nil {
+			Error(w, err)
+			return
+		}
+
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if mediaType != "application/merge-patch+json" && mediaType != "application/json" {
+			Error(w, &APIError{
+				Status:  http.StatusUnsupportedMediaType,
+				Code:    CodeUnsupportedMediaType,
+				Message: "patch must be sent as application/merge-patch+json",
+			})
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			Error(w, &APIError{Status: http.StatusBadRequest, Code: CodeInvalidBody, Message: err.Error()})
+			return
+		}
+
+		merged, index, err := config.Patch(r.Context(), key, string(body))
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		setIndexHeader(w, index)
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Write([]byte(merged))
+	}
+	r.Patch("/key/*", patchKey)
+
+	incrKey := func(w http.ResponseWriter, r *http.Request) {
+		key, err := keyParam(r)
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		if err := config.CheckAccess(r.Context(), store.AccessWrite, key); err != nil {
+			Error(w, err)
+			return
+		}
+
+		delta := int64(1)
+		if fromQuery := r.URL.Query().Get("delta"); fromQuery != "" {
+			if delta, err = strconv.ParseInt(fromQuery, 10, 64); err != nil {
+				Error(w, invalidParameter("delta", err))
+				return
+			}
+		}
+
+		value, index, err := config.Increment(r.Context(), key, delta)
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		setIndexHeader(w, index)
+		JSON(w, struct {
+			writeResult
+			Value int64 `json:"value"`
+		}{writeResult{Status: "success", Index: index, Term: config.Term()}, value})
+	}
+	r.Post("/key-ops/incr/*", incrKey)
+
+	r.Post("/key-ops/rename/*", func(w http.ResponseWriter, r *http.Request) {
+		key, err := keyParam(r)
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		if err := config.CheckAccess(r.Context(), store.AccessWrite, key); err != nil {
+			Error(w, err)
+			return
+		}
+
+		to := r.URL.Query().Get("to")
+		if to == "" {
+			Error(w, invalidParameter("to", errors.New("missing destination key")))
+			return
+		}
+
+		if err := config.CheckAccess(r.Context(), store.AccessWrite, to); err != nil {
+			Error(w, err)
+			return
+		}
+
+		overwrite, err := boolParam(r, "overwrite")
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		index, err := config.Rename(r.Context(), key, to, overwrite)
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		writeSuccess(w, index, config.Term())
+	})
+
+	r.Put("/key-ops/cas/*", func(w http.ResponseWriter, r *http.Request) {
+		key, err := keyParam(r)
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		if err := config.CheckAccess(r.Context(), store.AccessWrite, key); err != nil {
+			Error(w, err)
+			return
+		}
+
+		var swap struct {
+			Expected    string            `json:"expected"`
+			Value       string            `json:"value"`
+			ContentType string            `json:"content_type"`
+			Metadata    map[string]string `json:"metadata"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&swap); err != nil {
+			Error(w, &APIError{Status: http.StatusBadRequest, Code: CodeInvalidBody, Message: err.Error()})
+			return
+		}
+
+		index, err := config.CompareAndSwap(r.Context(), key, swap.Expected, store.Entry{
+			Value:       swap.Value,
+			ContentType: swap.ContentType,
+			Metadata:    swap.Metadata,
+		})
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		writeSuccess(w, index, config.Term())
+	})
+
+	r.Post("/key-ops/copy/*", func(w http.ResponseWriter, r *http.Request) {
+		key, err := keyParam(r)
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		if err := config.CheckAccess(r.Context(), store.AccessRead, key); err != nil {
+			Error(w, err)
+			return
+		}
+
+		to := r.URL.Query().Get("to")
+		if to == "" {
+			Error(w, invalidParameter("to", errors.New("missing destination key")))
+			return
+		}
+
+		if err := config.CheckAccess(r.Context(), store.AccessWrite, to); err != nil {
+			Error(w, err)
+			return
+		}
+
+		overwrite, err := boolParam(r, "overwrite")
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		metadata, err := boolParam(r, "metadata")
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		index, err := config.Copy(r.Context(), key, to, overwrite, metadata)
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		writeSuccess(w, index, config.Term())
+	})
+
+	batch := s.batchHandler()
+	r.Post("/keys", func(w http.ResponseWriter, r *http.Request) {
+		// A batch of keys to write is told apart from the value of a key to
+		// create by its content type
+		if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == batchMediaType {
+			if r.URL.Query().Get("prefix") != "" {
+				Error(w, invalidParameter("prefix", errors.New("a batch names its keys")))
+				return
+			}
+			batch(w, r)
+			return
+		}
+
+		if err := config.CheckAccess(r.Context(), store.AccessWrite, r.URL.Query().Get("prefix")); err != nil {
+			Error(w, err)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			Error(w, &APIError{Status: http.StatusBadRequest, Code: CodeInvalidBody, Message: err.Error()})
+			return
+		}
+
+		if s.rejectEmptyValues {
+			if err := checkEmptyValue(r, body); err != nil {
+				Error(w, err)
+				return
+			}
+		}
+
+		key, index, err := config.Create(r.Context(), r.URL.Query().Get("prefix"), store.Entry{
+			Value:       string(body),
+			ContentType: r.Header.Get("Content-Type"),
+			Metadata:    readMetadata(r),
+		})
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		setIndexHeader(w, index)
+		w.Header().Set("Location", "/key/"+url.PathEscape(key))
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(struct {
+			writeResult
+			Key string `json:"key"`
+		}{writeResult{Status: "success", Index: index, Term: config.Term()}, key})
+	})
+
+	r.Get("/keys", func(w http.ResponseWriter, r *http.Request) {
+		if err := config.CheckAccess(r.Context(), store.AccessRead, r.URL.Query().Get("prefix")); err != nil {
+			Error(w, err)
+			return
+		}
+
+		if err := checkConsistency(config, r); err != nil {
+			Error(w, err)
+			return
+		}
+
+		limit := 0
+		if fromQuery := r.URL.Query().Get("limit"); fromQuery != "" {
+			var err error
+			if limit, err = strconv.Atoi(fromQuery); err != nil {
+				Error(w, invalidParameter("limit", err))
+				return
+			}
+		}
+
+		list, err := config.List(r.Context(), r.URL.Query().Get("prefix"), r.URL.Query().Get("cursor"), limit)
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		JSON(w, list)
+	})
+
+	r.Get("/watch/*", s.watchHandler())
+
+	r.Delete("/keys", func(w http.ResponseWriter, r *http.Request) {
+		if err := config.CheckAccess(r.Context(), store.AccessWrite, r.URL.Query().Get("prefix")); err != nil {
+			Error(w, err)
+			return
+		}
+
+		deleted, index, err := config.DeletePrefix(r.Context(), r.URL.Query().Get("prefix"))
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		setIndexHeader(w, index)
+		JSON(w, struct {
+			writeResult
+			Deleted int `json:"deleted"`
+		}{writeResult{Status: "success", Index: index, Term: config.Term()}, deleted})
+	})
+
+	r.Post("/kv/batch", s.batchHandler())
+
+	r.Post("/kv/batch-nx", func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			Error(w, &APIError{Status: http.StatusBadRequest, Code: CodeInvalidBody, Message: err.Error()})
+			return
+		}
+
+		entries, err := parseBatch(body)
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		if err := config.CheckAccess(r.Context(), store.AccessWrite, batchKeys(entries)...); err != nil {
+			Error(w, err)
+			return
+		}
+
+		index, err := config.SetBatchIfAbsent(r.Context(), entries)
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		writeSuccess(w, index, config.Term())
+	})
+
+	r.Post("/kv/batch-if", func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			Error(w, &APIError{Status: http.StatusBadRequest, Code: CodeInvalidBody, Message: err.Error()})
+			return
+		}
+
+		pre, entries, err := parseConditionalBatch(body)
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		if err := config.CheckAccess(r.Context(), store.AccessWrite, append(batchKeys(entries), pre.Key)...); err != nil {
+			Error(w, err)
+			return
+		}
+
+		index, err := config.SetBatchIf(r.Context(), pre, entries)
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		writeSuccess(w, index, config.Term())
+	})
+
+	r.Get("/buckets", func(w http.ResponseWriter, r *http.Request) {
+		buckets, err := config.Buckets(r.Context())
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		// Only the buckets the client can read are listed
+		readable := []store.Bucket{}
+		for _, b := range buckets {
+			if config.CheckNamespace(r.Context(), store.AccessRead, b.Name) == nil {
+				readable = append(readable, b)
+			}
+		}
+
+		JSON(w, readable)
+	})
+
+	r.Put("/bucket/{bucket}", func(w http.ResponseWriter, r *http.Request) {
+		if err := config.CheckNamespace(r.Context(), store.AccessWrite, chi.URLParam(r, "bucket")); err != nil {
+			Error(w, err)
+			return
+		}
+
+		index, err := config.CreateBucket(r.Context(), chi.URLParam(r, "bucket"))
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		writeSuccess(w, index, config.Term())
+	})
+
+	r.Delete("/bucket/{bucket}", func(w http.ResponseWriter, r *http.Request) {
+		if err := config.CheckNamespace(r.Context(), store.AccessWrite, chi.URLParam(r, "bucket")); err != nil {
+			Error(w, err)
+			return
+		}
+
+		deleted, index, err := config.DeleteBucket(r.Context(), chi.URLParam(r, "bucket"))
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		setIndexHeader(w, index)
+		JSON(w, struct {
+			writeResult
+			Deleted int `json:"deleted"`
+		}{writeResult{Status: "success", Index: index, Term: config.Term()}, deleted})
+	})
+
+	r.Get("/bucket/{bucket}/stats", func(w http.ResponseWriter, r *http.Request) {
+		if err := config.CheckNamespace(r.Context(), store.AccessRead, chi.URLParam(r, "bucket")); err != nil {
+			Error(w, err)
+			return
+		}
+
+		stats, err := config.BucketStats(r.Context(), chi.URLParam(r, "bucket"))
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		JSON(w, stats)
+	})
+
+	// The keys of a bucket are served by the handlers of /key, keyParam
+	// giving them the key in the namespace of the bucket
+	r.Route("/bucket/{bucket}/key", func(r chi.Router) {
+		r.Use(s.inBucket)
+		r.Get("/*", getKey)
+		r.Head("/*", getKey)
+		r.Post("/*", setKey)
+		r.Delete("/*", deleteKey)
+		r.Patch("/*", patchKey)
+	})
+	r.Route("/bucket/{bucket}/key-ops", func(r chi.Router) {
+		r.Use(s.inBucket)
+		r.Get("/history/*", getHistory)
+		r.Post("/incr/*", incrKey)
+	})
+
+	r.Post("/lease", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			TTL string `json:"ttl"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			Error(w, &APIError{Status: http.StatusBadRequest, Code: CodeInvalidBody, Message: err.Error()})
+			return
+		}
+
+		ttl, err := time.ParseDuration(body.TTL)
+		if err != nil || ttl <= 0 {
+			Error(w, &APIError{Status: http.StatusBadRequest, Code: CodeInvalidTTL, Message: fmt.Sprintf("invalid ttl %q", body.TTL)})
+			return
+		}
+
+		l, err := config.GrantLease(r.Context(), ttl)
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		setIndexHeader(w, l.ID)
+		JSON(w, newLeaseResult(l))
+	})
+
+	r.Get("/lease/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id, err := leaseParam(chi.URLParam(r, "id"))
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		l, err := config.Lease(r.Context(), id)
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		JSON(w, newLeaseResult(l))
+	})
+
+	r.Post("/lease/{id}/keepalive", func(w http.ResponseWriter, r *http.Request) {
+		id, err := leaseParam(chi.URLParam(r, "id"))
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		l, err := config.KeepAliveLease(r.Context(), id)
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		JSON(w, newLeaseResult(l))
+	})
+
+	r.Delete("/lease/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id, err := leaseParam(chi.URLParam(r, "id"))
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		deleted, index, err := config.RevokeLease(r.Context(), id)
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		setIndexHeader(w, index)
+		JSON(w, struct {
+			writeResult
+			Deleted int `json:"deleted"`
+		}{writeResult{Status: "success", Index: index, Term: config.Term()}, deleted})
+	})
+
+	// Lock names are checked against the ACL rules like keys
+	r.Get("/lock/{name}", func(w http.ResponseWriter, r *http.Request) {
+		name := chi.URLParam(r, "name")
+		if err := config.CheckAccess(r.Context(), store.AccessRead, name); err != nil {
+			Error(w, err)
+			return
+		}
+
+		l, err := config.LockHolder(r.Context(), name)
+		if errors.Is(err, store.ErrLockNotHeld) {
+			Error(w, &APIError{Status: http.StatusNotFound, Code: CodeLockNotHeld, Message: err.Error()})
+			return
+		}
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		JSON(w, l)
+	})
+
+	r.Post("/lock/{name}", func(w http.ResponseWriter, r *http.Request) {
+		name := chi.URLParam(r, "name")
+		if err := config.CheckAccess(r.Context(), store.AccessWrite, name); err != nil {
+			Error(w, err)
+			return
+		}
+
+		id, err := leaseParam(r.URL.Query().Get("lease"))
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		l, err := config.Lock(r.Context(), name, id)
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		setIndexHeader(w, l.Revision)
+		JSON(w, l)
+	})
+
+	r.Delete("/lock/{name}", func(w http.ResponseWriter, r *http.Request) {
+		name := chi.URLParam(r, "name")
+		if err := config.CheckAccess(r.Context(), store.AccessWrite, name); err != nil {
+			Error(w, err)
+			return
+		}
+
+		id, err := leaseParam(r.URL.Query().Get("lease"))
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		index, err := config.Unlock(r.Context(), name, id)
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		writeSuccess(w, index, config.Term())
+	})
+
+	r.Get("/ns/{namespace}/stats", func(w http.ResponseWriter, r *http.Request) {
+		if err := config.CheckNamespace(r.Context(), store.AccessRead, chi.URLParam(r, "namespace")); err != nil {
+			Error(w, err)
+			return
+		}
+
+		stats, err := config.NamespaceStats(r.Context(), chi.URLParam(r, "namespace"))
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		JSON(w, stats)
+	})
+
+	r.Post("/kv/mget", func(w http.ResponseWriter, r *http.Request) {
+		var keys []string
+		if err := json.NewDecoder(r.Body).Decode(&keys); err != nil {
+			Error(w, &APIError{Status: http.StatusBadRequest, Code: CodeInvalidBody, Message: err.Error()})
+			return
+		}
+
+		if err := config.CheckAccess(r.Context(), store.AccessRead, keys...); err != nil {
+			Error(w, err)
+			return
+		}
+
+		reportMissing, err := boolParam(r, "missing")
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		if err := checkConsistency(config, r); err != nil {
+			Error(w, err)
+			return
+		}
+
+		entries, err := config.GetMany(r.Context(), keys)
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		if reportMissing {
+			JSON(w, newMGetResult(keys, entries))
+			return
+		}
+
+		values := make(map[string]string, len(entries))
+		for key, e := range entries {
+			values[key] = e.Value
+		}
+		JSON(w, values)
+	})
+
+	r.Post("/kv/exists", func(w http.ResponseWriter, r *http.Request) {
+		var keys []string
+		if err := json.NewDecoder(r.Body).Decode(&keys); err != nil {
+			Error(w, &APIError{Status: http.StatusBadRequest, Code: CodeInvalidBody, Message: err.Error()})
+			return
+		}
+
+		if err := config.CheckAccess(r.Context(), store.AccessRead, keys...); err != nil {
+			Error(w, err)
+			return
+		}
+
+		if err := checkConsistency(config, r); err != nil {
+			Error(w, err)
+			return
+		}
+
+		exists, err := config.Exists(r.Context(), keys)
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		JSON(w, exists)
+	})
+
+	return r
+}
+
+// bucketPrefixKey is the context key of the prefix the keys of the bucket
+// addressed by a request are stored under.
+type bucketPrefixKey struct{}
+
+// inBucket serves the requests for the keys of the bucket in the path, once
+// it checked the bucket exists.
+func (s *Server) inBucket(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		prefix, err := s.config.BucketKey(r.Context(), chi.URLParam(r, "bucket"), "")
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), bucketPrefixKey{}, prefix)))
+	})
+}
+
+// writeEntry writes the value of e as the response, with its content type and
+// metadata, or base64 encoded when the request asks for encoding=base64. Large
+// values are gzip compressed for the clients accepting it, see writeBody.
+func (s *Server) writeEntry(w http.ResponseWriter, r *http.Request, e store.Entry) {
+	if e.Revision != 0 {
+		w.Header().Set(revisionHeader, strconv.FormatUint(e.Revision, 10))
+	}
+	for name, value := range e.Metadata {
+		w.Header().Set(metadataHeaderPrefix+name, value)
+	}
+
+	switch encoding := r.URL.Query().Get("encoding"); encoding {
+	case "":
+		if e.ContentType != "" {
+			w.Header().Set("Content-Type", e.ContentType)
+		}
+		s.writeBody(w, r, []byte(e.Value))
+	case "base64":
+		if e.ContentType != "" {
+			w.Header().Set("X-Value-Content-Type", e.ContentType)
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		s.writeBody(w, r, []byte(base64.StdEncoding.EncodeToString([]byte(e.Value))))
+	default:
+		Error(w, checkEncoding(r))
+	}
+}
+
+// readMetadata returns the user metadata of r, from its headers named
+// metadataHeaderPrefix followed by the lower case name of each.
+func readMetadata(r *http.Request) map[string]string {
+	var meta map[string]string
+	for name, values := range r.Header {
+		if !strings.HasPrefix(name, metadataHeaderPrefix) || name == metadataHeaderPrefix {
+			continue
+		}
+		if meta == nil {
+			meta = map[string]string{}
+		}
+		meta[strings.ToLower(strings.TrimPrefix(name, metadataHeaderPrefix))] = strings.Join(values, ", ")
+	}
+
+	return meta
+}
+
+// checkConsistency returns once config can serve r with the consistency it
+// asks for.
+func checkConsistency(config *store.Config, r *http.Request) error {
+	c, err := store.ParseConsistency(r.URL.Query().Get("consistency"))
+	if err != nil {
+		return invalidParameter("consistency", err)
+	}
+
+	return config.Consistent(r.Context(), c)
+}
+
+// ParseMissingKeyStatus parses the status answering a GET of a missing key,
+// see WithMissingKeyStatus: 200, 204 or 404.
+func ParseMissingKeyStatus(s string) (int, error) {
+	status, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, err
+	}
+
+	switch status {
+	case http.StatusOK, http.StatusNoContent, http.StatusNotFound:
+		return status, nil
+	default:
+		return 0, fmt.Errorf("unsupported status %d, use 200, 204 or 404", status)
+	}
+}
+
+// writeMissing answers a GET of a key holding no value with the missing key
+// status: an empty value with 200, no body with 204 or a not_found error with
+// 404.
+func (s *Server) writeMissing(w http.ResponseWriter, r *http.Request, key string) {
+	switch s.missingKeyStatus {
+	case http.StatusNoContent:
+		w.WriteHeader(http.StatusNoContent)
+	case http.StatusNotFound:
+		Error(w, fmt.Errorf("%w: %q", store.ErrNotFound, key))
+	default:
+		s.writeEntry(w, r, store.Entry{})
+	}
+}
+
+// checkEmptyValue rejects an empty body, most often sent by a client that
+// forgot the value, unless the allowempty query parameter says it is meant.
+func checkEmptyValue(r *http.Request, body []byte) error {
+	if len(body) > 0 {
+		return nil
+	}
+
+	allow, err := boolParam(r, "allowempty")
+	if err != nil {
+		return err
+	}
+	if !allow {
+		return &APIError{
+			Status:  http.StatusBadRequest,
+			Code:    CodeEmptyValue,
+			Message: "the value is empty, set allowempty=true to store it",
+		}
+	}
+
+	return nil
+}
+
+// checkEncoding rejects an encoding writeEntry doesn't know, so a handler can
+// fail before changing anything.
+func checkEncoding(r *http.Request) error {
+	switch encoding := r.URL.Query().Get("encoding"); encoding {
+	case "", "base64":
+		return nil
+	default:
+		return &APIError{
+			Status:  http.StatusBadRequest,
+			Code:    CodeInvalidEncoding,
+			Message: fmt.Sprintf("unknown encoding %q", encoding),
+		}
+	}
+}
+
+// keyParam returns the key addressed by r, the rest of the path after /key/
+// or /key-ops/{op}/. Keys are percent-encoded in the path, slashes may be
+// sent as is. Under /bucket/{bucket}/, it is the key of the bucket in the
+// keyspace.
+func keyParam(r *http.Request) (string, error) {
+	key := chi.URLParam(r, "*")
+
+	// chi routes on the escaped path when it isn't the default encoding of
+	// the decoded one, the key then still needs decoding
+	if r.URL.RawPath != "" {
+		decoded, err := url.PathUnescape(key)
+		if err != nil {
+			return "", &APIError{Status: http.StatusBadRequest, Code: CodeInvalidKey, Message: err.Error()}
+		}
+		key = decoded
+	}
+
+	// The keys of a bucket are stored in its namespace
+	if prefix, ok := r.Context().Value(bucketPrefixKey{}).(string); ok && key != "" {
+		key = prefix + key
+	}
+
+	return key, nil
+}
+
+// boolParam parses the optional boolean query parameter name, false when
+// it's missing.
+func boolParam(r *http.Request, name string) (bool, error) {
+	fromQuery := r.URL.Query().Get(name)
+	if fromQuery == "" {
+		return false, nil
+	}
+
+	b, err := strconv.ParseBool(fromQuery)
+	if err != nil {
+		return false, invalidParameter(name, err)
+	}
+
+	return b, nil
+}
+
+// durationParam parses the query parameter name as a duration, def when it
+// isn't set.
+func durationParam(r *http.Request, name string, def time.Duration) (time.Duration, error) {
+	fromQuery := r.URL.Query().Get(name)
+	if fromQuery == "" {
+		return def, nil
+	}
+
+	d, err := time.ParseDuration(fromQuery)
+	if err != nil {
+		return 0, invalidParameter(name, err)
+	}
+
+	return d, nil
+}
+
+// mgetResult is the response of a multi-get reporting missing keys: keys
+// holding an empty value are in Found, keys holding none in Missing.
+type mgetResult struct {
+	Found   map[string]string `json:"found"`
+	Missing []string          `json:"missing"`
+}
+
+// newMGetResult sorts keys between the found and the missing ones, given the
+// entries read for them. Missing keys are listed in the order of keys, once.
+func newMGetResult(keys []string, entries map[string]store.Entry) mgetResult {
+	res := mgetResult{Found: make(map[string]string, len(entries)), Missing: []string{}}
+	for key, e := range entries {
+		res.Found[key] = e.Value
+	}
+
+	listed := map[string]bool{}
+	for _, key := range keys {
+		if _, ok := entries[key]; !ok && !listed[key] {
+			res.Missing = append(res.Missing, key)
+			listed[key] = true
+		}
+	}
+
+	return res
+}
+
+// historyResult is the response of a history read, the versions of the key
+// the latest first.
+type historyResult struct {
+	Key      string          `json:"key"`
+	Versions []versionResult `json:"versions"`
+}
+
+type versionResult struct {
+	Revision    uint64            `json:"revision"`
+	Value       string            `json:"value"`
+	ContentType string            `json:"content_type,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+}
+
+// newHistoryResult lists the versions of key, their values base64 encoded
+// when encode is set.
+func newHistoryResult(key string, versions []store.Entry, encode bool) historyResult {
+	res := historyResult{Key: key, Versions: make([]versionResult, 0, len(versions))}
+	for _, e := range versions {
+		v := versionResult{Revision: e.Revision, Value: e.Value, ContentType: e.ContentType, Metadata: e.Metadata}
+		if encode {
+			v.Value = base64.StdEncoding.EncodeToString([]byte(e.Value))
+		}
+		res.Versions = append(res.Versions, v)
+	}
+
+	return res
+}
+
+// leaseResult is a lease as answered by the lease endpoints.
+type leaseResult struct {
+	ID        uint64    `json:"id"`
+	TTL       string    `json:"ttl"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Keys      []string  `json:"keys"`
+	Locks     []string  `json:"locks"`
+}
+
+func newLeaseResult(l store.Lease) leaseResult {
+	res := leaseResult{ID: l.ID, TTL: l.TTL.String(), ExpiresAt: l.ExpiresAt.UTC(), Keys: l.Keys, Locks: l.Locks}
+	if res.Keys == nil {
+		res.Keys = []string{}
+	}
+	if res.Locks == nil {
+		res.Locks = []string{}
+	}
+
+	return res
+}
+
+// leaseParam parses the ID of a lease.
+func leaseParam(s string) (uint64, error) {
+	id, err := strconv.ParseUint(s, 10, 64)
+	if err != nil || id == 0 {
+		return 0, invalidParameter("lease", fmt.Errorf("%q isn't a lease ID", s))
+	}
+
+	return id, nil
+}
+
+// writeResult is the response of a successful write. Index and Term are the
+// Raft log index of the write and the current term, the index can be used as
+// the minindex of a read from a follower.
+type writeResult struct {
+	Status string `json:"status"`
+	Index  uint64 `json:"index"`
+	Term   uint64 `json:"term"`
+}
+
+// writeSuccess answers a successful write, giving its index in the body and
+// in the X-Raft-Index header.
+func writeSuccess(w http.ResponseWriter, index, term uint64) {
+	setIndexHeader(w, index)
+	JSON(w, writeResult{Status: "success", Index: index, Term: term})
+}
+
+// setIndexHeader tells the client the Raft log index of its write, to be used
+// as the minindex of a read from a follower.
+func setIndexHeader(w http.ResponseWriter, index uint64) {
+	w.Header().Set("X-Raft-Index", strconv.FormatUint(index, 10))
+}
+
+// JSON encodes data to json and writes it to the http response
+func JSON(w http.ResponseWriter, data interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	b, err := json.Marshal(data)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		JSON(w, map[string]string{"error": err.Error()})
+		return
+	}
+
+	w.Write(b)
+}
@@ -0,0 +1,597 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/hashicorp/go-hclog"
+	"github.com/maelfosso/key-value-store/store"
+)
+
+func TestServer(t *testing.T) {
+	s, err := New(
+		WithStandalone(),
+		WithStoragePath(t.TempDir()),
+		WithListenAddr("127.0.0.1:0"),
+		WithGRPCAddr("127.0.0.1:0"),
+		WithLogger(hclog.NewNullLogger()),
+		WithMissingKeyStatus(http.StatusNotFound),
+	)
+	if err != nil {
+		t.Fatalf("New returned unexpected error: %s", err)
+	}
+	if err := s.Start(); err != nil {
+		t.Fatalf("Start returned unexpected error: %s", err)
+	}
+
+	url := "http://" + s.Addr().String() + "/key/greeting"
+	resp, err := http.Post(url, "text/plain", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatalf("Couldn't set the key: %s", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Got status %d setting the key, expected 200", resp.StatusCode)
+	}
+	if v, _ := s.Config().Get(context.Background(), "greeting"); v != "hello" {
+		t.Errorf("Got %q from the store, expected hello", v)
+	}
+
+	// Values keep their content type and metadata
+	req, _ := http.NewRequest(http.MethodPost, url, strings.NewReader("\x89PNG\x00\xff"))
+	req.Header.Set("Content-Type", "image/png")
+	req.Header.Set("X-Meta-Owner", "me")
+	if resp, err = http.DefaultClient.Do(req); err != nil {
+		t.Fatalf("Couldn't set the key: %s", err)
+	}
+	resp.Body.Close()
+	if resp, err = http.Get(url); err != nil {
+		t.Fatalf("Couldn't get the key: %s", err)
+	}
+	b, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(b) != "\x89PNG\x00\xff" || resp.Header.Get("Content-Type") != "image/png" || resp.Header.Get("X-Meta-Owner") != "me" {
+		t.Errorf("Got %q with headers %v, expected the PNG with its type and owner", b, resp.Header)
+	}
+
+	resp, err = http.Get("http://" + s.Addr().String() + "/key/missing")
+	if err != nil {
+		t.Fatalf("Couldn't get the key: %s", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Got status %d for a missing key, expected 404", resp.StatusCode)
+	}
+
+	if err := s.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop returned unexpected error: %s", err)
+	}
+	if _, err := http.Get(url); err == nil {
+		t.Error("The server still answers once stopped")
+	}
+}
+
+func TestHistory(t *testing.T) {
+	s, err := New(
+		WithStandalone(),
+		WithStoragePath(t.TempDir()),
+		WithLogger(hclog.NewNullLogger()),
+		WithStoreOptions(store.WithHistory(1)),
+	)
+	if err != nil {
+		t.Fatalf("New returned unexpected error: %s", err)
+	}
+	t.Cleanup(func() { s.Config().Shutdown() })
+
+	var revisions []string
+	for _, value := range []string{"v1", "v2", "v3"} {
+		recorder := httptest.NewRecorder()
+		s.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/key/k", strings.NewReader(value)))
+		revisions = append(revisions, recorder.Header().Get("X-Raft-Index"))
+	}
+
+	testCases := []struct {
+		target string
+		status int
+		body   string
+	}{
+		{"/key/k?rev=" + revisions[1], http.StatusOK, "v2"},
+		{"/key/k?rev=" + revisions[0], http.StatusNotFound, `"code":"revision_not_found"`},
+		{"/key/k?rev=latest", http.StatusBadRequest, `"code":"invalid_parameter"`},
+		{"/key-ops/history/k", http.StatusOK, `"versions":[{"revision":` + revisions[2] + `,"value":"v3"},{"revision":` + revisions[1] + `,"value":"v2"}]`},
+		{"/key-ops/history/k?encoding=base64", http.StatusOK, `"value":"djM="`},
+		{"/key-ops/history/missing", http.StatusNotFound, `"code":"not_found"`},
+	}
+	for _, test := range testCases {
+		recorder := httptest.NewRecorder()
+		s.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, test.target, nil))
+
+		if recorder.Code != test.status || !strings.Contains(recorder.Body.String(), test.body) {
+			t.Errorf("GET %s: Got %d %s, expected %d with %s", test.target, recorder.Code, recorder.Body, test.status, test.body)
+		}
+	}
+
+	recorder := httptest.NewRecorder()
+	s.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/key/k", nil))
+	if got := recorder.Header().Get("X-Revision"); got != revisions[2] {
+		t.Errorf("Got revision %q, expected %s", got, revisions[2])
+	}
+}
+
+func TestBuckets(t *testing.T) {
+	s, err := New(WithStandalone(), WithStoragePath(t.TempDir()), WithLogger(hclog.NewNullLogger()))
+	if err != nil {
+		t.Fatalf("New returned unexpected error: %s", err)
+	}
+	t.Cleanup(func() { s.Config().Shutdown() })
+
+	testCases := []struct {
+		method, target, body string
+		status               int
+		response             string
+	}{
+		{http.MethodPost, "/bucket/app/key/k", "v", http.StatusNotFound, `"code":"bucket_not_found"`},
+		{http.MethodPut, "/bucket/app", "", http.StatusOK, `"status":"success"`},
+		{http.MethodPut, "/bucket/app", "", http.StatusConflict, `"code":"bucket_exists"`},
+		{http.MethodPost, "/bucket/app/key/a/b", "v", http.StatusOK, `"status":"success"`},
+		{http.MethodGet, "/bucket/app/key/a/b", "", http.StatusOK, "v"},
+		{http.MethodGet, "/key/app:a/b", "", http.StatusOK, "v"},
+		{http.MethodPost, "/bucket/app/key-ops/incr/n", "", http.StatusOK, `"value":1`},
+		{http.MethodGet, "/key/app:n", "", http.StatusOK, "1"},
+		{http.MethodGet, "/bucket/app/stats", "", http.StatusOK, `"keys":2`},
+		{http.MethodGet, "/buckets", "", http.StatusOK, `[{"name":"app"`},
+		{http.MethodDelete, "/bucket/app", "", http.StatusOK, `"deleted":2`},
+		{http.MethodGet, "/bucket/app/key/a/b", "", http.StatusNotFound, `"code":"bucket_not_found"`},
+		{http.MethodGet, "/buckets", "", http.StatusOK, `[]`},
+	}
+	for _, test := range testCases {
+		recorder := httptest.NewRecorder()
+		s.Handler().ServeHTTP(recorder, httptest.NewRequest(test.method, test.target, strings.NewReader(test.body)))
+
+		if recorder.Code != test.status || !strings.Contains(recorder.Body.String(), test.response) {
+			t.Errorf("%s %s: Got %d %s, expected %d with %s", test.method, test.target, recorder.Code, recorder.Body, test.status, test.response)
+		}
+	}
+}
+
+func TestIncr(t *testing.T) {
+	s, err := New(WithStandalone(), WithStoragePath(t.TempDir()), WithLogger(hclog.NewNullLogger()))
+	if err != nil {
+		t.Fatalf("New returned unexpected error: %s", err)
+	}
+	t.Cleanup(func() { s.Config().Shutdown() })
+	s.Config().Set(context.Background(), "text", "hello")
+
+	testCases := []struct {
+		target   string
+		status   int
+		response string
+	}{
+		{"/key-ops/incr/hits", http.StatusOK, `"value":1`},
+		{"/key-ops/incr/hits?delta=-3", http.StatusOK, `"value":-2`},
+		{"/key-ops/incr/hits?delta=many", http.StatusBadRequest, `"code":"invalid_parameter"`},
+		{"/key-ops/incr/text", http.StatusConflict, `"code":"not_integer"`},
+		{"/key-ops/incr/app/hits", http.StatusOK, `"value":1`},
+	}
+	for _, test := range testCases {
+		recorder := httptest.NewRecorder()
+		s.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, test.target, nil))
+
+		if recorder.Code != test.status || !strings.Contains(recorder.Body.String(), test.response) {
+			t.Errorf("POST %s: Got %d %s, expected %d with %s", test.target, recorder.Code, recorder.Body, test.status, test.response)
+		}
+	}
+	if v, _ := s.Config().Get(context.Background(), "app/hits"); v != "1" {
+		t.Errorf("Got %q at app/hits, expected 1", v)
+	}
+
+	// A key ending like an operation is a key like any other
+	recorder := httptest.NewRecorder()
+	s.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/key/hits/incr", strings.NewReader("v")))
+	if v, _ := s.Config().Get(context.Background(), "hits/incr"); recorder.Code != http.StatusOK || v != "v" {
+		t.Errorf("POST /key/hits/incr: Got %d and %q stored, expected the key hits/incr set", recorder.Code, v)
+	}
+}
+
+func TestKeysBatch(t *testing.T) {
+	s, err := New(WithStandalone(), WithStoragePath(t.TempDir()), WithLogger(hclog.NewNullLogger()))
+	if err != nil {
+		t.Fatalf("New returned unexpected error: %s", err)
+	}
+	t.Cleanup(func() { s.Config().Shutdown() })
+
+	testCases := []struct {
+		target, contentType, body string
+		status                    int
+		response                  string
+	}{
+		{"/keys", batchMediaType, `{"k1": "v1", "k2": {"value": "v2", "ttl": "60s"}}`, http.StatusOK, `"status":"success"`},
+		{"/keys", batchMediaType + "; charset=utf-8", `{"k3": "v3"}`, http.StatusOK, `"status":"success"`},
+		{"/keys", batchMediaType, `["k1"]`, http.StatusBadRequest, `"code":"invalid_body"`},
+		{"/keys?prefix=app:", batchMediaType, `{"k1": "v1"}`, http.StatusBadRequest, `"code":"invalid_parameter"`},
+		// Any other content type is the value of a key to create
+		{"/keys?prefix=doc:", "application/json", `{"k1": "v1"}`, http.StatusCreated, `"key":"doc:1"`},
+	}
+	for _, test := range testCases {
+		req := httptest.NewRequest(http.MethodPost, test.target, strings.NewReader(test.body))
+		req.Header.Set("Content-Type", test.contentType)
+		recorder := httptest.NewRecorder()
+		s.Handler().ServeHTTP(recorder, req)
+
+		if recorder.Code != test.status || !strings.Contains(recorder.Body.String(), test.response) {
+			t.Errorf("POST %s as %s: Got %d %s, expected %d with %s", test.target, test.contentType, recorder.Code, recorder.Body, test.status, test.response)
+		}
+	}
+
+	for key, want := range map[string]string{"k1": "v1", "k2": "v2", "k3": "v3", "doc:1": `{"k1": "v1"}`} {
+		if got, _ := s.Config().Get(context.Background(), key); got != want {
+			t.Errorf("Get(%s) = %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestLocks(t *testing.T) {
+	s, err := New(WithStandalone(), WithStoragePath(t.TempDir()), WithLogger(hclog.NewNullLogger()))
+	if err != nil {
+		t.Fatalf("New returned unexpected error: %s", err)
+	}
+	t.Cleanup(func() { s.Config().Shutdown() })
+
+	recorder := httptest.NewRecorder()
+	s.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/lease", strings.NewReader(`{"ttl":"1m"}`)))
+	var lease struct {
+		ID  uint64 `json:"id"`
+		TTL string `json:"ttl"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &lease); err != nil || recorder.Code != http.StatusOK || lease.TTL != "1m0s" {
+		t.Fatalf("POST /lease: Got %d %s, expected a lease", recorder.Code, recorder.Body)
+	}
+	other, _ := s.Config().GrantLease(context.Background(), time.Minute)
+
+	testCases := []struct {
+		method, target, body string
+		status               int
+		response             string
+	}{
+		{http.MethodPost, "/lease", `{"ttl":"soon"}`, http.StatusBadRequest, `"code":"invalid_ttl"`},
+		{http.MethodPost, fmt.Sprintf("/key/owned?lease=%d", lease.ID), "v", http.StatusOK, `"status":"success"`},
+		{http.MethodPost, "/key/owned?lease=999", "v", http.StatusNotFound, `"code":"lease_not_found"`},
+		{http.MethodPost, fmt.Sprintf("/lease/%d/keepalive", lease.ID), "", http.StatusOK, `"keys":["owned"]`},
+		{http.MethodPost, "/lock/leader", "", http.StatusBadRequest, `"code":"invalid_parameter"`},
+		{http.MethodPost, fmt.Sprintf("/lock/leader?lease=%d", lease.ID), "", http.StatusOK, fmt.Sprintf(`"lease":%d`, lease.ID)},
+		{http.MethodPost, fmt.Sprintf("/lock/leader?lease=%d", other.ID), "", http.StatusConflict, `"code":"lock_held"`},
+		{http.MethodGet, "/lock/leader", "", http.StatusOK, `"name":"leader"`},
+		{http.MethodGet, fmt.Sprintf("/lease/%d", lease.ID), "", http.StatusOK, `"locks":["leader"]`},
+		{http.MethodDelete, fmt.Sprintf("/lease/%d", lease.ID), "", http.StatusOK, `"deleted":1`},
+		{http.MethodGet, "/lock/leader", "", http.StatusNotFound, `"code":"lock_not_held"`},
+		{http.MethodPost, fmt.Sprintf("/lock/leader?lease=%d", other.ID), "", http.StatusOK, fmt.Sprintf(`"lease":%d`, other.ID)},
+		{http.MethodDelete, fmt.Sprintf("/lock/leader?lease=%d", lease.ID), "", http.StatusConflict, `"code":"lock_not_held"`},
+		{http.MethodDelete, fmt.Sprintf("/lock/leader?lease=%d", other.ID), "", http.StatusOK, `"status":"success"`},
+	}
+	for _, test := range testCases {
+		recorder := httptest.NewRecorder()
+		s.Handler().ServeHTTP(recorder, httptest.NewRequest(test.method, test.target, strings.NewReader(test.body)))
+
+		if recorder.Code != test.status || !strings.Contains(recorder.Body.String(), test.response) {
+			t.Errorf("%s %s: Got %d %s, expected %d with %s", test.method, test.target, recorder.Code, recorder.Body, test.status, test.response)
+		}
+	}
+}
+
+func TestHTTPAddress(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		opts []Option
+		addr string
+	}{
+		{nil, "http://localhost:8080"},
+		{[]Option{WithListenAddr("10.0.0.1:9000")}, "http://10.0.0.1:9000"},
+		{[]Option{WithListenAddr("0.0.0.0:9000"), WithRaftAddress("node1", "9001")}, "http://node1:9000"},
+		{[]Option{WithListenAddr(":9000"), WithRaftAddress("0.0.0.0", "9001")}, ""},
+		{[]Option{WithListenAddr("127.0.0.1:0")}, ""},
+		{[]Option{WithAdvertiseAddr("node1.example.com:30080")}, "http://node1.example.com:30080"},
+		{[]Option{WithAdvertiseAddr("https://node1.example.com")}, "https://node1.example.com"},
+		{[]Option{WithAdvertiseAddr("node1.example.com:30080"), WithTLS(tls.Certificate{})}, "https://node1.example.com:30080"},
+	}
+
+	for _, test := range testCases {
+		s := &Server{options: newOptions(test.opts)}
+		if got, err := s.httpAddress(); err != nil || got != test.addr {
+			t.Errorf("%v: Got %q, %v, expected %q", test.opts, got, err, test.addr)
+		}
+	}
+
+	s := &Server{options: newOptions([]Option{WithAdvertiseAddr("http://")})}
+	if _, err := s.httpAddress(); err == nil {
+		t.Errorf("httpAddress accepted an address without host")
+	}
+}
+
+func TestJSON(t *testing.T) {
+	t.Parallel()
+
+	header := http.Header{}
+	headerKey := "Content-Type"
+	headerValue := "application/json; charset=utf-8"
+	header.Add(headerKey, headerValue)
+
+	testCases := []struct {
+		in     interface{}
+		header http.Header
+		out    string
+	}{
+		{map[string]string{"hello": "world"}, header, `{"hello":"world"}`},
+		{map[string]string{"hello": "tables"}, header, `{"hello":"tables"}`},
+		{make(chan bool), header, `{"error":"json: unsupported type: chan bool"}`},
+	}
+
+	for _, test := range testCases {
+		recorder := httptest.NewRecorder()
+
+		JSON(recorder, test.in)
+
+		response := recorder.Result()
+		defer response.Body.Close()
+
+		got, err := io.ReadAll(response.Body)
+		if err != nil {
+			t.Fatalf("Error reading response body: %s", err)
+		}
+
+		if string(got) != test.out {
+			t.Errorf("Got %s, expected %s", string(got), test.out)
+		}
+
+		if contentType := response.Header.Get(headerKey); contentType != headerValue {
+			t.Errorf("Got %s, expected %s", contentType, headerValue)
+		}
+	}
+}
+
+func TestError(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		in     error
+		status int
+		code   string
+	}{
+		{store.ErrNotLeader, http.StatusServiceUnavailable, CodeNotLeader},
+		{&store.NotLeaderError{}, http.StatusServiceUnavailable, CodeNotLeader},
+		{&store.NotLeaderError{Leader: "http://10.0.0.1:8080"}, http.StatusMisdirectedRequest, CodeNotLeader},
+		{fmt.Errorf("%w: bad", store.ErrInvalidPatch), http.StatusBadRequest, CodeInvalidPatch},
+		{fmt.Errorf("%w: bad", store.ErrNotJSON), http.StatusConflict, CodeNotJSON},
+		{fmt.Errorf("%w: applied index is 1", store.ErrIndexTimeout), http.StatusServiceUnavailable, CodeIndexTimeout},
+		{fmt.Errorf("%w: \"k\"", store.ErrWaitTimeout), http.StatusGatewayTimeout, CodeWaitTimeout},
+		{invalidParameter("minindex", errors.New("bad")), http.StatusBadRequest, CodeInvalidParameter},
+		{fmt.Errorf("%w: \"k\"", store.ErrNotFound), http.StatusNotFound, CodeNotFound},
+		{fmt.Errorf("%w: \"k\"", store.ErrKeyExists), http.StatusConflict, CodeKeyExists},
+		{fmt.Errorf("%w: applied index is 3, replaying up to 10", store.ErrNotReady), http.StatusServiceUnavailable, CodeNotReady},
+		{fmt.Errorf("%w: \"version\" doesn't hold the expected value", store.ErrConditionFailed), http.StatusConflict, CodeConditionFailed},
+		{fmt.Errorf("%w: \"k\" is the precondition key", store.ErrInvalidPrecondition), http.StatusBadRequest, CodeInvalidPrecondition},
+		{&store.KeysExistError{Keys: []string{"k"}}, http.StatusPreconditionFailed, CodeKeysExist},
+		{store.ErrReadOnly, http.StatusForbidden, CodeReadOnly},
+		{fmt.Errorf("%w: \"k\" isn't valid JSON", store.ErrPolicyViolation), http.StatusUnprocessableEntity, CodePolicyViolation},
+		{store.ErrTooManyWrites, http.StatusTooManyRequests, CodeTooManyWrites},
+		{fmt.Errorf("%w: namespace \"t\" would hold 11 keys, maximum is 10", store.ErrQuotaExceeded), http.StatusInsufficientStorage, CodeQuotaExceeded},
+		{fmt.Errorf("%w: there would be 4 namespaces, maximum is 3", store.ErrNamespaceLimit), http.StatusInsufficientStorage, CodeNamespaceLimit},
+		{fmt.Errorf("load: %w", store.ErrStoreLocked), http.StatusServiceUnavailable, CodeStoreLocked},
+		{fmt.Errorf("%w: key is empty", store.ErrInvalidKey), http.StatusBadRequest, CodeInvalidKey},
+		{fmt.Errorf("%w: \"__kv:k\"", store.ErrReservedKey), http.StatusForbidden, CodeReservedKey},
+		{fmt.Errorf("wrapped: %w", store.ErrValueTooLarge), http.StatusRequestEntityTooLarge, CodeValueTooLarge},
+		{&APIError{Status: http.StatusBadRequest, Code: CodeInvalidBody, Message: "bad"}, http.StatusBadRequest, CodeInvalidBody},
+		{errors.New("disk on fire"), http.StatusInternalServerError, CodeInternal},
+	}
+
+	for _, test := range testCases {
+		recorder := httptest.NewRecorder()
+
+		Error(recorder, test.in)
+
+		response := recorder.Result()
+		defer response.Body.Close()
+
+		if response.StatusCode != test.status {
+			t.Errorf("Got status %d, expected %d", response.StatusCode, test.status)
+		}
+
+		var body APIError
+		if err := json.NewDecoder(response.Body).Decode(&body); err != nil {
+			t.Fatalf("Error decoding response body: %s", err)
+		}
+
+		if body.Code != test.code {
+			t.Errorf("Got code %s, expected %s", body.Code, test.code)
+		}
+
+		if body.Message != test.in.Error() {
+			t.Errorf("Got error %s, expected %s", body.Message, test.in.Error())
+		}
+
+		if leader := body.Leader; leader != "" {
+			if notLeader, ok := test.in.(*store.NotLeaderError); !ok || leader != notLeader.Leader {
+				t.Errorf("Got unexpected leader %s", leader)
+			}
+		}
+
+		if keysExist, ok := test.in.(*store.KeysExistError); ok && !reflect.DeepEqual(body.Keys, keysExist.Keys) {
+			t.Errorf("Got keys %v, expected %v", body.Keys, keysExist.Keys)
+		}
+	}
+}
+
+func TestAdminUIHandler(t *testing.T) {
+	t.Parallel()
+
+	recorder := httptest.NewRecorder()
+	AdminUIHandler(recorder, httptest.NewRequest(http.MethodGet, "/admin/ui", nil))
+
+	response := recorder.Result()
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		t.Errorf("Got status %d, expected %d", response.StatusCode, http.StatusOK)
+	}
+
+	if contentType := response.Header.Get("Content-Type"); contentType != "text/html; charset=utf-8" {
+		t.Errorf("Got %s, expected text/html", contentType)
+	}
+}
+
+func TestWriteSuccess(t *testing.T) {
+	t.Parallel()
+
+	recorder := httptest.NewRecorder()
+	writeSuccess(recorder, 42, 3)
+
+	if index := recorder.Header().Get("X-Raft-Index"); index != "42" {
+		t.Errorf("Got X-Raft-Index %s, expected 42", index)
+	}
+
+	expected := `{"status":"success","index":42,"term":3}`
+	if body := recorder.Body.String(); body != expected {
+		t.Errorf("Got %s, expected %s", body, expected)
+	}
+}
+
+func TestWriteMissing(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		env    string
+		status int
+		body   bool
+	}{
+		{"200", http.StatusOK, false},
+		{"204", http.StatusNoContent, false},
+		{"404", http.StatusNotFound, true},
+	}
+
+	for _, test := range testCases {
+		status, err := ParseMissingKeyStatus(test.env)
+		if err != nil {
+			t.Fatalf("ParseMissingKeyStatus(%s) returned unexpected error: %s", test.env, err)
+		}
+
+		recorder := httptest.NewRecorder()
+		s := &Server{options: newOptions([]Option{WithMissingKeyStatus(status)})}
+		s.writeMissing(recorder, httptest.NewRequest(http.MethodGet, "/key/k", nil), "k")
+
+		if recorder.Code != test.status {
+			t.Errorf("%s: Got status %d, expected %d", test.env, recorder.Code, test.status)
+		}
+
+		if hasBody := recorder.Body.Len() > 0; hasBody != test.body {
+			t.Errorf("%s: Got body %q", test.env, recorder.Body.String())
+		}
+	}
+
+	for _, env := range []string{"500", "not-found"} {
+		if _, err := ParseMissingKeyStatus(env); err == nil {
+			t.Errorf("ParseMissingKeyStatus(%s) accepted an unsupported status", env)
+		}
+	}
+}
+
+func TestCheckEmptyValue(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		target string
+		body   string
+		code   string
+	}{
+		{"/key/k", "value", ""},
+		{"/key/k", "", CodeEmptyValue},
+		{"/key/k?allowempty=false", "", CodeEmptyValue},
+		{"/key/k?allowempty=true", "", ""},
+		{"/key/k?allowempty=maybe", "", CodeInvalidParameter},
+	}
+
+	for _, test := range testCases {
+		err := checkEmptyValue(httptest.NewRequest(http.MethodPost, test.target, nil), []byte(test.body))
+
+		code := ""
+		if err != nil {
+			code = toAPIError(err).Code
+		}
+		if code != test.code {
+			t.Errorf("%s with body %q: Got code %q, expected %q", test.target, test.body, code, test.code)
+		}
+	}
+}
+
+func TestMGetResult(t *testing.T) {
+	t.Parallel()
+
+	keys := []string{"empty", "absent", "full", "absent", "other"}
+	entries := map[string]store.Entry{"empty": {}, "full": {Value: "v"}}
+
+	got := newMGetResult(keys, entries)
+	expected := mgetResult{
+		Found:   map[string]string{"empty": "", "full": "v"},
+		Missing: []string{"absent", "other"},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Got %+v, expected %+v", got, expected)
+	}
+
+	b, err := json.Marshal(newMGetResult(nil, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != `{"found":{},"missing":[]}` {
+		t.Errorf("Got %s for no keys", b)
+	}
+}
+
+func TestKeyParam(t *testing.T) {
+	t.Parallel()
+
+	r := chi.NewRouter()
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		key, err := keyParam(r)
+		if err != nil {
+			Error(w, err)
+			return
+		}
+		w.Write([]byte(key))
+	}
+	r.Get("/key/*", handler)
+	r.Post("/key-ops/rename/*", handler)
+
+	testCases := []struct {
+		method, target string
+		key            string
+	}{
+		{http.MethodGet, "/key/simple", "simple"},
+		{http.MethodGet, "/key/app/config/db", "app/config/db"},
+		{http.MethodGet, "/key/app%2Fconfig%2Fdb", "app/config/db"},
+		{http.MethodGet, "/key/with%20space", "with space"},
+		{http.MethodGet, "/key/100%25", "100%"},
+		{http.MethodGet, "/key/caf%C3%A9/%E2%9C%93", "café/✓"},
+		{http.MethodPost, "/key-ops/rename/app/config", "app/config"},
+		{http.MethodPost, "/key-ops/rename/app%2Fconfig", "app/config"},
+	}
+
+	for _, test := range testCases {
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, httptest.NewRequest(test.method, test.target, nil))
+
+		if got := recorder.Body.String(); recorder.Code != http.StatusOK || got != test.key {
+			t.Errorf("%s %s: Got %d %q, expected %q", test.method, test.target, recorder.Code, got, test.key)
+		}
+	}
+}
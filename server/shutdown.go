@@ -0,0 +1,40 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Stop shuts the node down. It drains, so load balancers move traffic away,
+// closes the RESP connections, stops accepting connections and waits for the
+// requests in flight until ctx is done, then shuts the store down, handing
+// over its leadership and closing the stores. A Server can't be started
+// again once stopped.
+func (s *Server) Stop(ctx context.Context) error {
+	s.config.Drain()
+	if s.resp != nil {
+		s.resp.Close()
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		s.grpcServer.GracefulStop()
+		close(stopped)
+	}()
+	if err := s.httpServer.Shutdown(ctx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		s.logger.Warn("requests in flight didn't complete", "error", err)
+	}
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		s.grpcServer.Stop()
+	}
+
+	if err := s.config.Shutdown(); err != nil {
+		return fmt.Errorf("shutting the store down: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/maelfosso/key-value-store/store"
+)
+
+// watchKeepAlive is how often a watch sends a comment when no change comes,
+// so proxies don't close the stream as idle.
+const watchKeepAlive = 15 * time.Second
+
+// watchHandler streams the changes to the key of the request, or to the keys
+// it prefixes with prefix=true, as server-sent events named after their
+// action. The streams end as the server shuts down.
+func (s *Server) watchHandler() http.HandlerFunc {
+	config := s.config
+	return func(w http.ResponseWriter, r *http.Request) {
+		key, err := keyParam(r)
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		prefix, err := boolParam(r, "prefix")
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		if err := config.CheckAccess(r.Context(), store.AccessRead, key); err != nil {
+			Error(w, err)
+			return
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			Error(w, errors.New("streaming isn't supported"))
+			return
+		}
+
+		events, err := config.Watch(r.Context(), key, prefix)
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		ticker := time.NewTicker(watchKeepAlive)
+		defer ticker.Stop()
+		for {
+			select {
+			case ev, ok := <-events:
+				if !ok {
+					return
+				}
+				data, err := json.Marshal(ev)
+				if err != nil {
+					s.logger.Error("couldn't marshal event", "key", ev.Key, "error", err)
+					continue
+				}
+				fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Action, data)
+			case <-ticker.C:
+				fmt.Fprint(w, ": keep-alive\n\n")
+			case <-s.watchStop:
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
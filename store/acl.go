@@ -0,0 +1,209 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Access is what an ACL rule allows on the keys it covers.
+type Access string
+
+const (
+	// AccessRead reads the keys.
+	AccessRead Access = "read"
+
+	// AccessWrite reads and writes the keys.
+	AccessWrite Access = "write"
+)
+
+// allows reports whether a allows required.
+func (a Access) allows(required Access) bool {
+	return a == AccessWrite || a == required
+}
+
+// ACLRule gives access to the keys starting with Prefix, to every key when
+// it is empty.
+type ACLRule struct {
+	Prefix string `json:"prefix"`
+	Access Access `json:"access"`
+}
+
+// ACLPolicy is a named set of rules. A token bound to policies only reaches
+// the keys one of their rules covers, on top of what its role allows:
+// a token with the write role bound to a policy giving read access to
+// "team-a:" can read the keys of team-a and nothing else. Tokens bound to no
+// policy reach every key.
+type ACLPolicy struct {
+	Name  string    `json:"name"`
+	Rules []ACLRule `json:"rules"`
+}
+
+// principalKey is the context key of the Principal of a request.
+type principalKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying p, whose access is checked by
+// CheckAccess.
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFrom returns the Principal carried by ctx.
+func PrincipalFrom(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
+
+// aclKey returns the key holding the policy name.
+func (cfg *Config) aclKey(name string) string {
+	return cfg.internalKey("acl", name)
+}
+
+// SetACLPolicy creates or replaces the policy p. Tokens bound to it get its
+// new rules straight away.
+func (cfg *Config) SetACLPolicy(ctx context.Context, p ACLPolicy) (uint64, error) {
+	if p.Name == "" {
+		return 0, fmt.Errorf("%w: the name of the policy is required", ErrInvalidACL)
+	}
+	if err := validateKey(p.Name); err != nil {
+		return 0, fmt.Errorf("%w: %s", ErrInvalidACL, err)
+	}
+	if p.Rules == nil {
+		p.Rules = []ACLRule{}
+	}
+	for _, rule := range p.Rules {
+		if rule.Access != AccessRead && rule.Access != AccessWrite {
+			return 0, fmt.Errorf("%w: unknown access %q", ErrInvalidACL, rule.Access)
+		}
+	}
+	if err := cfg.writable(); err != nil {
+		return 0, err
+	}
+
+	data, err := json.Marshal(p)
+	if err != nil {
+		return 0, fmt.Errorf("encoding policy: %w", err)
+	}
+	_, index, err := cfg.apply(ctx, Command{Action: "set", Key: cfg.aclKey(p.Name), Data: data, ContentType: "application/json"})
+
+	return index, err
+}
+
+// DeleteACLPolicy deletes the policy name, failing with ErrNotFound when
+// there is none. Its rules no longer give access to the tokens bound to it.
+func (cfg *Config) DeleteACLPolicy(ctx context.Context, name string) (uint64, error) {
+	if err := cfg.writable(); err != nil {
+		return 0, err
+	}
+
+	if _, found, err := cfg.aclPolicy(ctx, name); err != nil {
+		return 0, err
+	} else if !found {
+		return 0, fmt.Errorf("%w: policy %q", ErrNotFound, name)
+	}
+
+	_, index, err := cfg.apply(ctx, Command{Action: "delete", Key: cfg.aclKey(name)})
+
+	return index, err
+}
+
+// ACLPolicies returns the policies, by name.
+func (cfg *Config) ACLPolicies(ctx context.Context) ([]ACLPolicy, error) {
+	if err := readable(ctx); err != nil {
+		return nil, err
+	}
+
+	f := cfg.fsm
+	prefix := f.policies.key(cfg.aclKey(""))
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	policies := []ACLPolicy{}
+	for key, e := range f.data {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		var p ACLPolicy
+		if err := json.Unmarshal([]byte(e.Value), &p); err != nil {
+			return nil, fmt.Errorf("decoding policy %q: %w", key, err)
+		}
+		policies = append(policies, p)
+	}
+	sort.Slice(policies, func(i, j int) bool { return policies[i].Name < policies[j].Name })
+
+	return policies, nil
+}
+
+// aclPolicy returns the policy name.
+func (cfg *Config) aclPolicy(ctx context.Context, name string) (ACLPolicy, bool, error) {
+	e, found, err := cfg.fsm.localLookup(ctx, cfg.aclKey(name))
+	if err != nil || !found {
+		return ACLPolicy{}, false, err
+	}
+
+	var p ACLPolicy
+	if err := json.Unmarshal([]byte(e.Value), &p); err != nil {
+		return ACLPolicy{}, false, fmt.Errorf("decoding policy %q: %w", name, err)
+	}
+
+	return p, true, nil
+}
+
+// checkPolicies fails with ErrInvalidToken when one of names isn't a
+// policy.
+func (cfg *Config) checkPolicies(ctx context.Context, names []string) error {
+	for _, name := range names {
+		if _, found, err := cfg.aclPolicy(ctx, name); err != nil {
+			return err
+		} else if !found {
+			return fmt.Errorf("%w: unknown policy %q", ErrInvalidToken, name)
+		}
+	}
+
+	return nil
+}
+
+// CheckAccess fails with ErrForbidden unless the principal of ctx, see
+// WithPrincipal, has access to every key of keys. A key also stands for the
+// keys it prefixes, like the prefix of a listing: the principal needs a rule
+// whose prefix starts it. Everything is allowed when authentication is off,
+// ctx carries no principal or it is bound to no policy.
+func (cfg *Config) CheckAccess(ctx context.Context, access Access, keys ...string) error {
+	p, ok := PrincipalFrom(ctx)
+	if cfg.auth == nil || !ok || len(p.Policies) == 0 {
+		return nil
+	}
+
+	var rules []ACLRule
+	for _, name := range p.Policies {
+		policy, _, err := cfg.aclPolicy(ctx, name)
+		if err != nil {
+			return err
+		}
+		rules = append(rules, policy.Rules...)
+	}
+
+	keyOf := cfg.fsm.policies.key
+	for _, key := range keys {
+		allowed := false
+		for _, rule := range rules {
+			if rule.Access.allows(access) && strings.HasPrefix(keyOf(key), keyOf(rule.Prefix)) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("%w: %s has no %s access to %q", ErrForbidden, p.Name, access, key)
+		}
+	}
+
+	return nil
+}
+
+// CheckNamespace is CheckAccess for the keys of the namespace ns.
+func (cfg *Config) CheckNamespace(ctx context.Context, access Access, ns string) error {
+	return cfg.CheckAccess(ctx, access, ns+cfg.keySeparator)
+}
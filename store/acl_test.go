@@ -0,0 +1,74 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+func TestCheckAccess(t *testing.T) {
+	ctx := context.Background()
+	cfg, err := NewStandalone(t.TempDir(), WithLogger(hclog.NewNullLogger()), WithAdminToken("root"))
+	if err != nil {
+		t.Fatalf("NewStandalone returned unexpected error: %s", err)
+	}
+
+	if _, err := cfg.SetACLPolicy(ctx, ACLPolicy{Name: "team-a", Rules: []ACLRule{
+		{Prefix: "team-a:", Access: AccessWrite},
+		{Prefix: "shared:", Access: AccessRead},
+	}}); err != nil {
+		t.Fatalf("SetACLPolicy returned unexpected error: %s", err)
+	}
+	if _, err := cfg.SetACLPolicy(ctx, ACLPolicy{Name: "bad", Rules: []ACLRule{{Access: "delete"}}}); !errors.Is(err, ErrInvalidACL) {
+		t.Errorf("SetACLPolicy() with an unknown access = %v, want ErrInvalidACL", err)
+	}
+
+	if _, _, _, err := cfg.CreateToken(ctx, "team-b", RoleWrite, []string{"team-b"}); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("CreateToken() with an unknown policy = %v, want ErrInvalidToken", err)
+	}
+	token, _, _, err := cfg.CreateToken(ctx, "team-a", RoleWrite, []string{"team-a"})
+	if err != nil {
+		t.Fatalf("CreateToken returned unexpected error: %s", err)
+	}
+	p, err := cfg.Authorize(ctx, token, RoleWrite)
+	if err != nil {
+		t.Fatalf("Authorize returned unexpected error: %s", err)
+	}
+	ctx = WithPrincipal(ctx, p)
+
+	for _, tc := range []struct {
+		access Access
+		keys   []string
+		want   error
+	}{
+		{AccessWrite, []string{"team-a:k"}, nil},
+		{AccessRead, []string{"team-a:k", "shared:k"}, nil},
+		{AccessRead, []string{"team-a:"}, nil},
+		{AccessWrite, []string{"shared:k"}, ErrForbidden},
+		{AccessRead, []string{"team-a:k", "team-b:k"}, ErrForbidden},
+		{AccessRead, []string{""}, ErrForbidden},
+		{AccessRead, []string{"team-"}, ErrForbidden},
+	} {
+		if err := cfg.CheckAccess(ctx, tc.access, tc.keys...); !errors.Is(err, tc.want) {
+			t.Errorf("CheckAccess(%s, %v) = %v, want %v", tc.access, tc.keys, err, tc.want)
+		}
+	}
+
+	// Principals bound to no policy reach every key
+	if err := cfg.CheckAccess(WithPrincipal(ctx, Principal{Name: "admin", Role: RoleAdmin}), AccessWrite, "team-b:k"); err != nil {
+		t.Errorf("CheckAccess() without policies returned %v", err)
+	}
+
+	// Deleting the policy takes its access away
+	if _, err := cfg.DeleteACLPolicy(ctx, "team-a"); err != nil {
+		t.Fatalf("DeleteACLPolicy returned unexpected error: %s", err)
+	}
+	if err := cfg.CheckAccess(ctx, AccessRead, "team-a:k"); !errors.Is(err, ErrForbidden) {
+		t.Errorf("CheckAccess() after deleting the policy = %v, want ErrForbidden", err)
+	}
+	if policies, _ := cfg.ACLPolicies(ctx); len(policies) != 0 {
+		t.Errorf("ACLPolicies() = %v, want none", policies)
+	}
+}
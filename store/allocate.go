@@ -0,0 +1,125 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// KeyAllocator is how Create picks the key of a new value.
+type KeyAllocator string
+
+const (
+	// AllocateSequence appends the next number of a counter kept per prefix
+	// in the FSM: orders:1, orders:2... The counter is part of the data, so
+	// it survives snapshots and restarts, and is never handed out twice.
+	AllocateSequence KeyAllocator = "sequence"
+
+	// AllocateUUID appends a random UUID, picked by the node proposing the
+	// write. The FSM still refuses it if the key exists.
+	AllocateUUID KeyAllocator = "uuid"
+)
+
+// ParseKeyAllocator parses the name of a key allocator.
+func ParseKeyAllocator(s string) (KeyAllocator, error) {
+	switch a := KeyAllocator(s); a {
+	case AllocateSequence, AllocateUUID:
+		return a, nil
+	default:
+		return "", fmt.Errorf("unknown key allocator %q, expected %q or %q", s, AllocateSequence, AllocateUUID)
+	}
+}
+
+// Create stores e under a new key starting with prefix, and returns the key
+// along with the Raft log index of the write. The key is allocated by the
+// FSM, or checked by it to be free, while it applies the write, so concurrent
+// creates never get the same key.
+func (cfg *Config) Create(ctx context.Context, prefix string, e Entry) (string, uint64, error) {
+	if prefix != "" {
+		if err := cfg.validateKey(prefix); err != nil {
+			return "", 0, err
+		}
+	}
+
+	if err := validateValue(e.Value); err != nil {
+		return "", 0, err
+	}
+
+	if err := validateMetadata(e.Metadata); err != nil {
+		return "", 0, err
+	}
+
+	if err := cfg.writable(); err != nil {
+		return "", 0, err
+	}
+
+	cmd := Command{
+		Action:       "create",
+		Key:          prefix,
+		Data:         []byte(e.Value),
+		ContentType:  e.ContentType,
+		UserMetadata: e.Metadata,
+		Now:          time.Now().UnixNano(),
+	}
+	if cfg.keyAllocator == AllocateUUID {
+		cmd.Key += uuid.New().String()
+	} else {
+		cmd.Sequence = true
+	}
+
+	resp, index, err := cfg.apply(ctx, cmd)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return resp.(string), index, nil
+}
+
+// sequenceKey returns the key of the counter numbering the keys created
+// under prefix.
+func (f *fsm) sequenceKey(prefix string) string {
+	return f.reserved + "sequence" + f.separator + prefix
+}
+
+// localCreate stores e under key, or under the next key of the sequence of
+// the prefix key when sequence is set, and returns the key. Numbers whose key
+// was written some other way are skipped. An entry expired at now counts as
+// missing.
+func (f *fsm) localCreate(key string, sequence bool, e Entry, now time.Time) (string, error) {
+	prefix, counter := key, f.sequenceKey(key)
+	var next uint64
+	if sequence {
+		if c, ok := f.data[counter]; ok {
+			n, err := strconv.ParseUint(c.Value, 10, 64)
+			if err != nil {
+				return "", fmt.Errorf("reading sequence %q: %w", counter, err)
+			}
+			next = n
+		}
+
+		for {
+			next++
+			key = prefix + strconv.FormatUint(next, 10)
+			if _, taken := f.data[key]; !taken {
+				break
+			}
+		}
+	}
+
+	if err := f.checkAbsent(map[string]Entry{key: e}, now); err != nil {
+		return "", err
+	}
+	if err := f.checkQuotas(map[string]int{key: len(e.Value)}); err != nil {
+		return "", err
+	}
+
+	f.put(key, e)
+	if sequence {
+		f.put(counter, Entry{Value: strconv.FormatUint(next, 10)})
+	}
+
+	return key, nil
+}
@@ -0,0 +1,134 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hashicorp/raft"
+)
+
+func TestCreateConcurrently(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestConfig(t)
+
+	// A key written directly takes a number of the sequence
+	if err := cfg.Set(ctx, "orders:3", "taken"); err != nil {
+		t.Fatalf("Set returned unexpected error: %s", err)
+	}
+
+	const n = 20
+	keys := make(chan string, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			key, _, err := cfg.Create(ctx, "orders:", Entry{Value: "v"})
+			if err != nil {
+				t.Errorf("Create returned unexpected error: %s", err)
+				return
+			}
+			keys <- key
+		}()
+	}
+	wg.Wait()
+	close(keys)
+
+	seen := map[string]bool{}
+	for key := range keys {
+		if seen[key] {
+			t.Errorf("Create returned %q twice", key)
+		}
+		seen[key] = true
+	}
+	if len(seen) != n {
+		t.Fatalf("Create returned %d keys, want %d", len(seen), n)
+	}
+	if seen["orders:3"] {
+		t.Errorf("Create returned the existing key orders:3")
+	}
+	if !seen["orders:1"] || !seen["orders:21"] {
+		t.Errorf("Create returned %v, want orders:1 to orders:21 but orders:3", seen)
+	}
+
+	if v, err := cfg.Get(ctx, "orders:3"); err != nil || v != "taken" {
+		t.Errorf("Get(orders:3) = %q, %v, want taken", v, err)
+	}
+}
+
+func TestCreateUUID(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestConfig(t)
+	cfg.keyAllocator = AllocateUUID
+
+	key, _, err := cfg.Create(ctx, "jobs:", Entry{Value: "v"})
+	if err != nil {
+		t.Fatalf("Create returned unexpected error: %s", err)
+	}
+	if !strings.HasPrefix(key, "jobs:") || len(key) != len("jobs:")+36 {
+		t.Errorf("Create returned %q, want jobs: followed by a UUID", key)
+	}
+
+	if v, err := cfg.Get(ctx, key); err != nil || v != "v" {
+		t.Errorf("Get(%q) = %q, %v, want v", key, v, err)
+	}
+}
+
+func TestCreateSequenceSurvivesRestore(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestConfig(t)
+
+	if _, _, err := cfg.Create(ctx, "", Entry{Value: "v"}); err != nil {
+		t.Fatalf("Create returned unexpected error: %s", err)
+	}
+	// The sequence goes on once the created key is gone
+	if _, _, err := cfg.DeleteAndGet(ctx, "1"); err != nil {
+		t.Fatalf("DeleteAndGet returned unexpected error: %s", err)
+	}
+
+	cfg.fsm.mu.RLock()
+	snapshot, err := encode(cfg.fsm.copyData(), FormatBase64)
+	cfg.fsm.mu.RUnlock()
+	if err != nil {
+		t.Fatalf("encode returned unexpected error: %s", err)
+	}
+
+	restored := newTestConfig(t)
+	meta := &raft.SnapshotMeta{Version: raft.SnapshotVersionMax, Index: cfg.appliedIndex(), Size: int64(len(snapshot))}
+	if err := restored.raft.Restore(meta, bytes.NewReader(snapshot), 0); err != nil {
+		t.Fatalf("Restore returned unexpected error: %s", err)
+	}
+
+	key, _, err := restored.Create(ctx, "", Entry{Value: "v"})
+	if err != nil {
+		t.Fatalf("Create returned unexpected error: %s", err)
+	}
+	if key != "2" {
+		t.Errorf("Create after restore returned %q, want 2", key)
+	}
+}
+
+func TestCreateRejectsReservedPrefix(t *testing.T) {
+	cfg := newTestConfig(t)
+
+	_, _, err := cfg.Create(context.Background(), cfg.reservedSpace()+"sequence:", Entry{Value: "v"})
+	if !errors.Is(err, ErrReservedKey) {
+		t.Errorf("Create returned %v, want ErrReservedKey", err)
+	}
+}
+
+func TestParseKeyAllocator(t *testing.T) {
+	for _, s := range []string{"sequence", "uuid"} {
+		if a, err := ParseKeyAllocator(s); err != nil || string(a) != s {
+			t.Errorf("ParseKeyAllocator(%q) = %q, %v", s, a, err)
+		}
+	}
+
+	if _, err := ParseKeyAllocator("ulid"); err == nil {
+		t.Errorf("ParseKeyAllocator accepted an unknown allocator")
+	}
+}
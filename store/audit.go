@@ -0,0 +1,163 @@
+package store
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+const (
+	auditQueueSize = 4096
+
+	// DefaultAuditMaxSize is the size past which the audit file is rotated.
+	DefaultAuditMaxSize = 100 << 20
+)
+
+// auditRecord is the audit entry of a committed change. Values aren't
+// recorded, only their size.
+type auditRecord struct {
+	Timestamp time.Time `json:"timestamp"`
+	Action    string    `json:"action"`
+	Key       string    `json:"key"`
+	ValueSize int       `json:"value_size"`
+	Principal string    `json:"principal,omitempty"`
+}
+
+// auditLog records the changes applied by the FSM, from the events it
+// publishes once a command is committed, either as JSON lines appended to a
+// file or to a logger. Records are written by their own goroutine through a
+// buffer so auditing never slows fsm.Apply down; like other subscribers, it
+// misses events if it falls more than auditQueueSize events behind, so the
+// audit log is best-effort.
+//
+// The file is rotated when it grows past maxSize: it is renamed with a .1
+// suffix, replacing the previous one, and a new file is started.
+type auditLog struct {
+	path    string
+	maxSize int64
+	file    *os.File
+	w       *bufio.Writer
+	size    int64
+
+	// sink receives the records when there is no file.
+	sink hclog.Logger
+
+	logger hclog.Logger
+}
+
+func newAuditFile(path string, maxSize int64, logger hclog.Logger) (*auditLog, error) {
+	a := &auditLog{path: path, maxSize: maxSize, logger: logger}
+	if err := a.open(); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+func newAuditLogger(sink hclog.Logger) *auditLog {
+	return &auditLog{sink: sink, logger: sink}
+}
+
+func (a *auditLog) open() error {
+	f, err := os.OpenFile(a.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("opening audit file: %w", err)
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("opening audit file: %w", err)
+	}
+
+	a.file, a.w, a.size = f, bufio.NewWriter(f), fi.Size()
+
+	return nil
+}
+
+// run records the events received on queue until it is closed. The buffer is
+// flushed whenever the queue is drained.
+func (a *auditLog) run(queue <-chan Event) {
+	for ev := range queue {
+		if err := a.record(auditRecord{
+			Timestamp: ev.Timestamp,
+			Action:    ev.Action,
+			Key:       ev.Key,
+			ValueSize: len(ev.Value),
+			Principal: ev.Principal,
+		}); err != nil {
+			a.logger.Error("couldn't write audit record", "key", ev.Key, "error", err)
+		}
+
+		if len(queue) == 0 {
+			if err := a.flush(); err != nil {
+				a.logger.Error("couldn't flush audit file", "error", err)
+			}
+		}
+	}
+
+	if err := a.close(); err != nil {
+		a.logger.Error("couldn't close audit file", "error", err)
+	}
+}
+
+func (a *auditLog) record(rec auditRecord) error {
+	if a.file == nil {
+		a.sink.Info("audit", "action", rec.Action, "key", rec.Key, "value_size", rec.ValueSize, "principal", rec.Principal)
+		return nil
+	}
+
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	if a.size > 0 && a.size+int64(len(line)) > a.maxSize {
+		if err := a.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := a.w.Write(line)
+	a.size += int64(n)
+
+	return err
+}
+
+func (a *auditLog) rotate() error {
+	if err := a.close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(a.path, a.path+".1"); err != nil {
+		return fmt.Errorf("rotating audit file: %w", err)
+	}
+
+	return a.open()
+}
+
+func (a *auditLog) flush() error {
+	if a.file == nil {
+		return nil
+	}
+
+	return a.w.Flush()
+}
+
+func (a *auditLog) close() error {
+	if a.file == nil {
+		return nil
+	}
+
+	if err := a.w.Flush(); err != nil {
+		a.file.Close()
+		return err
+	}
+
+	return a.file.Close()
+}
@@ -0,0 +1,119 @@
+package store
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+func readAuditFile(t *testing.T, path string) []auditRecord {
+	t.Helper()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var records []auditRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var rec auditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatalf("Invalid audit line %q: %s", scanner.Text(), err)
+		}
+		records = append(records, rec)
+	}
+
+	return records
+}
+
+func TestAuditLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	audit, err := newAuditFile(path, DefaultAuditMaxSize, hclog.NewNullLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UTC()
+	queue := make(chan Event, 2)
+	queue <- Event{Action: "set", Key: "k", Value: "vv", Timestamp: now, Principal: "deploy"}
+	queue <- Event{Action: "delete", Key: "k", Timestamp: now}
+	close(queue)
+	audit.run(queue)
+
+	records := readAuditFile(t, path)
+	expected := []auditRecord{
+		{Timestamp: now, Action: "set", Key: "k", ValueSize: 2, Principal: "deploy"},
+		{Timestamp: now, Action: "delete", Key: "k"},
+	}
+	if len(records) != len(expected) {
+		t.Fatalf("Got %d records, expected %d", len(records), len(expected))
+	}
+
+	for i, rec := range records {
+		if !rec.Timestamp.Equal(expected[i].Timestamp) || rec.Action != expected[i].Action ||
+			rec.Key != expected[i].Key || rec.ValueSize != expected[i].ValueSize || rec.Principal != expected[i].Principal {
+			t.Errorf("Got %+v, expected %+v", rec, expected[i])
+		}
+	}
+}
+
+func TestAuditPrincipal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	cfg, err := NewStandalone(t.TempDir(), WithLogger(hclog.NewNullLogger()), WithAuditFile(path, 0))
+	if err != nil {
+		t.Fatalf("NewStandalone returned unexpected error: %s", err)
+	}
+	t.Cleanup(func() { cfg.Shutdown() })
+
+	// The principal the request was authenticated as is recorded
+	ctx := WithPrincipal(context.Background(), Principal{Name: "deploy", Role: RoleWrite})
+	if err := cfg.Set(ctx, "k", "v"); err != nil {
+		t.Fatalf("Set returned unexpected error: %s", err)
+	}
+	if err := cfg.Set(context.Background(), "k", "w"); err != nil {
+		t.Fatalf("Set returned unexpected error: %s", err)
+	}
+
+	var records []auditRecord
+	for deadline := time.Now().Add(5 * time.Second); len(records) < 2 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+		records = readAuditFile(t, path)
+	}
+	if len(records) != 2 || records[0].Principal != "deploy" || records[1].Principal != "" {
+		t.Errorf("Got records %+v, expected the first one by deploy and the second by nobody", records)
+	}
+}
+
+func TestAuditLogRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	// Records are 79 bytes long, so two of them fit.
+	audit, err := newAuditFile(path, 200, hclog.NewNullLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	queue := make(chan Event, 3)
+	for _, key := range []string{"k1", "k2", "k3"} {
+		queue <- Event{Action: "set", Key: key, Timestamp: time.Unix(0, 0).UTC()}
+	}
+	close(queue)
+	audit.run(queue)
+
+	rotated := readAuditFile(t, path+".1")
+	current := readAuditFile(t, path)
+	if len(rotated) != 2 || len(current) != 1 {
+		t.Fatalf("Got %d rotated and %d current records, expected 2 and 1", len(rotated), len(current))
+	}
+
+	if current[0].Key != "k3" {
+		t.Errorf("Got key %s, expected k3", current[0].Key)
+	}
+}
@@ -0,0 +1,443 @@
+package store
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Role is what a token lets its holder do, each role allowing what the
+// previous ones do.
+type Role string
+
+const (
+	// RoleRead reads the keys and the status of the cluster.
+	RoleRead Role = "read"
+
+	// RoleWrite writes the keys.
+	RoleWrite Role = "write"
+
+	// RoleAdmin manages the cluster and the tokens.
+	RoleAdmin Role = "admin"
+)
+
+// roleRanks orders the roles, a role allows what the roles of lower rank do.
+var roleRanks = map[Role]int{RoleRead: 1, RoleWrite: 2, RoleAdmin: 3}
+
+// ParseRole returns the Role named s.
+func ParseRole(s string) (Role, error) {
+	if _, ok := roleRanks[Role(s)]; !ok {
+		return "", fmt.Errorf("%w: unknown role %q", ErrInvalidToken, s)
+	}
+
+	return Role(s), nil
+}
+
+// allows reports whether r allows what required does.
+func (r Role) allows(required Role) bool {
+	return roleRanks[r] >= roleRanks[required]
+}
+
+// signedTokenPrefix starts the tokens signed with the HMAC secret.
+const signedTokenPrefix = "kvs."
+
+// Principal is who a token authenticates as.
+type Principal struct {
+	Name string `json:"name"`
+	Role Role   `json:"role"`
+
+	// Policies are the names of the ACL policies restricting the keys the
+	// principal reaches, see ACLPolicy.
+	Policies []string `json:"policies,omitempty"`
+}
+
+// Token describes a token created through the API. The token itself isn't
+// kept, only its SHA-256 hash, the ID.
+type Token struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Role      Role      `json:"role"`
+	Policies  []string  `json:"policies,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// auth holds the tokens a node accepts on top of the tokens created through
+// the API, which are replicated with the data.
+type auth struct {
+	adminToken string
+	static     map[string]Role
+	secret     []byte
+}
+
+// newAuth returns the auth of the options, nil when authentication is off.
+func newAuth(o *options) *auth {
+	if o.adminToken == "" && len(o.staticTokens) == 0 && len(o.hmacSecret) == 0 {
+		return nil
+	}
+
+	return &auth{adminToken: o.adminToken, static: o.staticTokens, secret: o.hmacSecret}
+}
+
+// WithAdminToken turns authentication on, token being the bootstrap admin
+// token, accepted with RoleAdmin to create the other tokens. The node also
+// sends it with its join requests, so the nodes of a cluster share it.
+func WithAdminToken(token string) Option {
+	return func(o *options) {
+		o.adminToken = token
+	}
+}
+
+// WithStaticTokens turns authentication on, accepting each token of tokens
+// with its role. They are only known to the node, each node of a cluster is
+// given its own.
+func WithStaticTokens(tokens map[string]Role) Option {
+	return func(o *options) {
+		o.staticTokens = tokens
+	}
+}
+
+// WithHMACSecret turns authentication on, accepting the tokens signed with
+// secret, see SignToken. Unlike the tokens created through the API, signed
+// tokens can't be revoked before they expire.
+func WithHMACSecret(secret []byte) Option {
+	return func(o *options) {
+		o.hmacSecret = secret
+	}
+}
+
+// ParseTokens parses a comma separated list of <token>:<role> pairs.
+func ParseTokens(s string) (map[string]Role, error) {
+	tokens := map[string]Role{}
+	for _, pair := range strings.Split(s, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+
+		i := strings.LastIndex(pair, ":")
+		if i <= 0 {
+			return nil, errors.New("invalid token, expected <token>:<role>")
+		}
+		role, err := ParseRole(pair[i+1:])
+		if err != nil {
+			return nil, err
+		}
+		tokens[pair[:i]] = role
+	}
+
+	return tokens, nil
+}
+
+// AuthEnabled reports whether the node requires a token.
+func (cfg *Config) AuthEnabled() bool {
+	return cfg.auth != nil
+}
+
+// Authorize returns the principal token authenticates as, failing with
+// ErrUnauthorized when it authenticates as none and with ErrForbidden when
+// its role doesn't allow required. Every token is authorized when
+// authentication is off.
+func (cfg *Config) Authorize(ctx context.Context, token string, required Role) (Principal, error) {
+	if cfg.auth == nil {
+		return Principal{Name: "anonymous", Role: RoleAdmin}, nil
+	}
+
+	p, err := cfg.authenticate(ctx, token)
+	if err != nil {
+		return Principal{}, err
+	}
+	if !p.Role.allows(required) {
+		return Principal{}, fmt.Errorf("%w: %s has the %s role, %s is required", ErrForbidden, p.Name, p.Role, required)
+	}
+
+	return p, nil
+}
+
+// authenticate returns the principal token authenticates as.
+func (cfg *Config) authenticate(ctx context.Context, token string) (Principal, error) {
+	if token == "" {
+		return Principal{}, fmt.Errorf("%w: no token", ErrUnauthorized)
+	}
+
+	a := cfg.auth
+	if a.adminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(a.adminToken)) == 1 {
+		return Principal{Name: "admin", Role: RoleAdmin}, nil
+	}
+	for static, role := range a.static {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(static)) == 1 {
+			return Principal{Name: "static", Role: role}, nil
+		}
+	}
+	if strings.HasPrefix(token, signedTokenPrefix) && len(a.secret) > 0 {
+		return verifyToken(a.secret, token, time.Now())
+	}
+
+	e, found, err := cfg.fsm.localLookup(ctx, cfg.tokenKey(tokenID(token)))
+	if err != nil {
+		return Principal{}, err
+	}
+	if !found {
+		return Principal{}, fmt.Errorf("%w: unknown token", ErrUnauthorized)
+	}
+	var t Token
+	if err := json.Unmarshal([]byte(e.Value), &t); err != nil {
+		return Principal{}, fmt.Errorf("decoding token: %w", err)
+	}
+
+	return Principal{Name: t.Name, Role: t.Role, Policies: t.Policies}, nil
+}
+
+// signedClaims are the claims of a signed token.
+type signedClaims struct {
+	Subject   string   `json:"sub"`
+	Role      Role     `json:"role"`
+	Policies  []string `json:"pol,omitempty"`
+	ExpiresAt int64    `json:"exp"`
+}
+
+// SignToken returns a token authenticating as subject with role, bound to
+// the ACL policies, until expiresAt, signed with the HMAC secret of the node.
+// Every node sharing the secret accepts it. It fails when the node has no
+// secret.
+func (cfg *Config) SignToken(ctx context.Context, subject string, role Role, policies []string, expiresAt time.Time) (string, error) {
+	if cfg.auth == nil || len(cfg.auth.secret) == 0 {
+		return "", ErrNoHMACSecret
+	}
+	if _, err := ParseRole(string(role)); err != nil {
+		return "", err
+	}
+	if err := cfg.checkPolicies(ctx, policies); err != nil {
+		return "", err
+	}
+
+	return signToken(cfg.auth.secret, signedClaims{Subject: subject, Role: role, Policies: policies, ExpiresAt: expiresAt.Unix()})
+}
+
+// signToken encodes claims and their HMAC-SHA256 signature with secret.
+func signToken(secret []byte, claims signedClaims) (string, error) {
+	b, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("encoding claims: %w", err)
+	}
+	payload := base64.RawURLEncoding.EncodeToString(b)
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+
+	return signedTokenPrefix + payload + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// verifyToken returns the principal of the signed token if its signature
+// matches secret and it hasn't expired at now.
+func verifyToken(secret []byte, token string, now time.Time) (Principal, error) {
+	parts := strings.Split(strings.TrimPrefix(token, signedTokenPrefix), ".")
+	if len(parts) != 2 {
+		return Principal{}, fmt.Errorf("%w: malformed signed token", ErrUnauthorized)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return Principal{}, fmt.Errorf("%w: malformed signed token", ErrUnauthorized)
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(parts[0]))
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return Principal{}, fmt.Errorf("%w: invalid signature", ErrUnauthorized)
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return Principal{}, fmt.Errorf("%w: malformed signed token", ErrUnauthorized)
+	}
+	var claims signedClaims
+	if err := json.Unmarshal(b, &claims); err != nil {
+		return Principal{}, fmt.Errorf("%w: malformed signed token", ErrUnauthorized)
+	}
+	if !now.Before(time.Unix(claims.ExpiresAt, 0)) {
+		return Principal{}, fmt.Errorf("%w: token expired", ErrUnauthorized)
+	}
+	if _, ok := roleRanks[claims.Role]; !ok {
+		return Principal{}, fmt.Errorf("%w: unknown role %q", ErrUnauthorized, claims.Role)
+	}
+
+	return Principal{Name: claims.Subject, Role: claims.Role, Policies: claims.Policies}, nil
+}
+
+// tokenID returns the ID of token, the hex encoding of its SHA-256 hash.
+func tokenID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// tokenKey returns the key holding the token of id.
+func (cfg *Config) tokenKey(id string) string {
+	return cfg.internalKey("tokens", id)
+}
+
+// CreateToken creates a random token authenticating as name with role,
+// bound to the ACL policies, and returns it along with its description. The
+// token is only known to the caller, the cluster keeps its hash.
+func (cfg *Config) CreateToken(ctx context.Context, name string, role Role, policies []string) (string, Token, uint64, error) {
+	if name == "" {
+		return "", Token{}, 0, fmt.Errorf("%w: the name of the token is required", ErrInvalidToken)
+	}
+	if _, err := ParseRole(string(role)); err != nil {
+		return "", Token{}, 0, err
+	}
+	if err := cfg.checkPolicies(ctx, policies); err != nil {
+		return "", Token{}, 0, err
+	}
+	if err := cfg.writable(); err != nil {
+		return "", Token{}, 0, err
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", Token{}, 0, fmt.Errorf("generating token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	t := Token{ID: tokenID(token), Name: name, Role: role, Policies: policies, CreatedAt: time.Now().UTC()}
+	data, err := json.Marshal(t)
+	if err != nil {
+		return "", Token{}, 0, fmt.Errorf("encoding token: %w", err)
+	}
+	_, index, err := cfg.apply(ctx, Command{Action: "set", Key: cfg.tokenKey(t.ID), Data: data, ContentType: "application/json"})
+	if err != nil {
+		return "", Token{}, 0, err
+	}
+
+	return token, t, index, nil
+}
+
+// RevokeToken deletes the token of id, failing with ErrNotFound when there
+// is none.
+func (cfg *Config) RevokeToken(ctx context.Context, id string) (uint64, error) {
+	if err := cfg.writable(); err != nil {
+		return 0, err
+	}
+
+	_, found, err := cfg.fsm.localLookup(ctx, cfg.tokenKey(id))
+	if err != nil {
+		return 0, err
+	}
+	if !found {
+		return 0, fmt.Errorf("%w: token %q", ErrNotFound, id)
+	}
+
+	_, index, err := cfg.apply(ctx, Command{Action: "delete", Key: cfg.tokenKey(id)})
+
+	return index, err
+}
+
+// Tokens returns the tokens created through the API, oldest first.
+func (cfg *Config) Tokens(ctx context.Context) ([]Token, error) {
+	if err := readable(ctx); err != nil {
+		return nil, err
+	}
+
+	f := cfg.fsm
+	prefix := f.policies.key(cfg.tokenKey(""))
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	tokens := []Token{}
+	for key, e := range f.data {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		var t Token
+		if err := json.Unmarshal([]byte(e.Value), &t); err != nil {
+			return nil, fmt.Errorf("decoding token %q: %w", key, err)
+		}
+		tokens = append(tokens, t)
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].CreatedAt.Before(tokens[j].CreatedAt) })
+
+	return tokens, nil
+}
+
+// bearerToken returns the bearer token of the Authorization header of r.
+func bearerToken(r *http.Request) string {
+	h := r.Header.Get("Authorization")
+	if len(h) > len("Bearer ") && strings.EqualFold(h[:len("Bearer ")], "Bearer ") {
+		return strings.TrimSpace(h[len("Bearer "):])
+	}
+
+	return ""
+}
+
+// requiredRole returns the role r requires, false when it is open to
+// everyone: the probes of load balancers. The admin UI page, under /admin/,
+// requires the admin role like the API it drives.
+func requiredRole(r *http.Request) (Role, bool) {
+	path := r.URL.Path
+	switch {
+	case path == "/" || path == "/healthz" || path == "/readyz":
+		return "", false
+	case strings.HasPrefix(path, "/admin/"):
+		return RoleAdmin, true
+	case strings.HasPrefix(path, "/raft/") && r.Method != http.MethodGet:
+		return RoleAdmin, true
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		return RoleRead, true
+	case path == "/kv/mget" || path == "/kv/exists":
+		// Reads whose keys don't fit in a URL
+		return RoleRead, true
+	default:
+		return RoleWrite, true
+	}
+}
+
+// authorizeRequest checks the bearer token of r allows what r requires, and
+// returns r carrying its principal.
+func (cfg *Config) authorizeRequest(r *http.Request) (*http.Request, error) {
+	if cfg.auth == nil {
+		return r, nil
+	}
+	required, ok := requiredRole(r)
+	if !ok {
+		return r, nil
+	}
+
+	p, err := cfg.Authorize(r.Context(), bearerToken(r), required)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.WithContext(WithPrincipal(r.Context(), p)), nil
+}
+
+// rejectUnauthorized answers a request whose token doesn't allow it.
+func rejectUnauthorized(w http.ResponseWriter, err error) {
+	status, code := http.StatusForbidden, "forbidden"
+	if errors.Is(err, ErrUnauthorized) {
+		status, code = http.StatusUnauthorized, "unauthorized"
+		w.Header().Set("WWW-Authenticate", `Bearer realm="kv"`)
+	} else if !errors.Is(err, ErrForbidden) {
+		status, code = http.StatusInternalServerError, "internal"
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"code": code, "error": err.Error()})
+}
+
+// setToken sets the Authorization header of the requests of the node to
+// other nodes, when it has an admin token.
+func (cfg *Config) setToken(req *http.Request) {
+	if cfg.auth != nil && cfg.auth.adminToken != "" {
+		req.Header.Set("Authorization", "Bearer "+cfg.auth.adminToken)
+	}
+}
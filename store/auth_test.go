@@ -0,0 +1,149 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+func TestParseTokens(t *testing.T) {
+	tokens, err := ParseTokens("reader:read, a:b:admin,")
+	if err != nil {
+		t.Fatalf("ParseTokens returned unexpected error: %s", err)
+	}
+	if len(tokens) != 2 || tokens["reader"] != RoleRead || tokens["a:b"] != RoleAdmin {
+		t.Errorf("ParseTokens() = %v", tokens)
+	}
+
+	for _, s := range []string{"token", ":read", "token:root"} {
+		if _, err := ParseTokens(s); err == nil {
+			t.Errorf("ParseTokens(%q) returned no error", s)
+		}
+	}
+}
+
+func TestSignedTokens(t *testing.T) {
+	secret := []byte("secret")
+	now := time.Now()
+	token, err := signToken(secret, signedClaims{Subject: "ci", Role: RoleWrite, ExpiresAt: now.Add(time.Minute).Unix()})
+	if err != nil {
+		t.Fatalf("signToken returned unexpected error: %s", err)
+	}
+
+	p, err := verifyToken(secret, token, now)
+	if err != nil {
+		t.Fatalf("verifyToken returned unexpected error: %s", err)
+	}
+	if p.Name != "ci" || p.Role != RoleWrite {
+		t.Errorf("verifyToken() = %+v, want ci with the write role", p)
+	}
+
+	if _, err := verifyToken(secret, token, now.Add(time.Hour)); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("verifyToken() of an expired token = %v, want ErrUnauthorized", err)
+	}
+	if _, err := verifyToken([]byte("other"), token, now); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("verifyToken() with another secret = %v, want ErrUnauthorized", err)
+	}
+
+	// Changing the claims breaks the signature
+	other, _ := signToken(secret, signedClaims{Subject: "ci", Role: RoleAdmin, ExpiresAt: now.Add(time.Minute).Unix()})
+	forged := other[:strings.LastIndex(other, ".")] + token[strings.LastIndex(token, "."):]
+	if _, err := verifyToken(secret, forged, now); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("verifyToken() of a forged token = %v, want ErrUnauthorized", err)
+	}
+}
+
+func TestTokens(t *testing.T) {
+	ctx := context.Background()
+	cfg, err := NewStandalone(t.TempDir(), WithLogger(hclog.NewNullLogger()), WithAdminToken("root"))
+	if err != nil {
+		t.Fatalf("NewStandalone returned unexpected error: %s", err)
+	}
+
+	if _, _, _, err := cfg.CreateToken(ctx, "ci", "root", nil); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("CreateToken() with an unknown role = %v, want ErrInvalidToken", err)
+	}
+
+	token, created, _, err := cfg.CreateToken(ctx, "ci", RoleWrite, nil)
+	if err != nil {
+		t.Fatalf("CreateToken returned unexpected error: %s", err)
+	}
+	if created.ID != tokenID(token) || strings.Contains(created.ID, token) {
+		t.Errorf("CreateToken() ID = %s, want the hash of the token", created.ID)
+	}
+
+	p, err := cfg.Authorize(ctx, token, RoleWrite)
+	if err != nil || p.Name != "ci" {
+		t.Errorf("Authorize() = %+v, %v, want ci", p, err)
+	}
+	if _, err := cfg.Authorize(ctx, token, RoleAdmin); !errors.Is(err, ErrForbidden) {
+		t.Errorf("Authorize() for admin = %v, want ErrForbidden", err)
+	}
+
+	tokens, err := cfg.Tokens(ctx)
+	if err != nil || len(tokens) != 1 || tokens[0].ID != created.ID {
+		t.Errorf("Tokens() = %+v, %v, want the created token", tokens, err)
+	}
+
+	// Tokens aren't keys
+	list, _ := cfg.List(ctx, "", "", 0)
+	if len(list.Keys) != 0 {
+		t.Errorf("List() = %v, want no keys", list.Keys)
+	}
+
+	if _, err := cfg.RevokeToken(ctx, created.ID); err != nil {
+		t.Fatalf("RevokeToken returned unexpected error: %s", err)
+	}
+	if _, err := cfg.Authorize(ctx, token, RoleRead); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("Authorize() of a revoked token = %v, want ErrUnauthorized", err)
+	}
+	if _, err := cfg.RevokeToken(ctx, created.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("RevokeToken() again = %v, want ErrNotFound", err)
+	}
+}
+
+func TestMiddlewareAuth(t *testing.T) {
+	cfg, err := NewStandalone(t.TempDir(), WithLogger(hclog.NewNullLogger()),
+		WithAdminToken("root"), WithStaticTokens(map[string]Role{"reader": RoleRead}))
+	if err != nil {
+		t.Fatalf("NewStandalone returned unexpected error: %s", err)
+	}
+	h := cfg.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for _, tc := range []struct {
+		method, path, token string
+		want                int
+	}{
+		{http.MethodGet, "/readyz", "", http.StatusOK},
+		{http.MethodGet, "/key/a", "", http.StatusUnauthorized},
+		{http.MethodGet, "/key/a", "wrong", http.StatusUnauthorized},
+		{http.MethodGet, "/key/a", "reader", http.StatusOK},
+		{http.MethodPost, "/kv/mget", "reader", http.StatusOK},
+		{http.MethodPost, "/key/a", "reader", http.StatusForbidden},
+		{http.MethodGet, "/raft/status", "reader", http.StatusOK},
+		{http.MethodPost, "/raft/add", "reader", http.StatusForbidden},
+		{http.MethodPost, "/raft/add", "root", http.StatusOK},
+		{http.MethodGet, "/admin/tokens", "reader", http.StatusForbidden},
+		{http.MethodGet, "/admin/ui", "", http.StatusUnauthorized},
+		{http.MethodGet, "/admin/ui", "reader", http.StatusForbidden},
+		{http.MethodGet, "/admin/ui", "root", http.StatusOK},
+		{http.MethodPost, "/key/a", "root", http.StatusOK},
+	} {
+		r := httptest.NewRequest(tc.method, tc.path, nil)
+		if tc.token != "" {
+			r.Header.Set("Authorization", "Bearer "+tc.token)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		if w.Code != tc.want {
+			t.Errorf("%s %s with %q answered %d, want %d", tc.method, tc.path, tc.token, w.Code, tc.want)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package store
+
+import (
+	"context"
+	"fmt"
+)
+
+// Store is where the FSM saves its data between restarts. The FSM keeps the
+// data in memory and only calls Snapshot when starting and Restore according
+// to the persistence policy, the other methods let tools work on the saved
+// data without loading it whole. FileStore, saving a JSON file, is the
+// default, WithBackend selects another built in one and WithStore any
+// implementation.
+type Store interface {
+	// Get returns the entry at key, the zero Entry when there is none.
+	Get(ctx context.Context, key string) (Entry, error)
+
+	// Set stores e at key.
+	Set(ctx context.Context, key string, e Entry) error
+
+	// Delete removes key, doing nothing when it doesn't exist.
+	Delete(ctx context.Context, key string) error
+
+	// Iterate calls fn with every entry, in no particular order, stopping
+	// at the first error fn returns.
+	Iterate(ctx context.Context, fn func(key string, e Entry) error) error
+
+	// Snapshot returns all the entries.
+	Snapshot(ctx context.Context) (map[string]Entry, error)
+
+	// Restore replaces all the entries with data.
+	Restore(ctx context.Context, data map[string]Entry) error
+}
+
+// IncrementalStore is a Store saving changes to the data rather than the
+// whole of it. The FSM then only saves the keys that changed since the last
+// save, and calls Restore after Raft restored a snapshot.
+type IncrementalStore interface {
+	Store
+
+	// Update stores the entries of set and removes the keys of deleted, all
+	// at once: either every change is saved or none is.
+	Update(ctx context.Context, set map[string]Entry, deleted []string) error
+}
+
+// Backend names a built in Store.
+type Backend string
+
+const (
+	// BackendFile saves the data in the data file with a FileStore, the
+	// default.
+	BackendFile Backend = "file"
+
+	// BackendMemory keeps the data in a MemoryStore, saving nothing.
+	BackendMemory Backend = "memory"
+
+	// BackendBolt saves the data in the data file with a BoltStore, writing
+	// only the keys that changed.
+	BackendBolt Backend = "bolt"
+)
+
+// ParseBackend returns the Backend named s.
+func ParseBackend(s string) (Backend, error) {
+	switch b := Backend(s); b {
+	case BackendFile, BackendMemory, BackendBolt:
+		return b, nil
+	default:
+		return "", fmt.Errorf("unknown storage backend %q", s)
+	}
+}
+
+// newStore builds the Store the options select.
+func (o *options) newStore() (Store, error) {
+	switch {
+	case o.store != nil:
+		return o.store, nil
+	case o.backend == BackendMemory:
+		return NewMemoryStore(), nil
+	case o.backend == BackendBolt:
+		if o.keyring != nil {
+			return nil, fmt.Errorf("the %s backend doesn't support encryption", BackendBolt)
+		}
+		return NewBoltStore(o.dataFile)
+	default:
+		return NewEncryptedFileStore(o.dataFile, o.storageFormat, o.keyring), nil
+	}
+}
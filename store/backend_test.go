@@ -0,0 +1,88 @@
+package store
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+func TestWithStore(t *testing.T) {
+	ctx := context.Background()
+	backend := NewMemoryStore()
+	backend.Set(ctx, "existing", Entry{Value: "loaded"})
+
+	opts := []Option{WithLogger(hclog.NewNullLogger()), WithStore(backend), WithPersistence(PersistEveryWrite, 0)}
+	cfg, err := NewStandalone(t.TempDir(), opts...)
+	if err != nil {
+		t.Fatalf("NewStandalone returned unexpected error: %s", err)
+	}
+
+	if v, err := cfg.Get(ctx, "existing"); err != nil || v != "loaded" {
+		t.Errorf("Get(existing) = %q, %v, want the value of the store", v, err)
+	}
+
+	if _, err := cfg.SetEntry(ctx, "k", Entry{Value: "v"}); err != nil {
+		t.Fatalf("SetEntry returned unexpected error: %s", err)
+	}
+	if e, _ := backend.Get(ctx, "k"); e.Value != "v" {
+		t.Errorf("the write wasn't saved to the store, got %q", e.Value)
+	}
+
+	// The reserved keys saved with the data aren't written by clients
+	var keys []string
+	backend.Iterate(ctx, func(key string, e Entry) error {
+		if !strings.HasPrefix(key, cfg.reservedSpace()) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if len(keys) != 2 {
+		t.Errorf("the store holds %v, want existing and k", keys)
+	}
+}
+
+func TestWithBackend(t *testing.T) {
+	newStore := func(opts ...Option) Store {
+		o := newOptions(opts)
+		s, err := o.newStore()
+		if err != nil {
+			t.Fatalf("newStore returned unexpected error: %s", err)
+		}
+		return s
+	}
+
+	if _, ok := newStore().(*FileStore); !ok {
+		t.Errorf("the default store isn't a FileStore")
+	}
+	if _, ok := newStore(WithBackend(BackendMemory)).(*MemoryStore); !ok {
+		t.Errorf("WithBackend(BackendMemory) didn't select a MemoryStore")
+	}
+	bolt, ok := newStore(WithBackend(BackendBolt), WithDataFile(filepath.Join(t.TempDir(), "data.db"))).(*BoltStore)
+	if !ok {
+		t.Errorf("WithBackend(BackendBolt) didn't select a BoltStore")
+	} else {
+		bolt.Close()
+	}
+
+	custom := NewMemoryStore()
+	if s := newStore(WithStore(custom), WithBackend(BackendFile)); s != custom {
+		t.Errorf("WithStore didn't take precedence over WithBackend")
+	}
+
+	_, err := NewStandalone(t.TempDir(), WithLogger(hclog.NewNullLogger()), WithBackend(BackendMemory))
+	if err == nil {
+		t.Errorf("NewStandalone accepted a backend saving nothing")
+	}
+
+	for _, s := range []string{"file", "memory", "bolt"} {
+		if b, err := ParseBackend(s); err != nil || string(b) != s {
+			t.Errorf("ParseBackend(%q) = %q, %v", s, b, err)
+		}
+	}
+	if _, err := ParseBackend("badger"); err == nil {
+		t.Errorf("ParseBackend accepted an unknown backend")
+	}
+}
@@ -0,0 +1,140 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// BatchEntry is a value written by SetBatchEntries.
+type BatchEntry struct {
+	Value string
+
+	// TTL is how long the entry lives, zero means forever.
+	TTL time.Duration
+}
+
+// SetBatch stores every key/value pair of values in a single Raft log entry,
+// so they are all applied or none is. It returns the log index of the write.
+func (cfg *Config) SetBatch(ctx context.Context, values map[string]string) (uint64, error) {
+	entries := make(map[string]BatchEntry, len(values))
+	for key, value := range values {
+		entries[key] = BatchEntry{Value: value}
+	}
+
+	return cfg.SetBatchEntries(ctx, entries)
+}
+
+// SetBatchEntries is SetBatch with an optional TTL for each entry. The
+// expiration times are computed by the leader when the batch is submitted.
+func (cfg *Config) SetBatchEntries(ctx context.Context, entries map[string]BatchEntry) (uint64, error) {
+	return cfg.setBatch(ctx, "batch", entries)
+}
+
+// SetBatchIfAbsent is SetBatchEntries writing the entries only if none of
+// their keys is set. The check and the writes are applied as one command, so
+// no other write can slip in between. It fails with a *KeysExistError listing
+// the keys already set.
+func (cfg *Config) SetBatchIfAbsent(ctx context.Context, entries map[string]BatchEntry) (uint64, error) {
+	return cfg.setBatch(ctx, "batch-nx", entries)
+}
+
+// Precondition is the value a key must hold for SetBatchIf to write.
+type Precondition struct {
+	Key string
+
+	// Expected is the value Key must hold, empty also matches a missing key.
+	Expected string
+
+	// Next is the value Key is set to along with the batch. When it is
+	// empty, an integer Expected is bumped by one.
+	Next string
+}
+
+// SetBatchIf is SetBatchEntries writing the entries only if the key of pre
+// holds the expected value, setting it to the next one in the same command:
+// writers deploying a batch against the same expected version can't both
+// succeed. It fails with ErrConditionFailed, writing nothing, when the key
+// holds another value.
+func (cfg *Config) SetBatchIf(ctx context.Context, pre Precondition, entries map[string]BatchEntry) (uint64, error) {
+	if err := cfg.validateKey(pre.Key); err != nil {
+		return 0, err
+	}
+	if _, ok := entries[pre.Key]; ok {
+		return 0, fmt.Errorf("%w: %q is the precondition key, it can't be written by the batch", ErrInvalidPrecondition, pre.Key)
+	}
+
+	next := pre.Next
+	if next == "" {
+		version, err := strconv.ParseInt(pre.Expected, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%w: the next value of %q is needed when %q isn't an integer", ErrInvalidPrecondition, pre.Key, pre.Expected)
+		}
+		next = strconv.FormatInt(version+1, 10)
+	}
+	if err := validateValue(next); err != nil {
+		return 0, fmt.Errorf("%q: %w", pre.Key, err)
+	}
+
+	cmd, err := cfg.batchCommand("batch-if", entries)
+	if err != nil {
+		return 0, err
+	}
+	cmd.Key, cmd.Expected, cmd.Data = pre.Key, pre.Expected, []byte(next)
+
+	if err := cfg.writable(); err != nil {
+		return 0, err
+	}
+
+	_, index, err := cfg.apply(ctx, cmd)
+	return index, err
+}
+
+// setBatch applies the batch command action writing entries.
+func (cfg *Config) setBatch(ctx context.Context, action string, entries map[string]BatchEntry) (uint64, error) {
+	cmd, err := cfg.batchCommand(action, entries)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := cfg.writable(); err != nil {
+		return 0, err
+	}
+
+	_, index, err := cfg.apply(ctx, cmd)
+	return index, err
+}
+
+// batchCommand builds the batch command action writing entries.
+func (cfg *Config) batchCommand(action string, entries map[string]BatchEntry) (Command, error) {
+	now := time.Now()
+	cmd := Command{Action: action, Entries: make([]CommandEntry, 0, len(entries)), Now: now.UnixNano()}
+	for key, e := range entries {
+		if err := cfg.validateKey(key); err != nil {
+			return Command{}, err
+		}
+
+		if err := validateValue(e.Value); err != nil {
+			return Command{}, fmt.Errorf("%q: %w", key, err)
+		}
+
+		if e.TTL < 0 {
+			return Command{}, fmt.Errorf("%w: %q has a negative TTL", ErrInvalidTTL, key)
+		}
+
+		ce := CommandEntry{Key: key, Data: []byte(e.Value)}
+		if e.TTL > 0 {
+			ce.ExpiresAt = now.Add(e.TTL).UnixNano()
+		}
+		cmd.Entries = append(cmd.Entries, ce)
+	}
+
+	// Keep the log entry identical whatever the map order
+	sort.Slice(cmd.Entries, func(i, j int) bool {
+		return cmd.Entries[i].Key < cmd.Entries[j].Key
+	})
+
+	return cmd, nil
+}
@@ -0,0 +1,175 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/raft"
+)
+
+func TestSetBatchEntries(t *testing.T) {
+	cfg := newTestConfig(t)
+	ctx := context.Background()
+
+	_, err := cfg.SetBatchEntries(ctx, map[string]BatchEntry{
+		"k1":      {Value: "v1"},
+		"k2":      {Value: "v2"},
+		"session": {Value: "abc", TTL: 100 * time.Millisecond},
+	})
+	if err != nil {
+		t.Fatalf("SetBatchEntries returned unexpected error: %s", err)
+	}
+
+	for key, expected := range map[string]string{"k1": "v1", "k2": "v2", "session": "abc"} {
+		if got, err := cfg.Get(ctx, key); err != nil || got != expected {
+			t.Errorf("Get(%s): Got %q (error: %v), expected %q", key, got, err, expected)
+		}
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	if got, _ := cfg.Get(ctx, "session"); got != "" {
+		t.Errorf("Expired key still returned %q", got)
+	}
+
+	// Purge the expired entry the way the leader does
+	if _, _, err := cfg.apply(ctx, Command{Action: "expire", Now: time.Now().UnixNano()}); err != nil {
+		t.Fatalf("expire returned unexpected error: %s", err)
+	}
+
+	data := cfg.fsm.data
+	if _, ok := data["session"]; ok {
+		t.Errorf("Expired key wasn't purged")
+	}
+	if _, ok := data["k1"]; !ok {
+		t.Errorf("Key without TTL was purged")
+	}
+}
+
+func TestSetBatchEntriesRejectsWholeBatch(t *testing.T) {
+	cfg := newTestConfig(t)
+	ctx := context.Background()
+
+	_, err := cfg.SetBatchEntries(ctx, map[string]BatchEntry{
+		"k1": {Value: "v1"},
+		"":   {Value: "v2"},
+	})
+	if err == nil {
+		t.Fatalf("SetBatchEntries accepted an empty key")
+	}
+
+	if got, _ := cfg.Get(ctx, "k1"); got != "" {
+		t.Errorf("Part of a rejected batch was written")
+	}
+}
+
+func TestSetBatchIfAbsent(t *testing.T) {
+	cfg := newTestConfig(t)
+	ctx := context.Background()
+
+	cfg.Set(ctx, "taken", "old")
+
+	_, err := cfg.SetBatchIfAbsent(ctx, map[string]BatchEntry{
+		"k1":    {Value: "v1"},
+		"taken": {Value: "new"},
+		"k2":    {Value: "v2"},
+	})
+	var keysExist *KeysExistError
+	if !errors.As(err, &keysExist) || !errors.Is(err, ErrKeyExists) {
+		t.Fatalf("Got error %v, expected a KeysExistError", err)
+	}
+	if !reflect.DeepEqual(keysExist.Keys, []string{"taken"}) {
+		t.Errorf("Got conflicting keys %v, expected [taken]", keysExist.Keys)
+	}
+
+	for key, expected := range map[string]string{"k1": "", "k2": "", "taken": "old"} {
+		if got, _ := cfg.Get(ctx, key); got != expected {
+			t.Errorf("Get(%s): Got %q after the failed batch, expected %q", key, got, expected)
+		}
+	}
+
+	if _, err := cfg.SetBatchIfAbsent(ctx, map[string]BatchEntry{"k1": {Value: "v1"}, "k2": {Value: "v2"}}); err != nil {
+		t.Fatalf("SetBatchIfAbsent returned unexpected error: %s", err)
+	}
+	if got, _ := cfg.Get(ctx, "k2"); got != "v2" {
+		t.Errorf("Got %q, expected %q", got, "v2")
+	}
+}
+
+func TestBatchReplay(t *testing.T) {
+	// The key expired long ago by the local clock, but not yet at the time of
+	// the first writes
+	at := func(d time.Duration) string {
+		return strconv.FormatInt(time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC).Add(d).UnixNano(), 10)
+	}
+	f := newFSM(NewFileStore(filepath.Join(t.TempDir(), "data.json")), hclog.NewNullLogger())
+	f.Apply(&raft.Log{Index: 1, Data: []byte(`{"Action":"batch","Entries":[{"Key":"taken","Data":"dg==","ExpiresAt":` + at(time.Minute) + `}]}`)})
+
+	testCases := []struct {
+		log *raft.Log
+		err error
+	}{
+		{&raft.Log{Index: 2, Data: []byte(`{"Action":"batch-nx","Entries":[{"Key":"taken","Data":"dw=="}],"Now":` + at(30*time.Second) + `}`)}, ErrKeyExists},
+		{&raft.Log{Index: 3, Data: []byte(`{"Action":"create","Key":"taken","Data":"dw==","Now":` + at(30*time.Second) + `}`)}, ErrKeyExists},
+		{&raft.Log{Index: 4, Data: []byte(`{"Action":"batch-if","Key":"taken","Entries":[{"Key":"other","Data":"dw=="}],"Now":` + at(30*time.Second) + `}`)}, ErrConditionFailed},
+		{&raft.Log{Index: 5, Data: []byte(`{"Action":"batch-nx","Entries":[{"Key":"taken","Data":"dw=="}],"Now":` + at(2*time.Minute) + `}`)}, nil},
+	}
+	for _, test := range testCases {
+		err, _ := f.Apply(test.log).(error)
+		if !errors.Is(err, test.err) {
+			t.Errorf("Log %d: got error %v, expected %v", test.log.Index, err, test.err)
+		}
+	}
+}
+
+func TestSetBatchIf(t *testing.T) {
+	cfg := newTestConfig(t)
+	ctx := context.Background()
+
+	cfg.Set(ctx, "version", "41")
+	batch := map[string]BatchEntry{"app:a": {Value: "1"}, "app:b": {Value: "2"}}
+
+	_, err := cfg.SetBatchIf(ctx, Precondition{Key: "version", Expected: "40"}, batch)
+	if !errors.Is(err, ErrConditionFailed) {
+		t.Fatalf("Got error %v for a stale version, expected %v", err, ErrConditionFailed)
+	}
+	for key, expected := range map[string]string{"app:a": "", "version": "41"} {
+		if got, _ := cfg.Get(ctx, key); got != expected {
+			t.Errorf("Get(%s): Got %q after the failed batch, expected %q", key, got, expected)
+		}
+	}
+
+	// The version is bumped along with the batch
+	if _, err := cfg.SetBatchIf(ctx, Precondition{Key: "version", Expected: "41"}, batch); err != nil {
+		t.Fatalf("SetBatchIf returned unexpected error: %s", err)
+	}
+	for key, expected := range map[string]string{"app:a": "1", "app:b": "2", "version": "42"} {
+		if got, _ := cfg.Get(ctx, key); got != expected {
+			t.Errorf("Get(%s): Got %q, expected %q", key, got, expected)
+		}
+	}
+
+	// So the same deploy can't be applied twice
+	if _, err := cfg.SetBatchIf(ctx, Precondition{Key: "version", Expected: "41"}, batch); !errors.Is(err, ErrConditionFailed) {
+		t.Errorf("Got error %v replaying the deploy, expected %v", err, ErrConditionFailed)
+	}
+
+	// A missing key matches an empty expected value
+	if _, err := cfg.SetBatchIf(ctx, Precondition{Key: "release", Next: "blue"}, batch); err != nil {
+		t.Errorf("SetBatchIf on a missing key returned unexpected error: %s", err)
+	}
+	if got, _ := cfg.Get(ctx, "release"); got != "blue" {
+		t.Errorf("Got %q, expected the next value", got)
+	}
+
+	for _, pre := range []Precondition{{Key: "release", Expected: "blue"}, {Key: "app:a", Expected: "1", Next: "x"}} {
+		if _, err := cfg.SetBatchIf(ctx, pre, batch); !errors.Is(err, ErrInvalidPrecondition) {
+			t.Errorf("%+v: Got error %v, expected %v", pre, err, ErrInvalidPrecondition)
+		}
+	}
+}
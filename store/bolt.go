@@ -0,0 +1,216 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// boltBucket is the bucket holding the entries of a BoltStore.
+var boltBucket = []byte("entries")
+
+// BoltStore is an IncrementalStore saving the entries in a bbolt file: the
+// FSM only writes the keys that changed, each save is a single transaction,
+// so a node killed while saving finds the data as it was before the save or
+// after it, never a partial write.
+type BoltStore struct {
+	db   *bolt.DB
+	path string
+}
+
+var _ IncrementalStore = (*BoltStore)(nil)
+
+// boltEntry is an entry as saved in the bucket, under its key.
+type boltEntry struct {
+	Value       []byte            `json:"v"`
+	ContentType string            `json:"t,omitempty"`
+	Metadata    map[string]string `json:"m,omitempty"`
+
+	// ExpiresAt is the expiration time of the entry in Unix nanoseconds.
+	ExpiresAt int64  `json:"e,omitempty"`
+	Revision  uint64 `json:"r,omitempty"`
+
+	// History holds the previous versions of the entry.
+	History []boltEntry `json:"h,omitempty"`
+}
+
+// NewBoltStore opens the bbolt file at path, creating it if it doesn't exist.
+// The file is locked while it is open, NewBoltStore fails with
+// ErrStoreLocked if it stays locked by another process for a second.
+func NewBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err == bolt.ErrTimeout {
+		return nil, fmt.Errorf("%w: %s is open in another process", ErrStoreLocked, path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("opening %s: %w", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("creating bucket in %s: %w", path, err)
+	}
+
+	return &BoltStore{db: db, path: path}, nil
+}
+
+// Path returns the location of the bbolt file.
+func (s *BoltStore) Path() string {
+	return s.path
+}
+
+// Close closes the bbolt file, releasing its lock.
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+// Get returns the entry at key.
+func (s *BoltStore) Get(ctx context.Context, key string) (Entry, error) {
+	if err := readable(ctx); err != nil {
+		return Entry{}, err
+	}
+
+	var e Entry
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(boltBucket).Get([]byte(key))
+		if b == nil {
+			return nil
+		}
+
+		var err error
+		e, err = decodeBoltEntry(b)
+		return err
+	})
+
+	return e, err
+}
+
+// Set stores e at key.
+func (s *BoltStore) Set(ctx context.Context, key string, e Entry) error {
+	return s.Update(ctx, map[string]Entry{key: e}, nil)
+}
+
+// Delete removes key.
+func (s *BoltStore) Delete(ctx context.Context, key string) error {
+	return s.Update(ctx, nil, []string{key})
+}
+
+// Update stores the entries of set and removes the keys of deleted in a
+// single transaction.
+func (s *BoltStore) Update(ctx context.Context, set map[string]Entry, deleted []string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltBucket)
+		for _, key := range deleted {
+			if err := bucket.Delete([]byte(key)); err != nil {
+				return err
+			}
+		}
+
+		return putBoltEntries(bucket, set)
+	})
+}
+
+// Iterate calls fn with every entry, in key order.
+func (s *BoltStore) Iterate(ctx context.Context, fn func(key string, e Entry) error) error {
+	if err := readable(ctx); err != nil {
+		return err
+	}
+
+	return s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucket).ForEach(func(k, v []byte) error {
+			e, err := decodeBoltEntry(v)
+			if err != nil {
+				return fmt.Errorf("decoding %q: %w", k, err)
+			}
+
+			return fn(string(k), e)
+		})
+	})
+}
+
+// Snapshot returns all the entries.
+func (s *BoltStore) Snapshot(ctx context.Context) (map[string]Entry, error) {
+	data := map[string]Entry{}
+	err := s.Iterate(ctx, func(key string, e Entry) error {
+		data[key] = e
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// Restore replaces all the entries with data in a single transaction.
+func (s *BoltStore) Restore(ctx context.Context, data map[string]Entry) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket(boltBucket); err != nil {
+			return err
+		}
+
+		bucket, err := tx.CreateBucket(boltBucket)
+		if err != nil {
+			return err
+		}
+
+		return putBoltEntries(bucket, data)
+	})
+}
+
+// putBoltEntries stores the entries of data in bucket.
+func putBoltEntries(bucket *bolt.Bucket, data map[string]Entry) error {
+	for key, e := range data {
+		b, err := json.Marshal(newBoltEntry(e))
+		if err != nil {
+			return err
+		}
+		if err := bucket.Put([]byte(key), b); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// newBoltEntry returns the boltEntry of e, its versions included.
+func newBoltEntry(e Entry) boltEntry {
+	be := boltEntry{Value: []byte(e.Value), ContentType: e.ContentType, Metadata: e.Metadata, Revision: e.Revision}
+	if !e.ExpiresAt.IsZero() {
+		be.ExpiresAt = e.ExpiresAt.UnixNano()
+	}
+	for _, version := range e.history {
+		be.History = append(be.History, newBoltEntry(version))
+	}
+
+	return be
+}
+
+func decodeBoltEntry(b []byte) (Entry, error) {
+	var be boltEntry
+	if err := json.Unmarshal(b, &be); err != nil {
+		return Entry{}, err
+	}
+
+	return be.entry(), nil
+}
+
+// entry returns the Entry be holds, its versions included.
+func (be boltEntry) entry() Entry {
+	e := Entry{Value: string(be.Value), ContentType: be.ContentType, Metadata: be.Metadata, Revision: be.Revision}
+	if be.ExpiresAt != 0 {
+		e.ExpiresAt = time.Unix(0, be.ExpiresAt)
+	}
+	for _, version := range be.History {
+		e.history = append(e.history, version.entry())
+	}
+
+	return e
+}
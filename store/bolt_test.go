@@ -0,0 +1,154 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+func newTestBoltStore(t *testing.T, path string) *BoltStore {
+	t.Helper()
+
+	s, err := NewBoltStore(path)
+	if err != nil {
+		t.Fatalf("NewBoltStore returned unexpected error: %s", err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	return s
+}
+
+func TestBoltStore(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "data.db")
+	s := newTestBoltStore(t, path)
+
+	expires := time.Now().Add(time.Hour).Round(0)
+	data := map[string]Entry{
+		"key1":      {Value: "value1"},
+		"versioned": {Value: "v2", Revision: 9, history: []Entry{{Value: "v1", Revision: 4}}},
+		"with/char": {Value: "sp ace\x00binary", ContentType: "application/octet-stream", Metadata: map[string]string{"owner": "me"}, ExpiresAt: expires},
+	}
+	if err := s.Restore(ctx, map[string]Entry{"stale": {Value: "x"}}); err != nil {
+		t.Fatalf("Restore returned unexpected error: %s", err)
+	}
+	if err := s.Restore(ctx, data); err != nil {
+		t.Fatalf("Restore returned unexpected error: %s", err)
+	}
+
+	err := s.Update(ctx, map[string]Entry{"key2": {Value: "value2"}}, []string{"key1", "missing"})
+	if err != nil {
+		t.Fatalf("Update returned unexpected error: %s", err)
+	}
+	delete(data, "key1")
+	data["key2"] = Entry{Value: "value2"}
+
+	// The entries outlive the process
+	s.Close()
+	s = newTestBoltStore(t, path)
+
+	got, err := s.Snapshot(ctx)
+	if err != nil {
+		t.Fatalf("Snapshot returned unexpected error: %s", err)
+	}
+	if len(got) != len(data) {
+		t.Fatalf("Snapshot() = %v, want %v", got, data)
+	}
+	for key, e := range data {
+		g := got[key]
+		if g.Value != e.Value || g.ContentType != e.ContentType || !reflect.DeepEqual(g.Metadata, e.Metadata) ||
+			!g.ExpiresAt.Equal(e.ExpiresAt) || g.Revision != e.Revision || !reflect.DeepEqual(g.history, e.history) {
+			t.Errorf("Entry at %q is %+v, want %+v", key, g, e)
+		}
+	}
+
+	if e, err := s.Get(ctx, "key1"); err != nil || !reflect.DeepEqual(e, Entry{}) {
+		t.Errorf("Get(key1) = %+v, %v, want the zero Entry", e, err)
+	}
+}
+
+func TestBoltStoreLocked(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.db")
+	newTestBoltStore(t, path)
+
+	if _, err := NewBoltStore(path); !errors.Is(err, ErrStoreLocked) {
+		t.Errorf("Opening an open bolt file returned %v, want ErrStoreLocked", err)
+	}
+}
+
+// updateRecorder records the changes saved to an IncrementalStore.
+type updateRecorder struct {
+	*BoltStore
+	restores int
+	set      []string
+	deleted  []string
+}
+
+func (r *updateRecorder) Restore(ctx context.Context, data map[string]Entry) error {
+	r.restores++
+	return r.BoltStore.Restore(ctx, data)
+}
+
+func (r *updateRecorder) Update(ctx context.Context, set map[string]Entry, deleted []string) error {
+	r.set, r.deleted = nil, deleted
+	for key := range set {
+		r.set = append(r.set, key)
+	}
+	sort.Strings(r.set)
+	sort.Strings(r.deleted)
+
+	return r.BoltStore.Update(ctx, set, deleted)
+}
+
+func TestFlushSavesChangedKeys(t *testing.T) {
+	ctx := context.Background()
+	backend := newTestBoltStore(t, filepath.Join(t.TempDir(), "data.db"))
+	backend.Restore(ctx, map[string]Entry{"a": {Value: "1"}, "b": {Value: "2"}, "c": {Value: "3"}})
+
+	recorder := &updateRecorder{BoltStore: backend}
+	f := newFSM(recorder, hclog.NewNullLogger())
+	if err := f.load(ctx); err != nil {
+		t.Fatalf("load returned unexpected error: %s", err)
+	}
+
+	f.mu.Lock()
+	f.put("b", Entry{Value: "two"})
+	f.put("d", Entry{Value: "4"})
+	f.remove("c")
+	f.dirty = true
+	f.mu.Unlock()
+
+	if err := f.flush(ctx); err != nil {
+		t.Fatalf("flush returned unexpected error: %s", err)
+	}
+	if recorder.restores != 0 {
+		t.Errorf("flush rewrote the whole data instead of the changes")
+	}
+	if want := []string{"b", "d"}; !reflect.DeepEqual(recorder.set, want) {
+		t.Errorf("flush saved %v, want %v", recorder.set, want)
+	}
+	if want := []string{"c"}; !reflect.DeepEqual(recorder.deleted, want) {
+		t.Errorf("flush removed %v, want %v", recorder.deleted, want)
+	}
+
+	// Restoring a snapshot replaces the data whole
+	f.mu.Lock()
+	f.reset(map[string]Entry{"z": {Value: "26"}})
+	f.dirty = true
+	f.mu.Unlock()
+	if err := f.flush(ctx); err != nil {
+		t.Fatalf("flush returned unexpected error: %s", err)
+	}
+	if recorder.restores != 1 {
+		t.Errorf("flush after a restore didn't rewrite the whole data")
+	}
+	if got, _ := backend.Snapshot(ctx); len(got) != 1 || got["z"].Value != "26" {
+		t.Errorf("the store holds %v after the restore, want z only", got)
+	}
+}
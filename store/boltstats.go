@@ -0,0 +1,101 @@
+package store
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+
+	raftbolt "github.com/hashicorp/raft-boltdb/v2"
+)
+
+// BoltStats are the statistics of one of the BoltDB files backing Raft.
+// Transaction counters are totals since the node started.
+type BoltStats struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+
+	FreePages     int `json:"free_pages"`
+	PendingPages  int `json:"pending_pages"`
+	FreeBytes     int `json:"free_bytes"`
+	FreelistBytes int `json:"freelist_bytes"`
+
+	ReadTx     int `json:"read_tx"`
+	OpenReadTx int `json:"open_read_tx"`
+
+	PageCount int `json:"page_count"`
+	PageBytes int `json:"page_bytes"`
+	Cursors   int `json:"cursors"`
+	Nodes     int `json:"nodes"`
+	Rebalance int `json:"rebalance"`
+	Splits    int `json:"splits"`
+	Spills    int `json:"spills"`
+	Writes    int `json:"writes"`
+}
+
+// LogStoreStats adds the range of indexes still held by the log store, which
+// shrinks when a snapshot compacts the log.
+type LogStoreStats struct {
+	BoltStats
+	FirstIndex uint64 `json:"first_index"`
+	LastIndex  uint64 `json:"last_index"`
+}
+
+func boltStats(bs *raftbolt.BoltStore, path string) BoltStats {
+	s := bs.Stats()
+	stats := BoltStats{
+		Path:          path,
+		FreePages:     s.FreePageN,
+		PendingPages:  s.PendingPageN,
+		FreeBytes:     s.FreeAlloc,
+		FreelistBytes: s.FreelistInuse,
+		ReadTx:        s.TxN,
+		OpenReadTx:    s.OpenTxN,
+		PageCount:     s.TxStats.PageCount,
+		PageBytes:     s.TxStats.PageAlloc,
+		Cursors:       s.TxStats.CursorCount,
+		Nodes:         s.TxStats.NodeCount,
+		Rebalance:     s.TxStats.Rebalance,
+		Splits:        s.TxStats.Split,
+		Spills:        s.TxStats.Spill,
+		Writes:        s.TxStats.Write,
+	}
+
+	if fi, err := os.Stat(path); err == nil {
+		stats.Size = fi.Size()
+	}
+
+	return stats
+}
+
+// BoltStatsHandler serves the statistics of the stable and log stores of this
+// node. It only reads local state, so followers answer it themselves.
+func (cfg *Config) BoltStatsHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		jw := json.NewEncoder(w)
+
+		if cfg.stableStore == nil || cfg.logStore == nil {
+			w.WriteHeader(http.StatusNotFound)
+			jw.Encode(map[string]string{"error": "raft isn't backed by bolt stores"})
+
+			return
+		}
+
+		logStats := LogStoreStats{BoltStats: boltStats(cfg.logStore, cfg.logStorePath)}
+		var err error
+		if logStats.FirstIndex, err = cfg.logStore.FirstIndex(); err == nil {
+			logStats.LastIndex, err = cfg.logStore.LastIndex()
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			jw.Encode(map[string]string{"error": err.Error()})
+
+			return
+		}
+
+		jw.Encode(struct {
+			Stable BoltStats     `json:"stable"`
+			Log    LogStoreStats `json:"log"`
+		}{boltStats(cfg.stableStore, cfg.stableStorePath), logStats})
+	}
+}
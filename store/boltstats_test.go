@@ -0,0 +1,64 @@
+package store
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/raft"
+	raftbolt "github.com/hashicorp/raft-boltdb/v2"
+)
+
+func TestBoltStatsHandler(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &Config{
+		stableStorePath: filepath.Join(dir, "stable"),
+		logStorePath:    filepath.Join(dir, "log"),
+	}
+
+	var err error
+	if cfg.stableStore, err = raftbolt.NewBoltStore(cfg.stableStorePath); err != nil {
+		t.Fatal(err)
+	}
+	defer cfg.stableStore.Close()
+
+	if cfg.logStore, err = raftbolt.NewBoltStore(cfg.logStorePath); err != nil {
+		t.Fatal(err)
+	}
+	defer cfg.logStore.Close()
+
+	for i := uint64(3); i <= 5; i++ {
+		if err := cfg.logStore.StoreLog(&raft.Log{Index: i, Term: 1, Data: []byte("data")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	recorder := httptest.NewRecorder()
+	cfg.BoltStatsHandler()(recorder, httptest.NewRequest(http.MethodGet, "/raft/boltstats", nil))
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Got status %d, expected %d", recorder.Code, http.StatusOK)
+	}
+
+	var got struct {
+		Stable BoltStats
+		Log    LogStoreStats
+	}
+	if err := json.NewDecoder(recorder.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Log.FirstIndex != 3 || got.Log.LastIndex != 5 {
+		t.Errorf("Got log indexes %d-%d, expected 3-5", got.Log.FirstIndex, got.Log.LastIndex)
+	}
+
+	if got.Log.Writes == 0 || got.Log.Size == 0 {
+		t.Errorf("Got %+v, expected writes and a size", got.Log)
+	}
+
+	if got.Stable.Path != cfg.stableStorePath {
+		t.Errorf("Got path %s, expected %s", got.Stable.Path, cfg.stableStorePath)
+	}
+}
@@ -0,0 +1,168 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A bucket is a namespace created before use, to share the cluster between
+// applications: the key k of the bucket b is b followed by the key
+// separator and k in the keyspace, so the quotas, the limits and the ACL
+// rules of the namespace apply to the bucket. Deleting a bucket deletes its
+// keys.
+
+// Bucket is a bucket of keys.
+type Bucket struct {
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// bucketKey returns the key recording the bucket name.
+func (cfg *Config) bucketKey(name string) string {
+	return cfg.internalKey("bucket", name)
+}
+
+// validateBucket checks name can name a bucket: a valid namespace.
+func (cfg *Config) validateBucket(name string) error {
+	if name == "" || strings.Contains(name, cfg.keySeparator) {
+		return fmt.Errorf("%w: invalid bucket name %q", ErrInvalidKey, name)
+	}
+
+	return cfg.validateKey(name + cfg.keySeparator)
+}
+
+// CreateBucket creates the bucket name, failing with ErrBucketExists when it
+// already exists. Keys of its namespace written before are in the bucket.
+func (cfg *Config) CreateBucket(ctx context.Context, name string) (uint64, error) {
+	if err := cfg.validateBucket(name); err != nil {
+		return 0, err
+	}
+	if err := cfg.writable(); err != nil {
+		return 0, err
+	}
+
+	data, err := json.Marshal(Bucket{Name: name, CreatedAt: time.Now().UTC()})
+	if err != nil {
+		return 0, fmt.Errorf("encoding bucket: %w", err)
+	}
+	_, index, err := cfg.apply(ctx, Command{
+		Action:  "batch-nx",
+		Entries: []CommandEntry{{Key: cfg.bucketKey(name), Data: data}},
+		Now:     time.Now().UnixNano(),
+	})
+	if errors.Is(err, ErrKeyExists) {
+		return 0, fmt.Errorf("%w: %q", ErrBucketExists, name)
+	}
+
+	return index, err
+}
+
+// DeleteBucket deletes the bucket name and its keys in a single Raft log
+// entry, failing with ErrBucketNotFound when there is no such bucket. It
+// returns the number of keys deleted and the log index of the write.
+func (cfg *Config) DeleteBucket(ctx context.Context, name string) (int, uint64, error) {
+	if err := cfg.validateBucket(name); err != nil {
+		return 0, 0, err
+	}
+	if err := cfg.writable(); err != nil {
+		return 0, 0, err
+	}
+
+	resp, index, err := cfg.apply(ctx, Command{Action: "delete-bucket", Key: name})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	n, _ := resp.(int)
+	return n, index, nil
+}
+
+// Buckets returns the buckets, by name.
+func (cfg *Config) Buckets(ctx context.Context) ([]Bucket, error) {
+	if err := readable(ctx); err != nil {
+		return nil, err
+	}
+
+	f := cfg.fsm
+	prefix := f.policies.key(cfg.bucketKey(""))
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	buckets := []Bucket{}
+	for key, e := range f.data {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		var b Bucket
+		if err := json.Unmarshal([]byte(e.Value), &b); err != nil {
+			return nil, fmt.Errorf("decoding bucket %q: %w", key, err)
+		}
+		buckets = append(buckets, b)
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].Name < buckets[j].Name })
+
+	return buckets, nil
+}
+
+// BucketKey returns the key holding key in the bucket name, failing with
+// ErrBucketNotFound when there is no such bucket.
+func (cfg *Config) BucketKey(ctx context.Context, name, key string) (string, error) {
+	if err := cfg.checkBucket(ctx, name); err != nil {
+		return "", err
+	}
+
+	return name + cfg.keySeparator + key, nil
+}
+
+// BucketStats counts the keys of the bucket name and the size of their
+// values, like NamespaceStats.
+func (cfg *Config) BucketStats(ctx context.Context, name string) (NamespaceStats, error) {
+	if err := cfg.checkBucket(ctx, name); err != nil {
+		return NamespaceStats{}, err
+	}
+
+	return cfg.NamespaceStats(ctx, name)
+}
+
+// checkBucket fails with ErrBucketNotFound unless the bucket name exists.
+func (cfg *Config) checkBucket(ctx context.Context, name string) error {
+	if err := cfg.validateBucket(name); err != nil {
+		return err
+	}
+	if err := readable(ctx); err != nil {
+		return err
+	}
+
+	f := cfg.fsm
+	f.mu.RLock()
+	_, ok := f.data[f.policies.key(cfg.bucketKey(name))]
+	f.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrBucketNotFound, name)
+	}
+
+	return nil
+}
+
+// bucketKey is Config.bucketKey for the FSM.
+func (f *fsm) bucketKey(name string) string {
+	return f.reserved + "bucket" + f.separator + name
+}
+
+// localDeleteBucket removes the bucket name and its keys, whose keys it
+// returns. The caller holds the write lock.
+func (f *fsm) localDeleteBucket(name string) ([]string, error) {
+	key := f.bucketKey(name)
+	if _, ok := f.data[key]; !ok {
+		return nil, fmt.Errorf("%w: %q", ErrBucketNotFound, name)
+	}
+
+	f.remove(key)
+	return f.localDeletePrefix(name + f.separator), nil
+}
@@ -0,0 +1,62 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestBuckets(t *testing.T) {
+	cfg := newTestConfig(t)
+	ctx := context.Background()
+
+	for _, name := range []string{"billing", "app"} {
+		if _, err := cfg.CreateBucket(ctx, name); err != nil {
+			t.Fatalf("CreateBucket(%s) returned unexpected error: %s", name, err)
+		}
+	}
+	if _, err := cfg.CreateBucket(ctx, "app"); !errors.Is(err, ErrBucketExists) {
+		t.Errorf("Got error %v creating a bucket twice, expected %v", err, ErrBucketExists)
+	}
+	for _, name := range []string{"", "a:b", DefaultReservedPrefix} {
+		if _, err := cfg.CreateBucket(ctx, name); err == nil {
+			t.Errorf("CreateBucket(%q) accepted an invalid name", name)
+		}
+	}
+
+	buckets, err := cfg.Buckets(ctx)
+	if err != nil {
+		t.Fatalf("Buckets returned unexpected error: %s", err)
+	}
+	if len(buckets) != 2 || buckets[0].Name != "app" || buckets[1].Name != "billing" || buckets[0].CreatedAt.IsZero() {
+		t.Errorf("Got buckets %+v, expected app and billing", buckets)
+	}
+
+	key, err := cfg.BucketKey(ctx, "app", "k")
+	if err != nil {
+		t.Fatalf("BucketKey returned unexpected error: %s", err)
+	}
+	cfg.Set(ctx, key, "in app")
+	cfg.Set(ctx, "billing:k", "in billing")
+	if _, err := cfg.BucketKey(ctx, "missing", "k"); !errors.Is(err, ErrBucketNotFound) {
+		t.Errorf("Got error %v for a missing bucket, expected %v", err, ErrBucketNotFound)
+	}
+
+	if stats, err := cfg.BucketStats(ctx, "app"); err != nil || stats.Keys != 1 || stats.Bytes != 6 {
+		t.Errorf("BucketStats(app) = %+v, %v, want 1 key of 6 bytes", stats, err)
+	}
+
+	deleted, _, err := cfg.DeleteBucket(ctx, "app")
+	if err != nil || deleted != 1 {
+		t.Fatalf("DeleteBucket(app) = %d, %v, want 1 key deleted", deleted, err)
+	}
+	if _, _, err := cfg.DeleteBucket(ctx, "app"); !errors.Is(err, ErrBucketNotFound) {
+		t.Errorf("Got error %v deleting a bucket twice, expected %v", err, ErrBucketNotFound)
+	}
+	if v, _ := cfg.Get(ctx, "billing:k"); v != "in billing" {
+		t.Errorf("Deleting app removed the keys of billing, got %q", v)
+	}
+	if buckets, _ := cfg.Buckets(ctx); len(buckets) != 1 {
+		t.Errorf("Got buckets %+v once app is deleted, expected billing", buckets)
+	}
+}
@@ -0,0 +1,40 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// CompareAndSwap stores e at key only if key holds expected, a missing or
+// expired key holding the empty value, so writers updating a key from the
+// value they read can't overwrite each other's update. The check and the
+// write are applied as one command. It fails with ErrConditionFailed, writing
+// nothing, when key holds another value.
+func (cfg *Config) CompareAndSwap(ctx context.Context, key, expected string, e Entry) (uint64, error) {
+	if err := cfg.validateKey(key); err != nil {
+		return 0, err
+	}
+
+	if err := validateValue(e.Value); err != nil {
+		return 0, err
+	}
+
+	if err := validateMetadata(e.Metadata); err != nil {
+		return 0, err
+	}
+
+	if err := cfg.writable(); err != nil {
+		return 0, err
+	}
+
+	_, index, err := cfg.apply(ctx, Command{
+		Action:       "cas",
+		Key:          key,
+		Expected:     expected,
+		Data:         []byte(e.Value),
+		ContentType:  e.ContentType,
+		UserMetadata: e.Metadata,
+		Now:          time.Now().UnixNano(),
+	})
+	return index, err
+}
@@ -0,0 +1,65 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/raft"
+)
+
+func TestCompareAndSwap(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestConfig(t)
+
+	// A missing key holds the empty value
+	if _, err := cfg.CompareAndSwap(ctx, "k", "", Entry{Value: "1"}); err != nil {
+		t.Fatalf("CompareAndSwap on a missing key returned unexpected error: %s", err)
+	}
+	if _, err := cfg.CompareAndSwap(ctx, "k", "", Entry{Value: "2"}); !errors.Is(err, ErrConditionFailed) {
+		t.Errorf("CompareAndSwap on a set key expecting it missing returned %v, want ErrConditionFailed", err)
+	}
+
+	if _, err := cfg.CompareAndSwap(ctx, "k", "1", Entry{Value: "2", ContentType: "text/plain"}); err != nil {
+		t.Fatalf("CompareAndSwap returned unexpected error: %s", err)
+	}
+	if _, err := cfg.CompareAndSwap(ctx, "k", "1", Entry{Value: "3"}); !errors.Is(err, ErrConditionFailed) {
+		t.Errorf("CompareAndSwap with a stale value returned %v, want ErrConditionFailed", err)
+	}
+
+	e, err := cfg.GetEntry(ctx, "k")
+	if err != nil {
+		t.Fatalf("GetEntry returned unexpected error: %s", err)
+	}
+	if e.Value != "2" || e.ContentType != "text/plain" {
+		t.Errorf("Got %+v, expected the value of the successful swap", e)
+	}
+}
+
+func TestCompareAndSwapReplay(t *testing.T) {
+	// The key expired long ago by the local clock, but not yet at the time of
+	// the first swap
+	at := func(d time.Duration) string {
+		return strconv.FormatInt(time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC).Add(d).UnixNano(), 10)
+	}
+	f := newFSM(NewFileStore(filepath.Join(t.TempDir(), "data.json")), hclog.NewNullLogger())
+	f.Apply(&raft.Log{Index: 1, Data: []byte(`{"Action":"batch","Entries":[{"Key":"k","Data":"dg==","ExpiresAt":` + at(time.Minute) + `}]}`)})
+
+	testCases := []struct {
+		log *raft.Log
+		err error
+	}{
+		{&raft.Log{Index: 2, Data: []byte(`{"Action":"cas","Key":"k","Data":"dw==","Now":` + at(30*time.Second) + `}`)}, ErrConditionFailed},
+		{&raft.Log{Index: 3, Data: []byte(`{"Action":"cas","Key":"k","Expected":"v","Data":"dw==","Now":` + at(40*time.Second) + `}`)}, nil},
+	}
+	for _, test := range testCases {
+		err, _ := f.Apply(test.log).(error)
+		if !errors.Is(err, test.err) {
+			t.Errorf("Log %d: got error %v, expected %v", test.log.Index, err, test.err)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// compaction counts the compactions of a node, see Config.Compact. The
+// counters are updated atomically.
+type compaction struct {
+	runs uint64
+
+	// last is the Unix time in nanoseconds of the last compaction, 0 before
+	// the first one. reclaimed is the number of log store bytes it freed.
+	last      int64
+	reclaimed int64
+
+	// leading receives the leadership changes of the node when compactions
+	// are scheduled, it is nil otherwise.
+	leading chan bool
+}
+
+// CompactionResult describes a compaction.
+type CompactionResult struct {
+	At time.Time `json:"at"`
+
+	// Index is the log index of the snapshot taken.
+	Index uint64 `json:"index"`
+
+	// CompactedEntries is the number of entries removed from the log store
+	// and ReclaimedBytes the bytes it freed. Both are 0 when Raft isn't
+	// backed by bolt stores.
+	CompactedEntries uint64 `json:"compacted_entries"`
+	ReclaimedBytes   int64  `json:"reclaimed_bytes"`
+}
+
+// Compact has the node take a Raft snapshot, which lets Raft truncate its log
+// up to the snapshot, but for the trailing entries it keeps for followers
+// catching up. The freed pages are reused by the log store, its file doesn't
+// shrink. It fails with ErrNothingToCompact when nothing was applied since
+// the last snapshot.
+func (cfg *Config) Compact() (CompactionResult, error) {
+	if cfg.standalone() {
+		return CompactionResult{}, errors.New("a standalone node has no log to compact")
+	}
+
+	firstBefore, usedBefore := cfg.logStoreUsage()
+	snapshot, err := cfg.Snapshot()
+	if err != nil {
+		return CompactionResult{}, err
+	}
+	firstAfter, usedAfter := cfg.logStoreUsage()
+
+	result := CompactionResult{
+		At:    time.Now().UTC(),
+		Index: snapshot.Index,
+	}
+	if firstAfter > firstBefore {
+		result.CompactedEntries = firstAfter - firstBefore
+	}
+	if usedBefore > usedAfter {
+		result.ReclaimedBytes = usedBefore - usedAfter
+	}
+
+	atomic.AddUint64(&cfg.compaction.runs, 1)
+	atomic.StoreInt64(&cfg.compaction.reclaimed, result.ReclaimedBytes)
+	atomic.StoreInt64(&cfg.compaction.last, result.At.UnixNano())
+
+	return result, nil
+}
+
+// logStoreUsage returns the first index of the log store and the bytes of
+// its file not held by free pages, zero when it isn't a bolt store.
+func (cfg *Config) logStoreUsage() (uint64, int64) {
+	if cfg.logStore == nil {
+		return 0, 0
+	}
+
+	stats := boltStats(cfg.logStore, cfg.logStorePath)
+	first, err := cfg.logStore.FirstIndex()
+	if err != nil {
+		cfg.logger.Warn("couldn't read first index of log store", "error", err)
+	}
+
+	return first, stats.Size - int64(stats.FreeBytes)
+}
+
+// lastCompactionTime returns when the node last compacted its log, nil if it
+// never did.
+func (c *compaction) lastCompactionTime() *time.Time {
+	nsec := atomic.LoadInt64(&c.last)
+	if nsec == 0 {
+		return nil
+	}
+
+	t := time.Unix(0, nsec).UTC()
+	return &t
+}
+
+// notify passes a leadership change to the compaction schedule, replacing
+// the previous change if it wasn't read yet.
+func (c *compaction) notify(isLeader bool) {
+	if c.leading == nil {
+		return
+	}
+
+	select {
+	case <-c.leading:
+	default:
+	}
+	c.leading <- isLeader
+}
+
+// compactWhileLeading runs forever, compacting the log every interval while
+// the node is the leader and idling while it follows.
+func (cfg *Config) compactWhileLeading(interval time.Duration) {
+	var (
+		ticker *time.Ticker
+		tick   <-chan time.Time
+	)
+	for {
+		select {
+		case isLeader := <-cfg.compaction.leading:
+			if ticker != nil {
+				ticker.Stop()
+				ticker, tick = nil, nil
+			}
+			if isLeader {
+				ticker = time.NewTicker(interval)
+				tick = ticker.C
+			}
+		case <-tick:
+			result, err := cfg.Compact()
+			switch {
+			case errors.Is(err, ErrNothingToCompact):
+				cfg.logger.Debug("nothing to compact")
+			case err != nil:
+				cfg.logger.Error("couldn't compact the log", "error", err)
+			default:
+				cfg.logger.Info("compacted the log", "index", result.Index, "entries", result.CompactedEntries, "reclaimed_bytes", result.ReclaimedBytes)
+			}
+		}
+	}
+}
+
+// CompactHandler compacts the log of the node answering the request, the
+// leader unless it is pinned to the node with local=true, and answers with
+// the CompactionResult.
+func (cfg *Config) CompactHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		jw := json.NewEncoder(w)
+
+		result, err := cfg.Compact()
+		switch {
+		case cfg.standalone(), errors.Is(err, ErrNothingToCompact):
+			w.WriteHeader(http.StatusConflict)
+			jw.Encode(map[string]string{"error": err.Error()})
+		case err != nil:
+			w.WriteHeader(http.StatusInternalServerError)
+			jw.Encode(map[string]string{"error": err.Error()})
+		default:
+			jw.Encode(result)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCompact(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestConfig(t)
+
+	index, err := cfg.SetEntry(ctx, "k", Entry{Value: "v"})
+	if err != nil {
+		t.Fatalf("SetEntry returned unexpected error: %s", err)
+	}
+
+	result, err := cfg.Compact()
+	if err != nil {
+		t.Fatalf("Compact returned unexpected error: %s", err)
+	}
+	if result.Index < index {
+		t.Errorf("Compact() snapshot index is %d, want at least %d", result.Index, index)
+	}
+	if s := cfg.Status(); s.LastCompaction == nil || !s.LastCompaction.Equal(result.At) {
+		t.Errorf("Status().LastCompaction = %v, want %v", s.LastCompaction, result.At)
+	}
+
+	if _, err := cfg.Compact(); !errors.Is(err, ErrNothingToCompact) {
+		t.Errorf("Compact without new commands returned %v, want ErrNothingToCompact", err)
+	}
+
+	recorder := httptest.NewRecorder()
+	cfg.CompactHandler()(recorder, httptest.NewRequest(http.MethodPost, "/admin/compact", nil))
+	if recorder.Code != http.StatusConflict {
+		t.Errorf("Got status %d with nothing to compact, expected %d", recorder.Code, http.StatusConflict)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	cfg := newTestConfig(t)
+
+	index, err := cfg.SetEntry(context.Background(), "k", Entry{Value: "v"})
+	if err != nil {
+		t.Fatalf("SetEntry returned unexpected error: %s", err)
+	}
+
+	recorder := httptest.NewRecorder()
+	cfg.SnapshotHandler()(recorder, httptest.NewRequest(http.MethodPost, "/raft/snapshot", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Got status %d taking a snapshot, expected %d: %s", recorder.Code, http.StatusOK, recorder.Body)
+	}
+	var snapshot SnapshotInfo
+	if err := json.NewDecoder(recorder.Body).Decode(&snapshot); err != nil {
+		t.Fatalf("Couldn't decode snapshot: %s", err)
+	}
+	if snapshot.ID == "" || snapshot.Index < index {
+		t.Errorf("Got snapshot %+v, expected one covering index %d", snapshot, index)
+	}
+
+	recorder = httptest.NewRecorder()
+	cfg.SnapshotHandler()(recorder, httptest.NewRequest(http.MethodPost, "/raft/snapshot", nil))
+	if recorder.Code != http.StatusConflict {
+		t.Errorf("Got status %d with nothing to snapshot, expected %d", recorder.Code, http.StatusConflict)
+	}
+}
+
+func TestCompactWhileLeading(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestConfig(t)
+	cfg.compaction.leading = make(chan bool, 1)
+	go cfg.compactWhileLeading(10 * time.Millisecond)
+
+	write := func(key string) {
+		t.Helper()
+		if _, err := cfg.SetEntry(ctx, key, Entry{Value: "v"}); err != nil {
+			t.Fatalf("SetEntry returned unexpected error: %s", err)
+		}
+	}
+
+	// Idle until the node is known to lead
+	write("k1")
+	time.Sleep(50 * time.Millisecond)
+	if runs := atomic.LoadUint64(&cfg.compaction.runs); runs != 0 {
+		t.Fatalf("%d compactions ran before the node led", runs)
+	}
+
+	cfg.compaction.notify(true)
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadUint64(&cfg.compaction.runs) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("no compaction ran while leading")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// A compaction may be running as leadership is lost
+	cfg.compaction.notify(false)
+	time.Sleep(50 * time.Millisecond)
+	runs := atomic.LoadUint64(&cfg.compaction.runs)
+	write("k2")
+	time.Sleep(50 * time.Millisecond)
+	if after := atomic.LoadUint64(&cfg.compaction.runs); after != runs {
+		t.Errorf("%d compactions ran while following", after-runs)
+	}
+}
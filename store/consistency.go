@@ -0,0 +1,84 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// linearizeTimeout bounds the wait of a linearizable read for the leader to
+// apply the writes committed before it.
+const linearizeTimeout = 5 * time.Second
+
+// Consistency is the guarantee a read gets about the writes it sees.
+type Consistency string
+
+const (
+	// ConsistencyDefault reads the data of the node answering, the leader
+	// unless the read is pinned to another node. A leader that lost its
+	// leadership without noticing yet, cut off from the others, serves
+	// stale data until its lease times out.
+	ConsistencyDefault Consistency = "default"
+
+	// ConsistencyLinearizable has the leader confirm it still leads, by
+	// hearing from a quorum, and apply every write committed before the
+	// read: the read sees every write acknowledged before it started. It
+	// costs a round trip to the followers.
+	ConsistencyLinearizable Consistency = "linearizable"
+
+	// ConsistencyStale reads the data of the node answering, a follower
+	// serving the read itself instead of forwarding it to the leader. The
+	// follower may lag behind the leader, by as much as it is cut off from
+	// it: the read may miss any recent write.
+	ConsistencyStale Consistency = "stale"
+)
+
+// ParseConsistency returns the Consistency named s, ConsistencyDefault when
+// s is empty.
+func ParseConsistency(s string) (Consistency, error) {
+	switch c := Consistency(s); c {
+	case "":
+		return ConsistencyDefault, nil
+	case ConsistencyDefault, ConsistencyLinearizable, ConsistencyStale:
+		return c, nil
+	default:
+		return "", fmt.Errorf("unknown consistency %q", s)
+	}
+}
+
+// Consistent returns once the node can serve a read with the consistency c,
+// see Linearize. Followers are handed the reads with ConsistencyStale by
+// Middleware instead of forwarding them.
+func (cfg *Config) Consistent(ctx context.Context, c Consistency) error {
+	if c == ConsistencyLinearizable {
+		return cfg.Linearize(ctx)
+	}
+
+	return nil
+}
+
+// Linearize returns once the reads of the node see every write committed
+// before the call. It fails with a *NotLeaderError on followers and on a
+// leader that can't reach a quorum, and with ErrIndexTimeout if the writes
+// aren't applied in time.
+func (cfg *Config) Linearize(ctx context.Context) error {
+	if cfg.standalone() {
+		return nil
+	}
+
+	if cfg.state() != raft.Leader {
+		return cfg.notLeader()
+	}
+
+	index := cfg.raft.CommitIndex()
+	if err := cfg.raft.VerifyLeader().Error(); errors.Is(err, raft.ErrNotLeader) || errors.Is(err, raft.ErrLeadershipLost) {
+		return cfg.notLeader()
+	} else if err != nil {
+		return fmt.Errorf("verifying leadership: %w", err)
+	}
+
+	return cfg.WaitForIndex(ctx, index, linearizeTimeout)
+}
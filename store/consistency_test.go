@@ -0,0 +1,47 @@
+package store
+
+import (
+	"context"
+	"testing"
+)
+
+func TestLinearize(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestConfig(t)
+
+	index, err := cfg.SetEntry(ctx, "k", Entry{Value: "v"})
+	if err != nil {
+		t.Fatalf("SetEntry returned unexpected error: %s", err)
+	}
+
+	if err := cfg.Consistent(ctx, ConsistencyLinearizable); err != nil {
+		t.Fatalf("Consistent(linearizable) returned unexpected error on the leader: %s", err)
+	}
+	if applied := cfg.appliedIndex(); applied < index {
+		t.Errorf("Applied index is %d after a linearizable barrier, want at least %d", applied, index)
+	}
+}
+
+func TestParseConsistency(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		in  string
+		out Consistency
+	}{
+		{"", ConsistencyDefault},
+		{"default", ConsistencyDefault},
+		{"linearizable", ConsistencyLinearizable},
+		{"stale", ConsistencyStale},
+	}
+
+	for _, test := range testCases {
+		if got, err := ParseConsistency(test.in); err != nil || got != test.out {
+			t.Errorf("ParseConsistency(%q) = %q, %v, want %q", test.in, got, err, test.out)
+		}
+	}
+
+	if _, err := ParseConsistency("eventual"); err == nil {
+		t.Errorf("ParseConsistency accepted an unknown consistency")
+	}
+}
@@ -0,0 +1,131 @@
+package store
+
+import (
+	"sync"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// FollowerStatus describes a follower as the leader sees it.
+type FollowerStatus struct {
+	ID      string `json:"id"`
+	Address string `json:"address"`
+	Voter   bool   `json:"voter"`
+
+	// LastContact is when the leader last heard from the follower. Raft
+	// doesn't expose it while heartbeats succeed, the follower is then
+	// reported as heard from now, which is right to within a heartbeat.
+	// Once heartbeats fail, it is the time of the last successful contact
+	// and Failing is set.
+	LastContact time.Time `json:"last_contact"`
+	Failing     bool      `json:"failing"`
+}
+
+// contactTracker keeps the last contact of the followers the leader fails to
+// heartbeat, from the observations of Raft.
+type contactTracker struct {
+	mu      sync.Mutex
+	failing map[raft.ServerID]time.Time
+}
+
+func newContactTracker() *contactTracker {
+	return &contactTracker{failing: map[raft.ServerID]time.Time{}}
+}
+
+// register subscribes the tracker to the heartbeat observations of node.
+func (t *contactTracker) register(node *raft.Raft) {
+	ch := make(chan raft.Observation, 16)
+	node.RegisterObserver(raft.NewObserver(ch, false, func(o *raft.Observation) bool {
+		switch o.Data.(type) {
+		case raft.FailedHeartbeatObservation, raft.ResumedHeartbeatObservation:
+			return true
+		default:
+			return false
+		}
+	}))
+
+	go func() {
+		for o := range ch {
+			t.observe(o.Data)
+		}
+	}()
+}
+
+func (t *contactTracker) observe(data interface{}) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch o := data.(type) {
+	case raft.FailedHeartbeatObservation:
+		t.failing[o.PeerID] = o.LastContact
+	case raft.ResumedHeartbeatObservation:
+		delete(t.failing, o.PeerID)
+	}
+}
+
+// lastContact returns when the leader last heard from id as of now, and
+// whether heartbeats to it are failing.
+func (t *contactTracker) lastContact(id raft.ServerID, now time.Time) (time.Time, bool) {
+	if t == nil {
+		return now, false
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if last, ok := t.failing[id]; ok {
+		return last, true
+	}
+
+	return now, false
+}
+
+// lastLeaderContact returns when this node last heard from the leader, nil
+// when it is the leader, standalone or never heard from one.
+func (cfg *Config) lastLeaderContact() *time.Time {
+	if cfg.standalone() || cfg.raft.State() == raft.Leader {
+		return nil
+	}
+
+	contact := cfg.raft.LastContact()
+	if contact.IsZero() {
+		return nil
+	}
+	contact = contact.UTC()
+
+	return &contact
+}
+
+// followers returns the status of the followers when this node is the
+// leader, nil otherwise.
+func (cfg *Config) followers() []FollowerStatus {
+	if cfg.standalone() || cfg.raft.State() != raft.Leader {
+		return nil
+	}
+
+	future := cfg.raft.GetConfiguration()
+	if err := future.Error(); err != nil {
+		cfg.logger.Error("couldn't get configuration", "error", err)
+		return nil
+	}
+
+	now := time.Now()
+	var followers []FollowerStatus
+	for _, server := range future.Configuration().Servers {
+		if server.ID == cfg.id {
+			continue
+		}
+
+		last, failing := cfg.contacts.lastContact(server.ID, now)
+		followers = append(followers, FollowerStatus{
+			ID:          string(server.ID),
+			Address:     cfg.memberURL(server.ID, server.Address).String(),
+			Voter:       server.Suffrage == raft.Voter,
+			LastContact: last,
+			Failing:     failing,
+		})
+	}
+
+	return followers
+}
@@ -0,0 +1,60 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+func TestContactTracker(t *testing.T) {
+	tracker := newContactTracker()
+	now := time.Now()
+	lost := now.Add(-30 * time.Second)
+
+	if last, failing := tracker.lastContact("f1", now); failing || !last.Equal(now) {
+		t.Errorf("Got %s (failing: %t) for a healthy follower, expected now", last, failing)
+	}
+
+	tracker.observe(raft.FailedHeartbeatObservation{PeerID: "f1", LastContact: lost})
+	if last, failing := tracker.lastContact("f1", now); !failing || !last.Equal(lost) {
+		t.Errorf("Got %s (failing: %t), expected the last contact %s", last, failing, lost)
+	}
+	if _, failing := tracker.lastContact("f2", now); failing {
+		t.Errorf("Another follower is reported failing")
+	}
+
+	tracker.observe(raft.ResumedHeartbeatObservation{PeerID: "f1"})
+	if last, failing := tracker.lastContact("f1", now); failing || !last.Equal(now) {
+		t.Errorf("Got %s (failing: %t) once heartbeats resumed, expected now", last, failing)
+	}
+}
+
+func TestStatusFollowers(t *testing.T) {
+	cfg := newTestConfig(t)
+
+	// A single node cluster has no followers
+	if followers := cfg.Status().Followers; len(followers) != 0 {
+		t.Errorf("Got followers %+v, expected none", followers)
+	}
+}
+
+func TestStatusPeers(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.Set(context.Background(), "k", "v")
+
+	s := cfg.Status()
+	if len(s.Peers) != 1 || s.Peers[0].ID != "test" || !s.Peers[0].Voter || !s.Peers[0].Leader {
+		t.Errorf("Got peers %+v, expected the node as the leading voter", s.Peers)
+	}
+	if s.LeaderID != "test" {
+		t.Errorf("Got leader ID %q, expected test", s.LeaderID)
+	}
+	if s.CommitIndex < s.AppliedIndex || s.CommitIndex == 0 {
+		t.Errorf("Got commit index %d, expected at least the applied index %d", s.CommitIndex, s.AppliedIndex)
+	}
+	if s.LastLeaderContact != nil {
+		t.Errorf("The leader reports a last contact with the leader")
+	}
+}
@@ -0,0 +1,65 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// Increment adds delta, which may be negative, to the integer stored at key
+// and returns the new value along with the Raft log index of the write. The
+// addition happens inside the FSM, so concurrent increments don't lose each
+// other's update. A missing or expired key counts from 0, the value of an
+// existing one keeps its content type, metadata and expiration. It fails with
+// ErrNotInteger when key holds something else than a base 10 integer, and
+// with ErrOverflow when the result doesn't fit in an int64.
+func (cfg *Config) Increment(ctx context.Context, key string, delta int64) (int64, uint64, error) {
+	if err := cfg.validateKey(key); err != nil {
+		return 0, 0, err
+	}
+
+	if err := cfg.writable(); err != nil {
+		return 0, 0, err
+	}
+
+	resp, index, err := cfg.apply(ctx, Command{Action: "incr", Key: key, Delta: delta, Now: time.Now().UnixNano()})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return resp.(int64), index, nil
+}
+
+// localIncrement adds delta to the integer at key and returns the result,
+// counting from 0 when key expired at now. The caller holds the write lock.
+func (f *fsm) localIncrement(key string, delta int64, now time.Time) (int64, error) {
+	e, ok := f.data[key]
+	if !ok || e.expired(now) {
+		e = Entry{Value: "0"}
+	}
+
+	n, err := strconv.ParseInt(e.Value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q holds %q", ErrNotInteger, key, e.Value)
+	}
+	if (delta > 0 && n > math.MaxInt64-delta) || (delta < 0 && n < math.MinInt64-delta) {
+		return 0, fmt.Errorf("%w: %d%+d", ErrOverflow, n, delta)
+	}
+	n += delta
+
+	value := strconv.FormatInt(n, 10)
+	if err := f.policies.check(key, value); err != nil {
+		return 0, err
+	}
+
+	if err := f.checkQuotas(map[string]int{key: len(value)}); err != nil {
+		return 0, err
+	}
+
+	e.Value = value
+	f.put(key, e)
+
+	return n, nil
+}
@@ -0,0 +1,93 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"math"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/raft"
+)
+
+func TestIncrement(t *testing.T) {
+	cfg := newTestConfig(t)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				if _, _, err := cfg.Increment(ctx, "hits", 1); err != nil {
+					t.Errorf("Increment returned unexpected error: %s", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if v, _ := cfg.Get(ctx, "hits"); v != "100" {
+		t.Errorf("Got %q after 100 concurrent increments, expected 100", v)
+	}
+
+	cfg.SetEntry(ctx, "typed", Entry{Value: "41", ContentType: "text/plain"})
+	cfg.SetBatchEntries(ctx, map[string]BatchEntry{"expiring": {Value: "41", TTL: time.Hour}})
+	for _, key := range []string{"typed", "expiring"} {
+		if n, _, err := cfg.Increment(ctx, key, 1); err != nil || n != 42 {
+			t.Errorf("Increment(%s) = %d, %v, want 42", key, n, err)
+		}
+	}
+	if e, _ := cfg.GetEntry(ctx, "typed"); e.ContentType != "text/plain" {
+		t.Errorf("Got %+v, expected the content type kept", e)
+	}
+	if e, _ := cfg.GetEntry(ctx, "expiring"); e.ExpiresAt.IsZero() {
+		t.Errorf("Got %+v, expected the expiration kept", e)
+	}
+
+	cfg.Set(ctx, "text", "hello")
+	cfg.Set(ctx, "max", "9223372036854775807")
+	testCases := []struct {
+		key   string
+		delta int64
+		err   error
+	}{
+		{"text", 1, ErrNotInteger},
+		{"max", 1, ErrOverflow},
+		{"min", math.MinInt64, nil},
+		{"min", -1, ErrOverflow},
+	}
+	for _, test := range testCases {
+		if _, _, err := cfg.Increment(ctx, test.key, test.delta); !errors.Is(err, test.err) {
+			t.Errorf("Increment(%s, %d) returned error %v, expected %v", test.key, test.delta, err, test.err)
+		}
+	}
+}
+
+func TestIncrementReplay(t *testing.T) {
+	// The counter expired long ago by the local clock, but not yet at the
+	// time of the first increment
+	at := func(d time.Duration) string {
+		return strconv.FormatInt(time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC).Add(d).UnixNano(), 10)
+	}
+	f := newFSM(NewFileStore(filepath.Join(t.TempDir(), "data.json")), hclog.NewNullLogger())
+	f.Apply(&raft.Log{Index: 1, Data: []byte(`{"Action":"batch","Entries":[{"Key":"c","Data":"NDE=","ExpiresAt":` + at(time.Minute) + `}]}`)})
+
+	testCases := []struct {
+		log  *raft.Log
+		want int64
+	}{
+		{&raft.Log{Index: 2, Data: []byte(`{"Action":"incr","Key":"c","Delta":1,"Now":` + at(30*time.Second) + `}`)}, 42},
+		{&raft.Log{Index: 3, Data: []byte(`{"Action":"incr","Key":"c","Delta":1,"Now":` + at(2*time.Minute) + `}`)}, 1},
+	}
+	for _, test := range testCases {
+		if got := f.Apply(test.log); got != test.want {
+			t.Errorf("Log %d: got %v, expected %d", test.log.Index, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// A node started with a Discoverer instead of RAFT_LEADER finds the other
+// nodes by itself, and either joins the cluster they are members of or,
+// when none of them is, bootstraps it with them. Every node can be started
+// the same way: the first one up, or the one with the lowest ID among those
+// starting together, bootstraps the cluster and the others join it.
+
+// discoveryTimeout bounds each round of lookups and status requests.
+const discoveryTimeout = 5 * time.Second
+
+// Discoverer finds the nodes of the cluster.
+type Discoverer interface {
+	// Discover returns the HTTP addresses of the nodes, as URLs or as
+	// host and port. It may include the node looking them up.
+	Discover(ctx context.Context) ([]string, error)
+}
+
+// StaticSeeds are the HTTP addresses of the nodes, given up front like by
+// SEEDS. Every node can be given the same list, itself included.
+type StaticSeeds []string
+
+// Discover returns the seeds.
+func (s StaticSeeds) Discover(context.Context) ([]string, error) {
+	return s, nil
+}
+
+// DNSDiscoverer finds the nodes at the addresses Name resolves to, their
+// HTTP API listening on Port. A Kubernetes headless service resolves to the
+// addresses of its pods.
+type DNSDiscoverer struct {
+	Name string
+	Port string
+
+	// Resolver looks Name up, net.DefaultResolver when nil.
+	Resolver *net.Resolver
+}
+
+// Discover returns the addresses Name resolves to, on Port.
+func (d DNSDiscoverer) Discover(ctx context.Context) ([]string, error) {
+	addrs, err := resolver(d.Resolver).LookupHost(ctx, d.Name)
+	if err != nil {
+		return nil, fmt.Errorf("looking up %s: %w", d.Name, err)
+	}
+
+	nodes := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		nodes = append(nodes, net.JoinHostPort(addr, d.Port))
+	}
+
+	return nodes, nil
+}
+
+// SRVDiscoverer finds the nodes named by the SRV records of Name, such as
+// _http._tcp.kv.default.svc.cluster.local, whose targets and ports are
+// those of their HTTP API.
+type SRVDiscoverer struct {
+	Name string
+
+	// Resolver looks Name up, net.DefaultResolver when nil.
+	Resolver *net.Resolver
+}
+
+// Discover returns the targets of the SRV records of Name.
+func (d SRVDiscoverer) Discover(ctx context.Context) ([]string, error) {
+	_, records, err := resolver(d.Resolver).LookupSRV(ctx, "", "", d.Name)
+	if err != nil {
+		return nil, fmt.Errorf("looking up %s: %w", d.Name, err)
+	}
+
+	nodes := make([]string, 0, len(records))
+	for _, srv := range records {
+		host := strings.TrimSuffix(srv.Target, ".")
+		nodes = append(nodes, net.JoinHostPort(host, strconv.Itoa(int(srv.Port))))
+	}
+
+	return nodes, nil
+}
+
+// resolver returns r, net.DefaultResolver when it is nil.
+func resolver(r *net.Resolver) *net.Resolver {
+	if r == nil {
+		return net.DefaultResolver
+	}
+
+	return r
+}
+
+// discoveredNode is a node found by the Discoverer, and its status.
+type discoveredNode struct {
+	url    string
+	status Status
+}
+
+// discover finds the other nodes answering their status through d. The
+// node itself is left out, by ID.
+func (cfg *Config) discover(d Discoverer) ([]discoveredNode, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), discoveryTimeout)
+	defer cancel()
+
+	addrs, err := d.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var nodes []discoveredNode
+	seen := make(map[string]bool)
+	for _, addr := range addrs {
+		u := strings.TrimSuffix(addr, "/")
+		if !strings.Contains(u, "://") {
+			scheme := "http://"
+			if cfg.https {
+				scheme = "https://"
+			}
+			u = scheme + u
+		}
+		if seen[u] {
+			continue
+		}
+		seen[u] = true
+
+		s, err := cfg.nodeStatus(u)
+		if err != nil {
+			cfg.logger.Debug("couldn't get status of discovered node", "node", u, "error", err)
+
+			continue
+		}
+		if raft.ServerID(s.ID) == cfg.id {
+			continue
+		}
+		nodes = append(nodes, discoveredNode{url: u, status: s})
+	}
+
+	return nodes, nil
+}
+
+// discoverCluster has this node, self in the Raft configuration and
+// described by body to the leader, join the cluster of the nodes found
+// through d, or bootstrap it when none of them is a member of one: once at
+// least expect nodes, this one included, are found and this one has the
+// lowest ID. The rounds are separated by the backoff of joinCluster until the
+// node is a member, or timeout elapsed. Read replicas never bootstrap.
+func (cfg *Config) discoverCluster(d Discoverer, self raft.Server, body string, expect int, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	backoff := joinInitialBackoff
+	for attempt := 1; ; attempt++ {
+		if cfg.member() {
+			return nil
+		}
+
+		err := cfg.discoverRound(d, self, body, expect)
+		if err == nil {
+			if err = cfg.waitMember(joinMemberWait); err == nil {
+				return nil
+			}
+		}
+
+		if time.Now().Add(backoff).After(deadline) {
+			return fmt.Errorf("giving up discovering the cluster after %d attempts: %w", attempt, err)
+		}
+		cfg.logger.Warn("couldn't discover the cluster, retrying", "attempt", attempt, "backoff", backoff, "error", err)
+		time.Sleep(backoff)
+
+		if backoff *= 2; backoff > joinMaxBackoff {
+			backoff = joinMaxBackoff
+		}
+	}
+}
+
+// discoverRound finds the other nodes through d once, and joins their
+// cluster or bootstraps it, see discoverCluster.
+func (cfg *Config) discoverRound(d Discoverer, self raft.Server, body string, expect int) error {
+	nodes, err := cfg.discover(d)
+	if err != nil {
+		return err
+	}
+
+	var seeds []string
+	clustered, lowest := false, true
+	for _, n := range nodes {
+		if n.status.Leader != "" || len(n.status.Peers) > 0 {
+			seeds = append(seeds, n.url)
+			clustered = true
+		}
+		if n.status.ID < string(cfg.id) {
+			lowest = false
+		}
+	}
+
+	if clustered {
+		cfg.logger.Info("joining the discovered cluster", "nodes", seeds)
+		return cfg.join(seeds, body)
+	}
+
+	if cfg.readReplica {
+		return fmt.Errorf("found %d nodes, none is a member of a cluster", len(nodes))
+	}
+	if len(nodes)+1 < expect {
+		return fmt.Errorf("found %d nodes, waiting for %d before bootstrapping", len(nodes)+1, expect)
+	}
+	if !lowest {
+		return fmt.Errorf("found %d nodes, waiting for the one with the lowest ID to bootstrap", len(nodes)+1)
+	}
+
+	cfg.logger.Info("bootstrapping the cluster", "nodes", len(nodes)+1)
+	return cfg.bootstrap(self)
+}
+
+// bootstrap bootstraps a cluster of this node, self in the Raft
+// configuration. It fails on a node that already has a state.
+func (cfg *Config) bootstrap(self raft.Server) error {
+	return cfg.raft.BootstrapCluster(raft.Configuration{Servers: []raft.Server{self}}).Error()
+}
@@ -0,0 +1,26 @@
+package store
+
+import (
+	"context"
+	"testing"
+)
+
+func TestDiscoverers(t *testing.T) {
+	seeds, err := StaticSeeds{"node1:8080", "http://node2:8080"}.Discover(context.Background())
+	if err != nil || len(seeds) != 2 || seeds[1] != "http://node2:8080" {
+		t.Errorf("StaticSeeds.Discover = %v, %v, want the seeds as is", seeds, err)
+	}
+
+	// localhost resolves without a DNS server
+	nodes, err := DNSDiscoverer{Name: "localhost", Port: "8080"}.Discover(context.Background())
+	if err != nil {
+		t.Fatalf("DNSDiscoverer.Discover returned unexpected error: %s", err)
+	}
+	found := false
+	for _, n := range nodes {
+		found = found || n == "127.0.0.1:8080" || n == "[::1]:8080"
+	}
+	if !found {
+		t.Errorf("Got %v for localhost, expected its loopback address on port 8080", nodes)
+	}
+}
@@ -0,0 +1,59 @@
+package store
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// Drain puts the node in drain mode: it keeps replicating the Raft log and
+// answering the /raft and /admin endpoints, but rejects client requests with
+// 503 so load balancers move them to other nodes before it is removed.
+func (cfg *Config) Drain() {
+	if atomic.CompareAndSwapInt32(&cfg.draining, 0, 1) {
+		cfg.logger.Info("draining node")
+	}
+}
+
+// Undrain takes the node out of drain mode.
+func (cfg *Config) Undrain() {
+	if atomic.CompareAndSwapInt32(&cfg.draining, 1, 0) {
+		cfg.logger.Info("node undrained")
+	}
+}
+
+// Draining reports whether the node is in drain mode.
+func (cfg *Config) Draining() bool {
+	return atomic.LoadInt32(&cfg.draining) == 1
+}
+
+// DrainHandler puts the node in drain mode when drain is set, takes it out
+// otherwise, and answers with its status.
+func (cfg *Config) DrainHandler(drain bool) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if drain {
+			cfg.Drain()
+		} else {
+			cfg.Undrain()
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(w).Encode(cfg.Status())
+	}
+}
+
+// clientRequest reports whether r comes from a client rather than from the
+// cluster or an operator, the requests a draining node rejects.
+func clientRequest(r *http.Request) bool {
+	return !nodePaths[r.URL.Path] &&
+		!strings.HasPrefix(r.URL.Path, "/raft/") &&
+		!strings.HasPrefix(r.URL.Path, "/admin/")
+}
+
+// rejectDraining answers a client request sent to a draining node.
+func rejectDraining(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	json.NewEncoder(w).Encode(map[string]string{"code": "draining", "error": ErrDraining.Error()})
+}
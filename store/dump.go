@@ -0,0 +1,44 @@
+package store
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Dump returns a copy of the data as of the moment it is taken: it holds
+// every command applied before and none applied after, batches included. The
+// copy is made under the read lock of the FSM, which only holds writes back
+// while the map is copied, not while the caller reads it. Expired entries
+// that weren't purged yet are included with their expiration.
+func (cfg *Config) Dump() map[string]Entry {
+	cfg.fsm.mu.RLock()
+	defer cfg.fsm.mu.RUnlock()
+
+	return cfg.fsm.copyData()
+}
+
+// DumpHandler serves a Dump in the format of the data file, so it can be used
+// as one to restore a node.
+func (cfg *Config) DumpHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+		// The dump holds every key
+		if err := cfg.CheckAccess(r.Context(), AccessRead, ""); err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]string{"code": "forbidden", "error": err.Error()})
+
+			return
+		}
+
+		b, err := encode(cfg.Dump(), cfg.fsm.format)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+
+			return
+		}
+
+		w.Write(b)
+	}
+}
@@ -0,0 +1,60 @@
+package store
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestDumpWhileWriting(t *testing.T) {
+	cfg := newTestConfig(t)
+	ctx := context.Background()
+
+	// Both keys always hold the same value, a dump catching one write but not
+	// the other isn't point-in-time
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			v := strconv.Itoa(i)
+			if _, err := cfg.SetBatch(ctx, map[string]string{"a": v, "b": v}); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+
+	for dumps := 0; ; dumps++ {
+		select {
+		case <-done:
+			if dumps == 0 {
+				t.Fatal("no dump was taken while writing")
+			}
+			return
+		default:
+		}
+
+		data := cfg.Dump()
+		if data["a"].Value != data["b"].Value {
+			t.Fatalf("Got a=%q and b=%q in the same dump", data["a"].Value, data["b"].Value)
+		}
+	}
+}
+
+func TestDumpHandler(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.Set(context.Background(), "k", "v")
+
+	recorder := httptest.NewRecorder()
+	cfg.DumpHandler()(recorder, httptest.NewRequest(http.MethodGet, "/admin/dump", nil))
+
+	data, err := decode(recorder.Body.Bytes())
+	if err != nil {
+		t.Fatalf("Couldn't decode dump: %s", err)
+	}
+	if data["k"].Value != "v" {
+		t.Errorf("Got %v, expected k=v", data)
+	}
+}
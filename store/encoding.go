@@ -0,0 +1,260 @@
+package store
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+	"unicode/utf8"
+)
+
+// Format is the layout used to write the data file and snapshots.
+type Format string
+
+const (
+	// FormatBase64 base64 encodes every key and value. Files without
+	// metadata keep the original flat {key: value} layout, readable by any
+	// version of the store.
+	FormatBase64 Format = "base64"
+
+	// FormatRaw writes valid UTF-8 keys and values as plain JSON strings and
+	// falls back to base64 for the others. Text heavy datasets take around
+	// 20% less space than with FormatBase64, see TestRawFormatSize.
+	FormatRaw Format = "raw"
+
+	// FormatBase64Raw base64 encodes every key and value without padding,
+	// making files slightly smaller than FormatBase64.
+	FormatBase64Raw Format = "base64-raw"
+
+	// FormatHex hex encodes every key and value, for tools that can't read
+	// base64. Files are larger than with FormatBase64.
+	FormatHex Format = "hex"
+)
+
+// ParseFormat returns the Format named s.
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(s); f {
+	case FormatBase64, FormatRaw, FormatBase64Raw, FormatHex:
+		return f, nil
+	default:
+		return "", fmt.Errorf("unknown storage format %q", s)
+	}
+}
+
+// fileFormatVersion is written in data files that don't use the flat layout.
+const fileFormatVersion = 2
+
+type fileFormat struct {
+	Version int `json:"version"`
+
+	// Encoding names the encoding of the keys and values that aren't raw,
+	// empty for the padded base64 of FormatBase64 that files written before
+	// it existed use.
+	Encoding string      `json:"encoding,omitempty"`
+	Entries  []fileEntry `json:"entries"`
+}
+
+// textEncoding turns keys and values into JSON safe text and back.
+type textEncoding interface {
+	EncodeToString(src []byte) string
+	DecodeString(s string) ([]byte, error)
+}
+
+type hexEncoding struct{}
+
+func (hexEncoding) EncodeToString(src []byte) string {
+	return hex.EncodeToString(src)
+}
+
+func (hexEncoding) DecodeString(s string) ([]byte, error) {
+	return hex.DecodeString(s)
+}
+
+// textEncodings are the encodings by the name written in files.
+var textEncodings = map[string]textEncoding{
+	"":                      base64.URLEncoding,
+	string(FormatBase64Raw): base64.RawURLEncoding,
+	string(FormatHex):       hexEncoding{},
+}
+
+// encodingName returns the name of the encoding of the values format doesn't
+// keep raw.
+func encodingName(format Format) string {
+	switch format {
+	case FormatBase64Raw, FormatHex:
+		return string(format)
+	default:
+		return ""
+	}
+}
+
+type fileEntry struct {
+	Key         string            `json:"key"`
+	Value       string            `json:"value"`
+	ContentType string            `json:"content_type,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+
+	// ExpiresAt is the expiration time of the entry in Unix nanoseconds.
+	ExpiresAt int64  `json:"expires_at,omitempty"`
+	Revision  uint64 `json:"revision,omitempty"`
+
+	// History holds the previous versions of the entry, without their key.
+	History []fileEntry `json:"history,omitempty"`
+
+	// Raw is set when Key and Value are stored as is rather than base64
+	// encoded.
+	Raw bool `json:"raw,omitempty"`
+}
+
+func encode(data map[string]Entry, format Format) ([]byte, error) {
+	plain := format == FormatBase64
+	for _, e := range data {
+		if e.ContentType != "" || len(e.Metadata) > 0 || !e.ExpiresAt.IsZero() || e.Revision != 0 {
+			plain = false
+			break
+		}
+	}
+
+	if plain {
+		encodedData := map[string]string{}
+		for k, e := range data {
+			ek := base64.URLEncoding.EncodeToString([]byte(k))
+			ev := base64.URLEncoding.EncodeToString([]byte(e.Value))
+			encodedData[ek] = ev
+		}
+
+		return json.Marshal(encodedData)
+	}
+
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	name := encodingName(format)
+	enc := textEncodings[name]
+	ff := fileFormat{Version: fileFormatVersion, Encoding: name, Entries: make([]fileEntry, 0, len(keys))}
+	for _, k := range keys {
+		ff.Entries = append(ff.Entries, newFileEntry(k, data[k], format, enc))
+	}
+
+	return json.Marshal(ff)
+}
+
+// newFileEntry returns the fileEntry of e at key, its versions included. The
+// key and value are encoded with enc, unless format keeps them raw.
+func newFileEntry(key string, e Entry, format Format, enc textEncoding) fileEntry {
+	fe := fileEntry{Key: key, Value: e.Value, ContentType: e.ContentType, Metadata: e.Metadata, Revision: e.Revision, Raw: true}
+	if !e.ExpiresAt.IsZero() {
+		fe.ExpiresAt = e.ExpiresAt.UnixNano()
+	}
+	if format != FormatRaw || !utf8.ValidString(key) || !utf8.ValidString(e.Value) {
+		fe.Key = enc.EncodeToString([]byte(key))
+		fe.Value = enc.EncodeToString([]byte(e.Value))
+		fe.Raw = false
+	}
+	for _, version := range e.history {
+		fe.History = append(fe.History, newFileEntry("", version, format, enc))
+	}
+
+	return fe
+}
+
+func decode(data []byte) (map[string]Entry, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	// Base64 encoded keys are padded to a multiple of 4 characters, so a
+	// "version" field can't be mistaken for a key of the flat layout.
+	if _, ok := raw["version"]; !ok {
+		return decodeFlat(data)
+	}
+
+	var ff fileFormat
+	if err := json.Unmarshal(data, &ff); err != nil {
+		return nil, err
+	}
+
+	if ff.Version != fileFormatVersion {
+		return nil, fmt.Errorf("unsupported data file version %d", ff.Version)
+	}
+
+	enc, ok := textEncodings[ff.Encoding]
+	if !ok {
+		return nil, fmt.Errorf("unsupported data file encoding %q", ff.Encoding)
+	}
+
+	returnData := map[string]Entry{}
+	for _, fe := range ff.Entries {
+		key, e, err := fe.decode(enc)
+		if err != nil {
+			return nil, err
+		}
+		returnData[key] = e
+	}
+
+	return returnData, nil
+}
+
+// decode returns the key and the entry fe holds, decoding them with enc
+// unless they are raw.
+func (fe fileEntry) decode(enc textEncoding) (string, Entry, error) {
+	e := Entry{Value: fe.Value, ContentType: fe.ContentType, Metadata: fe.Metadata, Revision: fe.Revision}
+	if fe.ExpiresAt != 0 {
+		e.ExpiresAt = time.Unix(0, fe.ExpiresAt)
+	}
+	for _, version := range fe.History {
+		_, v, err := version.decode(enc)
+		if err != nil {
+			return "", Entry{}, err
+		}
+		e.history = append(e.history, v)
+	}
+
+	if fe.Raw {
+		return fe.Key, e, nil
+	}
+
+	dk, err := enc.DecodeString(fe.Key)
+	if err != nil {
+		return "", Entry{}, err
+	}
+
+	dv, err := enc.DecodeString(fe.Value)
+	if err != nil {
+		return "", Entry{}, err
+	}
+
+	e.Value = string(dv)
+	return string(dk), e, nil
+}
+
+func decodeFlat(data []byte) (map[string]Entry, error) {
+	var jsonData map[string]string
+
+	if err := json.Unmarshal(data, &jsonData); err != nil {
+		return nil, err
+	}
+
+	returnData := map[string]Entry{}
+	for k, v := range jsonData {
+		dk, err := base64.URLEncoding.DecodeString(k)
+		if err != nil {
+			return nil, err
+		}
+
+		dv, err := base64.URLEncoding.DecodeString(v)
+		if err != nil {
+			return nil, err
+		}
+
+		returnData[string(dk)] = Entry{Value: string(dv)}
+	}
+
+	return returnData, nil
+}
@@ -0,0 +1,129 @@
+package store
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	t.Parallel()
+
+	data := map[string]Entry{
+		"text":        {Value: "hello world"},
+		"typed":       {Value: `{"a":1}`, ContentType: "application/json"},
+		"described":   {Value: "v", Metadata: map[string]string{"owner": "me", "x-y": ""}},
+		"binary":      {Value: "\x00\xff\xfe"},
+		"\xff binary": {Value: "key isn't UTF-8"},
+		"empty":       {Value: ""},
+		"expiring":    {Value: "soon gone", ExpiresAt: time.Unix(0, 1618912800000000000)},
+		"versioned": {Value: "v3", Revision: 12, history: []Entry{
+			{Value: "\x00v2", ContentType: "text/plain", Revision: 7},
+			{Value: "v1", Revision: 3},
+		}},
+	}
+
+	for _, format := range []Format{FormatBase64, FormatRaw, FormatBase64Raw, FormatHex} {
+		encoded, err := encode(data, format)
+		if err != nil {
+			t.Fatalf("%s: encode returned unexpected error: %s", format, err)
+		}
+
+		got, err := decode(encoded)
+		if err != nil {
+			t.Fatalf("%s: decode returned unexpected error: %s", format, err)
+		}
+
+		if !reflect.DeepEqual(got, data) {
+			t.Errorf("%s: Got %v, expected %v", format, got, data)
+		}
+	}
+}
+
+func TestEncodingHeader(t *testing.T) {
+	t.Parallel()
+
+	data := map[string]Entry{"k": {Value: "\x00\xff"}}
+	testCases := []struct {
+		format Format
+		header string
+		value  string
+	}{
+		{FormatBase64Raw, `"encoding":"base64-raw"`, `"value":"AP8"`},
+		{FormatHex, `"encoding":"hex"`, `"value":"00ff"`},
+	}
+
+	for _, test := range testCases {
+		encoded, err := encode(data, test.format)
+		if err != nil {
+			t.Fatalf("%s: encode returned unexpected error: %s", test.format, err)
+		}
+
+		for _, part := range []string{test.header, test.value} {
+			if !strings.Contains(string(encoded), part) {
+				t.Errorf("%s: %s doesn't have %s", test.format, encoded, part)
+			}
+		}
+	}
+
+	if _, err := decode([]byte(`{"version":2,"encoding":"base32","entries":[]}`)); err == nil {
+		t.Errorf("decode accepted an unknown encoding")
+	}
+}
+
+func TestEncodeRawCollision(t *testing.T) {
+	t.Parallel()
+
+	// "aGk=" is both a valid raw key and the base64 encoding of "hi"
+	data := map[string]Entry{
+		"aGk=": {Value: "raw"},
+		"hi":   {Value: "\xff"},
+	}
+
+	encoded, err := encode(data, FormatRaw)
+	if err != nil {
+		t.Fatalf("encode returned unexpected error: %s", err)
+	}
+
+	got, err := decode(encoded)
+	if err != nil {
+		t.Fatalf("decode returned unexpected error: %s", err)
+	}
+
+	if !reflect.DeepEqual(got, data) {
+		t.Errorf("Got %v, expected %v", got, data)
+	}
+}
+
+func TestDecodeFlat(t *testing.T) {
+	t.Parallel()
+
+	got, err := decode(encodedFixture(map[string]string{"key": "value"}))
+	if err != nil {
+		t.Fatalf("decode returned unexpected error: %s", err)
+	}
+
+	expected := map[string]Entry{"key": {Value: "value"}}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Got %v, expected %v", got, expected)
+	}
+}
+
+func TestRawFormatSize(t *testing.T) {
+	t.Parallel()
+
+	data := map[string]Entry{}
+	for i := 0; i < 1000; i++ {
+		data[fmt.Sprintf("user:%d:bio", i)] = Entry{Value: strings.Repeat("lorem ipsum dolor sit amet ", 10)}
+	}
+
+	b64, _ := encode(data, FormatBase64)
+	raw, _ := encode(data, FormatRaw)
+	t.Logf("base64: %d bytes, raw: %d bytes (%.0f%% smaller)", len(b64), len(raw), 100-float64(len(raw))*100/float64(len(b64)))
+
+	if len(raw) >= len(b64) {
+		t.Errorf("Raw format (%d bytes) isn't smaller than base64 (%d bytes)", len(raw), len(b64))
+	}
+}
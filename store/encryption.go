@@ -0,0 +1,146 @@
+package store
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// encryptedMagic starts the files encrypted by a Keyring.
+var encryptedMagic = []byte("kvenc1")
+
+// EncryptionKey is an AES key, of 16, 24 or 32 bytes, and the ID it is
+// recorded under in the files it encrypts.
+type EncryptionKey struct {
+	ID  string
+	Key []byte
+}
+
+// Keyring encrypts the data file and the snapshots with AES-GCM. The
+// primary key encrypts, every key decrypts: to rotate keys, put the new one
+// first and keep the old ones until nothing is encrypted with them anymore.
+type Keyring struct {
+	primary string
+	aeads   map[string]cipher.AEAD
+}
+
+// NewKeyring returns a Keyring encrypting with the first of keys.
+func NewKeyring(keys []EncryptionKey) (*Keyring, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%w: no key", ErrInvalidEncryptionKey)
+	}
+
+	k := &Keyring{primary: keys[0].ID, aeads: map[string]cipher.AEAD{}}
+	for _, key := range keys {
+		if key.ID == "" || len(key.ID) > 255 {
+			return nil, fmt.Errorf("%w: the ID must be 1 to 255 bytes long", ErrInvalidEncryptionKey)
+		}
+		if _, ok := k.aeads[key.ID]; ok {
+			return nil, fmt.Errorf("%w: duplicate ID %q", ErrInvalidEncryptionKey, key.ID)
+		}
+
+		block, err := aes.NewCipher(key.Key)
+		if err != nil {
+			return nil, fmt.Errorf("%w: key %q: %s", ErrInvalidEncryptionKey, key.ID, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("%w: key %q: %s", ErrInvalidEncryptionKey, key.ID, err)
+		}
+		k.aeads[key.ID] = aead
+	}
+
+	return k, nil
+}
+
+// ParseEncryptionKeys parses a comma separated list of <id>:<base64 key>
+// pairs, the primary key first.
+func ParseEncryptionKeys(s string) ([]EncryptionKey, error) {
+	var keys []EncryptionKey
+	for _, pair := range strings.Split(s, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+
+		i := strings.Index(pair, ":")
+		if i <= 0 {
+			return nil, fmt.Errorf("%w: expected <id>:<base64 key>", ErrInvalidEncryptionKey)
+		}
+		key, err := base64.StdEncoding.DecodeString(pair[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("%w: key %q: %s", ErrInvalidEncryptionKey, pair[:i], err)
+		}
+		keys = append(keys, EncryptionKey{ID: pair[:i], Key: key})
+	}
+
+	return keys, nil
+}
+
+// WithEncryption encrypts the data file and the snapshots with keyring.
+// Files written before encryption was turned on are still read, and
+// encrypted when next written. The Raft log isn't encrypted, nor are the
+// stores set by WithStore, and the bolt backend doesn't support it.
+func WithEncryption(keyring *Keyring) Option {
+	return func(o *options) {
+		o.keyring = keyring
+	}
+}
+
+// seal encrypts plaintext with the primary key. A nil Keyring returns
+// plaintext as is.
+func (k *Keyring) seal(plaintext []byte) ([]byte, error) {
+	if k == nil {
+		return plaintext, nil
+	}
+
+	aead := k.aeads[k.primary]
+	header := append(append(append([]byte{}, encryptedMagic...), byte(len(k.primary))), k.primary...)
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("generating nonce: %w", err)
+	}
+
+	// The header is authenticated, so the key ID can't be swapped
+	sealed := append(header, nonce...)
+
+	return aead.Seal(sealed, nonce, plaintext, header), nil
+}
+
+// open decrypts b, returning it as is when it isn't encrypted, and fails
+// with ErrDecryption when it is but k is nil, lacks its key or it was
+// tampered with.
+func (k *Keyring) open(b []byte) ([]byte, error) {
+	if !bytes.HasPrefix(b, encryptedMagic) {
+		return b, nil
+	}
+	if k == nil {
+		return nil, fmt.Errorf("%w: the data is encrypted and no key is configured", ErrDecryption)
+	}
+
+	rest := b[len(encryptedMagic):]
+	if len(rest) == 0 || len(rest) < 1+int(rest[0]) {
+		return nil, fmt.Errorf("%w: truncated header", ErrDecryption)
+	}
+	id := string(rest[1 : 1+int(rest[0])])
+	header := b[:len(encryptedMagic)+1+len(id)]
+	rest = rest[1+len(id):]
+
+	aead, ok := k.aeads[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown key %q", ErrDecryption, id)
+	}
+	if len(rest) < aead.NonceSize() {
+		return nil, fmt.Errorf("%w: truncated nonce", ErrDecryption)
+	}
+
+	plaintext, err := aead.Open(nil, rest[:aead.NonceSize()], rest[aead.NonceSize():], header)
+	if err != nil {
+		return nil, fmt.Errorf("%w: key %q: %s", ErrDecryption, id, err)
+	}
+
+	return plaintext, nil
+}
@@ -0,0 +1,155 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/raft"
+)
+
+func newTestKeyring(t *testing.T, ids ...string) *Keyring {
+	t.Helper()
+
+	var keys []EncryptionKey
+	for _, id := range ids {
+		keys = append(keys, EncryptionKey{ID: id, Key: bytes.Repeat([]byte(id[:1]), 32)})
+	}
+	k, err := NewKeyring(keys)
+	if err != nil {
+		t.Fatalf("NewKeyring returned unexpected error: %s", err)
+	}
+
+	return k
+}
+
+func TestKeyring(t *testing.T) {
+	old := newTestKeyring(t, "old")
+	sealed, err := old.seal([]byte("secret"))
+	if err != nil {
+		t.Fatalf("seal returned unexpected error: %s", err)
+	}
+	if bytes.Contains(sealed, []byte("secret")) {
+		t.Errorf("The sealed data holds the plaintext")
+	}
+
+	// After a rotation, data sealed with the old key is still opened
+	rotated := newTestKeyring(t, "new", "old")
+	if got, err := rotated.open(sealed); err != nil || string(got) != "secret" {
+		t.Errorf("open() = %q, %v, want secret", got, err)
+	}
+	resealed, _ := rotated.seal([]byte("secret"))
+	if _, err := old.open(resealed); !errors.Is(err, ErrDecryption) {
+		t.Errorf("open() with a retired keyring = %v, want ErrDecryption", err)
+	}
+
+	// Data written before encryption is read as is
+	if got, err := rotated.open([]byte(`{}`)); err != nil || string(got) != "{}" {
+		t.Errorf("open() of plaintext = %q, %v, want {}", got, err)
+	}
+
+	var none *Keyring
+	if _, err := none.open(sealed); !errors.Is(err, ErrDecryption) {
+		t.Errorf("open() without a keyring = %v, want ErrDecryption", err)
+	}
+
+	tampered := append([]byte{}, sealed...)
+	tampered[len(tampered)-1] ^= 1
+	if _, err := old.open(tampered); !errors.Is(err, ErrDecryption) {
+		t.Errorf("open() of tampered data = %v, want ErrDecryption", err)
+	}
+}
+
+func TestParseEncryptionKeys(t *testing.T) {
+	keys, err := ParseEncryptionKeys("k2:MDEyMzQ1Njc4OWFiY2RlZg==, k1:MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=")
+	if err != nil {
+		t.Fatalf("ParseEncryptionKeys returned unexpected error: %s", err)
+	}
+	if len(keys) != 2 || keys[0].ID != "k2" || len(keys[0].Key) != 16 || len(keys[1].Key) != 32 {
+		t.Errorf("ParseEncryptionKeys() = %v", keys)
+	}
+	if _, err := NewKeyring(keys); err != nil {
+		t.Errorf("NewKeyring returned unexpected error: %s", err)
+	}
+
+	for _, s := range []string{"MDEyMzQ1Njc4OWFiY2RlZg==", "k:not base64"} {
+		if _, err := ParseEncryptionKeys(s); !errors.Is(err, ErrInvalidEncryptionKey) {
+			t.Errorf("ParseEncryptionKeys(%q) = %v, want ErrInvalidEncryptionKey", s, err)
+		}
+	}
+	if _, err := NewKeyring([]EncryptionKey{{ID: "short", Key: []byte("key")}}); !errors.Is(err, ErrInvalidEncryptionKey) {
+		t.Errorf("NewKeyring() with a short key = %v, want ErrInvalidEncryptionKey", err)
+	}
+}
+
+func TestEncryptedFileStore(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "data.json")
+
+	// A plaintext file is encrypted when next saved
+	if err := NewFileStore(path).Save(ctx, map[string]Entry{"k": {Value: "plain"}}); err != nil {
+		t.Fatalf("Save returned unexpected error: %s", err)
+	}
+	s := NewEncryptedFileStore(path, FormatRaw, newTestKeyring(t, "key"))
+	data, err := s.Load(ctx)
+	if err != nil || data["k"].Value != "plain" {
+		t.Fatalf("Load() = %v, %v, want the plaintext data", data, err)
+	}
+
+	if err := s.Save(ctx, map[string]Entry{"k": {Value: "confidential"}}); err != nil {
+		t.Fatalf("Save returned unexpected error: %s", err)
+	}
+	content, _ := ioutil.ReadFile(path)
+	if bytes.Contains(content, []byte("confidential")) {
+		t.Errorf("The data file holds the value in clear")
+	}
+	if data, err := s.Load(ctx); err != nil || data["k"].Value != "confidential" {
+		t.Errorf("Load() = %v, %v, want the saved data", data, err)
+	}
+
+	if _, err := NewFileStore(path).Load(ctx); !errors.Is(err, ErrDecryption) {
+		t.Errorf("Load() without the key = %v, want ErrDecryption", err)
+	}
+}
+
+func TestEncryptedSnapshot(t *testing.T) {
+	f := newFSM(NewMemoryStore(), hclog.NewNullLogger())
+	f.format, f.keyring = FormatRaw, newTestKeyring(t, "key")
+	f.Apply(setLog(t, 1, "k", "confidential"))
+
+	snaps := raft.NewInmemSnapshotStore()
+	snap, err := f.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot returned unexpected error: %s", err)
+	}
+	sink, err := snaps.Create(raft.SnapshotVersionMax, 1, 1, raft.Configuration{}, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := snap.Persist(sink); err != nil {
+		t.Fatalf("Persist returned unexpected error: %s", err)
+	}
+	snap.Release()
+
+	_, rc, err := snaps.Open(sink.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, _ := ioutil.ReadAll(rc)
+	if bytes.Contains(content, []byte("confidential")) {
+		t.Errorf("The snapshot holds the value in clear")
+	}
+
+	restored := newFSM(NewMemoryStore(), hclog.NewNullLogger())
+	restored.keyring = newTestKeyring(t, "next", "key")
+	if err := restored.Restore(ioutil.NopCloser(bytes.NewReader(content))); err != nil {
+		t.Fatalf("Restore returned unexpected error: %s", err)
+	}
+	if e, _ := restored.localGet(context.Background(), "k"); e.Value != "confidential" {
+		t.Errorf("Restored %q, want confidential", e.Value)
+	}
+}
@@ -0,0 +1,262 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// MaxKeySize is the maximum length of a key, in bytes.
+	MaxKeySize = 1024
+
+	// MaxValueSize is the maximum length of a value, in bytes.
+	MaxValueSize = 8 << 20
+
+	// MaxMetadataSize is the maximum length of the user metadata of a
+	// value, its names and values together, in bytes.
+	MaxMetadataSize = 8 << 10
+)
+
+var (
+	// ErrNotLeader is returned when a write reaches a node that isn't the
+	// cluster leader.
+	ErrNotLeader = errors.New("not leader")
+
+	// ErrNotFound is returned when an operation needs a key that doesn't
+	// exist.
+	ErrNotFound = errors.New("key not found")
+
+	// ErrKeyExists is returned when an operation would overwrite a key it
+	// isn't allowed to.
+	ErrKeyExists = errors.New("key already exists")
+
+	// ErrInvalidKey is returned when a key is empty or longer than MaxKeySize.
+	ErrInvalidKey = errors.New("invalid key")
+
+	// ErrReservedKey is returned when a client tries to use a key kept for
+	// internal subsystems.
+	ErrReservedKey = errors.New("reserved key")
+
+	// ErrValueTooLarge is returned when a value is longer than MaxValueSize.
+	ErrValueTooLarge = errors.New("value too large")
+
+	// ErrInvalidPatch is returned when a merge patch isn't valid JSON.
+	ErrInvalidPatch = errors.New("invalid patch")
+
+	// ErrNotJSON is returned when patching a value that isn't a JSON
+	// document.
+	ErrNotJSON = errors.New("stored value isn't valid JSON")
+
+	// ErrNotInteger is returned when incrementing a value that isn't an
+	// integer.
+	ErrNotInteger = errors.New("stored value isn't an integer")
+
+	// ErrOverflow is returned when an increment would take an integer out
+	// of the int64 range.
+	ErrOverflow = errors.New("increment overflows")
+
+	// ErrIndexTimeout is returned when a node doesn't catch up with a
+	// requested log index in time.
+	ErrIndexTimeout = errors.New("timed out waiting for index")
+
+	// ErrWaitTimeout is returned when a key waited for isn't created in
+	// time.
+	ErrWaitTimeout = errors.New("timed out waiting for key")
+
+	// ErrInvalidTTL is returned when a TTL is negative or can't be parsed.
+	ErrInvalidTTL = errors.New("invalid TTL")
+
+	// ErrInvalidLimit is returned when a listing asks for more keys than
+	// MaxListLimit, or a negative number of them.
+	ErrInvalidLimit = errors.New("invalid limit")
+
+	// ErrPolicyViolation is returned when a write breaks one of the
+	// WritePolicies.
+	ErrPolicyViolation = errors.New("write rejected by policy")
+
+	// ErrReadOnly is returned when a write reaches a read replica.
+	ErrReadOnly = errors.New("node is a read replica, send writes to the leader")
+
+	// ErrTooManyWrites is returned when a write arrives while the maximum
+	// number of writes are already being applied.
+	ErrTooManyWrites = errors.New("too many writes in flight, retry later")
+
+	// ErrQuotaExceeded is returned when a write would take a namespace past
+	// its Quota.
+	ErrQuotaExceeded = errors.New("namespace quota exceeded")
+
+	// ErrConditionFailed is returned when the precondition of a conditional
+	// batch or of a compare-and-swap doesn't hold.
+	ErrConditionFailed = errors.New("precondition failed")
+
+	// ErrInvalidPrecondition is returned when the precondition of a
+	// conditional batch can't be checked.
+	ErrInvalidPrecondition = errors.New("invalid precondition")
+
+	// ErrNamespaceLimit is returned when a write would go past the
+	// NamespaceLimits.
+	ErrNamespaceLimit = errors.New("namespace limit exceeded")
+
+	// ErrNotReady is returned by reads on a node still restoring its data
+	// at startup, see Config.Ready.
+	ErrNotReady = errors.New("node is still restoring its data")
+
+	// ErrDraining is returned to client requests reaching a node in drain
+	// mode.
+	ErrDraining = errors.New("node is draining, send requests to another node")
+
+	// ErrNothingToCompact is returned when compacting a log that holds no
+	// entry applied after the last snapshot.
+	ErrNothingToCompact = errors.New("nothing applied since the last snapshot")
+
+	// ErrStoreLocked is returned when the data file is held by another
+	// operation for longer than the caller is willing to wait.
+	ErrStoreLocked = errors.New("couldn't get lock")
+
+	// ErrInvalidEncryptionKey is returned when an encryption key isn't a
+	// valid AES key or can't be parsed.
+	ErrInvalidEncryptionKey = errors.New("invalid encryption key")
+
+	// ErrDecryption is returned when encrypted data can't be decrypted with
+	// the configured keys.
+	ErrDecryption = errors.New("couldn't decrypt")
+
+	// ErrUnauthorized is returned when a request carries no token, or one
+	// the node doesn't accept.
+	ErrUnauthorized = errors.New("unauthorized")
+
+	// ErrForbidden is returned when the role of a token doesn't allow the
+	// request.
+	ErrForbidden = errors.New("forbidden")
+
+	// ErrInvalidToken is returned when a token is created with an unknown
+	// role or without a name.
+	ErrInvalidToken = errors.New("invalid token")
+
+	// ErrInvalidACL is returned when an ACL policy has no name or a rule
+	// with an unknown access.
+	ErrInvalidACL = errors.New("invalid ACL policy")
+
+	// ErrNoHMACSecret is returned when a token is signed by a node without
+	// an HMAC secret.
+	ErrNoHMACSecret = errors.New("no HMAC secret configured")
+
+	// ErrStandalone is returned when changing the members of the cluster of
+	// a standalone node, which has none.
+	ErrStandalone = errors.New("node is standalone")
+
+	// ErrReadReplica is returned when promoting a read replica to a voter,
+	// it would reject writes once elected.
+	ErrReadReplica = errors.New("node is a read replica")
+
+	// ErrInvalidTxn is returned for a transaction with an operation it
+	// can't run.
+	ErrInvalidTxn = errors.New("invalid transaction")
+
+	// ErrRevisionNotFound is returned when reading a revision of a key that
+	// never held it, or whose version isn't kept anymore.
+	ErrRevisionNotFound = errors.New("revision not found")
+
+	// ErrBucketNotFound is returned when an operation needs a bucket that
+	// doesn't exist.
+	ErrBucketNotFound = errors.New("bucket not found")
+
+	// ErrBucketExists is returned when creating a bucket that already
+	// exists.
+	ErrBucketExists = errors.New("bucket already exists")
+
+	// ErrLeaseNotFound is returned when an operation needs a lease that
+	// expired, was revoked or never existed.
+	ErrLeaseNotFound = errors.New("lease not found")
+
+	// ErrLockHeld is returned when acquiring a lock held by another lease.
+	ErrLockHeld = errors.New("lock held by another lease")
+
+	// ErrLockNotHeld is returned when releasing a lock the lease doesn't
+	// hold.
+	ErrLockNotHeld = errors.New("lock not held")
+
+	// ErrInvalidMetadata is returned when user metadata has an invalid
+	// name or is longer than MaxMetadataSize.
+	ErrInvalidMetadata = errors.New("invalid metadata")
+)
+
+// NotLeaderError is returned when a write reaches a follower. It matches
+// ErrNotLeader with errors.Is and carries the HTTP address of the current
+// leader, or an empty string while no leader is known.
+type NotLeaderError struct {
+	Leader string
+}
+
+func (e *NotLeaderError) Error() string {
+	if e.Leader == "" {
+		return "not leader: no leader elected"
+	}
+
+	return fmt.Sprintf("not leader: leader is %s", e.Leader)
+}
+
+// Is reports whether target is ErrNotLeader.
+func (e *NotLeaderError) Is(target error) bool {
+	return target == ErrNotLeader
+}
+
+// KeysExistError is returned when a conditional batch finds some of its keys
+// already set. It matches ErrKeyExists with errors.Is and lists the
+// conflicting keys, sorted.
+type KeysExistError struct {
+	Keys []string
+}
+
+func (e *KeysExistError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrKeyExists, strings.Join(e.Keys, ", "))
+}
+
+// Is reports whether target is ErrKeyExists.
+func (e *KeysExistError) Is(target error) bool {
+	return target == ErrKeyExists
+}
+
+func validateKey(key string) error {
+	if key == "" {
+		return fmt.Errorf("%w: key is empty", ErrInvalidKey)
+	}
+
+	if len(key) > MaxKeySize {
+		return fmt.Errorf("%w: key is %d bytes, maximum is %d", ErrInvalidKey, len(key), MaxKeySize)
+	}
+
+	return nil
+}
+
+func validateValue(value string) error {
+	if len(value) > MaxValueSize {
+		return fmt.Errorf("%w: value is %d bytes, maximum is %d", ErrValueTooLarge, len(value), MaxValueSize)
+	}
+
+	return nil
+}
+
+// validateMetadata checks the names of meta are lower case letters, digits
+// and dashes, and that it fits in MaxMetadataSize.
+func validateMetadata(meta map[string]string) error {
+	size := 0
+	for name, value := range meta {
+		if name == "" {
+			return fmt.Errorf("%w: name is empty", ErrInvalidMetadata)
+		}
+		for _, c := range name {
+			if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+				return fmt.Errorf("%w: name %q isn't lower case letters, digits and dashes", ErrInvalidMetadata, name)
+			}
+		}
+		size += len(name) + len(value)
+	}
+
+	if size > MaxMetadataSize {
+		return fmt.Errorf("%w: metadata is %d bytes, maximum is %d", ErrInvalidMetadata, size, MaxMetadataSize)
+	}
+
+	return nil
+}
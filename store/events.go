@@ -0,0 +1,68 @@
+package store
+
+import (
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+// Event describes a change committed to the store.
+type Event struct {
+	Action    string    `json:"action"`
+	Key       string    `json:"key"`
+	Value     string    `json:"value,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+
+	// Principal is the principal of the write, see Command. Only the audit
+	// log records it, watchers and webhooks don't get it.
+	Principal string `json:"-"`
+}
+
+// broker fans out the events applied by the FSM to its subscribers. Sends
+// never block: a subscriber whose channel is full misses the event, so a slow
+// consumer can't hold up fsm.Apply.
+type broker struct {
+	mu     sync.Mutex
+	subs   map[chan Event]struct{}
+	logger hclog.Logger
+}
+
+func newBroker(logger hclog.Logger) *broker {
+	return &broker{subs: map[chan Event]struct{}{}, logger: logger}
+}
+
+// subscribe returns a channel receiving events, buffered to size.
+func (b *broker) subscribe(size int) chan Event {
+	ch := make(chan Event, size)
+
+	b.mu.Lock()
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+
+	return ch
+}
+
+// unsubscribe stops the delivery of events to ch and closes it.
+func (b *broker) unsubscribe(ch chan Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subs[ch]; ok {
+		delete(b.subs, ch)
+		close(ch)
+	}
+}
+
+func (b *broker) publish(ev Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subs {
+		select {
+		case ch <- ev:
+		default:
+			b.logger.Warn("dropping event for slow subscriber", "action", ev.Action, "key", ev.Key)
+		}
+	}
+}
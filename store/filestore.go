@@ -0,0 +1,249 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gofrs/flock"
+)
+
+// Entry is a value along with the metadata stored next to it.
+type Entry struct {
+	Value string
+
+	// ContentType is the media type the value was written with, if any.
+	ContentType string
+
+	// Metadata is the user metadata the value was written with, by lower
+	// case name, see MaxMetadataSize.
+	Metadata map[string]string
+
+	// ExpiresAt is when the entry expires, the zero time means never.
+	ExpiresAt time.Time
+
+	// Revision is the Raft log index of the write that set the value. It
+	// grows with every write of the key, see Config.History.
+	Revision uint64
+
+	// history holds the previous versions of the entry, the latest first,
+	// see WithHistory.
+	history []Entry
+}
+
+func (e Entry) expired(now time.Time) bool {
+	return !e.ExpiresAt.IsZero() && !now.Before(e.ExpiresAt)
+}
+
+// FileStore is a key/value map persisted to a single JSON file. Keys and
+// values are written according to the store's Format. It is safe for
+// concurrent use: the file is read and written by one goroutine at a time,
+// under a file lock keeping other processes out. Set and Delete read and then
+// write the file, a concurrent write may land between the two.
+type FileStore struct {
+	path    string
+	format  Format
+	keyring *Keyring
+
+	// mu serializes the uses of lock, opened on first use.
+	mu   sync.Mutex
+	lock *flock.Flock
+}
+
+var _ Store = (*FileStore)(nil)
+
+// NewFileStore returns a FileStore backed by the file at path, writing it in
+// FormatBase64. The file and its parent directory are created on first use.
+func NewFileStore(path string) *FileStore {
+	return NewFileStoreWithFormat(path, FormatBase64)
+}
+
+// NewFileStoreWithFormat returns a FileStore backed by the file at path,
+// writing it in format. Files are read whatever format they were written in.
+func NewFileStoreWithFormat(path string, format Format) *FileStore {
+	return &FileStore{path: path, format: format}
+}
+
+// NewEncryptedFileStore returns a FileStore backed by the file at path,
+// writing it in format encrypted with keyring, see WithEncryption. It is
+// NewFileStoreWithFormat when keyring is nil.
+func NewEncryptedFileStore(path string, format Format, keyring *Keyring) *FileStore {
+	return &FileStore{path: path, format: format, keyring: keyring}
+}
+
+// Path returns the location of the data file.
+func (s *FileStore) Path() string {
+	return s.path
+}
+
+// Get gets the entry at the specified key
+func (s *FileStore) Get(ctx context.Context, key string) (Entry, error) {
+	data, err := s.Load(ctx)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	return data[key], nil
+}
+
+// Set stores e at the specified key
+func (s *FileStore) Set(ctx context.Context, key string, e Entry) error {
+	data, err := s.Load(ctx)
+	if err != nil {
+		return err
+	}
+
+	data[key] = e
+	return s.Save(ctx, data)
+}
+
+// Delete removes the specified key
+func (s *FileStore) Delete(ctx context.Context, key string) error {
+	data, err := s.Load(ctx)
+	if err != nil {
+		return err
+	}
+
+	delete(data, key)
+
+	return s.Save(ctx, data)
+}
+
+// Iterate calls fn with every entry of the data file.
+func (s *FileStore) Iterate(ctx context.Context, fn func(key string, e Entry) error) error {
+	data, err := s.Load(ctx)
+	if err != nil {
+		return err
+	}
+
+	for key, e := range data {
+		if err := fn(key, e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Snapshot returns all the entries of the data file, see Load.
+func (s *FileStore) Snapshot(ctx context.Context) (map[string]Entry, error) {
+	return s.Load(ctx)
+}
+
+// Restore replaces the content of the data file with data, see Save.
+func (s *FileStore) Restore(ctx context.Context, data map[string]Entry) error {
+	return s.Save(ctx, data)
+}
+
+// Load reads and decodes the whole data file, creating an empty one if it
+// doesn't exist yet.
+func (s *FileStore) Load(ctx context.Context) (map[string]Entry, error) {
+	empty := map[string]Entry{}
+
+	if err := readable(ctx); err != nil {
+		return empty, err
+	}
+
+	if err := s.ensureDir(); err != nil {
+		return empty, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lock == nil {
+		s.lock = flock.New(s.path)
+	}
+	defer s.lock.Close()
+
+	locked, err := s.lock.TryLockContext(ctx, time.Microsecond)
+	if err != nil {
+		return empty, fmt.Errorf("trylock: %w", err)
+	}
+
+	if locked {
+		// First check if the file exists and create it if it is missing. The
+		// lock itself creates an empty file, so treat that as missing too.
+		if info, err := os.Stat(s.path); os.IsNotExist(err) || (err == nil && info.Size() == 0) {
+			emptyData, err := encode(map[string]Entry{}, s.format)
+			if err != nil {
+				return empty, fmt.Errorf("encode: %w", err)
+			}
+			if emptyData, err = s.keyring.seal(emptyData); err != nil {
+				return empty, fmt.Errorf("encrypt: %w", err)
+			}
+
+			if err := ioutil.WriteFile(s.path, emptyData, 0644); err != nil {
+				return empty, fmt.Errorf("write: %w", err)
+			}
+		}
+
+		content, err := ioutil.ReadFile(s.path)
+		if err != nil {
+			return empty, fmt.Errorf("read file: %w", err)
+		}
+
+		if content, err = s.keyring.open(content); err != nil {
+			return empty, err
+		}
+
+		return decode(content)
+	}
+
+	return empty, ErrStoreLocked
+}
+
+// Save encodes data and replaces the content of the data file with it.
+func (s *FileStore) Save(ctx context.Context, data map[string]Entry) error {
+	encodedData, err := encode(data, s.format)
+	if err != nil {
+		return err
+	}
+	if encodedData, err = s.keyring.seal(encodedData); err != nil {
+		return fmt.Errorf("encrypt: %w", err)
+	}
+
+	if err := s.ensureDir(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lock == nil {
+		s.lock = flock.New(s.path)
+	}
+	defer s.lock.Close()
+
+	locked, err := s.lock.TryLockContext(ctx, time.Microsecond)
+	if err != nil {
+		return err
+	}
+
+	if locked {
+		if err := ioutil.WriteFile(s.path, encodedData, 0644); err != nil {
+			return err
+		}
+
+		if err := s.lock.Unlock(); err != nil {
+			return err
+		}
+
+		return nil
+	}
+
+	return ErrStoreLocked
+}
+
+func (s *FileStore) ensureDir() error {
+	dir := filepath.Dir(s.path)
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("creating data directory: %w", err)
+		}
+	}
+
+	return nil
+}
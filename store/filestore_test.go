@@ -0,0 +1,154 @@
+package store
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/raft"
+)
+
+func encodedFixture(data map[string]string) []byte {
+	encodedStore := map[string]string{}
+	for key, value := range data {
+		encodedKey := base64.URLEncoding.EncodeToString([]byte(key))
+		encodedValue := base64.URLEncoding.EncodeToString([]byte(value))
+		encodedStore[encodedKey] = encodedValue
+	}
+
+	fileContents, _ := json.Marshal(encodedStore)
+	return fileContents
+}
+
+func TestFileStoreReadsExistingFormat(t *testing.T) {
+	dir := t.TempDir()
+
+	kvStore := map[string]string{
+		"key1": "value1",
+		"key2": "value2",
+		"key4": "value4",
+	}
+	path := filepath.Join(dir, "data.json")
+	if err := os.WriteFile(path, encodedFixture(kvStore), 0644); err != nil {
+		t.Fatalf("Couldn't write fixture: %s", err)
+	}
+
+	s := NewFileStore(path)
+	data, err := s.Load(context.Background())
+	if err != nil {
+		t.Fatalf("Load returned unexpected error: %s", err)
+	}
+
+	got := map[string]string{}
+	for key, e := range data {
+		got[key] = e.Value
+	}
+	if !reflect.DeepEqual(got, kvStore) {
+		t.Errorf("Got %v, expected %v", got, kvStore)
+	}
+}
+
+func TestFileStoreWritesExistingFormat(t *testing.T) {
+	dir := t.TempDir()
+
+	ctx := context.Background()
+	path := filepath.Join(dir, "nested", "data.json")
+	s := NewFileStore(path)
+
+	kvStore := map[string]string{
+		"key1":      "value1",
+		"with/char": "sp ace\x00binary",
+	}
+	for key, value := range kvStore {
+		if err := s.Set(ctx, key, Entry{Value: value}); err != nil {
+			t.Fatalf("Set returned unexpected error: %s", err)
+		}
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Couldn't read data file: %s", err)
+	}
+
+	var got, expected map[string]string
+	if err := json.Unmarshal(content, &got); err != nil {
+		t.Fatalf("Data file isn't a JSON object: %s", err)
+	}
+	json.Unmarshal(encodedFixture(kvStore), &expected)
+
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Got %v, expected %v", got, expected)
+	}
+}
+
+func TestFileStoreGetSetDelete(t *testing.T) {
+	dir := t.TempDir()
+
+	ctx := context.Background()
+	s := NewFileStore(filepath.Join(dir, "data.json"))
+
+	if out, err := s.Get(ctx, "key"); err != nil || out.Value != "" {
+		t.Fatalf("First Get returned unexpected result, out: %q, error: %s", out, err)
+	}
+
+	if err := s.Set(ctx, "key", Entry{Value: "value"}); err != nil {
+		t.Fatalf("Set returned unexpected error: %s", err)
+	}
+
+	if out, err := s.Get(ctx, "key"); err != nil || out.Value != "value" {
+		t.Fatalf("Second Get returned unexpected result, out: %q, error: %s", out, err)
+	}
+
+	if err := s.Delete(ctx, "key"); err != nil {
+		t.Fatalf("Delete returned unexpected error: %s", err)
+	}
+
+	if out, err := s.Get(ctx, "key"); err != nil || out.Value != "" {
+		t.Fatalf("Third Get returned unexpected result, out: %q, error: %s", out, err)
+	}
+}
+
+func TestFileStoreMetadata(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "data.json")
+
+	data := map[string]Entry{
+		"image": {Value: "\x89PNG\r\n\x1a\n\x00\xff", ContentType: "image/png"},
+		"plain": {Value: "value"},
+	}
+	if err := NewFileStore(path).Save(ctx, data); err != nil {
+		t.Fatalf("Save returned unexpected error: %s", err)
+	}
+
+	// Reopen the file to make sure everything comes from disk
+	got, err := NewFileStore(path).Load(ctx)
+	if err != nil {
+		t.Fatalf("Load returned unexpected error: %s", err)
+	}
+
+	if !reflect.DeepEqual(got, data) {
+		t.Errorf("Got %v, expected %v", got, data)
+	}
+}
+
+func TestRaftAddressToHTTP(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		in  string
+		out string
+	}{
+		{"localhost:8081", "http://localhost:8080"},
+		{"10.0.0.1:9001", "http://10.0.0.1:9000"},
+	}
+
+	for _, test := range testCases {
+		if got := RaftAddressToHTTP(raft.ServerAddress(test.in)).String(); got != test.out {
+			t.Errorf("Got %s, expected %s", got, test.out)
+		}
+	}
+}
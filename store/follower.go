@@ -0,0 +1,91 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+)
+
+// LeaderHeader names the HTTP address of the leader on the answers of
+// followers sending clients to it.
+const LeaderHeader = "X-Raft-Leader"
+
+// FollowerMode is how a follower answers the requests only the leader can
+// serve.
+type FollowerMode string
+
+const (
+	// FollowerProxy forwards the request to the leader and relays its
+	// answer, the default. Clients don't have to know about the cluster.
+	FollowerProxy FollowerMode = "proxy"
+
+	// FollowerRedirect answers 307 Temporary Redirect to the same path on
+	// the leader, clients following redirects resend the request there.
+	FollowerRedirect FollowerMode = "redirect"
+
+	// FollowerMisdirected answers 421 Misdirected Request naming the leader,
+	// which HTTP/2 aware clients and proxies retry against the right origin.
+	FollowerMisdirected FollowerMode = "misdirected"
+
+	// FollowerUnavailable answers 503 Service Unavailable naming the leader,
+	// for clients or load balancers that only retry on 503.
+	FollowerUnavailable FollowerMode = "unavailable"
+)
+
+// ParseFollowerMode returns the FollowerMode named s.
+func ParseFollowerMode(s string) (FollowerMode, error) {
+	switch m := FollowerMode(s); m {
+	case FollowerProxy, FollowerRedirect, FollowerMisdirected, FollowerUnavailable:
+		return m, nil
+	default:
+		return "", fmt.Errorf("unknown follower mode %q", s)
+	}
+}
+
+// forward answers r, received by a follower, according to the follower mode.
+// leader is the HTTP address of the leader.
+func (cfg *Config) forward(w http.ResponseWriter, r *http.Request, leader *url.URL) {
+	switch cfg.followerMode {
+	case FollowerRedirect:
+		target := *leader
+		target.Path, target.RawPath, target.RawQuery = r.URL.Path, r.URL.RawPath, r.URL.RawQuery
+		w.Header().Set(LeaderHeader, leader.String())
+		http.Redirect(w, r, target.String(), http.StatusTemporaryRedirect)
+	case FollowerMisdirected:
+		rejectFollower(w, http.StatusMisdirectedRequest, leader)
+	case FollowerUnavailable:
+		rejectFollower(w, http.StatusServiceUnavailable, leader)
+	default:
+		cfg.proxy(w, r, leader)
+	}
+}
+
+// proxyError answers a request the leader didn't answer: 504 when it timed
+// out, 502 otherwise.
+func (cfg *Config) proxyError(w http.ResponseWriter, r *http.Request, err error) {
+	cfg.logger.Warn("couldn't forward request to the leader", "path", r.URL.Path, "error", err)
+
+	status := http.StatusBadGateway
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		status = http.StatusGatewayTimeout
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": "forwarding to the leader: " + err.Error()})
+}
+
+// rejectFollower answers a request the follower doesn't serve with status,
+// naming the leader in the body, as a not_leader error, and in LeaderHeader.
+func rejectFollower(w http.ResponseWriter, status int, leader *url.URL) {
+	err := &NotLeaderError{Leader: leader.String()}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set(LeaderHeader, err.Leader)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"code": "not_leader", "error": err.Error(), "leader": err.Leader})
+}
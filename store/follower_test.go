@@ -0,0 +1,156 @@
+package store
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+func TestForward(t *testing.T) {
+	leader := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "from leader "+r.URL.RequestURI())
+	}))
+	defer leader.Close()
+
+	leaderURL, err := url.Parse(leader.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		mode   FollowerMode
+		status int
+	}{
+		{FollowerProxy, http.StatusOK},
+		{FollowerRedirect, http.StatusTemporaryRedirect},
+		{FollowerMisdirected, http.StatusMisdirectedRequest},
+		{FollowerUnavailable, http.StatusServiceUnavailable},
+	}
+
+	for _, test := range testCases {
+		cfg := &Config{followerMode: test.mode, logger: hclog.NewNullLogger()}
+		recorder := httptest.NewRecorder()
+		cfg.forward(recorder, httptest.NewRequest(http.MethodPost, "/key/a%2Fb?ttl=1s", nil), leaderURL)
+
+		if recorder.Code != test.status {
+			t.Errorf("%s: Got status %d, expected %d", test.mode, recorder.Code, test.status)
+		}
+
+		switch test.mode {
+		case FollowerProxy:
+			if body := recorder.Body.String(); body != "from leader /key/a%2Fb?ttl=1s" {
+				t.Errorf("%s: Got body %q", test.mode, body)
+			}
+			continue
+		case FollowerRedirect:
+			if location := recorder.Header().Get("Location"); location != leader.URL+"/key/a%2Fb?ttl=1s" {
+				t.Errorf("%s: Got location %q", test.mode, location)
+			}
+		default:
+			var body map[string]string
+			if err := json.NewDecoder(recorder.Body).Decode(&body); err != nil {
+				t.Fatalf("%s: couldn't decode body: %s", test.mode, err)
+			}
+			if body["code"] != "not_leader" || body["leader"] != leader.URL {
+				t.Errorf("%s: Got body %v", test.mode, body)
+			}
+		}
+
+		if got := recorder.Header().Get(LeaderHeader); got != leader.URL {
+			t.Errorf("%s: Got %s %q, expected %q", test.mode, LeaderHeader, got, leader.URL)
+		}
+	}
+}
+
+func TestForwardAfterLeaderChange(t *testing.T) {
+	var forwardedBy, body string
+	leader := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwardedBy = r.Header.Get(ForwardedHeader)
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+		io.WriteString(w, "applied")
+	}))
+	defer leader.Close()
+
+	leaderURL, err := url.Parse(leader.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The former leader answers like a follower getting a forwarded request
+	former := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rejectFollower(w, http.StatusServiceUnavailable, leaderURL)
+	}))
+	defer former.Close()
+
+	formerURL, err := url.Parse(former.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &Config{id: "follower", followerMode: FollowerProxy, logger: hclog.NewNullLogger()}
+	recorder := httptest.NewRecorder()
+	cfg.forward(recorder, httptest.NewRequest(http.MethodPost, "/key/k", strings.NewReader("value")), formerURL)
+
+	if recorder.Code != http.StatusOK || recorder.Body.String() != "applied" {
+		t.Errorf("Got %d %q, expected the answer of the new leader", recorder.Code, recorder.Body.String())
+	}
+	if body != "value" || forwardedBy != "follower" {
+		t.Errorf("The new leader got body %q forwarded by %q, expected value forwarded by follower", body, forwardedBy)
+	}
+}
+
+func TestForwardToUnresponsiveLeader(t *testing.T) {
+	release := make(chan struct{})
+	leader := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer leader.Close()
+	defer close(release)
+
+	leaderURL, err := url.Parse(leader.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &Config{
+		followerMode: FollowerProxy,
+		logger:       hclog.NewNullLogger(),
+		httpClient:   NewHTTPClient(time.Second, 50*time.Millisecond, nil),
+	}
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		recorder := httptest.NewRecorder()
+		cfg.forward(recorder, httptest.NewRequest(http.MethodPost, "/key/k", nil), leaderURL)
+		done <- recorder
+	}()
+
+	select {
+	case recorder := <-done:
+		if recorder.Code != http.StatusGatewayTimeout {
+			t.Errorf("Got status %d, expected %d", recorder.Code, http.StatusGatewayTimeout)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the forwarded request is still waiting for the leader")
+	}
+}
+
+func TestParseFollowerMode(t *testing.T) {
+	for _, s := range []string{"proxy", "redirect", "misdirected", "unavailable"} {
+		if m, err := ParseFollowerMode(s); err != nil || string(m) != s {
+			t.Errorf("ParseFollowerMode(%q) = %q, %v", s, m, err)
+		}
+	}
+
+	if _, err := ParseFollowerMode("drop"); err == nil {
+		t.Errorf("ParseFollowerMode accepted an unknown mode")
+	}
+}
@@ -0,0 +1,179 @@
+package store
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// ForwardedHeader names the node that forwarded a request to the leader. A
+// node getting a forwarded request while it isn't the leader anymore answers
+// not_leader instead of forwarding it again, so the forwarding node retries
+// against the new leader.
+const ForwardedHeader = "X-Raft-Forwarded-By"
+
+const (
+	// forwardAttempts bounds the attempts of a follower at forwarding a
+	// request, across leader changes.
+	forwardAttempts = 3
+
+	// forwardLeaderWait bounds the wait of a follower for a new leader
+	// between two attempts.
+	forwardLeaderWait = 2 * time.Second
+)
+
+// hopHeaders are the headers describing a single connection, which aren't
+// forwarded.
+var hopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// proxy forwards r to the leader and relays its answer. The request is
+// retried against the new leader when the leader can't be reached or
+// answers it is no longer the leader: it didn't apply the request either way.
+func (cfg *Config) proxy(w http.ResponseWriter, r *http.Request, leader *url.URL) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		cfg.proxyError(w, r, fmt.Errorf("reading the request: %w", err))
+
+		return
+	}
+
+	client := *cfg.client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	for attempt := 1; ; attempt++ {
+		resp, err := client.Do(cfg.forwardRequest(r, leader, body))
+		retry := attempt < forwardAttempts && r.Context().Err() == nil
+		if err != nil {
+			var opErr *net.OpError
+			if !retry || !errors.As(err, &opErr) || opErr.Op != "dial" {
+				cfg.proxyError(w, r, err)
+
+				return
+			}
+			cfg.logger.Warn("couldn't reach the leader, retrying", "leader", leader, "error", err)
+		} else if next := movedLeader(resp); retry && next != nil {
+			resp.Body.Close()
+			cfg.logger.Debug("the leader changed, retrying", "leader", leader, "next", next)
+		} else {
+			relay(w, resp)
+			resp.Body.Close()
+
+			return
+		}
+
+		next, err := cfg.nextLeader(r, leader, resp)
+		if err != nil {
+			cfg.proxyError(w, r, err)
+
+			return
+		}
+		leader = next
+	}
+}
+
+// forwardRequest builds the request forwarding r, whose body is body, to the
+// leader.
+func (cfg *Config) forwardRequest(r *http.Request, leader *url.URL, body []byte) *http.Request {
+	target := *leader
+	target.Path, target.RawPath, target.RawQuery = r.URL.Path, r.URL.RawPath, r.URL.RawQuery
+
+	out := r.Clone(r.Context())
+	out.URL, out.Host, out.RequestURI = &target, target.Host, ""
+	out.Body, out.ContentLength = ioutil.NopCloser(bytes.NewReader(body)), int64(len(body))
+	for _, h := range hopHeaders {
+		out.Header.Del(h)
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		if prior := r.Header.Get("X-Forwarded-For"); prior != "" {
+			host = prior + ", " + host
+		}
+		out.Header.Set("X-Forwarded-For", host)
+	}
+	out.Header.Set(ForwardedHeader, string(cfg.id))
+
+	return out
+}
+
+// movedLeader returns the leader named by resp when it answers that it is no
+// longer the leader, nil otherwise.
+func movedLeader(resp *http.Response) *url.URL {
+	if resp.StatusCode != http.StatusServiceUnavailable && resp.StatusCode != http.StatusMisdirectedRequest {
+		return nil
+	}
+
+	u, err := url.Parse(resp.Header.Get(LeaderHeader))
+	if err != nil || u.Host == "" {
+		return nil
+	}
+
+	return u
+}
+
+// nextLeader returns the leader to retry r against after leader failed it:
+// the one named by its answer resp, if any, or the next one elected.
+func (cfg *Config) nextLeader(r *http.Request, leader *url.URL, resp *http.Response) (*url.URL, error) {
+	if resp != nil {
+		return movedLeader(resp), nil
+	}
+
+	deadline := time.Now().Add(forwardLeaderWait)
+	for {
+		if next := cfg.leaderURL(); next != nil && next.String() != leader.String() {
+			return next, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("no leader elected in %s", forwardLeaderWait)
+		}
+
+		select {
+		case <-r.Context().Done():
+			return nil, r.Context().Err()
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+// relay writes to w the answer of the leader resp, flushing it as it comes.
+func relay(w http.ResponseWriter, resp *http.Response) {
+	for h, values := range resp.Header {
+		w.Header()[h] = values
+	}
+	for _, h := range hopHeaders {
+		w.Header().Del(h)
+	}
+	w.WriteHeader(resp.StatusCode)
+
+	flusher, _ := w.(http.Flusher)
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := resp.Body.Read(buf)
+		if n > 0 {
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
@@ -2,227 +2,808 @@ package store
 
 import (
 	"context"
-	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/gofrs/flock"
 	"github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/raft"
 )
 
+// fsm keeps the data in memory and applies commands to it. The store is
+// only written according to the persistence policy, see Persistence.
 type fsm struct {
-	dataFile string
-	lock     *flock.Flock
+	store  Store
+	events *broker
+	logger hclog.Logger
+
+	policies    WritePolicies
+	persistence Persistence
+
+	// quotas limit the namespaces, whose keys start with their name and
+	// separator.
+	quotas    map[string]Quota
+	limits    NamespaceLimits
+	separator string
+
+	// reserved is the prefix of the keys of internal subsystems.
+	reserved string
+
+	// format is the encoding of snapshots and dumps.
+	format Format
+
+	// keyring encrypts the snapshots, they aren't when it is nil.
+	keyring *Keyring
+
+	// mu is held for writing while a command is applied, reads holding it
+	// see the data between two commands. dirty is set when data changed
+	// since it was last saved.
+	mu    sync.RWMutex
+	data  map[string]Entry
+	dirty bool
+
+	// changed are the keys written or removed since the data was last
+	// saved, tracked when the store is an IncrementalStore and nil
+	// otherwise. rewrite is set when the whole data must be saved instead,
+	// after a restore or a failed save. Both are guarded by mu.
+	changed map[string]struct{}
+	rewrite bool
+
+	// namespaces counts the keys and bytes of the namespaces holding keys,
+	// guarded by mu. put and remove keep it up to date, so checking the
+	// limits of a write doesn't scan the data.
+	namespaces map[string]NamespaceStats
+
+	// sorted holds the keys of data in order, the reserved ones aside, for
+	// listings. unsorted is set by the writes adding or removing keys, under
+	// the write lock of mu, and the next listing sorts the keys again:
+	// listings hold the read lock of mu and sortMu to read or rebuild them.
+	sortMu   sync.Mutex
+	sorted   []string
+	unsorted bool
+
+	// ops counts the commands applied, guarded by mu, see OpCounts.
+	ops OpCounts
+
+	// saveMu orders the writes of the data file.
+	saveMu sync.Mutex
+
+	// applied is the index of the last log entry applied, or being applied
+	// while the write lock of mu is held, guarded by mu. It is the Revision
+	// of the entries written.
+	applied uint64
+
+	// historySize is the number of previous versions kept for each key,
+	// see WithHistory.
+	historySize int
+
+	metrics *fsmMetrics
+
+	// snapshotting counts the snapshots taken but not yet released.
+	snapshotting int32
+}
+
+func newFSM(store Store, logger hclog.Logger) *fsm {
+	f := &fsm{
+		store:  store,
+		events: newBroker(logger),
+		logger: logger,
+		data:   map[string]Entry{},
+
+		namespaces: map[string]NamespaceStats{},
+		ops:        OpCounts{},
+
+		separator: DefaultKeySeparator,
+		reserved:  DefaultReservedPrefix + DefaultKeySeparator,
+		format:    FormatBase64,
+		metrics:   newFSMMetrics(),
+	}
+	if _, ok := store.(IncrementalStore); ok {
+		f.changed = map[string]struct{}{}
+	}
+
+	return f
 }
 
 type fsmSnapshot struct {
-	data []byte
+	data   map[string]Entry
+	index  uint64
+	fsm    *fsm
+	logger hclog.Logger
 }
 
 func (f *fsm) Apply(l *raft.Log) interface{} {
-	log.Info("fsm.Apply called", "type", hclog.Fmt("%d", l.Type), "data", hclog.Fmt("%s", l.Data))
+	f.logger.Trace("fsm.Apply called", "type", hclog.Fmt("%d", l.Type), "data", hclog.Fmt("%s", l.Data))
 
 	var cmd Command
 	if err := json.Unmarshal(l.Data, &cmd); err != nil {
-		log.Error("failed command unmarshal", "error", err)
+		f.logger.Error("failed command unmarshal", "error", err)
+		return nil
+	}
+
+	span := startApplySpan(l, cmd)
+	defer span.End()
+
+	f.mu.Lock()
+	// On restart, Raft replays the log from its last snapshot over the data
+	// loaded from the store, which may already hold the commands
+	if l.Index <= f.applied {
+		f.mu.Unlock()
+		f.logger.Trace("skipping command already applied", "index", l.Index)
+
 		return nil
 	}
+	f.applied = l.Index
+	result, events, err := f.apply(cmd)
+	if len(events) > 0 {
+		f.countOp(cmd.Action)
+		f.recordApplied()
+		f.dirty = true
+	}
+	f.mu.Unlock()
+
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	if f.persistence == PersistEveryWrite {
+		if err := f.flush(context.Background()); err != nil {
+			f.logger.Error("couldn't save data file", "error", err)
+		}
+	}
+
+	now := time.Now()
+	for _, ev := range events {
+		// The keys of internal subsystems, like the tokens, aren't
+		// watched
+		if strings.HasPrefix(ev.Key, f.reserved) {
+			continue
+		}
+		ev.Timestamp, ev.Principal = now, cmd.Principal
+		f.events.publish(ev)
+	}
 
-	ctx := context.Background()
+	return result
+}
+
+// apply applies cmd to the data and returns the response of the command and
+// the events it produced, none when it failed. The caller holds the write
+// lock.
+func (f *fsm) apply(cmd Command) (interface{}, []Event, error) {
+	if err := f.policies.normalize(&cmd); err != nil {
+		return nil, nil, err
+	}
+
+	value := cmd.value()
+	var (
+		result interface{}
+		events []Event
+		err    error
+	)
 	switch cmd.Action {
 	case "set":
-		return f.localSet(ctx, cmd.Key, cmd.Value)
+		if err = f.checkQuotas(map[string]int{cmd.Key: len(value)}); err != nil {
+			break
+		}
+		e := Entry{Value: value, ContentType: cmd.ContentType, Metadata: cmd.UserMetadata}
+		if cmd.Lease != 0 {
+			if err = f.attachLease(cmd.Lease, cmd.Key, &e, cmd.time()); err != nil {
+				break
+			}
+		}
+		f.localSet(cmd.Key, e)
+		events = append(events, Event{Action: cmd.Action, Key: cmd.Key, Value: value})
+	case "cas":
+		if err = f.checkCondition(cmd.Key, cmd.Expected, cmd.time()); err != nil {
+			break
+		}
+		if err = f.checkQuotas(map[string]int{cmd.Key: len(value)}); err != nil {
+			break
+		}
+		f.localSet(cmd.Key, Entry{Value: value, ContentType: cmd.ContentType, Metadata: cmd.UserMetadata})
+		events = append(events, Event{Action: "set", Key: cmd.Key, Value: value})
+	case "create":
+		result, err = f.localCreate(cmd.Key, cmd.Sequence, Entry{Value: value, ContentType: cmd.ContentType, Metadata: cmd.UserMetadata}, cmd.time())
+		if err == nil {
+			events = append(events, Event{Action: "set", Key: result.(string), Value: value})
+		}
 	case "delete":
-		return f.localDelete(ctx, cmd.Key)
+		if prev, found := f.localDelete(cmd.Key, cmd.time()); found {
+			result = prev
+		}
+		events = append(events, Event{Action: cmd.Action, Key: cmd.Key})
+	case "delete-bucket":
+		var deleted []string
+		if deleted, err = f.localDeleteBucket(cmd.Key); err != nil {
+			break
+		}
+		events = append(events, Event{Action: "delete", Key: f.bucketKey(cmd.Key)})
+		for _, key := range deleted {
+			events = append(events, Event{Action: "delete", Key: key})
+		}
+		result = len(deleted)
+	case "delete-prefix":
+		deleted := f.localDeletePrefix(cmd.Key)
+		for _, key := range deleted {
+			events = append(events, Event{Action: "delete", Key: key})
+		}
+		result = len(deleted)
+	case "patch":
+		value, err = f.localPatch(cmd.Key, value, cmd.time())
+		result = value
+		events = append(events, Event{Action: cmd.Action, Key: cmd.Key, Value: value})
+	case "incr":
+		var n int64
+		if n, err = f.localIncrement(cmd.Key, cmd.Delta, cmd.time()); err != nil {
+			break
+		}
+		result = n
+		events = append(events, Event{Action: "set", Key: cmd.Key, Value: strconv.FormatInt(n, 10)})
+	case "rename":
+		var e Entry
+		e, err = f.localCopy(cmd.Key, cmd.To, cmd.Overwrite, true, true, cmd.time())
+		events = append(events,
+			Event{Action: "delete", Key: cmd.Key},
+			Event{Action: "set", Key: cmd.To, Value: e.Value},
+		)
+	case "copy":
+		var e Entry
+		e, err = f.localCopy(cmd.Key, cmd.To, cmd.Overwrite, cmd.Metadata, false, cmd.time())
+		events = append(events, Event{Action: "set", Key: cmd.To, Value: e.Value})
+	case "batch":
+		entries := cmd.entries()
+		if err = f.checkQuotas(entrySizes(entries)); err != nil {
+			break
+		}
+		f.localSetMany(entries)
+		for key, e := range entries {
+			events = append(events, Event{Action: "set", Key: key, Value: e.Value})
+		}
+	case "batch-nx":
+		entries := cmd.entries()
+		if err = f.checkAbsent(entries, cmd.time()); err != nil {
+			break
+		}
+		if err = f.checkQuotas(entrySizes(entries)); err != nil {
+			break
+		}
+		f.localSetMany(entries)
+		for key, e := range entries {
+			events = append(events, Event{Action: "set", Key: key, Value: e.Value})
+		}
+	case "batch-if":
+		entries := cmd.entries()
+		if err = f.checkCondition(cmd.Key, cmd.Expected, cmd.time()); err != nil {
+			break
+		}
+		entries[cmd.Key] = Entry{Value: value}
+		if err = f.checkQuotas(entrySizes(entries)); err != nil {
+			break
+		}
+		f.localSetMany(entries)
+		for key, e := range entries {
+			events = append(events, Event{Action: "set", Key: key, Value: e.Value})
+		}
+	case "lease-grant":
+		result, err = f.localGrantLease(cmd.TTL, cmd.time())
+		events = append(events, Event{Action: "set", Key: f.leaseKey(f.applied)})
+	case "lease-keepalive":
+		result, err = f.localKeepAlive(cmd.Lease, cmd.time())
+		events = append(events, Event{Action: "set", Key: f.leaseKey(cmd.Lease)})
+	case "lease-revoke":
+		var deleted []string
+		if deleted, err = f.localRevokeLease(cmd.Lease, cmd.time()); err != nil {
+			break
+		}
+		events = append(events, Event{Action: "delete", Key: f.leaseKey(cmd.Lease)})
+		for _, key := range deleted {
+			events = append(events, Event{Action: "delete", Key: key})
+		}
+		result = len(deleted)
+	case "lock":
+		result, err = f.localLock(cmd.Key, cmd.Lease, cmd.time())
+		events = append(events, Event{Action: "set", Key: f.lockKey(cmd.Key)})
+	case "unlock":
+		err = f.localUnlock(cmd.Key, cmd.Lease, cmd.time())
+		events = append(events, Event{Action: "delete", Key: f.lockKey(cmd.Key)})
+	case "expire":
+		for _, key := range f.localExpire(cmd.time()) {
+			events = append(events, Event{Action: cmd.Action, Key: key})
+		}
+	case "txn":
+		result, events, err = f.localTxn(cmd)
 	default:
-		log.Error("unknown command", "command", cmd, "log", l)
+		f.logger.Error("unknown command", "command", cmd)
+		return nil, nil, nil
+	}
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return result, events, nil
+}
+
+// load replaces the data with the content of the store.
+func (f *fsm) load(ctx context.Context) error {
+	data, err := f.store.Snapshot(ctx)
+	if err != nil {
+		return err
 	}
 
+	f.mu.Lock()
+	f.reset(data)
+	f.dirty, f.rewrite = false, false
+	f.mu.Unlock()
+
 	return nil
 }
 
-func (f *fsm) Snapshot() (raft.FSMSnapshot, error) {
-	log.Info("fsm.Snapshot called")
+// appliedKey returns the key recording the index of the last command that
+// changed the data, saved and snapshotted along with it.
+func (f *fsm) appliedKey() string {
+	return f.reserved + "applied"
+}
+
+// recordApplied records the index of the command being applied as the last
+// one changing the data. The caller holds the write lock.
+func (f *fsm) recordApplied() {
+	f.put(f.appliedKey(), Entry{Value: strconv.FormatUint(f.applied, 10)})
+}
+
+// loadApplied reads the index of the last command the data holds, zero when
+// it isn't recorded: data saved before it was replays the whole log. The
+// caller holds the write lock.
+func (f *fsm) loadApplied() {
+	f.applied = 0
 
-	data, err := f.loadData(context.Background())
+	e, ok := f.data[f.appliedKey()]
+	if !ok {
+		return
+	}
+	index, err := strconv.ParseUint(e.Value, 10, 64)
 	if err != nil {
-		return nil, err
+		f.logger.Error("couldn't decode the applied index, replaying the whole log", "error", err)
+		return
+	}
+	f.applied = index
+}
+
+// flush saves the data to the store if it changed since it was last
+// saved, only the keys that changed when the store is an IncrementalStore.
+// The data is copied under the lock and written without holding it, so
+// writes can go on meanwhile.
+func (f *fsm) flush(ctx context.Context) error {
+	f.saveMu.Lock()
+	defer f.saveMu.Unlock()
+
+	f.mu.Lock()
+	if !f.dirty {
+		f.mu.Unlock()
+		return nil
 	}
+	incremental, ok := f.store.(IncrementalStore)
+	full := !ok || f.rewrite
+
+	var (
+		data    map[string]Entry
+		deleted []string
+	)
+	if full {
+		data = f.copyData()
+	} else {
+		data, deleted = f.changes()
+	}
+	f.dirty, f.rewrite = false, false
+	if f.changed != nil {
+		f.changed = map[string]struct{}{}
+	}
+	f.mu.Unlock()
 
-	encodedData, err := encode(data)
+	var err error
+	if full {
+		err = f.store.Restore(ctx, data)
+	} else {
+		err = incremental.Update(ctx, data, deleted)
+	}
 	if err != nil {
-		return nil, err
+		// The changes saved before the failure aren't known
+		f.mu.Lock()
+		f.dirty, f.rewrite = true, true
+		f.mu.Unlock()
+
+		return err
+	}
+
+	return nil
+}
+
+// changes returns the entries of the keys that changed since the data was
+// last saved, and the changed keys that were removed. The caller holds the
+// lock.
+func (f *fsm) changes() (map[string]Entry, []string) {
+	set := map[string]Entry{}
+	var deleted []string
+	for key := range f.changed {
+		if e, ok := f.data[key]; ok {
+			set[key] = e
+		} else {
+			deleted = append(deleted, key)
+		}
 	}
 
-	return &fsmSnapshot{data: encodedData}, nil
+	return set, deleted
+}
+
+// flushEvery saves the data every interval until ctx is done, then one last
+// time.
+func (f *fsm) flushEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if err := f.flush(context.Background()); err != nil {
+				f.logger.Error("couldn't save data file", "error", err)
+			}
+			return
+		case <-ticker.C:
+			if err := f.flush(ctx); err != nil {
+				f.logger.Error("couldn't save data file", "error", err)
+			}
+		}
+	}
+}
+
+// copyData returns a copy of the data, the caller holds the lock.
+func (f *fsm) copyData() map[string]Entry {
+	data := make(map[string]Entry, len(f.data))
+	for key, e := range f.data {
+		data[key] = e
+	}
+
+	return data
+}
+
+func (f *fsm) Snapshot() (raft.FSMSnapshot, error) {
+	f.logger.Debug("fsm.Snapshot called")
+	defer f.metrics.snapshotDuration.since(time.Now())
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	atomic.AddInt32(&f.snapshotting, 1)
+	return &fsmSnapshot{data: f.copyData(), index: f.applied, fsm: f, logger: f.logger}, nil
 }
 
+// Restore replaces the data with the snapshot read from old. The snapshot is
+// read and decoded without holding the lock, reads go on meanwhile and see the
+// data as it was before, then the data is swapped under the write lock: a
+// read sees the data either fully before or fully after the restore, never
+// part of both. Raft never applies a command while restoring, so writes wait
+// for the restore to complete. The store is written after the swap, reads
+// don't wait for it.
 func (f *fsm) Restore(old io.ReadCloser) error {
-	log.Info("fs.Restore called")
+	f.logger.Debug("fsm.Restore called")
+	defer f.metrics.restoreDuration.since(time.Now())
+
 	b, err := ioutil.ReadAll(old)
 	if err != nil {
 		return err
 	}
 
+	if b, err = f.keyring.open(b); err != nil {
+		return err
+	}
+
 	data, err := decode(b)
 	if err != nil {
 		return err
 	}
 
-	return f.saveData(context.Background(), data)
+	f.mu.Lock()
+	f.reset(data)
+	f.dirty = true
+	f.mu.Unlock()
+	atomic.AddUint64(&f.metrics.restores, 1)
+
+	return f.flush(context.Background())
 }
 
-func (f *fsm) localSet(ctx context.Context, key, value string) error {
-	data, err := f.loadData(ctx)
-	if err != nil {
-		return err
+func (f *fsm) localSet(key string, e Entry) {
+	f.put(key, e)
+}
+
+// localSetMany stores every entry.
+func (f *fsm) localSetMany(entries map[string]Entry) {
+	for key, e := range entries {
+		f.put(key, e)
+	}
+}
+
+// readable fails with the error of ctx when it is done, so a read whose
+// client went away or timed out doesn't wait for the lock.
+func readable(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("reading the store: %w", err)
 	}
 
-	data[key] = value
-	return f.saveData(ctx, data)
+	return nil
 }
 
-// Get gets the value at the specified key
-func (f *fsm) localGet(ctx context.Context, key string) (string, error) {
-	data, err := f.loadData(ctx)
-	if err != nil {
-		return "", err
+// Get gets the entry at the specified key, expired entries are reported as
+// missing even if they haven't been purged yet.
+func (f *fsm) localGet(ctx context.Context, key string) (Entry, error) {
+	e, _, err := f.localLookup(ctx, key)
+	return e, err
+}
+
+// localLookup is localGet also reporting whether key holds an entry, which
+// tells a missing key from an empty value.
+func (f *fsm) localLookup(ctx context.Context, key string) (Entry, bool, error) {
+	if err := readable(ctx); err != nil {
+		return Entry{}, false, err
+	}
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	e, ok := f.data[f.policies.key(key)]
+	if !ok || e.expired(time.Now()) {
+		return Entry{}, false, nil
 	}
 
-	return data[key], nil
+	return e, true, nil
 }
 
-func (f *fsm) localDelete(ctx context.Context, key string) error {
-	data, err := f.loadData(ctx)
-	if err != nil {
-		return err
+// localGetMany returns the entries held by keys, all read between the same
+// two commands. Missing and expired keys are left out.
+func (f *fsm) localGetMany(ctx context.Context, keys []string) (map[string]Entry, error) {
+	if err := readable(ctx); err != nil {
+		return nil, err
 	}
 
-	delete(data, key)
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	now := time.Now()
+	entries := make(map[string]Entry, len(keys))
+	for _, key := range keys {
+		if e, ok := f.data[f.policies.key(key)]; ok && !e.expired(now) {
+			entries[key] = e
+		}
+	}
 
-	return f.saveData(ctx, data)
+	return entries, nil
 }
 
-func (f *fsm) loadData(ctx context.Context) (map[string]string, error) {
-	empty := map[string]string{}
+// localExists reports which of keys hold an entry that hasn't expired.
+func (f *fsm) localExists(ctx context.Context, keys []string) (map[string]bool, error) {
+	if err := readable(ctx); err != nil {
+		return nil, err
+	}
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
 
-	if f.lock == nil {
-		f.lock = flock.New(f.dataFile)
+	now := time.Now()
+	exists := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		e, ok := f.data[f.policies.key(key)]
+		exists[key] = ok && !e.expired(now)
 	}
-	defer f.lock.Close()
 
-	locked, err := f.lock.TryLockContext(ctx, time.Microsecond)
-	if err != nil {
-		return empty, fmt.Errorf("trylock: %w", err)
+	return exists, nil
+}
+
+// entrySizes returns the size of the value of every entry by key.
+func entrySizes(entries map[string]Entry) map[string]int {
+	sizes := make(map[string]int, len(entries))
+	for key, e := range entries {
+		sizes[key] = len(e.Value)
 	}
 
-	if locked {
-		// First check if the folder exists and create it if it is missing
-		if _, err := os.Stat(f.dataFile); os.IsNotExist(err) {
-			emptyData, err := encode(map[string]string{})
-			if err != nil {
-				return empty, fmt.Errorf("encode: %w", err)
-			}
+	return sizes
+}
 
-			if err := ioutil.WriteFile(f.dataFile, emptyData, 0644); err != nil {
-				return empty, fmt.Errorf("write: %w", err)
-			}
+// checkAbsent fails with a *KeysExistError when some of the keys of entries
+// hold an entry that hasn't expired at now.
+func (f *fsm) checkAbsent(entries map[string]Entry, now time.Time) error {
+	var taken []string
+	for key := range entries {
+		if e, ok := f.data[key]; ok && !e.expired(now) {
+			taken = append(taken, key)
 		}
+	}
 
-		content, err := ioutil.ReadFile(f.dataFile)
-		if err != nil {
-			return empty, fmt.Errorf("read file: %w", err)
-		}
+	if len(taken) > 0 {
+		sort.Strings(taken)
+		return &KeysExistError{Keys: taken}
+	}
 
-		return decode(content)
+	return nil
+}
+
+// checkCondition fails with ErrConditionFailed unless key holds expected, a
+// missing key or one expired at now holding the empty value.
+func (f *fsm) checkCondition(key, expected string, now time.Time) error {
+	var current string
+	if e, ok := f.data[key]; ok && !e.expired(now) {
+		current = e.Value
 	}
 
-	return empty, fmt.Errorf("couldn't get lock")
+	if current != expected {
+		return fmt.Errorf("%w: %q doesn't hold the expected value", ErrConditionFailed, key)
+	}
 
+	return nil
 }
 
-func (f *fsm) saveData(ctx context.Context, data map[string]string) error {
-	encodedData, err := encode(data)
-	if err != nil {
-		return err
+// localCopy copies the entry at from to the key to and returns the new entry.
+// The content type and expiration are only copied when metadata is set, and
+// from is removed when move is set. Entries expired at now count as missing.
+func (f *fsm) localCopy(from, to string, overwrite, metadata, move bool, now time.Time) (Entry, error) {
+	e, ok := f.data[from]
+	if !ok || e.expired(now) {
+		return Entry{}, fmt.Errorf("%w: %q", ErrNotFound, from)
 	}
 
-	if f.lock == nil {
-		f.lock = flock.New(f.dataFile)
+	if dst, ok := f.data[to]; ok && !dst.expired(now) && !overwrite {
+		return Entry{}, fmt.Errorf("%w: %q", ErrKeyExists, to)
 	}
-	defer f.lock.Close()
 
-	locked, err := f.lock.TryLockContext(ctx, time.Microsecond)
-	if err != nil {
-		return err
+	if !metadata {
+		e = Entry{Value: e.Value}
 	}
 
-	if locked {
-		if err := ioutil.WriteFile(f.dataFile, encodedData, 0644); err != nil {
-			return err
-		}
+	var removed []string
+	if move {
+		removed = append(removed, from)
+	}
+	if err := f.checkQuotas(map[string]int{to: len(e.Value)}, removed...); err != nil {
+		return Entry{}, err
+	}
 
-		if err := f.lock.Unlock(); err != nil {
-			return err
-		}
+	if move {
+		f.remove(from)
+	}
+	f.put(to, e)
 
-		return nil
+	return e, nil
+}
+
+// localExpire removes the entries that expired at now and returns their keys.
+func (f *fsm) localExpire(now time.Time) []string {
+	var expired []string
+	for key, e := range f.data {
+		if e.expired(now) {
+			expired = append(expired, key)
+			f.remove(key)
+		}
 	}
 
-	return fmt.Errorf("couldn't get lock")
+	return expired
 }
 
-func encode(data map[string]string) ([]byte, error) {
-	encodedData := map[string]string{}
-	for k, v := range data {
-		ek := base64.URLEncoding.EncodeToString([]byte(k))
-		ev := base64.URLEncoding.EncodeToString([]byte(v))
-		encodedData[ek] = ev
+// hasExpired reports whether any entry expired at now.
+func (f *fsm) hasExpired(ctx context.Context, now time.Time) (bool, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	for _, e := range f.data {
+		if e.expired(now) {
+			return true, nil
+		}
 	}
 
-	return json.Marshal(encodedData)
+	return false, nil
 }
 
-func decode(data []byte) (map[string]string, error) {
-	var jsonData map[string]string
+// localPatch applies the JSON merge patch to the document at key and returns
+// the merged document. A missing key, or one expired at now, is patched as an
+// empty document.
+func (f *fsm) localPatch(key, patch string, now time.Time) (string, error) {
+	e, ok := f.data[key]
+	if !ok || e.expired(now) {
+		e = Entry{Value: "null", ContentType: "application/json"}
+	}
 
-	if err := json.Unmarshal(data, &jsonData); err != nil {
-		return nil, err
+	merged, err := mergePatch(e.Value, patch)
+	if err != nil {
+		return "", err
 	}
 
-	returnData := map[string]string{}
-	for k, v := range jsonData {
-		dk, err := base64.URLEncoding.DecodeString(k)
-		if err != nil {
-			return nil, err
-		}
+	if err := f.policies.check(key, merged); err != nil {
+		return "", err
+	}
+
+	if err := f.checkQuotas(map[string]int{key: len(merged)}); err != nil {
+		return "", err
+	}
+
+	e.Value = merged
+	f.put(key, e)
 
-		dv, err := base64.URLEncoding.DecodeString(v)
-		if err != nil {
-			return nil, err
+	return merged, nil
+}
+
+// localDeletePrefix removes the keys starting with prefix, but those of the
+// reserved space, and returns them.
+func (f *fsm) localDeletePrefix(prefix string) []string {
+	var deleted []string
+	for key := range f.data {
+		if strings.HasPrefix(key, prefix) && !strings.HasPrefix(key, f.reserved) {
+			f.remove(key)
+			deleted = append(deleted, key)
 		}
+	}
+	sort.Strings(deleted)
 
-		returnData[string(dk)] = string(dv)
+	return deleted
+}
+
+// localDelete removes the entry at key and returns it, found is false when
+// the key didn't exist or had expired at now.
+func (f *fsm) localDelete(key string, now time.Time) (e Entry, found bool) {
+	e, found = f.data[key]
+	if !found {
+		return Entry{}, false
+	}
+	f.remove(key)
+
+	if e.expired(now) {
+		return Entry{}, false
 	}
 
-	return returnData, nil
+	return e, true
 }
 
 func (s *fsmSnapshot) Persist(sink raft.SnapshotSink) error {
-	log.Info("fsmSnapshot.Persist called")
-	if _, err := sink.Write(s.data); err != nil {
+	s.logger.Debug("fsmSnapshot.Persist called")
+	defer s.fsm.metrics.persistDuration.since(time.Now())
+
+	encodedData, err := encode(s.data, s.fsm.format)
+	if err == nil {
+		encodedData, err = s.fsm.keyring.seal(encodedData)
+	}
+	if err != nil {
+		sink.Cancel()
+		return err
+	}
+
+	if _, err := sink.Write(encodedData); err != nil {
+		sink.Cancel()
 		return err
 	}
-	defer sink.Close()
+
+	if err := sink.Close(); err != nil {
+		return err
+	}
+
+	atomic.AddUint64(&s.fsm.metrics.snapshots, 1)
+	atomic.StoreUint64(&s.fsm.metrics.lastSnapshotSize, uint64(len(encodedData)))
+	atomic.StoreUint64(&s.fsm.metrics.lastSnapshotIndex, s.index)
+
+	// The data file was last written by the previous snapshot
+	if s.fsm.persistence == PersistOnSnapshot {
+		if err := s.fsm.flush(context.Background()); err != nil {
+			s.logger.Error("couldn't save data file", "error", err)
+		}
+	}
 
 	return nil
 }
 
 func (s *fsmSnapshot) Release() {
-	log.Info("fsmSnapshot.Release called")
+	s.logger.Trace("fsmSnapshot.Release called")
+	atomic.AddInt32(&s.fsm.snapshotting, -1)
 }
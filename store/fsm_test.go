@@ -0,0 +1,247 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/raft"
+)
+
+func TestRename(t *testing.T) {
+	cfg := newTestConfig(t)
+	ctx := context.Background()
+
+	if _, err := cfg.SetEntry(ctx, "src", Entry{Value: "value", ContentType: "text/plain"}); err != nil {
+		t.Fatalf("SetEntry returned unexpected error: %s", err)
+	}
+	cfg.Set(ctx, "taken", "other")
+
+	if _, err := cfg.Rename(ctx, "missing", "dst", false); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Rename of missing key: Got error %v, expected %v", err, ErrNotFound)
+	}
+
+	if _, err := cfg.Rename(ctx, "src", "taken", false); !errors.Is(err, ErrKeyExists) {
+		t.Errorf("Rename onto existing key: Got error %v, expected %v", err, ErrKeyExists)
+	}
+
+	if got, _ := cfg.Get(ctx, "taken"); got != "other" {
+		t.Errorf("Failed rename changed the destination to %q", got)
+	}
+
+	if _, err := cfg.Rename(ctx, "src", "dst", false); err != nil {
+		t.Fatalf("Rename returned unexpected error: %s", err)
+	}
+
+	if got, _ := cfg.GetEntry(ctx, "dst"); got.Value != "value" || got.ContentType != "text/plain" {
+		t.Errorf("Got %+v at destination, expected the source entry", got)
+	}
+
+	if got, _ := cfg.Get(ctx, "src"); got != "" {
+		t.Errorf("Source still holds %q", got)
+	}
+
+	if _, err := cfg.Rename(ctx, "dst", "taken", true); err != nil {
+		t.Fatalf("Rename with overwrite returned unexpected error: %s", err)
+	}
+
+	if got, _ := cfg.Get(ctx, "taken"); got != "value" {
+		t.Errorf("Got %q, expected overwritten destination", got)
+	}
+}
+
+func TestRenameReplay(t *testing.T) {
+	// Both keys expired long ago by the local clock, but not yet at the time
+	// of the renames and copies
+	at := func(d time.Duration) string {
+		return strconv.FormatInt(time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC).Add(d).UnixNano(), 10)
+	}
+	f := newFSM(NewFileStore(filepath.Join(t.TempDir(), "data.json")), hclog.NewNullLogger())
+	f.Apply(&raft.Log{Index: 1, Data: []byte(`{"Action":"batch","Entries":[` +
+		`{"Key":"src","Data":"dg==","ExpiresAt":` + at(time.Minute) + `},` +
+		`{"Key":"taken","Data":"dg==","ExpiresAt":` + at(time.Minute) + `}]}`)})
+
+	testCases := []struct {
+		log *raft.Log
+		err error
+	}{
+		{&raft.Log{Index: 2, Data: []byte(`{"Action":"rename","Key":"src","To":"taken","Now":` + at(30*time.Second) + `}`)}, ErrKeyExists},
+		{&raft.Log{Index: 3, Data: []byte(`{"Action":"rename","Key":"src","To":"dst","Now":` + at(30*time.Second) + `}`)}, nil},
+		{&raft.Log{Index: 4, Data: []byte(`{"Action":"rename","Key":"dst","To":"src","Now":` + at(2*time.Minute) + `}`)}, ErrNotFound},
+		{&raft.Log{Index: 5, Data: []byte(`{"Action":"copy","Key":"dst","To":"src","Metadata":true,"Now":` + at(30*time.Second) + `}`)}, nil},
+		{&raft.Log{Index: 6, Data: []byte(`{"Action":"copy","Key":"dst","To":"taken","Now":` + at(40*time.Second) + `}`)}, ErrKeyExists},
+		{&raft.Log{Index: 7, Data: []byte(`{"Action":"copy","Key":"dst","To":"taken","Now":` + at(2*time.Minute) + `}`)}, ErrNotFound},
+	}
+	for _, test := range testCases {
+		err, _ := f.Apply(test.log).(error)
+		if !errors.Is(err, test.err) {
+			t.Errorf("Log %d: got error %v, expected %v", test.log.Index, err, test.err)
+		}
+	}
+}
+
+func TestDeleteReplay(t *testing.T) {
+	// Both keys expired long ago by the local clock, but only the second at
+	// the time of its delete
+	at := func(d time.Duration) string {
+		return strconv.FormatInt(time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC).Add(d).UnixNano(), 10)
+	}
+	f := newFSM(NewFileStore(filepath.Join(t.TempDir(), "data.json")), hclog.NewNullLogger())
+	f.Apply(&raft.Log{Index: 1, Data: []byte(`{"Action":"batch","Entries":[` +
+		`{"Key":"a","Data":"dg==","ExpiresAt":` + at(time.Minute) + `},` +
+		`{"Key":"b","Data":"dg==","ExpiresAt":` + at(time.Minute) + `}]}`)})
+
+	if e, ok := f.Apply(&raft.Log{Index: 2, Data: []byte(`{"Action":"delete","Key":"a","Now":` + at(30*time.Second) + `}`)}).(Entry); !ok || e.Value != "v" {
+		t.Errorf("Delete before the expiration returned %+v, expected the entry", e)
+	}
+	if got := f.Apply(&raft.Log{Index: 3, Data: []byte(`{"Action":"delete","Key":"b","Now":` + at(2*time.Minute) + `}`)}); got != nil {
+		t.Errorf("Delete after the expiration returned %+v, expected nothing", got)
+	}
+}
+
+func TestCopy(t *testing.T) {
+	cfg := newTestConfig(t)
+	ctx := context.Background()
+
+	cfg.SetEntry(ctx, "src", Entry{Value: "value", ContentType: "text/plain"})
+	cfg.Set(ctx, "taken", "other")
+
+	if _, err := cfg.Copy(ctx, "missing", "dst", false, false); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Copy of missing key: Got error %v, expected %v", err, ErrNotFound)
+	}
+
+	if _, err := cfg.Copy(ctx, "src", "taken", false, false); !errors.Is(err, ErrKeyExists) {
+		t.Errorf("Copy onto existing key: Got error %v, expected %v", err, ErrKeyExists)
+	}
+
+	if _, err := cfg.Copy(ctx, "src", "plain", false, false); err != nil {
+		t.Fatalf("Copy returned unexpected error: %s", err)
+	}
+
+	if _, err := cfg.Copy(ctx, "src", "taken", true, true); err != nil {
+		t.Fatalf("Copy with overwrite returned unexpected error: %s", err)
+	}
+
+	testCases := []struct {
+		key      string
+		expected Entry
+	}{
+		{"src", Entry{Value: "value", ContentType: "text/plain"}},
+		{"plain", Entry{Value: "value"}},
+		{"taken", Entry{Value: "value", ContentType: "text/plain"}},
+	}
+	for _, test := range testCases {
+		got, _ := cfg.GetEntry(ctx, test.key)
+		got.Revision = 0
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("%s: Got %+v, expected %+v", test.key, got, test.expected)
+		}
+	}
+}
+
+// slowReader blocks its first read until release is closed.
+type slowReader struct {
+	r       io.Reader
+	reading chan struct{}
+	release chan struct{}
+}
+
+func (s *slowReader) Read(p []byte) (int, error) {
+	if s.reading != nil {
+		close(s.reading)
+		s.reading = nil
+		<-s.release
+	}
+
+	return s.r.Read(p)
+}
+
+func TestReadsDuringRestore(t *testing.T) {
+	ctx := context.Background()
+	f := newFSM(NewFileStore(filepath.Join(t.TempDir(), "data.json")), hclog.NewNullLogger())
+	f.Apply(setLog(t, 1, "k1", "old"))
+	f.Apply(setLog(t, 2, "k2", "old"))
+
+	snapshot, err := encode(map[string]Entry{"k1": {Value: "new"}, "k2": {Value: "new"}}, FormatBase64)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	slow := &slowReader{r: bytes.NewReader(snapshot), reading: make(chan struct{}), release: make(chan struct{})}
+	reading := slow.reading
+	restored := make(chan error)
+	go func() { restored <- f.Restore(ioutil.NopCloser(slow)) }()
+
+	// Reads aren't held up by a restore that is still reading the snapshot
+	<-reading
+	if e, err := f.localGet(ctx, "k1"); err != nil || e.Value != "old" {
+		t.Errorf("localGet during restore = %q, %v, want the data before the restore", e.Value, err)
+	}
+
+	close(slow.release)
+	for done := false; !done; {
+		select {
+		case err := <-restored:
+			if err != nil {
+				t.Fatalf("Restore returned unexpected error: %s", err)
+			}
+			done = true
+		default:
+		}
+
+		entries, err := f.localGetMany(ctx, []string{"k1", "k2"})
+		if err != nil {
+			t.Fatalf("localGetMany returned unexpected error: %s", err)
+		}
+		if v := entries["k1"].Value; (v != "old" && v != "new") || entries["k2"].Value != v {
+			t.Fatalf("read a partly restored state: k1 = %q, k2 = %q", v, entries["k2"].Value)
+		}
+	}
+
+	if e, _ := f.localGet(ctx, "k2"); e.Value != "new" {
+		t.Errorf("localGet after restore = %q, want the restored data", e.Value)
+	}
+}
+
+func TestReplayAfterRestart(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "data.json")
+	log := []*raft.Log{
+		{Index: 1, Data: []byte(`{"Action":"incr","Key":"c","Delta":1}`)},
+		{Index: 2, Data: []byte(`{"Action":"incr","Key":"c","Delta":1}`)},
+	}
+
+	f := newFSM(NewFileStore(path), hclog.NewNullLogger())
+	for _, l := range log {
+		f.Apply(l)
+	}
+	if err := f.flush(ctx); err != nil {
+		t.Fatalf("flush returned unexpected error: %s", err)
+	}
+
+	// Without a snapshot, Raft replays the whole log over the saved data
+	restarted := newFSM(NewFileStore(path), hclog.NewNullLogger())
+	if err := restarted.load(ctx); err != nil {
+		t.Fatalf("load returned unexpected error: %s", err)
+	}
+	for _, l := range log {
+		restarted.Apply(l)
+	}
+	if e, err := restarted.localGet(ctx, "c"); err != nil || e.Value != "2" {
+		t.Errorf("localGet after the replay = %q, %v, want 2", e.Value, err)
+	}
+
+	// The commands the saved data doesn't hold yet are applied
+	restarted.Apply(&raft.Log{Index: 3, Data: []byte(`{"Action":"incr","Key":"c","Delta":1}`)})
+	if e, _ := restarted.localGet(ctx, "c"); e.Value != "3" {
+		t.Errorf("localGet after a new command = %q, want 3", e.Value)
+	}
+}
@@ -0,0 +1,107 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// History returns the versions of the value at key, the current one first
+// and then the previous ones kept, see WithHistory, the latest first. It
+// fails with ErrNotFound when key holds no value: deleting a key drops its
+// history.
+func (cfg *Config) History(ctx context.Context, key string) (_ []Entry, err error) {
+	ctx, span := startSpan(ctx, "Config.History", attribute.String("kv.key", key))
+	defer func() { endSpan(span, err) }()
+
+	if err := cfg.validateKey(key); err != nil {
+		return nil, err
+	}
+	if err := cfg.checkReady(); err != nil {
+		return nil, err
+	}
+	cfg.recordReads(key)
+
+	return cfg.fsm.localHistory(ctx, key)
+}
+
+// GetRevision returns the version of the value at key written at revision
+// rev. It fails with ErrRevisionNotFound when key never held that revision,
+// or when its version isn't kept anymore.
+func (cfg *Config) GetRevision(ctx context.Context, key string, rev uint64) (Entry, error) {
+	versions, err := cfg.History(ctx, key)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return Entry{}, err
+	}
+
+	for _, e := range versions {
+		if e.Revision == rev {
+			return e, nil
+		}
+	}
+
+	return Entry{}, fmt.Errorf("%w: %q has no revision %d", ErrRevisionNotFound, key, rev)
+}
+
+// localHistory returns the current entry at key followed by its previous
+// versions.
+func (f *fsm) localHistory(ctx context.Context, key string) ([]Entry, error) {
+	if err := readable(ctx); err != nil {
+		return nil, err
+	}
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	e, ok := f.data[f.policies.key(key)]
+	if !ok || e.expired(time.Now()) {
+		return nil, fmt.Errorf("%w: %q", ErrNotFound, key)
+	}
+
+	versions := append(make([]Entry, 0, 1+len(e.history)), e)
+	versions[0].history = nil
+
+	return append(versions, e.history...), nil
+}
+
+// versions returns the previous versions kept by the entry replacing old, the
+// latest first. Replaying the log over data holding later writes, as after a
+// restart without a snapshot, leaves out the versions written after the
+// command being applied: replaying the later commands brings them back. The
+// caller holds the write lock.
+func (f *fsm) versions(old Entry) []Entry {
+	var versions []Entry
+	history := old.history
+	if old.Revision < f.applied {
+		old.history = nil
+		versions = append(versions, old)
+	}
+	for _, v := range history {
+		if len(versions) == f.historySize {
+			break
+		}
+		if v.Revision < f.applied {
+			versions = append(versions, v)
+		}
+	}
+
+	return versions
+}
+
+// lastRevision returns the latest revision of the data.
+func (f *fsm) lastRevision() uint64 {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	var last uint64
+	for _, e := range f.data {
+		if e.Revision > last {
+			last = e.Revision
+		}
+	}
+
+	return last
+}
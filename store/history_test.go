@@ -0,0 +1,85 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/raft"
+)
+
+func TestHistory(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.fsm.historySize = 2
+	ctx := context.Background()
+
+	var revisions []uint64
+	for i := 1; i <= 4; i++ {
+		index, err := cfg.SetEntry(ctx, "key", Entry{Value: fmt.Sprintf("v%d", i)})
+		if err != nil {
+			t.Fatalf("SetEntry returned unexpected error: %s", err)
+		}
+		revisions = append(revisions, index)
+	}
+
+	versions, err := cfg.History(ctx, "key")
+	if err != nil {
+		t.Fatalf("History returned unexpected error: %s", err)
+	}
+	if len(versions) != 3 {
+		t.Fatalf("Got %d versions, expected the current one and 2 previous ones", len(versions))
+	}
+	for i, e := range versions {
+		if want := fmt.Sprintf("v%d", 4-i); e.Value != want || e.Revision != revisions[3-i] {
+			t.Errorf("Version %d is %q at %d, expected %q at %d", i, e.Value, e.Revision, want, revisions[3-i])
+		}
+	}
+
+	if e, err := cfg.GetRevision(ctx, "key", revisions[1]); err != nil || e.Value != "v2" {
+		t.Errorf("GetRevision(%d) = %q, %v, want v2", revisions[1], e.Value, err)
+	}
+	if _, err := cfg.GetRevision(ctx, "key", revisions[0]); !errors.Is(err, ErrRevisionNotFound) {
+		t.Errorf("Got error %v for a dropped version, expected %v", err, ErrRevisionNotFound)
+	}
+
+	if _, err := cfg.Delete(ctx, "key"); err != nil {
+		t.Fatalf("Delete returned unexpected error: %s", err)
+	}
+	if _, err := cfg.History(ctx, "key"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Got error %v once deleted, expected %v", err, ErrNotFound)
+	}
+}
+
+func TestHistoryReplay(t *testing.T) {
+	f := newFSM(NewFileStore(filepath.Join(t.TempDir(), "data.json")), hclog.NewNullLogger())
+	f.historySize = 5
+
+	logs := []*raft.Log{
+		{Index: 1, Data: []byte(`{"Action":"set","Key":"key","Data":"djE="}`)},
+		{Index: 2, Data: []byte(`{"Action":"set","Key":"key","Data":"djI="}`)},
+		{Index: 3, Data: []byte(`{"Action":"set","Key":"key","Data":"djM="}`)},
+	}
+	for _, l := range logs {
+		f.Apply(l)
+	}
+
+	// Restarting without a snapshot replays the log over the saved data
+	for _, l := range logs {
+		f.Apply(l)
+	}
+
+	versions, err := f.localHistory(context.Background(), "key")
+	if err != nil {
+		t.Fatalf("localHistory returned unexpected error: %s", err)
+	}
+	var got []string
+	for _, e := range versions {
+		got = append(got, fmt.Sprintf("%s@%d", e.Value, e.Revision))
+	}
+	if want := "[v3@3 v2@2 v1@1]"; fmt.Sprint(got) != want {
+		t.Errorf("Got versions %v, expected %s", got, want)
+	}
+}
@@ -0,0 +1,169 @@
+package store
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+const (
+	// hotKeysQueueSize is the buffer of the events counted as writes.
+	hotKeysQueueSize = 4096
+
+	// defaultHotKeysTop is the number of keys reported when the request
+	// doesn't say.
+	defaultHotKeysTop = 20
+)
+
+// KeyAccess counts the reads and writes of a key seen by a node.
+type KeyAccess struct {
+	Key    string `json:"key"`
+	Reads  uint64 `json:"reads"`
+	Writes uint64 `json:"writes"`
+}
+
+func (a *KeyAccess) total() uint64 {
+	return a.Reads + a.Writes
+}
+
+// hotKeys counts the accesses to at most capacity keys, so the tracking
+// doesn't grow with the keyspace. When it is full, a new key replaces the
+// least accessed one and inherits its count, as in the space-saving
+// algorithm: keys accessed often always make it to the top, the counts of
+// the others can be overestimated. The counts are local to the node and lost
+// on restart.
+type hotKeys struct {
+	mu       sync.Mutex
+	capacity int
+	keys     map[string]*KeyAccess
+}
+
+func newHotKeys(capacity int) *hotKeys {
+	return &hotKeys{capacity: capacity, keys: make(map[string]*KeyAccess, capacity)}
+}
+
+// access returns the counters of key, making room for it if needed. The
+// caller holds the lock.
+func (h *hotKeys) access(key string) *KeyAccess {
+	if a, ok := h.keys[key]; ok {
+		return a
+	}
+
+	a := &KeyAccess{Key: key}
+	if len(h.keys) >= h.capacity {
+		var min *KeyAccess
+		for _, other := range h.keys {
+			if min == nil || other.total() < min.total() {
+				min = other
+			}
+		}
+		delete(h.keys, min.Key)
+		a.Reads, a.Writes = min.Reads, min.Writes
+	}
+	h.keys[key] = a
+
+	return a
+}
+
+func (h *hotKeys) read(keys ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, key := range keys {
+		h.access(key).Reads++
+	}
+}
+
+func (h *hotKeys) write(key string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.access(key).Writes++
+}
+
+// countWrites counts the key of every event of queue as a write, until it is
+// closed. Purges of expired keys aren't client writes and are left out.
+func (h *hotKeys) countWrites(queue <-chan Event) {
+	for ev := range queue {
+		if ev.Action != "expire" {
+			h.write(ev.Key)
+		}
+	}
+}
+
+// top returns the n most accessed keys, most accessed first.
+func (h *hotKeys) top(n int) []KeyAccess {
+	h.mu.Lock()
+	all := make([]KeyAccess, 0, len(h.keys))
+	for _, a := range h.keys {
+		all = append(all, *a)
+	}
+	h.mu.Unlock()
+
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].total() != all[j].total() {
+			return all[i].total() > all[j].total()
+		}
+		return all[i].Key < all[j].Key
+	})
+
+	if len(all) > n {
+		all = all[:n]
+	}
+
+	return all
+}
+
+// recordReads counts a read of keys when hot key tracking is on.
+func (cfg *Config) recordReads(keys ...string) {
+	if cfg.hotKeys == nil {
+		return
+	}
+
+	// Count reads under the key writes are stored at
+	stored := make([]string, len(keys))
+	for i, key := range keys {
+		stored[i] = cfg.fsm.policies.key(key)
+	}
+	cfg.hotKeys.read(stored...)
+}
+
+// HotKeysHandler serves the most accessed keys of the node, as many as the
+// top query parameter asks for.
+func (cfg *Config) HotKeysHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		jw := json.NewEncoder(w)
+
+		if cfg.hotKeys == nil {
+			w.WriteHeader(http.StatusNotFound)
+			jw.Encode(map[string]string{"error": "hot key tracking is off"})
+
+			return
+		}
+
+		// The top keys may be any key
+		if err := cfg.CheckAccess(r.Context(), AccessRead, ""); err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			jw.Encode(map[string]string{"code": "forbidden", "error": err.Error()})
+
+			return
+		}
+
+		top := defaultHotKeysTop
+		if fromQuery := r.URL.Query().Get("top"); fromQuery != "" {
+			n, err := strconv.Atoi(fromQuery)
+			if err != nil || n <= 0 {
+				w.WriteHeader(http.StatusBadRequest)
+				jw.Encode(map[string]string{"error": "invalid top " + strconv.Quote(fromQuery)})
+
+				return
+			}
+			top = n
+		}
+
+		jw.Encode(cfg.hotKeys.top(top))
+	}
+}
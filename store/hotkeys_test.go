@@ -0,0 +1,68 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestHotKeys(t *testing.T) {
+	h := newHotKeys(2)
+
+	h.read("a", "a", "a")
+	h.write("a")
+	h.read("b")
+
+	// Replaces b, the least accessed key, inheriting its count
+	h.write("c")
+
+	expected := []KeyAccess{{Key: "a", Reads: 3, Writes: 1}, {Key: "c", Reads: 1, Writes: 1}}
+	if got := h.top(5); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Got %+v, expected %+v", got, expected)
+	}
+
+	if got := h.top(1); len(got) != 1 || got[0].Key != "a" {
+		t.Errorf("Got %+v, expected only a", got)
+	}
+}
+
+func TestHotKeysHandler(t *testing.T) {
+	cfg := newTestConfig(t)
+	ctx := context.Background()
+
+	recorder := httptest.NewRecorder()
+	cfg.HotKeysHandler()(recorder, httptest.NewRequest(http.MethodGet, "/stats/hotkeys", nil))
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("Got status %d with tracking off, expected %d", recorder.Code, http.StatusNotFound)
+	}
+
+	cfg.hotKeys = newHotKeys(10)
+	go cfg.hotKeys.countWrites(cfg.fsm.events.subscribe(hotKeysQueueSize))
+
+	cfg.Set(ctx, "hot", "v")
+	cfg.Get(ctx, "hot")
+	cfg.Get(ctx, "hot")
+	cfg.Get(ctx, "cold")
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		recorder := httptest.NewRecorder()
+		cfg.HotKeysHandler()(recorder, httptest.NewRequest(http.MethodGet, "/stats/hotkeys?top=1", nil))
+
+		var got []KeyAccess
+		if err := json.NewDecoder(recorder.Body).Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		if reflect.DeepEqual(got, []KeyAccess{{Key: "hot", Reads: 2, Writes: 1}}) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Got %+v, expected hot with 2 reads and 1 write", got)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
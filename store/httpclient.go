@@ -0,0 +1,58 @@
+package store
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+const (
+	// DefaultDialTimeout bounds the connection to another node, TLS
+	// handshake included.
+	DefaultDialTimeout = 5 * time.Second
+
+	// DefaultResponseTimeout bounds the wait for another node to start
+	// answering. It is longer than a write waits for Raft, so a write
+	// forwarded to a busy leader gets the leader's own answer.
+	DefaultResponseTimeout = 90 * time.Second
+)
+
+// NewHTTPClient returns a client for the requests a node sends to the others:
+// connecting, TLS handshake included, takes at most dialTimeout and the
+// answer must start within responseTimeout. tlsConfig, which may be nil, is
+// used for https addresses, with the cluster CA in its RootCAs when the
+// certificates of the nodes aren't signed by a public one. The requests
+// carry the trace context of their context, so the forwarding of a request to
+// the leader shows in its trace.
+func NewHTTPClient(dialTimeout, responseTimeout time.Duration, tlsConfig *tls.Config) *http.Client {
+	return &http.Client{
+		Timeout: responseTimeout,
+		Transport: otelhttp.NewTransport(&http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			DialContext:           (&net.Dialer{Timeout: dialTimeout, KeepAlive: 30 * time.Second}).DialContext,
+			TLSClientConfig:       tlsConfig,
+			TLSHandshakeTimeout:   dialTimeout,
+			ResponseHeaderTimeout: responseTimeout,
+			MaxIdleConns:          100,
+			IdleConnTimeout:       90 * time.Second,
+			ExpectContinueTimeout: time.Second,
+		}),
+	}
+}
+
+// client returns the client sending requests to the other nodes, the default
+// client of NewHTTPClient when none was configured.
+func (cfg *Config) client() *http.Client {
+	if cfg.httpClient == nil {
+		return defaultHTTPClient
+	}
+
+	return cfg.httpClient
+}
+
+// defaultHTTPClient is shared by the nodes configured without a client, so
+// they reuse its connections.
+var defaultHTTPClient = NewHTTPClient(DefaultDialTimeout, DefaultResponseTimeout, nil)
@@ -0,0 +1,205 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultJoinTimeout bounds the time a node keeps trying to join the
+	// cluster.
+	DefaultJoinTimeout = 2 * time.Minute
+
+	// joinInitialBackoff is the wait after the first round of join attempts
+	// failing, it doubles after each round up to joinMaxBackoff.
+	joinInitialBackoff = 500 * time.Millisecond
+	joinMaxBackoff     = 15 * time.Second
+
+	// joinMemberWait bounds the wait for the configuration adding the node
+	// to reach it, after the leader accepted it.
+	joinMemberWait = 10 * time.Second
+
+	// joinMaxHops bounds the nodes an add request is sent to, following the
+	// leaders they name.
+	joinMaxHops = 3
+)
+
+// splitSeeds returns the HTTP addresses of the comma separated list of seed
+// peers s, leaving out empty entries.
+func splitSeeds(s string) []string {
+	var seeds []string
+	for _, seed := range strings.Split(s, ",") {
+		if seed = strings.TrimSpace(seed); seed != "" {
+			seeds = append(seeds, seed)
+		}
+	}
+
+	return seeds
+}
+
+// joinCluster has this node, described by body, join the cluster through
+// seeds until it is a member of the configuration it replicated from the
+// leader, or timeout elapsed. The rounds of attempts are separated by an
+// exponential backoff, so a node started along with the rest of the cluster
+// waits for the leader to come up.
+func (cfg *Config) joinCluster(seeds []string, body string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	backoff := joinInitialBackoff
+	for attempt := 1; ; attempt++ {
+		err := cfg.join(seeds, body)
+		if err == nil {
+			if err = cfg.waitMember(joinMemberWait); err == nil {
+				return nil
+			}
+		}
+
+		if time.Now().Add(backoff).After(deadline) {
+			return fmt.Errorf("giving up joining the cluster after %d attempts: %w", attempt, err)
+		}
+		cfg.logger.Warn("couldn't join the cluster, retrying", "attempt", attempt, "backoff", backoff, "error", err)
+		time.Sleep(backoff)
+
+		if backoff *= 2; backoff > joinMaxBackoff {
+			backoff = joinMaxBackoff
+		}
+	}
+}
+
+// waitMember waits up to timeout for this node to be a member of the Raft
+// configuration it knows.
+func (cfg *Config) waitMember(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for !cfg.member() {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("the leader accepted the node but the configuration adding it didn't reach it")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	return nil
+}
+
+// member reports whether this node is in the Raft configuration it knows, a
+// standalone node always is.
+func (cfg *Config) member() bool {
+	if cfg.standalone() {
+		return true
+	}
+
+	future := cfg.raft.GetConfiguration()
+	if err := future.Error(); err != nil {
+		return false
+	}
+	for _, server := range future.Configuration().Servers {
+		if server.ID == cfg.id {
+			return true
+		}
+	}
+
+	return false
+}
+
+// join asks the cluster to add this node, described by body, trying each seed
+// in turn until one accepts. A seed knowing the leader is asked through its
+// /raft/status, the add request then goes straight to the leader.
+func (cfg *Config) join(seeds []string, body string) error {
+	var errs []string
+	for _, seed := range seeds {
+		target := seed
+		if leader, err := cfg.seedLeader(seed); err != nil {
+			cfg.logger.Warn("couldn't get status of seed", "seed", seed, "error", err)
+		} else if leader != "" {
+			target = leader
+		}
+
+		if err := cfg.addSelf(target, body); err != nil {
+			cfg.logger.Warn("couldn't join through seed", "seed", seed, "target", target, "error", err)
+			errs = append(errs, fmt.Sprintf("%s: %s", seed, err))
+
+			continue
+		}
+
+		cfg.logger.Debug("added self to leader", "seed", seed, "leader", target)
+
+		return nil
+	}
+
+	return fmt.Errorf("failed adding self to the cluster: %s", strings.Join(errs, "; "))
+}
+
+// seedLeader returns the HTTP address of the leader known by seed, empty when
+// it knows none.
+func (cfg *Config) seedLeader(seed string) (string, error) {
+	s, err := cfg.nodeStatus(seed)
+	if err != nil {
+		return "", err
+	}
+
+	return s.Leader, nil
+}
+
+// nodeStatus returns the status of the node at the HTTP address target.
+func (cfg *Config) nodeStatus(target string) (Status, error) {
+	req, err := http.NewRequest(http.MethodGet, target+"/raft/status", nil)
+	if err != nil {
+		return Status{}, err
+	}
+	cfg.setToken(req)
+
+	resp, err := cfg.client().Do(req)
+	if err != nil {
+		return Status{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Status{}, fmt.Errorf("got status %d", resp.StatusCode)
+	}
+
+	var s Status
+	if err := json.NewDecoder(resp.Body).Decode(&s); err != nil {
+		return Status{}, err
+	}
+
+	return s, nil
+}
+
+// addSelf posts body to the /raft/add endpoint of target. A follower that
+// doesn't forward the request names the leader, see FollowerMode, the
+// request is then sent to it: redirects aren't followed by the client, which
+// would drop the token on the way.
+func (cfg *Config) addSelf(target, body string) error {
+	client := *cfg.client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+
+	for hops := 1; ; hops++ {
+		req, err := http.NewRequest(http.MethodPost, target+"/raft/add", strings.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json; charset=utf-8")
+		cfg.setToken(req)
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		msg, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode == http.StatusOK {
+			return nil
+		}
+		if leader := resp.Header.Get(LeaderHeader); leader != "" && leader != target && hops < joinMaxHops {
+			cfg.logger.Debug("following the leader", "from", target, "leader", leader)
+			target = leader
+			continue
+		}
+
+		return fmt.Errorf("got status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+}
@@ -0,0 +1,93 @@
+package store
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+func TestSplitSeeds(t *testing.T) {
+	got := splitSeeds(" http://a:8080, ,http://b:8080,")
+	want := []string{"http://a:8080", "http://b:8080"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %v, expected %v", got, want)
+	}
+
+	if got := splitSeeds(""); len(got) != 0 {
+		t.Errorf("Got %v, expected no seeds", got)
+	}
+}
+
+func TestJoinSkipsDownSeed(t *testing.T) {
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	var added string
+	leader := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/raft/add" {
+			http.NotFound(w, r)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		added = string(body)
+	}))
+	defer leader.Close()
+
+	// The seed that is up isn't the leader, it points to it
+	follower := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/raft/status" {
+			http.Error(w, "not the leader", http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(Status{State: "Follower", Leader: leader.URL})
+	}))
+	defer follower.Close()
+
+	cfg := &Config{logger: hclog.NewNullLogger()}
+	body := `{"ID": "node", "Address": "localhost:8081", "NonVoter": false}`
+	if err := cfg.join([]string{down.URL, follower.URL}, body); err != nil {
+		t.Fatalf("join returned unexpected error: %s", err)
+	}
+
+	if added != body {
+		t.Errorf("Leader got %q, expected %q", added, body)
+	}
+
+	if err := cfg.join([]string{down.URL}, body); err == nil {
+		t.Errorf("join through a down seed succeeded")
+	}
+}
+
+func TestAddSelfFollowsLeader(t *testing.T) {
+	var added string
+	leader := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer root" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		added = string(body)
+	}))
+	defer leader.Close()
+
+	// A follower in redirect mode doesn't forward the request
+	follower := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(LeaderHeader, leader.URL)
+		http.Redirect(w, r, leader.URL+r.URL.Path, http.StatusTemporaryRedirect)
+	}))
+	defer follower.Close()
+
+	cfg := &Config{logger: hclog.NewNullLogger(), auth: &auth{adminToken: "root"}}
+	body := `{"ID": "node", "Address": "localhost:8081", "NonVoter": false}`
+	if err := cfg.addSelf(follower.URL, body); err != nil {
+		t.Fatalf("addSelf returned unexpected error: %s", err)
+	}
+	if added != body {
+		t.Errorf("Leader got %q, expected %q", added, body)
+	}
+}
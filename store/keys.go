@@ -0,0 +1,41 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// DefaultKeySeparator separates the parts of the keys built by the
+	// store, like namespaces or the keys of internal subsystems.
+	DefaultKeySeparator = ":"
+
+	// DefaultReservedPrefix is the first part of the internal keys.
+	DefaultReservedPrefix = "__kv"
+)
+
+// reservedSpace is the prefix of the keys kept for internal subsystems,
+// which clients can neither read nor write.
+func (cfg *Config) reservedSpace() string {
+	return cfg.reservedPrefix + cfg.keySeparator
+}
+
+// internalKey builds the key of an internal subsystem from its parts, in the
+// reserved space.
+func (cfg *Config) internalKey(parts ...string) string {
+	return cfg.reservedSpace() + strings.Join(parts, cfg.keySeparator)
+}
+
+// validateKey checks a key sent by a client: on top of validateKey, it must
+// stay out of the reserved space.
+func (cfg *Config) validateKey(key string) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+
+	if cfg.reservedPrefix != "" && strings.HasPrefix(cfg.fsm.policies.key(key), cfg.reservedSpace()) {
+		return fmt.Errorf("%w: %q is under %q", ErrReservedKey, key, cfg.reservedSpace())
+	}
+
+	return nil
+}
@@ -0,0 +1,56 @@
+package store
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// leadership counts the leadership changes of a node. A rising rate of
+// changes warns of an unstable cluster, like an election storm. The counters
+// are updated atomically.
+type leadership struct {
+	acquired uint64
+	lost     uint64
+
+	// lastChange is the Unix time in nanoseconds of the last change, 0
+	// before the first one.
+	lastChange int64
+}
+
+// observe counts a change of leadership, isLeader is the new state.
+func (l *leadership) observe(isLeader bool, now time.Time) {
+	if isLeader {
+		atomic.AddUint64(&l.acquired, 1)
+	} else {
+		atomic.AddUint64(&l.lost, 1)
+	}
+	atomic.StoreInt64(&l.lastChange, now.UnixNano())
+}
+
+// lastChangeTime returns when leadership last changed, nil if it never did.
+func (l *leadership) lastChangeTime() *time.Time {
+	nsec := atomic.LoadInt64(&l.lastChange)
+	if nsec == 0 {
+		return nil
+	}
+
+	t := time.Unix(0, nsec).UTC()
+	return &t
+}
+
+// watchLeadership runs forever, counting the leadership changes of the node.
+// Raft coalesces changes nobody read yet, so a leadership gained and lost in
+// a quick succession may be counted as one change.
+func (cfg *Config) watchLeadership() {
+	for isLeader := range cfg.raft.LeaderCh() {
+		cfg.leadership.observe(isLeader, time.Now())
+		cfg.compaction.notify(isLeader)
+		if !isLeader {
+			cfg.logger.Info("cluster leadership lost")
+			continue
+		}
+
+		cfg.logger.Info("cluster leadership acquired")
+		go cfg.recordSelf()
+	}
+}
@@ -0,0 +1,42 @@
+package store
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLeadershipCounters(t *testing.T) {
+	cfg := newTestConfig(t)
+	if s := cfg.Status(); s.LeadershipAcquired != 0 || s.LastLeadershipChange != nil {
+		t.Fatalf("Status() before any change = %+v", s)
+	}
+
+	// The test node is already the leader, Raft still holds the change
+	go cfg.watchLeadership()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for cfg.Status().LeadershipAcquired == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the leadership acquisition wasn't counted")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cfg.leadership.observe(false, time.Now())
+	s := cfg.Status()
+	if s.LeadershipAcquired != 1 || s.LeadershipLost != 1 || s.LastLeadershipChange == nil {
+		t.Errorf("Status() = %+v, want one acquisition and one loss", s)
+	}
+
+	recorder := httptest.NewRecorder()
+	cfg.MetricsHandler()(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, line := range []string{"kv_raft_leadership_acquired_total 1\n", "kv_raft_leadership_lost_total 1\n", fmt.Sprintf("kv_raft_term %d\n", cfg.Term())} {
+		if !strings.Contains(recorder.Body.String(), line) {
+			t.Errorf("metrics don't have %q:\n%s", line, recorder.Body.String())
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// A lease is granted for a TTL and expires unless it is kept alive within
+// it. Keys written with a lease expire with it, and are deleted when it is
+// revoked: a key stays attached to its lease as long as it expires with it, a
+// key written again without the lease leaves it. Leases are records in the
+// reserved space, expiring like any entry, so the leader purging expired
+// entries purges the expired leases and their keys together.
+
+// Lease is a lease and what is attached to it.
+type Lease struct {
+	// ID is the log index of the command granting the lease.
+	ID        uint64        `json:"id"`
+	TTL       time.Duration `json:"ttl"`
+	ExpiresAt time.Time     `json:"expires_at"`
+
+	// Keys are the keys written with the lease, and Locks the names of
+	// the locks it holds.
+	Keys  []string `json:"keys"`
+	Locks []string `json:"locks"`
+}
+
+// GrantLease grants a lease expiring after ttl and returns it.
+func (cfg *Config) GrantLease(ctx context.Context, ttl time.Duration) (Lease, error) {
+	if ttl <= 0 {
+		return Lease{}, fmt.Errorf("%w: lease TTL must be positive, got %s", ErrInvalidTTL, ttl)
+	}
+	if err := cfg.writable(); err != nil {
+		return Lease{}, err
+	}
+
+	resp, _, err := cfg.apply(ctx, Command{Action: "lease-grant", TTL: ttl, Now: time.Now().UnixNano()})
+	if err != nil {
+		return Lease{}, err
+	}
+
+	return resp.(Lease), nil
+}
+
+// KeepAliveLease renews the lease id for its TTL, along with the keys and
+// locks attached to it, and returns it. It fails with ErrLeaseNotFound once
+// the lease expired or was revoked.
+func (cfg *Config) KeepAliveLease(ctx context.Context, id uint64) (Lease, error) {
+	if err := cfg.writable(); err != nil {
+		return Lease{}, err
+	}
+
+	resp, _, err := cfg.apply(ctx, Command{Action: "lease-keepalive", Lease: id, Now: time.Now().UnixNano()})
+	if err != nil {
+		return Lease{}, err
+	}
+
+	return resp.(Lease), nil
+}
+
+// RevokeLease revokes the lease id, deleting its keys and releasing its
+// locks in the same Raft log entry. It returns the number of keys deleted
+// and the log index of the write.
+func (cfg *Config) RevokeLease(ctx context.Context, id uint64) (int, uint64, error) {
+	if err := cfg.writable(); err != nil {
+		return 0, 0, err
+	}
+
+	resp, index, err := cfg.apply(ctx, Command{Action: "lease-revoke", Lease: id, Now: time.Now().UnixNano()})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	n, _ := resp.(int)
+	return n, index, nil
+}
+
+// Lease returns the lease id, failing with ErrLeaseNotFound once it expired
+// or was revoked.
+func (cfg *Config) Lease(ctx context.Context, id uint64) (Lease, error) {
+	if err := readable(ctx); err != nil {
+		return Lease{}, err
+	}
+
+	f := cfg.fsm
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	l, err := f.lease(id, time.Now())
+	if err != nil {
+		return Lease{}, err
+	}
+	l.Keys, l.Locks = f.attached(l, l.Keys), f.heldLocks(l)
+
+	return l, nil
+}
+
+// SetWithLease sets key like SetEntry, attaching it to the lease id: it
+// expires with the lease instead of at e.ExpiresAt.
+func (cfg *Config) SetWithLease(ctx context.Context, key string, e Entry, id uint64) (uint64, error) {
+	if err := cfg.validateKey(key); err != nil {
+		return 0, err
+	}
+	if err := validateValue(e.Value); err != nil {
+		return 0, err
+	}
+	if err := validateMetadata(e.Metadata); err != nil {
+		return 0, err
+	}
+	if err := cfg.writable(); err != nil {
+		return 0, err
+	}
+
+	_, index, err := cfg.apply(ctx, Command{
+		Action:       "set",
+		Key:          key,
+		Data:         []byte(e.Value),
+		ContentType:  e.ContentType,
+		UserMetadata: e.Metadata,
+		Lease:        id,
+		Now:          time.Now().UnixNano(),
+	})
+	return index, err
+}
+
+// leaseKey returns the key recording the lease id.
+func (f *fsm) leaseKey(id uint64) string {
+	return f.reserved + "lease" + f.separator + strconv.FormatUint(id, 10)
+}
+
+// lease returns the lease id, failing with ErrLeaseNotFound when it expired at
+// now. The caller holds the lock.
+func (f *fsm) lease(id uint64, now time.Time) (Lease, error) {
+	e, ok := f.data[f.leaseKey(id)]
+	if !ok || e.expired(now) {
+		return Lease{}, fmt.Errorf("%w: %d", ErrLeaseNotFound, id)
+	}
+
+	var l Lease
+	if err := json.Unmarshal([]byte(e.Value), &l); err != nil {
+		return Lease{}, fmt.Errorf("decoding lease %d: %w", id, err)
+	}
+
+	return l, nil
+}
+
+// putLease records l. The caller holds the write lock.
+func (f *fsm) putLease(l Lease) error {
+	b, err := json.Marshal(l)
+	if err != nil {
+		return fmt.Errorf("encoding lease %d: %w", l.ID, err)
+	}
+
+	f.put(f.leaseKey(l.ID), Entry{Value: string(b), ExpiresAt: l.ExpiresAt})
+	return nil
+}
+
+// attached returns the keys still attached to l: expiring with it. The
+// caller holds the lock.
+func (f *fsm) attached(l Lease, keys []string) []string {
+	var still []string
+	for _, key := range keys {
+		if e, ok := f.data[key]; ok && e.ExpiresAt.Equal(l.ExpiresAt) {
+			still = append(still, key)
+		}
+	}
+
+	return still
+}
+
+// localGrantLease grants a lease expiring ttl after now. The caller holds the
+// write lock.
+func (f *fsm) localGrantLease(ttl time.Duration, now time.Time) (Lease, error) {
+	l := Lease{ID: f.applied, TTL: ttl, ExpiresAt: now.Add(ttl)}
+	if err := f.putLease(l); err != nil {
+		return Lease{}, err
+	}
+
+	return l, nil
+}
+
+// localKeepAlive renews the lease id and what is attached to it from now.
+// The attached keys keep their revision: their value doesn't change. The
+// caller holds the write lock.
+func (f *fsm) localKeepAlive(id uint64, now time.Time) (Lease, error) {
+	l, err := f.lease(id, now)
+	if err != nil {
+		return Lease{}, err
+	}
+
+	l.Keys, l.Locks = f.attached(l, l.Keys), f.heldLocks(l)
+	l.ExpiresAt = now.Add(l.TTL)
+	for _, key := range append(l.Keys, f.lockKeys(l.Locks)...) {
+		e := f.data[key]
+		e.ExpiresAt = l.ExpiresAt
+		f.data[key] = e
+		f.track(key)
+	}
+
+	if err := f.putLease(l); err != nil {
+		return Lease{}, err
+	}
+
+	return l, nil
+}
+
+// localRevokeLease removes the lease id, unless it expired at now, and its
+// keys and locks, and returns the keys removed. The caller holds the write
+// lock.
+func (f *fsm) localRevokeLease(id uint64, now time.Time) ([]string, error) {
+	l, err := f.lease(id, now)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := f.attached(l, l.Keys)
+	for _, key := range append(keys, f.lockKeys(f.heldLocks(l))...) {
+		f.remove(key)
+	}
+	f.remove(f.leaseKey(id))
+
+	return keys, nil
+}
+
+// attachLease makes e, to be written at key, expire with the lease id, and
+// records key in the lease, unless it expired at now. The caller holds the
+// write lock.
+func (f *fsm) attachLease(id uint64, key string, e *Entry, now time.Time) error {
+	l, err := f.lease(id, now)
+	if err != nil {
+		return err
+	}
+
+	e.ExpiresAt = l.ExpiresAt
+	for _, k := range l.Keys {
+		if k == key {
+			return nil
+		}
+	}
+	l.Keys = append(l.Keys, key)
+
+	return f.putLease(l)
+}
@@ -0,0 +1,186 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/raft"
+)
+
+func TestLease(t *testing.T) {
+	cfg := newTestConfig(t)
+	ctx := context.Background()
+
+	if _, err := cfg.GrantLease(ctx, 0); !errors.Is(err, ErrInvalidTTL) {
+		t.Errorf("Got error %v granting a lease without TTL, expected %v", err, ErrInvalidTTL)
+	}
+
+	l, err := cfg.GrantLease(ctx, time.Minute)
+	if err != nil {
+		t.Fatalf("GrantLease returned unexpected error: %s", err)
+	}
+	if l.ID == 0 || l.TTL != time.Minute || l.ExpiresAt.IsZero() {
+		t.Errorf("Got lease %+v, expected an ID and a minute TTL", l)
+	}
+
+	for _, key := range []string{"a", "b"} {
+		if _, err := cfg.SetWithLease(ctx, key, Entry{Value: key}, l.ID); err != nil {
+			t.Fatalf("SetWithLease(%s) returned unexpected error: %s", key, err)
+		}
+	}
+	if _, err := cfg.SetWithLease(ctx, "c", Entry{Value: "c"}, l.ID+100); !errors.Is(err, ErrLeaseNotFound) {
+		t.Errorf("Got error %v writing with a missing lease, expected %v", err, ErrLeaseNotFound)
+	}
+	if e, _ := cfg.fsm.localGet(ctx, "a"); !e.ExpiresAt.Equal(l.ExpiresAt) {
+		t.Errorf("Key expires at %s, expected %s like its lease", e.ExpiresAt, l.ExpiresAt)
+	}
+
+	// Writing b again without the lease detaches it
+	cfg.Set(ctx, "b", "b")
+
+	time.Sleep(10 * time.Millisecond)
+	renewed, err := cfg.KeepAliveLease(ctx, l.ID)
+	if err != nil {
+		t.Fatalf("KeepAliveLease returned unexpected error: %s", err)
+	}
+	if !renewed.ExpiresAt.After(l.ExpiresAt) || len(renewed.Keys) != 1 || renewed.Keys[0] != "a" {
+		t.Errorf("Got lease %+v once kept alive, expected a later expiration and the key a", renewed)
+	}
+	if e, _ := cfg.fsm.localGet(ctx, "a"); !e.ExpiresAt.Equal(renewed.ExpiresAt) {
+		t.Errorf("Key expires at %s once kept alive, expected %s", e.ExpiresAt, renewed.ExpiresAt)
+	}
+
+	deleted, _, err := cfg.RevokeLease(ctx, l.ID)
+	if err != nil || deleted != 1 {
+		t.Fatalf("RevokeLease = %d, %v, want 1 key deleted", deleted, err)
+	}
+	if v, _ := cfg.Get(ctx, "a"); v != "" {
+		t.Errorf("Got %q for a key of a revoked lease, expected it deleted", v)
+	}
+	if v, _ := cfg.Get(ctx, "b"); v != "b" {
+		t.Errorf("Revoking the lease deleted a detached key, got %q", v)
+	}
+	if _, err := cfg.Lease(ctx, l.ID); !errors.Is(err, ErrLeaseNotFound) {
+		t.Errorf("Got error %v for a revoked lease, expected %v", err, ErrLeaseNotFound)
+	}
+}
+
+func TestLeaseExpiry(t *testing.T) {
+	cfg := newTestConfig(t)
+	ctx := context.Background()
+
+	l, err := cfg.GrantLease(ctx, 20*time.Millisecond)
+	if err != nil {
+		t.Fatalf("GrantLease returned unexpected error: %s", err)
+	}
+	cfg.SetWithLease(ctx, "key", Entry{Value: "v"}, l.ID)
+
+	time.Sleep(30 * time.Millisecond)
+	if v, _ := cfg.Get(ctx, "key"); v != "" {
+		t.Errorf("Got %q for a key of an expired lease, expected nothing", v)
+	}
+	if _, err := cfg.KeepAliveLease(ctx, l.ID); !errors.Is(err, ErrLeaseNotFound) {
+		t.Errorf("Got error %v keeping an expired lease alive, expected %v", err, ErrLeaseNotFound)
+	}
+}
+
+func TestLock(t *testing.T) {
+	cfg := newTestConfig(t)
+	ctx := context.Background()
+
+	first, _ := cfg.GrantLease(ctx, time.Minute)
+	second, _ := cfg.GrantLease(ctx, time.Minute)
+
+	held, err := cfg.Lock(ctx, "leader", first.ID)
+	if err != nil {
+		t.Fatalf("Lock returned unexpected error: %s", err)
+	}
+	if held.Lease != first.ID || held.Revision == 0 {
+		t.Errorf("Got lock %+v, expected it held by lease %d", held, first.ID)
+	}
+	if again, err := cfg.Lock(ctx, "leader", first.ID); err != nil || again.Revision != held.Revision {
+		t.Errorf("Lock by its holder = %+v, %v, want the lock unchanged", again, err)
+	}
+	if _, err := cfg.Lock(ctx, "leader", second.ID); !errors.Is(err, ErrLockHeld) {
+		t.Errorf("Got error %v locking a held lock, expected %v", err, ErrLockHeld)
+	}
+	if _, err := cfg.Unlock(ctx, "leader", second.ID); !errors.Is(err, ErrLockNotHeld) {
+		t.Errorf("Got error %v unlocking another lease's lock, expected %v", err, ErrLockNotHeld)
+	}
+	if l, _ := cfg.Lease(ctx, first.ID); len(l.Locks) != 1 || l.Locks[0] != "leader" {
+		t.Errorf("Got locks %v for the holder, expected leader", l.Locks)
+	}
+
+	// Revoking the lease releases its locks
+	if _, _, err := cfg.RevokeLease(ctx, first.ID); err != nil {
+		t.Fatalf("RevokeLease returned unexpected error: %s", err)
+	}
+	if _, err := cfg.LockHolder(ctx, "leader"); !errors.Is(err, ErrLockNotHeld) {
+		t.Errorf("Got error %v for the lock of a revoked lease, expected %v", err, ErrLockNotHeld)
+	}
+
+	next, err := cfg.Lock(ctx, "leader", second.ID)
+	if err != nil {
+		t.Fatalf("Lock returned unexpected error once released: %s", err)
+	}
+	if next.Revision <= held.Revision {
+		t.Errorf("Got revision %d for the next holder, expected more than %d", next.Revision, held.Revision)
+	}
+	if _, err := cfg.Unlock(ctx, "leader", second.ID); err != nil {
+		t.Errorf("Unlock returned unexpected error: %s", err)
+	}
+	if _, err := cfg.LockHolder(ctx, "leader"); !errors.Is(err, ErrLockNotHeld) {
+		t.Errorf("Got error %v once unlocked, expected %v", err, ErrLockNotHeld)
+	}
+}
+
+func TestLeaseReplay(t *testing.T) {
+	// The log was written long ago: the local clock is past every TTL, the
+	// outcome must still be the one decided at the time of the commands
+	at := func(d time.Duration) string {
+		return strconv.FormatInt(time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC).Add(d).UnixNano(), 10)
+	}
+	logs := []*raft.Log{
+		{Index: 1, Data: []byte(`{"Action":"lease-grant","TTL":60000000000,"Now":` + at(0) + `}`)},
+		{Index: 2, Data: []byte(`{"Action":"lease-grant","TTL":60000000000,"Now":` + at(0) + `}`)},
+		{Index: 3, Data: []byte(`{"Action":"lock","Key":"leader","Lease":1,"Now":` + at(time.Second) + `}`)},
+		{Index: 4, Data: []byte(`{"Action":"lease-keepalive","Lease":1,"Now":` + at(30*time.Second) + `}`)},
+		{Index: 5, Data: []byte(`{"Action":"lock","Key":"leader","Lease":2,"Now":` + at(40*time.Second) + `}`)},
+		{Index: 6, Data: []byte(`{"Action":"set","Key":"k","Data":"dg==","Lease":1,"Now":` + at(45*time.Second) + `}`)},
+		{Index: 7, Data: []byte(`{"Action":"unlock","Key":"leader","Lease":1,"Now":` + at(50*time.Second) + `}`)},
+		{Index: 8, Data: []byte(`{"Action":"lock","Key":"leader","Lease":2,"Now":` + at(55*time.Second) + `}`)},
+		{Index: 9, Data: []byte(`{"Action":"lease-revoke","Lease":1,"Now":` + at(80*time.Second) + `}`)},
+		{Index: 10, Data: []byte(`{"Action":"lease-keepalive","Lease":2,"Now":` + at(2*time.Minute) + `}`)},
+	}
+	// Whether each command failed when the leader applied it
+	want := []bool{false, false, false, false, true, false, false, false, false, true}
+
+	var replicas []*fsm
+	for i := 0; i < 2; i++ {
+		f := newFSM(NewFileStore(filepath.Join(t.TempDir(), "data.json")), hclog.NewNullLogger())
+		for j, l := range logs {
+			_, failed := f.Apply(l).(error)
+			if failed != want[j] {
+				t.Errorf("Replica %d, log %d: got failure %t, expected %t", i, l.Index, failed, want[j])
+			}
+		}
+		replicas = append(replicas, f)
+	}
+
+	if !reflect.DeepEqual(replicas[0].data, replicas[1].data) {
+		t.Errorf("The replicas hold different data:\n%v\n%v", replicas[0].data, replicas[1].data)
+	}
+	l, ok, _ := replicas[0].lock("leader", time.Date(2001, 1, 1, 0, 0, 56, 0, time.UTC))
+	if !ok || l.Lease != 2 {
+		t.Errorf("Got lock %+v, %t, expected it held by lease 2", l, ok)
+	}
+	if _, ok := replicas[0].data["k"]; ok {
+		t.Errorf("The key of the revoked lease is still there")
+	}
+}
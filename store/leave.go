@@ -0,0 +1,85 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// leaveLeaderWait bounds the wait for a leader when a node leaves the cluster
+// right after handing its leadership over.
+const leaveLeaderWait = 10 * time.Second
+
+// RemoveServer removes the node id from the cluster, failing with
+// ErrNotFound when it isn't a member. It must be called on the leader; a
+// leader removing itself steps down once the change is committed. The node
+// removed keeps running on its own until it is stopped.
+func (cfg *Config) RemoveServer(id raft.ServerID) error {
+	if _, err := cfg.server(id); err != nil {
+		return err
+	}
+
+	if err := cfg.raft.RemoveServer(id, 0, time.Minute).Error(); err != nil {
+		cfg.logger.Error("could not remove server", "id", id, "error", err)
+		return err
+	}
+	cfg.logger.Info("removed server", "id", id)
+
+	if err := cfg.forgetMember(context.Background(), id); err != nil {
+		cfg.logger.Warn("couldn't remove the metadata of the server", "id", id, "error", err)
+	}
+
+	return nil
+}
+
+// leave removes this node from the cluster: through the leader, once there
+// is one, when it follows, or itself when it still leads.
+func (cfg *Config) leave() error {
+	deadline := time.Now().Add(leaveLeaderWait)
+	for cfg.state() != raft.Leader && cfg.leader() == "" {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("no leader to leave through")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	if cfg.state() == raft.Leader {
+		return cfg.RemoveServer(cfg.id)
+	}
+
+	ldr := cfg.leaderURL()
+	if ldr == nil {
+		return fmt.Errorf("no leader to leave through")
+	}
+
+	return cfg.removeSelf(ldr.String())
+}
+
+// removeSelf asks the leader, at the HTTP address leader, to remove this
+// node.
+func (cfg *Config) removeSelf(leader string) error {
+	req, err := http.NewRequest(http.MethodDelete, leader+"/raft/node/"+url.PathEscape(string(cfg.id)), nil)
+	if err != nil {
+		return err
+	}
+	cfg.setToken(req)
+
+	resp, err := cfg.client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("got status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	return nil
+}
@@ -0,0 +1,37 @@
+package store
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+func TestRemoveServer(t *testing.T) {
+	cfg := newTestConfig(t)
+
+	if err := cfg.AddServer("replica", "replica:8081", true); err != nil {
+		t.Fatalf("AddServer returned unexpected error: %s", err)
+	}
+	if peers := cfg.Status().Peers; len(peers) != 2 {
+		t.Fatalf("Got peers %+v, expected the node and the replica", peers)
+	}
+
+	if err := cfg.RemoveServer("replica"); err != nil {
+		t.Fatalf("RemoveServer returned unexpected error: %s", err)
+	}
+	if peers := cfg.Status().Peers; len(peers) != 1 || peers[0].ID != "test" {
+		t.Errorf("Got peers %+v after removing the replica, expected the node alone", peers)
+	}
+	if err := cfg.RemoveServer("replica"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("RemoveServer() of a removed node = %v, want ErrNotFound", err)
+	}
+
+	standalone, err := NewStandalone(t.TempDir(), WithLogger(hclog.NewNullLogger()))
+	if err != nil {
+		t.Fatalf("NewStandalone returned unexpected error: %s", err)
+	}
+	if err := standalone.RemoveServer("replica"); !errors.Is(err, ErrStandalone) {
+		t.Errorf("RemoveServer() on a standalone node = %v, want ErrStandalone", err)
+	}
+}
@@ -0,0 +1,103 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultListLimit is the number of keys a listing returns when it
+	// doesn't set a limit.
+	DefaultListLimit = 100
+
+	// MaxListLimit is the largest number of keys a listing returns.
+	MaxListLimit = 1000
+)
+
+// KeyList is a page of keys, in order.
+type KeyList struct {
+	Keys []string `json:"keys"`
+
+	// Next is the cursor listing the following page, empty on the last
+	// one.
+	Next string `json:"next,omitempty"`
+}
+
+// List returns, in order, the first limit keys starting with prefix found
+// after cursor, the key a previous page ended with, or from the first key
+// when cursor is empty. limit defaults to DefaultListLimit and can't exceed
+// MaxListLimit. Expired and reserved keys aren't listed. Each page is read
+// on its own, so keys written while listing may or may not be listed.
+func (cfg *Config) List(ctx context.Context, prefix, cursor string, limit int) (KeyList, error) {
+	if limit < 0 || limit > MaxListLimit {
+		return KeyList{}, fmt.Errorf("%w: limit must be between 0 and %d, not %d", ErrInvalidLimit, MaxListLimit, limit)
+	}
+	if limit == 0 {
+		limit = DefaultListLimit
+	}
+	if err := cfg.checkReady(); err != nil {
+		return KeyList{}, err
+	}
+
+	return cfg.fsm.localList(ctx, prefix, cursor, limit)
+}
+
+// localList lists the keys of the data, see Config.List.
+func (f *fsm) localList(ctx context.Context, prefix, cursor string, limit int) (KeyList, error) {
+	if err := readable(ctx); err != nil {
+		return KeyList{}, err
+	}
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	keys := f.sortedKeys()
+	prefix, cursor = f.policies.key(prefix), f.policies.key(cursor)
+
+	i := sort.SearchStrings(keys, prefix)
+	if cursor > prefix {
+		i = sort.SearchStrings(keys, cursor)
+		if i < len(keys) && keys[i] == cursor {
+			i++
+		}
+	}
+
+	now := time.Now()
+	list := KeyList{Keys: []string{}}
+	for ; i < len(keys) && strings.HasPrefix(keys[i], prefix); i++ {
+		if f.data[keys[i]].expired(now) {
+			continue
+		}
+		if len(list.Keys) == limit {
+			list.Next = list.Keys[limit-1]
+			break
+		}
+		list.Keys = append(list.Keys, keys[i])
+	}
+
+	return list, nil
+}
+
+// sortedKeys returns the keys of the data in order, sorting them again if
+// they changed since the last listing. The caller holds the read lock, the
+// returned slice is only read.
+func (f *fsm) sortedKeys() []string {
+	f.sortMu.Lock()
+	defer f.sortMu.Unlock()
+
+	if f.unsorted {
+		keys := make([]string, 0, len(f.data))
+		for key := range f.data {
+			if !strings.HasPrefix(key, f.reserved) {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		f.sorted, f.unsorted = keys, false
+	}
+
+	return f.sorted
+}
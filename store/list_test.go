@@ -0,0 +1,56 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestList(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestConfig(t)
+
+	for _, key := range []string{"user:3", "user:1", "order:1", "user:2", "user:10"} {
+		if _, err := cfg.SetEntry(ctx, key, Entry{Value: "v"}); err != nil {
+			t.Fatalf("SetEntry returned unexpected error: %s", err)
+		}
+	}
+
+	var pages [][]string
+	cursor := ""
+	for {
+		list, err := cfg.List(ctx, "user:", cursor, 2)
+		if err != nil {
+			t.Fatalf("List returned unexpected error: %s", err)
+		}
+		pages = append(pages, list.Keys)
+		if list.Next == "" {
+			break
+		}
+		cursor = list.Next
+	}
+	want := [][]string{{"user:1", "user:10"}, {"user:2", "user:3"}}
+	if !reflect.DeepEqual(pages, want) {
+		t.Errorf("Listed pages %v, want %v", pages, want)
+	}
+
+	// The listing follows the keys added and removed
+	if _, err := cfg.SetEntry(ctx, "user:0", Entry{Value: "v"}); err != nil {
+		t.Fatalf("SetEntry returned unexpected error: %s", err)
+	}
+	if _, _, err := cfg.DeleteAndGet(ctx, "user:10"); err != nil {
+		t.Fatalf("DeleteAndGet returned unexpected error: %s", err)
+	}
+	list, err := cfg.List(ctx, "", "", 0)
+	if err != nil {
+		t.Fatalf("List returned unexpected error: %s", err)
+	}
+	if want := []string{"order:1", "user:0", "user:1", "user:2", "user:3"}; !reflect.DeepEqual(list.Keys, want) {
+		t.Errorf("List() = %v, want %v without reserved keys", list.Keys, want)
+	}
+
+	if _, err := cfg.List(ctx, "", "", MaxListLimit+1); !errors.Is(err, ErrInvalidLimit) {
+		t.Errorf("List past MaxListLimit returned %v, want ErrInvalidLimit", err)
+	}
+}
@@ -0,0 +1,195 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// A lock is held by a lease: the lock is released when its holder unlocks
+// it, or revokes or stops keeping alive the lease. Acquiring a lock goes
+// through Raft, so a single lease holds it at a time, and the revision of the
+// lock, at which it was acquired, grows every time it changes hands: clients
+// can send it along their writes as a fencing token.
+
+// Lock is a lock and its holder.
+type Lock struct {
+	Name       string    `json:"name"`
+	Lease      uint64    `json:"lease"`
+	AcquiredAt time.Time `json:"acquired_at"`
+
+	// Revision is the log index at which the lease acquired the lock.
+	Revision uint64 `json:"revision"`
+
+	// ExpiresAt is when the lock is released unless its lease is kept
+	// alive.
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// validateLock checks name can name a lock.
+func (cfg *Config) validateLock(name string) error {
+	if err := validateKey(name); err != nil {
+		return fmt.Errorf("%w: invalid lock name %q", ErrInvalidKey, name)
+	}
+
+	return nil
+}
+
+// Lock acquires the lock name for the lease id and returns it. Acquiring a
+// lock the lease already holds returns it unchanged. It fails with
+// ErrLockHeld when another lease holds it, and with ErrLeaseNotFound when
+// the lease expired.
+func (cfg *Config) Lock(ctx context.Context, name string, id uint64) (Lock, error) {
+	if err := cfg.validateLock(name); err != nil {
+		return Lock{}, err
+	}
+	if err := cfg.writable(); err != nil {
+		return Lock{}, err
+	}
+
+	resp, _, err := cfg.apply(ctx, Command{Action: "lock", Key: name, Lease: id, Now: time.Now().UnixNano()})
+	if err != nil {
+		return Lock{}, err
+	}
+
+	return resp.(Lock), nil
+}
+
+// Unlock releases the lock name held by the lease id, failing with
+// ErrLockNotHeld when the lease doesn't hold it. It returns the log index of
+// the write.
+func (cfg *Config) Unlock(ctx context.Context, name string, id uint64) (uint64, error) {
+	if err := cfg.validateLock(name); err != nil {
+		return 0, err
+	}
+	if err := cfg.writable(); err != nil {
+		return 0, err
+	}
+
+	_, index, err := cfg.apply(ctx, Command{Action: "unlock", Key: name, Lease: id, Now: time.Now().UnixNano()})
+	return index, err
+}
+
+// LockHolder returns the lock name, failing with ErrLockNotHeld when no lease
+// holds it.
+func (cfg *Config) LockHolder(ctx context.Context, name string) (Lock, error) {
+	if err := cfg.validateLock(name); err != nil {
+		return Lock{}, err
+	}
+	if err := readable(ctx); err != nil {
+		return Lock{}, err
+	}
+
+	f := cfg.fsm
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	l, ok, err := f.lock(f.policies.key(name), time.Now())
+	if err != nil {
+		return Lock{}, err
+	}
+	if !ok {
+		return Lock{}, fmt.Errorf("%w: %q", ErrLockNotHeld, name)
+	}
+
+	return l, nil
+}
+
+// lockKey returns the key recording the holder of the lock name.
+func (f *fsm) lockKey(name string) string {
+	return f.reserved + "lock" + f.separator + name
+}
+
+// lockName returns the name of the lock recorded at key.
+func (f *fsm) lockName(key string) string {
+	return strings.TrimPrefix(key, f.lockKey(""))
+}
+
+// lockKeys returns the keys of the locks names.
+func (f *fsm) lockKeys(names []string) []string {
+	keys := make([]string, 0, len(names))
+	for _, name := range names {
+		keys = append(keys, f.lockKey(name))
+	}
+
+	return keys
+}
+
+// heldLocks returns the names of the locks l still holds. The caller holds
+// the lock of the data.
+func (f *fsm) heldLocks(l Lease) []string {
+	var names []string
+	for _, key := range f.attached(l, f.lockKeys(l.Locks)) {
+		names = append(names, f.lockName(key))
+	}
+
+	return names
+}
+
+// lock returns the lock name, false when no lease holds it at now. The caller
+// holds the lock of the data.
+func (f *fsm) lock(name string, now time.Time) (Lock, bool, error) {
+	e, ok := f.data[f.lockKey(name)]
+	if !ok || e.expired(now) {
+		return Lock{}, false, nil
+	}
+
+	var l Lock
+	if err := json.Unmarshal([]byte(e.Value), &l); err != nil {
+		return Lock{}, false, fmt.Errorf("decoding lock %q: %w", name, err)
+	}
+	l.Revision, l.ExpiresAt = e.Revision, e.ExpiresAt
+
+	return l, true, nil
+}
+
+// localLock acquires the lock name for the lease id at now. The caller holds
+// the write lock.
+func (f *fsm) localLock(name string, id uint64, now time.Time) (Lock, error) {
+	held, ok, err := f.lock(name, now)
+	if err != nil {
+		return Lock{}, err
+	}
+	if ok && held.Lease == id {
+		return held, nil
+	}
+	if ok {
+		return Lock{}, fmt.Errorf("%w: %q is held by lease %d", ErrLockHeld, name, held.Lease)
+	}
+
+	lease, err := f.lease(id, now)
+	if err != nil {
+		return Lock{}, err
+	}
+
+	l := Lock{Name: name, Lease: id, AcquiredAt: now}
+	b, err := json.Marshal(l)
+	if err != nil {
+		return Lock{}, fmt.Errorf("encoding lock %q: %w", name, err)
+	}
+	lease.Locks = append(f.heldLocks(lease), name)
+	if err := f.putLease(lease); err != nil {
+		return Lock{}, err
+	}
+	f.put(f.lockKey(name), Entry{Value: string(b), ExpiresAt: lease.ExpiresAt})
+	l.Revision, l.ExpiresAt = f.applied, lease.ExpiresAt
+
+	return l, nil
+}
+
+// localUnlock releases the lock name held by the lease id at now. The caller
+// holds the write lock.
+func (f *fsm) localUnlock(name string, id uint64, now time.Time) error {
+	held, ok, err := f.lock(name, now)
+	if err != nil {
+		return err
+	}
+	if !ok || held.Lease != id {
+		return fmt.Errorf("%w: lease %d doesn't hold %q", ErrLockNotHeld, id, name)
+	}
+
+	f.remove(f.lockKey(name))
+	return nil
+}
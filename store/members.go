@@ -0,0 +1,112 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+
+	"github.com/hashicorp/raft"
+)
+
+// The cluster metadata records what the nodes can't learn from the Raft
+// configuration, which only holds their ID and Raft address: the URL of
+// their HTTP API, which followers forward requests to and name to clients.
+// The leader records it for the nodes joining, and for itself as it is
+// elected, so nodes whose HTTP address changed across a restart are
+// reachable again once they join or lead.
+
+// member is the metadata of a node.
+type member struct {
+	ID          raft.ServerID `json:"id"`
+	HTTPAddress string        `json:"http_address"`
+}
+
+// memberKey returns the key recording the metadata of the node id.
+func (cfg *Config) memberKey(id raft.ServerID) string {
+	return cfg.internalKey("member", string(id))
+}
+
+// recordMember records m in the cluster metadata, unless it already holds
+// it. Only the leader can.
+func (cfg *Config) recordMember(ctx context.Context, m member) error {
+	if recorded, ok := cfg.memberInfo(m.ID); ok && recorded == m {
+		return nil
+	}
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("encoding member %s: %w", m.ID, err)
+	}
+	_, _, err = cfg.apply(ctx, Command{Action: "set", Key: cfg.memberKey(m.ID), Data: data})
+
+	return err
+}
+
+// forgetMember removes the metadata of the node id, once it left the
+// cluster.
+func (cfg *Config) forgetMember(ctx context.Context, id raft.ServerID) error {
+	if _, ok := cfg.memberInfo(id); !ok {
+		return nil
+	}
+
+	_, _, err := cfg.apply(ctx, Command{Action: "delete", Key: cfg.memberKey(id)})
+	return err
+}
+
+// memberInfo returns the metadata of the node id, false when none is
+// recorded.
+func (cfg *Config) memberInfo(id raft.ServerID) (member, bool) {
+	e, found, err := cfg.fsm.localLookup(context.Background(), cfg.memberKey(id))
+	if err != nil || !found {
+		return member{}, false
+	}
+
+	var m member
+	if err := json.Unmarshal([]byte(e.Value), &m); err != nil {
+		cfg.logger.Warn("couldn't decode member", "id", id, "error", err)
+		return member{}, false
+	}
+
+	return m, true
+}
+
+// memberURL returns the URL of the HTTP API of the node id, whose Raft
+// address is addr: the one recorded in the cluster metadata, or the one
+// derived from addr for the nodes that recorded none.
+func (cfg *Config) memberURL(id raft.ServerID, addr raft.ServerAddress) *url.URL {
+	if m, ok := cfg.memberInfo(id); ok && m.HTTPAddress != "" {
+		if u, err := url.Parse(m.HTTPAddress); err == nil {
+			return u
+		}
+	}
+
+	return cfg.httpURL(addr)
+}
+
+// leaderURL returns the URL of the HTTP API of the leader, nil while there is
+// none or the node is standalone.
+func (cfg *Config) leaderURL() *url.URL {
+	if cfg.standalone() {
+		return nil
+	}
+
+	addr, id := cfg.raft.LeaderWithID()
+	if addr == "" {
+		return nil
+	}
+
+	return cfg.memberURL(id, addr)
+}
+
+// recordSelf records the HTTP address of the node in the cluster metadata,
+// as it is elected leader.
+func (cfg *Config) recordSelf() {
+	if cfg.httpAddress == "" {
+		return
+	}
+
+	if err := cfg.recordMember(context.Background(), member{ID: cfg.id, HTTPAddress: cfg.httpAddress}); err != nil {
+		cfg.logger.Error("couldn't record the HTTP address of the node", "error", err)
+	}
+}
@@ -0,0 +1,86 @@
+package store
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryStore is a Store keeping the entries in memory, so nothing is saved
+// between restarts: a restarting node gets its data back from the Raft
+// snapshots and log, replaying all of the log since the last snapshot. It
+// suits caches and experiments, or clusters whose log is snapshotted often.
+type MemoryStore struct {
+	mu   sync.Mutex
+	data map[string]Entry
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{data: map[string]Entry{}}
+}
+
+// Get returns the entry at key.
+func (s *MemoryStore) Get(ctx context.Context, key string) (Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.data[key], nil
+}
+
+// Set stores e at key.
+func (s *MemoryStore) Set(ctx context.Context, key string, e Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data[key] = e
+	return nil
+}
+
+// Delete removes key.
+func (s *MemoryStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.data, key)
+	return nil
+}
+
+// Iterate calls fn with a copy of every entry.
+func (s *MemoryStore) Iterate(ctx context.Context, fn func(key string, e Entry) error) error {
+	data, _ := s.Snapshot(ctx)
+	for key, e := range data {
+		if err := fn(key, e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Snapshot returns a copy of the entries.
+func (s *MemoryStore) Snapshot(ctx context.Context) (map[string]Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data := make(map[string]Entry, len(s.data))
+	for key, e := range s.data {
+		data[key] = e
+	}
+
+	return data, nil
+}
+
+// Restore replaces the entries with a copy of data.
+func (s *MemoryStore) Restore(ctx context.Context, data map[string]Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data = make(map[string]Entry, len(data))
+	for key, e := range data {
+		s.data[key] = e
+	}
+
+	return nil
+}
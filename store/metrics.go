@@ -0,0 +1,124 @@
+package store
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// durationBuckets are the upper bounds, in seconds, of the buckets of the
+// duration histograms.
+var durationBuckets = []float64{.001, .005, .01, .05, .1, .5, 1, 5, 10, 30, 60}
+
+// metric is a value exposed on /metrics.
+type metric struct {
+	name  string
+	help  string
+	kind  string
+	value float64
+}
+
+// histogram counts observations in cumulative buckets, exposed on /metrics
+// as a Prometheus histogram.
+type histogram struct {
+	name string
+	help string
+
+	mu      sync.Mutex
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+func newHistogram(name, help string, buckets []float64) *histogram {
+	return &histogram{name: name, help: help, buckets: buckets, counts: make([]uint64, len(buckets))}
+}
+
+func (h *histogram) observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i, bound := range h.buckets {
+		if v <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// since observes the time elapsed since start, in seconds.
+func (h *histogram) since(start time.Time) {
+	h.observe(time.Since(start).Seconds())
+}
+
+func (h *histogram) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	for i, bound := range h.buckets {
+		fmt.Fprintf(w, "%s_bucket{le=%q} %d\n", h.name, strconv.FormatFloat(bound, 'g', -1, 64), h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n%s_sum %g\n%s_count %d\n", h.name, h.count, h.name, h.sum, h.name, h.count)
+}
+
+// fsmMetrics measure the snapshots and restores of the FSM.
+type fsmMetrics struct {
+	snapshotDuration *histogram
+	persistDuration  *histogram
+	restoreDuration  *histogram
+
+	// The counters and gauges are updated atomically.
+	snapshots         uint64
+	restores          uint64
+	lastSnapshotSize  uint64
+	lastSnapshotIndex uint64
+}
+
+func newFSMMetrics() *fsmMetrics {
+	return &fsmMetrics{
+		snapshotDuration: newHistogram("kv_fsm_snapshot_duration_seconds", "Time taken to copy the data for a snapshot.", durationBuckets),
+		persistDuration:  newHistogram("kv_fsm_snapshot_persist_duration_seconds", "Time taken to write a snapshot.", durationBuckets),
+		restoreDuration:  newHistogram("kv_fsm_restore_duration_seconds", "Time taken to restore the data from a snapshot.", durationBuckets),
+	}
+}
+
+func (cfg *Config) metrics() []metric {
+	m := cfg.fsm.metrics
+	return []metric{
+		{"kv_inflight_applies", "Writes being replicated through Raft.", "gauge", float64(atomic.LoadInt64(&cfg.inflight))},
+		{"kv_raft_term", "Current Raft term.", "gauge", float64(cfg.Term())},
+		{"kv_raft_leadership_acquired_total", "Times the node became the leader.", "counter", float64(atomic.LoadUint64(&cfg.leadership.acquired))},
+		{"kv_raft_leadership_lost_total", "Times the node stopped being the leader.", "counter", float64(atomic.LoadUint64(&cfg.leadership.lost))},
+		{"kv_raft_last_leadership_change_timestamp_seconds", "Unix time of the last leadership change, 0 before the first one.", "gauge", float64(atomic.LoadInt64(&cfg.leadership.lastChange)) / float64(time.Second)},
+		{"kv_raft_compactions_total", "Log compactions run by the node.", "counter", float64(atomic.LoadUint64(&cfg.compaction.runs))},
+		{"kv_raft_last_compaction_timestamp_seconds", "Unix time of the last log compaction, 0 before the first one.", "gauge", float64(atomic.LoadInt64(&cfg.compaction.last)) / float64(time.Second)},
+		{"kv_raft_last_compaction_reclaimed_bytes", "Log store bytes freed by the last log compaction.", "gauge", float64(atomic.LoadInt64(&cfg.compaction.reclaimed))},
+		{"kv_fsm_snapshots_total", "Snapshots written.", "counter", float64(atomic.LoadUint64(&m.snapshots))},
+		{"kv_fsm_restores_total", "Restores from a snapshot.", "counter", float64(atomic.LoadUint64(&m.restores))},
+		{"kv_fsm_last_snapshot_size_bytes", "Size of the last snapshot written.", "gauge", float64(atomic.LoadUint64(&m.lastSnapshotSize))},
+		{"kv_fsm_last_snapshot_index", "Raft log index of the last snapshot written.", "gauge", float64(atomic.LoadUint64(&m.lastSnapshotIndex))},
+	}
+}
+
+// MetricsHandler serves the metrics of the node it is sent to in the
+// Prometheus text format.
+func (cfg *Config) MetricsHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		for _, m := range cfg.metrics() {
+			fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %g\n", m.name, m.help, m.name, m.kind, m.name, m.value)
+		}
+
+		m := cfg.fsm.metrics
+		for _, h := range []*histogram{m.snapshotDuration, m.persistDuration, m.restoreDuration} {
+			h.write(w)
+		}
+	}
+}
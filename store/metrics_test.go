@@ -0,0 +1,74 @@
+package store
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/raft"
+)
+
+func TestHistogram(t *testing.T) {
+	h := newHistogram("test_seconds", "Test.", []float64{.1, 1})
+	h.observe(.05)
+	h.observe(.5)
+	h.observe(5)
+
+	var b bytes.Buffer
+	h.write(&b)
+
+	expected := `# HELP test_seconds Test.
+# TYPE test_seconds histogram
+test_seconds_bucket{le="0.1"} 1
+test_seconds_bucket{le="1"} 2
+test_seconds_bucket{le="+Inf"} 3
+test_seconds_sum 5.55
+test_seconds_count 3
+`
+	if got := b.String(); got != expected {
+		t.Errorf("Got\n%s\nexpected\n%s", got, expected)
+	}
+}
+
+func TestSnapshotMetrics(t *testing.T) {
+	f := newFSM(NewFileStore(filepath.Join(t.TempDir(), "data.json")), hclog.NewNullLogger())
+	f.Apply(setLog(t, 7, "k", "v"))
+
+	snaps := raft.NewInmemSnapshotStore()
+	snap, err := f.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink, err := snaps.Create(raft.SnapshotVersionMax, 7, 1, raft.Configuration{}, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := snap.Persist(sink); err != nil {
+		t.Fatal(err)
+	}
+	snap.Release()
+
+	_, rc, err := snaps.Open(sink.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Restore(rc); err != nil {
+		t.Fatal(err)
+	}
+
+	m := f.metrics
+	if m.snapshots != 1 || m.restores != 1 || m.lastSnapshotIndex != 7 || m.lastSnapshotSize == 0 {
+		t.Errorf("Got %d snapshots, %d restores, last at index %d of %d bytes, expected 1, 1, 7 and a size",
+			m.snapshots, m.restores, m.lastSnapshotIndex, m.lastSnapshotSize)
+	}
+
+	for _, h := range []*histogram{m.snapshotDuration, m.persistDuration, m.restoreDuration} {
+		var b bytes.Buffer
+		h.write(&b)
+		if !strings.Contains(b.String(), h.name+"_count 1\n") {
+			t.Errorf("Got\n%s\nexpected one observation", b.String())
+		}
+	}
+}
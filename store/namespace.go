@@ -0,0 +1,253 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A namespace groups the keys sharing their first part: with the default
+// separator, "billing:invoice:1" is in the namespace "billing". Keys without
+// a separator aren't in any namespace.
+
+// NamespaceStats are the number of keys of a namespace and the size of their
+// values.
+type NamespaceStats struct {
+	Namespace string `json:"namespace"`
+	Keys      int    `json:"keys"`
+	Bytes     int64  `json:"bytes"`
+}
+
+// Quota limits the size of a namespace. Writes that would take the namespace
+// past it fail with ErrQuotaExceeded. Zero fields mean no limit.
+type Quota struct {
+	MaxKeys  int
+	MaxBytes int64
+}
+
+// NamespaceLimits bound the namespaces all together, on top of their quotas.
+// Writes that would create more namespaces than MaxNamespaces, or put more
+// keys than MaxKeysPerNamespace in one, fail with ErrNamespaceLimit. Zero
+// fields mean no limit. The keys of the reserved space aren't counted.
+type NamespaceLimits struct {
+	MaxNamespaces       int
+	MaxKeysPerNamespace int
+}
+
+// ParseQuotas parses a comma separated list of quotas, written
+// <namespace>:<max keys>:<max bytes>. A limit left empty or set to 0 isn't
+// enforced: "tenant1:1000:1048576,tenant2::65536".
+func ParseQuotas(s string) (map[string]Quota, error) {
+	quotas := map[string]Quota{}
+	for _, quota := range strings.Split(s, ",") {
+		if quota = strings.TrimSpace(quota); quota == "" {
+			continue
+		}
+
+		// The namespace comes first so it may hold a colon itself
+		parts := strings.Split(quota, ":")
+		if len(parts) < 3 {
+			return nil, fmt.Errorf("invalid quota %q, expected <namespace>:<max keys>:<max bytes>", quota)
+		}
+		ns := strings.Join(parts[:len(parts)-2], ":")
+		keys, bytes := parts[len(parts)-2], parts[len(parts)-1]
+
+		var q Quota
+		if keys != "" {
+			n, err := strconv.Atoi(keys)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("invalid max keys %q for namespace %q", keys, ns)
+			}
+			q.MaxKeys = n
+		}
+		if bytes != "" {
+			n, err := strconv.ParseInt(bytes, 10, 64)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("invalid max bytes %q for namespace %q", bytes, ns)
+			}
+			q.MaxBytes = n
+		}
+		quotas[ns] = q
+	}
+
+	return quotas, nil
+}
+
+// namespaceOf returns the namespace of key, empty when it has none.
+func namespaceOf(key, sep string) string {
+	if i := strings.Index(key, sep); i > 0 {
+		return key[:i]
+	}
+
+	return ""
+}
+
+// NamespaceStats counts the keys of the namespace ns and the size of their
+// values, scanning the whole store.
+func (cfg *Config) NamespaceStats(ctx context.Context, ns string) (NamespaceStats, error) {
+	if ns == "" || strings.Contains(ns, cfg.keySeparator) {
+		return NamespaceStats{}, fmt.Errorf("%w: invalid namespace %q", ErrInvalidKey, ns)
+	}
+
+	if err := cfg.validateKey(ns + cfg.keySeparator); err != nil {
+		return NamespaceStats{}, err
+	}
+
+	cfg.fsm.mu.RLock()
+	defer cfg.fsm.mu.RUnlock()
+
+	return cfg.fsm.namespaceStats(cfg.fsm.policies.key(ns)), nil
+}
+
+// namespaceStats returns the size of ns. Expired entries count until they
+// are purged. The caller holds the lock.
+func (f *fsm) namespaceStats(ns string) NamespaceStats {
+	stats := f.namespaces[ns]
+	stats.Namespace = ns
+
+	return stats
+}
+
+// put stores e at key, counting it in its namespace, as the revision being
+// applied. The caller holds the write lock.
+func (f *fsm) put(key string, e Entry) {
+	old, ok := f.data[key]
+	if ok {
+		f.count(key, -1, -int64(len(old.Value)))
+	} else {
+		f.unsorted = true
+	}
+	e.Revision, e.history = f.applied, nil
+	if ok && f.historySize > 0 && !strings.HasPrefix(key, f.reserved) {
+		e.history = f.versions(old)
+	}
+	f.data[key] = e
+	f.count(key, 1, int64(len(e.Value)))
+	f.track(key)
+}
+
+// remove deletes key, if it exists, from the data and its namespace. The
+// caller holds the write lock.
+func (f *fsm) remove(key string) {
+	if old, ok := f.data[key]; ok {
+		delete(f.data, key)
+		f.count(key, -1, -int64(len(old.Value)))
+		f.track(key)
+		f.unsorted = true
+	}
+}
+
+// reset replaces the data, which must then be saved whole, counts its
+// namespaces again and reads its operation counts and the index of the last
+// command it holds. The caller holds the write lock.
+func (f *fsm) reset(data map[string]Entry) {
+	f.data = data
+	f.rewrite, f.unsorted = true, true
+	if f.changed != nil {
+		f.changed = map[string]struct{}{}
+	}
+	f.namespaces = map[string]NamespaceStats{}
+	for key, e := range data {
+		f.count(key, 1, int64(len(e.Value)))
+	}
+	f.loadOps()
+	f.loadApplied()
+}
+
+// track records that key changed, when the store saves changes only. The
+// caller holds the write lock.
+func (f *fsm) track(key string) {
+	if f.changed != nil {
+		f.changed[key] = struct{}{}
+	}
+}
+
+// count adds keys and bytes to the namespace of key, forgetting namespaces
+// left without keys.
+func (f *fsm) count(key string, keys int, bytes int64) {
+	ns := namespaceOf(key, f.separator)
+	if ns == "" || strings.HasPrefix(key, f.reserved) {
+		return
+	}
+
+	stats := f.namespaces[ns]
+	stats.Keys += keys
+	stats.Bytes += bytes
+	if stats.Keys <= 0 {
+		delete(f.namespaces, ns)
+		return
+	}
+	f.namespaces[ns] = stats
+}
+
+// checkQuotas fails with ErrQuotaExceeded if writing values of the given
+// sizes at the keys of written, and removing the keys of removed, takes a
+// namespace past its quota, and with ErrNamespaceLimit if it goes past the
+// namespace limits. A namespace already past its quota or limit, because it
+// was lowered, can still shrink. The caller holds the write lock.
+func (f *fsm) checkQuotas(written map[string]int, removed ...string) error {
+	limited := f.limits != NamespaceLimits{}
+	if len(f.quotas) == 0 && !limited {
+		return nil
+	}
+
+	deltas := map[string]*NamespaceStats{}
+	delta := func(key string) *NamespaceStats {
+		ns := namespaceOf(key, f.separator)
+		if _, ok := f.quotas[ns]; (!ok && !limited) || ns == "" || strings.HasPrefix(key, f.reserved) {
+			return nil
+		}
+		if deltas[ns] == nil {
+			deltas[ns] = &NamespaceStats{Namespace: ns}
+		}
+		return deltas[ns]
+	}
+
+	for _, key := range removed {
+		e, ok := f.data[key]
+		if d := delta(key); d != nil && ok {
+			d.Keys--
+			d.Bytes -= int64(len(e.Value))
+		}
+	}
+	for key, size := range written {
+		d := delta(key)
+		if d == nil {
+			continue
+		}
+		if old, ok := f.data[key]; ok {
+			d.Bytes -= int64(len(old.Value))
+		} else {
+			d.Keys++
+		}
+		d.Bytes += int64(size)
+	}
+
+	created := 0
+	for ns, d := range deltas {
+		quota, stats := f.quotas[ns], f.namespaceStats(ns)
+		switch {
+		case stats.Keys == 0 && stats.Keys+d.Keys > 0:
+			created++
+		case stats.Keys > 0 && stats.Keys+d.Keys == 0:
+			created--
+		}
+
+		if max := f.limits.MaxKeysPerNamespace; max > 0 && d.Keys > 0 && stats.Keys+d.Keys > max {
+			return fmt.Errorf("%w: namespace %q would hold %d keys, maximum is %d", ErrNamespaceLimit, ns, stats.Keys+d.Keys, max)
+		}
+		if quota.MaxKeys > 0 && d.Keys > 0 && stats.Keys+d.Keys > quota.MaxKeys {
+			return fmt.Errorf("%w: namespace %q would hold %d keys, maximum is %d", ErrQuotaExceeded, ns, stats.Keys+d.Keys, quota.MaxKeys)
+		}
+		if quota.MaxBytes > 0 && d.Bytes > 0 && stats.Bytes+d.Bytes > quota.MaxBytes {
+			return fmt.Errorf("%w: namespace %q would hold %d bytes, maximum is %d", ErrQuotaExceeded, ns, stats.Bytes+d.Bytes, quota.MaxBytes)
+		}
+	}
+
+	if max := f.limits.MaxNamespaces; max > 0 && created > 0 && len(f.namespaces)+created > max {
+		return fmt.Errorf("%w: there would be %d namespaces, maximum is %d", ErrNamespaceLimit, len(f.namespaces)+created, max)
+	}
+
+	return nil
+}
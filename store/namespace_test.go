@@ -0,0 +1,148 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestNamespaceStats(t *testing.T) {
+	cfg := newTestConfig(t)
+	ctx := context.Background()
+
+	cfg.Set(ctx, "billing:a", "12")
+	cfg.Set(ctx, "billing:b", "345")
+	cfg.Set(ctx, "billingx", "ignored")
+	cfg.Set(ctx, "other:a", "ignored")
+
+	got, err := cfg.NamespaceStats(ctx, "billing")
+	if err != nil {
+		t.Fatalf("NamespaceStats returned unexpected error: %s", err)
+	}
+	if expected := (NamespaceStats{Namespace: "billing", Keys: 2, Bytes: 5}); got != expected {
+		t.Errorf("Got %+v, expected %+v", got, expected)
+	}
+
+	if _, err := cfg.NamespaceStats(ctx, DefaultReservedPrefix); !errors.Is(err, ErrReservedKey) {
+		t.Errorf("Got error %v for the reserved namespace, expected %v", err, ErrReservedKey)
+	}
+
+	if _, err := cfg.NamespaceStats(ctx, "a:b"); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("Got error %v for a namespace holding the separator, expected %v", err, ErrInvalidKey)
+	}
+}
+
+func TestNamespaceQuota(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.fsm.quotas = map[string]Quota{
+		"keys":  {MaxKeys: 2},
+		"bytes": {MaxBytes: 10},
+	}
+	ctx := context.Background()
+
+	cfg.Set(ctx, "keys:1", "v")
+	cfg.Set(ctx, "keys:2", "v")
+	if err := cfg.Set(ctx, "keys:3", "v"); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("Got error %v past the key quota, expected %v", err, ErrQuotaExceeded)
+	}
+	if got, _ := cfg.Get(ctx, "keys:3"); got != "" {
+		t.Errorf("Rejected write stored %q", got)
+	}
+
+	// Overwriting doesn't add a key
+	if err := cfg.Set(ctx, "keys:2", "new"); err != nil {
+		t.Errorf("Overwrite returned unexpected error: %s", err)
+	}
+
+	if _, err := cfg.SetBatch(ctx, map[string]string{"bytes:1": "12345", "bytes:2": "123456"}); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("Got error %v past the byte quota, expected %v", err, ErrQuotaExceeded)
+	}
+	if err := cfg.Set(ctx, "bytes:1", "1234567890"); err != nil {
+		t.Fatalf("Set within the quota returned unexpected error: %s", err)
+	}
+	if _, err := cfg.Copy(ctx, "bytes:1", "bytes:2", false, false); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("Got error %v copying past the byte quota, expected %v", err, ErrQuotaExceeded)
+	}
+
+	// Moving a key inside its namespace doesn't grow it
+	if _, err := cfg.Rename(ctx, "bytes:1", "bytes:2", false); err != nil {
+		t.Errorf("Rename returned unexpected error: %s", err)
+	}
+
+	// Keys outside the namespaces with a quota aren't limited
+	if err := cfg.Set(ctx, "free:1", "a much longer value"); err != nil {
+		t.Errorf("Set outside quotas returned unexpected error: %s", err)
+	}
+}
+
+func TestNamespaceLimits(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.fsm.limits = NamespaceLimits{MaxNamespaces: 2, MaxKeysPerNamespace: 2}
+	ctx := context.Background()
+
+	cfg.Set(ctx, "a:1", "v")
+	cfg.Set(ctx, "a:2", "v")
+	if err := cfg.Set(ctx, "a:3", "v"); !errors.Is(err, ErrNamespaceLimit) {
+		t.Errorf("Got error %v past the keys per namespace, expected %v", err, ErrNamespaceLimit)
+	}
+
+	cfg.Set(ctx, "b:1", "v")
+	if _, err := cfg.SetBatch(ctx, map[string]string{"b:2": "v", "c:1": "v"}); !errors.Is(err, ErrNamespaceLimit) {
+		t.Errorf("Got error %v past the number of namespaces, expected %v", err, ErrNamespaceLimit)
+	}
+	if got, _ := cfg.Get(ctx, "b:2"); got != "" {
+		t.Errorf("Rejected batch stored %q", got)
+	}
+
+	// Keys outside namespaces and in the reserved space aren't limited
+	if err := cfg.Set(ctx, "plain", "v"); err != nil {
+		t.Errorf("Set outside namespaces returned unexpected error: %s", err)
+	}
+	if _, _, err := cfg.apply(ctx, Command{Action: "set", Key: cfg.fsm.reserved + "lock", Data: []byte("v")}); err != nil {
+		t.Errorf("Set in the reserved space returned unexpected error: %s", err)
+	}
+
+	// Emptying a namespace makes room for another one
+	deleted, _, err := cfg.DeletePrefix(ctx, "b:")
+	if err != nil || deleted != 1 {
+		t.Fatalf("DeletePrefix = %d, %v", deleted, err)
+	}
+	if err := cfg.Set(ctx, "c:1", "v"); err != nil {
+		t.Errorf("Set in a new namespace after emptying one returned unexpected error: %s", err)
+	}
+
+	// Moving the last key of a namespace to a new one keeps the count
+	if _, err := cfg.Rename(ctx, "c:1", "d:1", false); err != nil {
+		t.Errorf("Rename to a new namespace returned unexpected error: %s", err)
+	}
+
+	if got, _ := cfg.NamespaceStats(ctx, "a"); got.Keys != 2 {
+		t.Errorf("Got %+v for namespace a, expected 2 keys", got)
+	}
+	if got, _ := cfg.NamespaceStats(ctx, "c"); got.Keys != 0 {
+		t.Errorf("Got %+v for the renamed namespace c, expected no keys", got)
+	}
+}
+
+func TestParseQuotas(t *testing.T) {
+	got, err := ParseQuotas("tenant1:1000:1048576, tenant2::65536,a:b:3:0")
+	if err != nil {
+		t.Fatalf("ParseQuotas returned unexpected error: %s", err)
+	}
+
+	expected := map[string]Quota{
+		"tenant1": {MaxKeys: 1000, MaxBytes: 1048576},
+		"tenant2": {MaxBytes: 65536},
+		"a:b":     {MaxKeys: 3},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Got %v, expected %v", got, expected)
+	}
+
+	for _, s := range []string{"tenant", "tenant:ten:1", "tenant:1:-1"} {
+		if _, err := ParseQuotas(s); err == nil {
+			t.Errorf("ParseQuotas(%q) accepted an invalid quota", s)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/hashicorp/raft"
+)
+
+// nodeIDFile names the file of the storage directory recording the Raft ID
+// of the node, so it keeps it across restarts.
+const nodeIDFile = "node-id"
+
+// WithNodeID sets the Raft ID of the node, which must be unique in the
+// cluster. By default, a node picks a random one when it starts with an empty
+// storage directory and records it there. A node can't change its ID once
+// recorded: its Raft state belongs to the node it was.
+func WithNodeID(id string) Option {
+	return func(o *options) {
+		o.nodeID = raft.ServerID(id)
+	}
+}
+
+// loadNodeID returns the ID of the node keeping its data in storagePath and
+// whether it is already recorded there: the recorded one, else configured,
+// else a random one. It fails when configured differs from the recorded ID.
+func loadNodeID(storagePath string, configured raft.ServerID) (raft.ServerID, bool, error) {
+	b, err := ioutil.ReadFile(filepath.Join(storagePath, nodeIDFile))
+	if errors.Is(err, os.ErrNotExist) {
+		if configured != "" {
+			return configured, false, nil
+		}
+
+		return raft.ServerID(uuid.New().URN()), false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("reading node ID: %w", err)
+	}
+
+	recorded := raft.ServerID(strings.TrimSpace(string(b)))
+	if recorded == "" {
+		return "", false, fmt.Errorf("the node ID file %s is empty", filepath.Join(storagePath, nodeIDFile))
+	}
+	if configured != "" && configured != recorded {
+		return "", false, fmt.Errorf("the node ID is %q but %s belongs to node %q", configured, storagePath, recorded)
+	}
+
+	return recorded, true, nil
+}
+
+// saveNodeID records id as the ID of the node keeping its data in
+// storagePath.
+func saveNodeID(storagePath string, id raft.ServerID) error {
+	path := filepath.Join(storagePath, nodeIDFile)
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, []byte(string(id)+"\n"), 0644); err != nil {
+		return fmt.Errorf("writing node ID: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("writing node ID: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,30 @@
+package store
+
+import "testing"
+
+func TestNodeID(t *testing.T) {
+	dir := t.TempDir()
+
+	id, recorded, err := loadNodeID(dir, "")
+	if err != nil || recorded || id == "" {
+		t.Fatalf("loadNodeID() of an empty directory = %q, %t, %v, want a new ID", id, recorded, err)
+	}
+	if err := saveNodeID(dir, id); err != nil {
+		t.Fatalf("saveNodeID returned unexpected error: %s", err)
+	}
+
+	// A restart keeps the ID
+	if got, recorded, err := loadNodeID(dir, ""); err != nil || !recorded || got != id {
+		t.Errorf("loadNodeID() after a restart = %q, %t, %v, want %q", got, recorded, err, id)
+	}
+	if got, _, err := loadNodeID(dir, id); err != nil || got != id {
+		t.Errorf("loadNodeID() with the recorded ID = %q, %v, want %q", got, err, id)
+	}
+	if _, _, err := loadNodeID(dir, "other"); err == nil {
+		t.Errorf("loadNodeID() with another ID returned no error")
+	}
+
+	if got, recorded, err := loadNodeID(t.TempDir(), "node1"); err != nil || recorded || got != "node1" {
+		t.Errorf("loadNodeID() with a configured ID = %q, %t, %v, want node1", got, recorded, err)
+	}
+}
@@ -0,0 +1,78 @@
+package store
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// OpCounts are the number of commands of each action applied by the FSM
+// since the cluster started. They are counted in fsm.Apply and saved with the
+// data under a reserved key, so snapshots, restores and the data file carry
+// them: every node applying the same log reports the same counts, a node
+// whose counts differ at the same index applied it differently. Commands that
+// fail or change nothing, like an expire purging no key, aren't counted. Until
+// the first snapshot, a restarting node replays the whole log over its data
+// file and counts the commands the file already holds again.
+type OpCounts map[string]uint64
+
+// OpStats are the operation counts of a node and the index they were read
+// at.
+type OpStats struct {
+	Index uint64   `json:"index"`
+	Ops   OpCounts `json:"ops"`
+}
+
+// opsKey returns the key holding the operation counts.
+func (f *fsm) opsKey() string {
+	return f.reserved + "ops"
+}
+
+// countOp counts a command of action and saves the counts with the data. The
+// caller holds the write lock.
+func (f *fsm) countOp(action string) {
+	f.ops[action]++
+
+	b, err := json.Marshal(f.ops)
+	if err != nil {
+		f.logger.Error("couldn't encode operation counts", "error", err)
+		return
+	}
+	f.put(f.opsKey(), Entry{Value: string(b)})
+}
+
+// loadOps reads the operation counts saved with the data, starting over from
+// zero when there are none. The caller holds the write lock.
+func (f *fsm) loadOps() {
+	f.ops = OpCounts{}
+
+	e, ok := f.data[f.opsKey()]
+	if !ok {
+		return
+	}
+	if err := json.Unmarshal([]byte(e.Value), &f.ops); err != nil {
+		f.logger.Error("couldn't decode operation counts, counting from zero", "error", err)
+		f.ops = OpCounts{}
+	}
+}
+
+// OpStats returns the operation counts of the node along with the index of
+// the last command it applied.
+func (cfg *Config) OpStats() OpStats {
+	cfg.fsm.mu.RLock()
+	defer cfg.fsm.mu.RUnlock()
+
+	ops := make(OpCounts, len(cfg.fsm.ops))
+	for action, n := range cfg.fsm.ops {
+		ops[action] = n
+	}
+
+	return OpStats{Index: cfg.fsm.applied, Ops: ops}
+}
+
+// OpStatsHandler serves the OpStats of the node.
+func (cfg *Config) OpStatsHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(w).Encode(cfg.OpStats())
+	}
+}
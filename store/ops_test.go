@@ -0,0 +1,65 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/raft"
+)
+
+func TestOpCounts(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestConfig(t)
+
+	for _, key := range []string{"k1", "k2", "k3"} {
+		if _, err := cfg.SetEntry(ctx, key, Entry{Value: "v"}); err != nil {
+			t.Fatalf("SetEntry returned unexpected error: %s", err)
+		}
+	}
+	if _, _, err := cfg.DeleteAndGet(ctx, "k1"); err != nil {
+		t.Fatalf("DeleteAndGet returned unexpected error: %s", err)
+	}
+	if _, err := cfg.SetBatch(ctx, map[string]string{"b1": "v", "b2": "v"}); err != nil {
+		t.Fatalf("SetBatch returned unexpected error: %s", err)
+	}
+	// Failed commands aren't counted
+	if _, err := cfg.Rename(ctx, "missing", "k4", false); err == nil {
+		t.Fatalf("Rename of a missing key succeeded")
+	}
+
+	want := OpCounts{"set": 3, "delete": 1, "batch": 1}
+	stats := cfg.OpStats()
+	if !reflect.DeepEqual(stats.Ops, want) {
+		t.Errorf("OpStats().Ops = %v, want %v", stats.Ops, want)
+	}
+	if stats.Index != cfg.appliedIndex() {
+		t.Errorf("OpStats().Index = %d, want %d", stats.Index, cfg.appliedIndex())
+	}
+
+	// A replica restored from a snapshot reports the same counts
+	cfg.fsm.mu.RLock()
+	snapshot, err := encode(cfg.fsm.copyData(), FormatBase64)
+	cfg.fsm.mu.RUnlock()
+	if err != nil {
+		t.Fatalf("encode returned unexpected error: %s", err)
+	}
+
+	// Restored through Raft, whose index carries on from the snapshot's
+	restored := newTestConfig(t)
+	meta := &raft.SnapshotMeta{Version: raft.SnapshotVersionMax, Index: cfg.appliedIndex(), Size: int64(len(snapshot))}
+	if err := restored.raft.Restore(meta, bytes.NewReader(snapshot), 0); err != nil {
+		t.Fatalf("Restore returned unexpected error: %s", err)
+	}
+	if got := restored.OpStats().Ops; !reflect.DeepEqual(got, want) {
+		t.Errorf("OpStats().Ops after restore = %v, want %v", got, want)
+	}
+
+	if _, err := restored.SetEntry(ctx, "k5", Entry{Value: "v"}); err != nil {
+		t.Fatalf("SetEntry returned unexpected error: %s", err)
+	}
+	if got := restored.OpStats().Ops["set"]; got != 4 {
+		t.Errorf("set count after restore and a write = %d, want 4", got)
+	}
+}
@@ -0,0 +1,614 @@
+package store
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/raft"
+)
+
+// Option configures an optional feature of the node built by NewRaftSetup.
+type Option func(*options)
+
+type options struct {
+	webhookURL    string
+	storageFormat Format
+	keyring       *Keyring
+
+	auditPath    string
+	auditMaxSize int64
+	auditLogger  hclog.Logger
+
+	stableStorePath string
+	logStorePath    string
+	snapshotPath    string
+	dataFile        string
+	backend         Backend
+	store           Store
+
+	heartbeatTimeout   time.Duration
+	electionTimeout    time.Duration
+	leaderLeaseTimeout time.Duration
+	commitTimeout      time.Duration
+
+	preVoteDisabled bool
+
+	snapshotInterval  time.Duration
+	snapshotThreshold uint64
+
+	transportMaxPool int
+	transportTimeout time.Duration
+	bindAddress      string
+	advertiseAddress string
+	discovery        Discoverer
+	discoveryExpect  int
+	raftTLS          *tls.Config
+	https            bool
+	adminToken       string
+	staticTokens     map[string]Role
+	hmacSecret       []byte
+	readReplica      bool
+	nonVoter         bool
+	followerMode     FollowerMode
+	followerReads    bool
+	httpAddress      string
+	readsWaitReady   bool
+	leaveOnShutdown  bool
+	nodeID           raft.ServerID
+	joinTimeout      time.Duration
+
+	maxInflightApplies int
+
+	keyAllocator KeyAllocator
+
+	keySeparator   string
+	reservedPrefix string
+
+	writePolicies WritePolicies
+
+	persistence   Persistence
+	flushInterval time.Duration
+
+	quotas          map[string]Quota
+	namespaceLimits NamespaceLimits
+
+	hotKeys int
+
+	historySize int
+
+	compactionInterval time.Duration
+
+	httpClient *http.Client
+
+	logger hclog.Logger
+}
+
+// WithReadReplica makes the node a read replica: it joins the cluster as a
+// non-voter, so it never takes part in elections, keeps applying the committed
+// log and serves reads from its own data, and rejects writes with
+// ErrReadOnly. A read replica needs a leader to join.
+func WithReadReplica() Option {
+	return func(o *options) {
+		o.readReplica = true
+	}
+}
+
+// WithNonVoter makes the node join the cluster as a non-voter: it replicates
+// the log and serves requests like the other nodes but takes no part in
+// elections nor in the quorum until promoted, see Config.PromoteServer.
+func WithNonVoter() Option {
+	return func(o *options) {
+		o.nonVoter = true
+	}
+}
+
+// WithFollowerMode sets how the node answers requests for the leader while
+// it is a follower, defaults to FollowerProxy.
+func WithFollowerMode(m FollowerMode) Option {
+	return func(o *options) {
+		o.followerMode = m
+	}
+}
+
+// WithFollowerReads has the node serve reads itself while it is a follower,
+// as if they read with ConsistencyStale, unless they ask for
+// ConsistencyLinearizable. Writes are still forwarded to the leader.
+func WithFollowerReads() Option {
+	return func(o *options) {
+		o.followerReads = true
+	}
+}
+
+// WithHTTPAddress is the URL the other nodes reach the HTTP API of the node
+// at, recorded in the cluster metadata so followers forward requests to it
+// while it leads. Without it, the other nodes derive it from the Raft
+// address of the node, see RaftAddressToHTTP.
+func WithHTTPAddress(addr string) Option {
+	return func(o *options) {
+		o.httpAddress = addr
+	}
+}
+
+// WithReadsWaitReady makes reads fail with ErrNotReady until the node is
+// ready, see Config.Ready, rather than answer from data still being
+// restored.
+func WithReadsWaitReady() Option {
+	return func(o *options) {
+		o.readsWaitReady = true
+	}
+}
+
+// WithJoinTimeout bounds the time a node started with seeds keeps trying to
+// join the cluster, defaults to DefaultJoinTimeout. NewRaftSetup fails once
+// it elapsed.
+func WithJoinTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.joinTimeout = d
+	}
+}
+
+// WithLeaveOnShutdown makes Config.Shutdown remove the node from the
+// cluster, for nodes stopped for good: the cluster shrinks and its quorum
+// with it. Nodes that restart, keeping their data and ID, shouldn't leave.
+func WithLeaveOnShutdown() Option {
+	return func(o *options) {
+		o.leaveOnShutdown = true
+	}
+}
+
+// WithKeyAllocator sets how Create picks the keys of new values, defaults to
+// AllocateSequence.
+func WithKeyAllocator(a KeyAllocator) Option {
+	return func(o *options) {
+		o.keyAllocator = a
+	}
+}
+
+// WithCompactionInterval has the leader compact its Raft log every interval,
+// see Config.Compact. Followers don't, they keep relying on the snapshot
+// thresholds of Raft. interval isn't positive means no scheduled compaction,
+// the default.
+func WithCompactionInterval(interval time.Duration) Option {
+	return func(o *options) {
+		o.compactionInterval = interval
+	}
+}
+
+// WithHTTPClient sends the requests to the other nodes, the requests
+// forwarded to the leader and the ones joining the cluster, with c. Defaults
+// to a client of NewHTTPClient with DefaultDialTimeout and
+// DefaultResponseTimeout. Only the transport of c is used when forwarding.
+func WithHTTPClient(c *http.Client) Option {
+	return func(o *options) {
+		o.httpClient = c
+	}
+}
+
+// WithMaxInflightApplies limits the number of writes being replicated at
+// once to n. Writes beyond it fail with ErrTooManyWrites instead of queueing,
+// so a burst can't pile up on the FSM and the disk. n isn't positive means no
+// limit, the default.
+func WithMaxInflightApplies(n int) Option {
+	return func(o *options) {
+		o.maxInflightApplies = n
+	}
+}
+
+// WithKeySeparator sets the separator between the parts of the keys built by
+// the store, defaults to DefaultKeySeparator.
+func WithKeySeparator(sep string) Option {
+	return func(o *options) {
+		o.keySeparator = sep
+	}
+}
+
+// WithReservedPrefix sets the first part of the keys kept for internal
+// subsystems, defaults to DefaultReservedPrefix. Clients can't read or write
+// the keys starting with the prefix followed by the key separator.
+func WithReservedPrefix(prefix string) Option {
+	return func(o *options) {
+		o.reservedPrefix = prefix
+	}
+}
+
+// WithWritePolicies has the FSM enforce p on every write. All the nodes of
+// the cluster must use the same policies.
+func WithWritePolicies(p WritePolicies) Option {
+	return func(o *options) {
+		o.writePolicies = p
+	}
+}
+
+// WithPersistence sets when the FSM saves its data to the data file, defaults
+// to PersistPeriodic. interval is how often PersistPeriodic saves it,
+// DefaultFlushInterval when it isn't positive.
+func WithPersistence(p Persistence, interval time.Duration) Option {
+	return func(o *options) {
+		if interval <= 0 {
+			interval = DefaultFlushInterval
+		}
+		o.persistence, o.flushInterval = p, interval
+	}
+}
+
+// WithNamespaceQuotas limits the size of the namespaces in quotas, by name.
+// The FSM enforces them, so all the nodes of the cluster must use the same
+// quotas.
+func WithNamespaceQuotas(quotas map[string]Quota) Option {
+	return func(o *options) {
+		o.quotas = quotas
+	}
+}
+
+// WithNamespaceLimits bounds the number of namespaces and of keys in each of
+// them. Like quotas, the FSM enforces them, so all the nodes of the cluster
+// must use the same limits.
+func WithNamespaceLimits(limits NamespaceLimits) Option {
+	return func(o *options) {
+		o.namespaceLimits = limits
+	}
+}
+
+// WithHotKeys counts the reads and writes of up to capacity keys on the
+// node, reported by HotKeysHandler. Tracking is off by default, or when
+// capacity isn't positive, as it adds a little work to every access.
+func WithHotKeys(capacity int) Option {
+	return func(o *options) {
+		o.hotKeys = capacity
+	}
+}
+
+// WithHistory keeps the n previous versions of each key, besides the current
+// one, for Config.History and Config.GetRevision. History is off by default,
+// or when n isn't positive. Versions take memory and disk like the current
+// values, but don't count in the quotas. All the nodes of the cluster must
+// keep the same number of versions.
+func WithHistory(n int) Option {
+	return func(o *options) {
+		o.historySize = n
+	}
+}
+
+// WithLogger sends the logs of the node, Raft included, to logger instead of
+// hclog.Default().
+func WithLogger(logger hclog.Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// WithStableStorePath puts the Bolt file holding the Raft stable store (the
+// current term and vote) at path, defaults to <storage path>/stable.
+func WithStableStorePath(path string) Option {
+	return func(o *options) {
+		o.stableStorePath = path
+	}
+}
+
+// WithLogStorePath puts the Bolt file holding the Raft log at path, defaults
+// to <storage path>/log. The log takes most of the writes, so it benefits the
+// most from fast storage.
+func WithLogStorePath(path string) Option {
+	return func(o *options) {
+		o.logStorePath = path
+	}
+}
+
+// WithSnapshotPath keeps the Raft snapshots in the directory at path,
+// defaults to <storage path>/snaps.
+func WithSnapshotPath(path string) Option {
+	return func(o *options) {
+		o.snapshotPath = path
+	}
+}
+
+// WithDataFile keeps the FSM data in the file at path, defaults to
+// <storage path>/data.json, or <storage path>/data.db with BackendBolt.
+func WithDataFile(path string) Option {
+	return func(o *options) {
+		o.dataFile = path
+	}
+}
+
+// WithBackend saves the FSM data in the built in Store b, defaults to
+// BackendFile. WithStore takes precedence.
+func WithBackend(b Backend) Option {
+	return func(o *options) {
+		o.backend = b
+	}
+}
+
+// WithStore saves the FSM data in s instead of the data file.
+func WithStore(s Store) Option {
+	return func(o *options) {
+		o.store = s
+	}
+}
+
+// WithWebhook makes the leader POST every committed change to url. See
+// webhook for the delivery guarantees.
+func WithWebhook(url string) Option {
+	return func(o *options) {
+		o.webhookURL = url
+	}
+}
+
+// WithAuditFile appends an audit record of every committed change to the file
+// at path, rotating it once it grows past maxSize bytes, DefaultAuditMaxSize
+// when maxSize isn't positive. See auditLog.
+func WithAuditFile(path string, maxSize int64) Option {
+	return func(o *options) {
+		if maxSize <= 0 {
+			maxSize = DefaultAuditMaxSize
+		}
+		o.auditPath, o.auditMaxSize = path, maxSize
+	}
+}
+
+// WithAuditLogger sends the audit records of committed changes to logger
+// rather than to a file.
+func WithAuditLogger(logger hclog.Logger) Option {
+	return func(o *options) {
+		o.auditLogger = logger
+	}
+}
+
+// WithStorageFormat sets the format of the data file and snapshots, defaults
+// to FormatBase64.
+func WithStorageFormat(format Format) Option {
+	return func(o *options) {
+		o.storageFormat = format
+	}
+}
+
+// The Raft timeouts default to the values of raft.DefaultConfig, tuned for a
+// LAN. On slower links, raise the heartbeat and election timeouts together,
+// keeping these ratios, which NewRaftSetup enforces:
+//
+//	ElectionTimeout >= HeartbeatTimeout >= LeaderLeaseTimeout
+//
+// The election timeout should stay well above the round trip time between
+// nodes (10x is a good rule), and the commit timeout well below the heartbeat
+// timeout, as it only bounds how long a follower waits for new entries.
+
+// WithHeartbeatTimeout sets how long a follower goes without hearing from
+// the leader before starting an election, defaults to 1s.
+func WithHeartbeatTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.heartbeatTimeout = d
+	}
+}
+
+// WithElectionTimeout sets how long a candidate waits for votes before
+// starting a new election, defaults to 1s.
+func WithElectionTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.electionTimeout = d
+	}
+}
+
+// WithLeaderLeaseTimeout sets how long a leader stays leader without
+// reaching a quorum, defaults to 500ms.
+func WithLeaderLeaseTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.leaderLeaseTimeout = d
+	}
+}
+
+// WithCommitTimeout sets how long the leader waits before sending an
+// heartbeat carrying the commit index when there are no new entries,
+// defaults to 50ms.
+func WithCommitTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.commitTimeout = d
+	}
+}
+
+// WithPreVote turns Raft's pre-vote on or off, it is on by default. With
+// pre-vote, a node first checks that it could win an election before bumping
+// the term, so a node rejoining after a partition doesn't depose a healthy
+// leader. Pre-vote needs github.com/hashicorp/raft v1.7.0 or newer.
+func WithPreVote(enabled bool) Option {
+	return func(o *options) {
+		o.preVoteDisabled = !enabled
+	}
+}
+
+// WithSnapshotInterval sets how often Raft checks whether to take a
+// snapshot, defaults to 2m. Raft spreads the checks by up to another
+// interval, so the nodes of a cluster don't snapshot all at once.
+func WithSnapshotInterval(d time.Duration) Option {
+	return func(o *options) {
+		o.snapshotInterval = d
+	}
+}
+
+// WithSnapshotThreshold sets how many log entries the node applies since its
+// last snapshot before a check takes the next one, defaults to 8192. A lower
+// threshold keeps the log and the replay on restart shorter, at the cost of
+// more frequent snapshots of the whole data.
+func WithSnapshotThreshold(n uint64) Option {
+	return func(o *options) {
+		o.snapshotThreshold = n
+	}
+}
+
+const (
+	// DefaultTransportMaxPool is the number of connections kept open to
+	// each peer by the Raft transport.
+	DefaultTransportMaxPool = 10
+
+	// DefaultTransportTimeout bounds the writes of the Raft transport.
+	DefaultTransportTimeout = 10 * time.Second
+)
+
+// WithTransportMaxPool keeps up to n connections open to each peer, defaults
+// to DefaultTransportMaxPool. Raise it when replicating to many followers or
+// over links with a high latency, where the pool would run out of
+// connections and appends would wait for one.
+func WithTransportMaxPool(n int) Option {
+	return func(o *options) {
+		o.transportMaxPool = n
+	}
+}
+
+// WithTransportTimeout sets how long the Raft transport waits on a write to a
+// peer before giving up on it, defaults to DefaultTransportTimeout. Raise it
+// on slow links, where big appends and snapshots take longer to send.
+func WithTransportTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.transportTimeout = d
+	}
+}
+
+// WithRaftBindAddress has the Raft transport listen on addr, such as
+// 0.0.0.0:8081, while the host and port given to NewRaftSetup are the address
+// advertised to the other nodes. Behind NAT or a container port mapping, the
+// address peers dial isn't one the node can bind to. Defaults to the
+// advertised address.
+func WithRaftBindAddress(addr string) Option {
+	return func(o *options) {
+		o.bindAddress = addr
+	}
+}
+
+// WithRaftAdvertiseAddress advertises addr, such as node1.example.com:30081,
+// to the other nodes as the Raft address of the node, instead of the host and
+// port given to NewRaftSetup, which the transport then listens on unless
+// WithRaftBindAddress says otherwise. The other nodes find it in the Raft
+// configuration, and dial it to replicate.
+func WithRaftAdvertiseAddress(addr string) Option {
+	return func(o *options) {
+		o.advertiseAddress = addr
+	}
+}
+
+// WithDiscovery has a node started without a leader to join find the other
+// nodes through d, and join their cluster or bootstrap it with them, instead
+// of bootstrapping a cluster of its own. The node with the lowest ID
+// bootstraps it, once expect nodes, itself included, answer: set it to the
+// initial size of the cluster, so nodes starting together don't bootstrap
+// clusters apart before they see each other. The node keeps trying for the
+// join timeout, see WithJoinTimeout, in the background.
+func WithDiscovery(d Discoverer, expect int) Option {
+	return func(o *options) {
+		o.discovery, o.discoveryExpect = d, expect
+	}
+}
+
+// newTransport builds the Raft transport listening on bind and advertising
+// advertise to the cluster.
+func (o *options) newTransport(bind, advertise string, logger hclog.Logger) (*raft.NetworkTransport, error) {
+	addr, err := net.ResolveTCPAddr("tcp", advertise)
+	if err != nil {
+		return nil, fmt.Errorf("getting advertised address: %w", err)
+	}
+
+	if o.raftTLS == nil {
+		trans, err := raft.NewTCPTransportWithLogger(bind, addr, o.transportMaxPool, o.transportTimeout, logger)
+		if err != nil {
+			return nil, fmt.Errorf("building transport: %w", err)
+		}
+
+		return trans, nil
+	}
+
+	stream, err := newTLSStreamLayer(bind, addr, o.raftTLS)
+	if err != nil {
+		return nil, fmt.Errorf("building TLS transport: %w", err)
+	}
+
+	return raft.NewNetworkTransportWithConfig(&raft.NetworkTransportConfig{
+		Stream:  stream,
+		MaxPool: o.transportMaxPool,
+		Timeout: o.transportTimeout,
+		Logger:  logger,
+	}), nil
+}
+
+// validateTransport fails if the transport settings can't be used.
+func (o *options) validateTransport() error {
+	if o.transportMaxPool < 1 {
+		return fmt.Errorf("transport max pool must be at least 1, got %d", o.transportMaxPool)
+	}
+
+	if o.transportTimeout <= 0 {
+		return fmt.Errorf("transport timeout must be positive, got %s", o.transportTimeout)
+	}
+
+	return nil
+}
+
+// applyElectionSettings overrides the election settings that were configured.
+func (o *options) applyElectionSettings(settings *raft.Config) {
+	if o.heartbeatTimeout != 0 {
+		settings.HeartbeatTimeout = o.heartbeatTimeout
+	}
+
+	if o.electionTimeout != 0 {
+		settings.ElectionTimeout = o.electionTimeout
+	}
+
+	if o.leaderLeaseTimeout != 0 {
+		settings.LeaderLeaseTimeout = o.leaderLeaseTimeout
+	}
+
+	if o.commitTimeout != 0 {
+		settings.CommitTimeout = o.commitTimeout
+	}
+
+	settings.PreVoteDisabled = o.preVoteDisabled
+}
+
+// applySnapshotSettings overrides the snapshot settings that were configured.
+func (o *options) applySnapshotSettings(settings *raft.Config) {
+	if o.snapshotInterval != 0 {
+		settings.SnapshotInterval = o.snapshotInterval
+	}
+
+	if o.snapshotThreshold != 0 {
+		settings.SnapshotThreshold = o.snapshotThreshold
+	}
+}
+
+// defaultPaths fills the paths that weren't set with their location under
+// storagePath.
+func (o *options) defaultPaths(storagePath string) {
+	if o.stableStorePath == "" {
+		o.stableStorePath = filepath.Join(storagePath, "stable")
+	}
+
+	if o.logStorePath == "" {
+		o.logStorePath = filepath.Join(storagePath, "log")
+	}
+
+	if o.snapshotPath == "" {
+		o.snapshotPath = filepath.Join(storagePath, "snaps")
+	}
+
+	if o.dataFile == "" && o.backend == BackendBolt {
+		o.dataFile = filepath.Join(storagePath, "data.db")
+	} else if o.dataFile == "" {
+		o.dataFile = filepath.Join(storagePath, "data.json")
+	}
+}
+
+// prepareFile makes sure a file can be created at path, creating its parent
+// directory if it is missing.
+func prepareFile(path string) error {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return fmt.Errorf("%s is a directory", path)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return fmt.Errorf("creating directory of %s: %w", path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,163 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/raft"
+)
+
+func TestDefaultPaths(t *testing.T) {
+	t.Parallel()
+
+	o := options{logStorePath: "/fast/log"}
+	o.defaultPaths("/data")
+
+	testCases := []struct {
+		got      string
+		expected string
+	}{
+		{o.stableStorePath, "/data/stable"},
+		{o.logStorePath, "/fast/log"},
+		{o.snapshotPath, "/data/snaps"},
+		{o.dataFile, "/data/data.json"},
+	}
+	for _, test := range testCases {
+		if test.got != test.expected {
+			t.Errorf("Got %s, expected %s", test.got, test.expected)
+		}
+	}
+}
+
+func TestPrepareFile(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "missing", "log")
+	if err := prepareFile(path); err != nil {
+		t.Fatalf("prepareFile returned unexpected error: %s", err)
+	}
+
+	if info, err := os.Stat(filepath.Dir(path)); err != nil || !info.IsDir() {
+		t.Errorf("Parent directory of %s wasn't created", path)
+	}
+
+	if err := prepareFile(dir); err == nil {
+		t.Errorf("prepareFile accepted the directory %s", dir)
+	}
+}
+
+func TestNewRaftSetupRejectsInvalidTimeouts(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name string
+		opts []Option
+	}{
+		{"election below heartbeat", []Option{WithHeartbeatTimeout(2 * time.Second), WithElectionTimeout(time.Second)}},
+		{"lease above heartbeat", []Option{WithLeaderLeaseTimeout(2 * time.Second)}},
+		{"commit too short", []Option{WithCommitTimeout(time.Microsecond)}},
+	}
+
+	for _, test := range testCases {
+		storagePath := filepath.Join(t.TempDir(), "kv")
+
+		if _, err := NewRaftSetup(storagePath, "localhost", "0", "", test.opts...); err == nil {
+			t.Errorf("%s: NewRaftSetup accepted invalid timeouts", test.name)
+		}
+
+		if _, err := os.Stat(storagePath); !os.IsNotExist(err) {
+			t.Errorf("%s: storage was set up before validating timeouts", test.name)
+		}
+	}
+}
+
+func TestNewRaftSetupRejectsInvalidTransport(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name string
+		opts []Option
+	}{
+		{"empty pool", []Option{WithTransportMaxPool(0)}},
+		{"negative timeout", []Option{WithTransportTimeout(-time.Second)}},
+	}
+
+	for _, test := range testCases {
+		storagePath := filepath.Join(t.TempDir(), "kv")
+
+		if _, err := NewRaftSetup(storagePath, "localhost", "0", "", test.opts...); err == nil {
+			t.Errorf("%s: NewRaftSetup accepted invalid transport settings", test.name)
+		}
+
+		if _, err := os.Stat(storagePath); !os.IsNotExist(err) {
+			t.Errorf("%s: storage was set up before validating the transport", test.name)
+		}
+	}
+}
+
+func TestTransportBindAddress(t *testing.T) {
+	t.Parallel()
+
+	o := options{transportMaxPool: DefaultTransportMaxPool, transportTimeout: DefaultTransportTimeout}
+	trans, err := o.newTransport("127.0.0.1:0", "127.0.0.2:9081", hclog.NewNullLogger())
+	if err != nil {
+		t.Fatalf("newTransport returned unexpected error: %s", err)
+	}
+	defer trans.Close()
+
+	if got := trans.LocalAddr(); got != "127.0.0.2:9081" {
+		t.Errorf("Got advertised address %s, expected 127.0.0.2:9081", got)
+	}
+
+	if _, err := o.newTransport("127.0.0.1:0", "0.0.0.0:9081", hclog.NewNullLogger()); err == nil {
+		t.Errorf("newTransport advertised an unspecified address")
+	}
+}
+
+func TestReadReplicaNeedsLeader(t *testing.T) {
+	t.Parallel()
+
+	storagePath := filepath.Join(t.TempDir(), "kv")
+	if _, err := NewRaftSetup(storagePath, "localhost", "0", "", WithReadReplica()); err == nil {
+		t.Errorf("NewRaftSetup bootstrapped a read replica")
+	}
+}
+
+func TestDiscoveryExcludesLeader(t *testing.T) {
+	t.Parallel()
+
+	storagePath := filepath.Join(t.TempDir(), "kv")
+	if _, err := NewRaftSetup(storagePath, "localhost", "0", "http://localhost:8080", WithDiscovery(StaticSeeds{"localhost:8080"}, 1)); err == nil {
+		t.Errorf("NewRaftSetup accepted both a leader and discovery")
+	}
+}
+
+func TestPreVote(t *testing.T) {
+	t.Parallel()
+
+	// raft.Config.PreVoteDisabled exists from github.com/hashicorp/raft
+	// v1.7.0, this won't compile against older versions.
+	for _, enabled := range []bool{true, false} {
+		var o options
+		WithPreVote(enabled)(&o)
+
+		settings := raft.DefaultConfig()
+		o.applyElectionSettings(settings)
+
+		if settings.PreVoteDisabled == enabled {
+			t.Errorf("WithPreVote(%t): Got PreVoteDisabled %t", enabled, settings.PreVoteDisabled)
+		}
+	}
+
+	var o options
+	settings := raft.DefaultConfig()
+	o.applyElectionSettings(settings)
+	if settings.PreVoteDisabled {
+		t.Errorf("Pre-vote is disabled by default")
+	}
+}
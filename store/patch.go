@@ -0,0 +1,69 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// mergePatch applies the JSON merge patch to the document doc, as described in
+// RFC 7386, and returns the resulting document.
+func mergePatch(doc, patch string) (string, error) {
+	target, err := decodeJSON(doc)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrNotJSON, err)
+	}
+
+	p, err := decodeJSON(patch)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrInvalidPatch, err)
+	}
+
+	merged, err := json.Marshal(mergeValue(target, p))
+	if err != nil {
+		return "", err
+	}
+
+	return string(merged), nil
+}
+
+func mergeValue(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = map[string]interface{}{}
+	}
+
+	for name, value := range p {
+		if value == nil {
+			delete(t, name)
+			continue
+		}
+
+		t[name] = mergeValue(t[name], value)
+	}
+
+	return t
+}
+
+// decodeJSON decodes s keeping numbers as written, so merging doesn't lose
+// the precision of large integers.
+func decodeJSON(s string) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader([]byte(s)))
+	dec.UseNumber()
+
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	if dec.More() {
+		return nil, fmt.Errorf("unexpected data after the JSON document")
+	}
+
+	return v, nil
+}
@@ -0,0 +1,106 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/raft"
+)
+
+func TestMergePatch(t *testing.T) {
+	t.Parallel()
+
+	// Examples from RFC 7386, appendix A
+	testCases := []struct {
+		doc   string
+		patch string
+		out   string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+		{`{"n":12345678901234567890}`, `{"m":1}`, `{"m":1,"n":12345678901234567890}`},
+	}
+
+	for _, test := range testCases {
+		got, err := mergePatch(test.doc, test.patch)
+		if err != nil {
+			t.Errorf("mergePatch(%s, %s) returned unexpected error: %s", test.doc, test.patch, err)
+			continue
+		}
+
+		if got != test.out {
+			t.Errorf("mergePatch(%s, %s): Got %s, expected %s", test.doc, test.patch, got, test.out)
+		}
+	}
+}
+
+func TestPatch(t *testing.T) {
+	cfg := newTestConfig(t)
+	ctx := context.Background()
+
+	if got, _, err := cfg.Patch(ctx, "doc", `{"a":1}`); err != nil || got != `{"a":1}` {
+		t.Fatalf("Patch of missing key returned %q (error: %v)", got, err)
+	}
+
+	if got, _, err := cfg.Patch(ctx, "doc", `{"b":2}`); err != nil || got != `{"a":1,"b":2}` {
+		t.Fatalf("Second Patch returned %q (error: %v)", got, err)
+	}
+
+	if got, _ := cfg.Get(ctx, "doc"); got != `{"a":1,"b":2}` {
+		t.Errorf("Got stored %q, expected merged document", got)
+	}
+
+	if _, _, err := cfg.Patch(ctx, "doc", `{"b":`); !errors.Is(err, ErrInvalidPatch) {
+		t.Errorf("Got error %v, expected %v", err, ErrInvalidPatch)
+	}
+
+	cfg.Set(ctx, "text", "not json")
+	if _, _, err := cfg.Patch(ctx, "text", `{"a":1}`); !errors.Is(err, ErrNotJSON) {
+		t.Errorf("Got error %v, expected %v", err, ErrNotJSON)
+	}
+
+	if got, _ := cfg.Get(ctx, "text"); got != "not json" {
+		t.Errorf("Failed patch changed the value to %q", got)
+	}
+}
+
+func TestPatchReplay(t *testing.T) {
+	// The document expired long ago by the local clock, but not yet at the
+	// time of the first patch
+	at := func(d time.Duration) string {
+		return strconv.FormatInt(time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC).Add(d).UnixNano(), 10)
+	}
+	f := newFSM(NewFileStore(filepath.Join(t.TempDir(), "data.json")), hclog.NewNullLogger())
+	f.Apply(&raft.Log{Index: 1, Data: []byte(`{"Action":"batch","Entries":[{"Key":"doc","Data":"eyJhIjoxfQ==","ExpiresAt":` + at(time.Minute) + `}]}`)})
+
+	testCases := []struct {
+		log  *raft.Log
+		want string
+	}{
+		{&raft.Log{Index: 2, Data: []byte(`{"Action":"patch","Key":"doc","Data":"eyJiIjoyfQ==","Now":` + at(30*time.Second) + `}`)}, `{"a":1,"b":2}`},
+		{&raft.Log{Index: 3, Data: []byte(`{"Action":"patch","Key":"doc","Data":"eyJjIjozfQ==","Now":` + at(2*time.Minute) + `}`)}, `{"c":3}`},
+	}
+	for _, test := range testCases {
+		if got := f.Apply(test.log); got != test.want {
+			t.Errorf("Log %d: got %v, expected %s", test.log.Index, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package store
+
+import (
+	"fmt"
+	"time"
+)
+
+// Persistence is the policy deciding when the FSM writes its in-memory data
+// to the data file. The Raft log and snapshots are always durable, the data
+// file only saves replaying them after a restart: a node losing writes that
+// weren't saved yet recovers them from the log. Saving more often costs more
+// disk writes but shortens the replay.
+type Persistence string
+
+const (
+	// PersistPeriodic saves the data every flush interval when it changed,
+	// the default.
+	PersistPeriodic Persistence = "periodic"
+
+	// PersistEveryWrite saves the data after every command, which is the
+	// slowest but never needs replaying more than the last command.
+	PersistEveryWrite Persistence = "every-write"
+
+	// PersistOnSnapshot only saves the data when Raft takes a snapshot, so
+	// writes never touch the data file.
+	PersistOnSnapshot Persistence = "on-snapshot-only"
+)
+
+// DefaultFlushInterval is how often PersistPeriodic saves the data.
+const DefaultFlushInterval = time.Second
+
+// ParsePersistence returns the Persistence named s.
+func ParsePersistence(s string) (Persistence, error) {
+	switch p := Persistence(s); p {
+	case PersistPeriodic, PersistEveryWrite, PersistOnSnapshot:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown persistence policy %q", s)
+	}
+}
@@ -0,0 +1,145 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/raft"
+)
+
+// setLog returns the log entry setting key to value.
+func setLog(t *testing.T, index uint64, key, value string) *raft.Log {
+	data, err := json.Marshal(Command{Action: "set", Key: key, Data: []byte(value)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &raft.Log{Index: index, Term: 1, Data: data}
+}
+
+// recovered returns a new FSM loading the data file of f through a store of
+// its own, as a node restarting after being killed.
+func recovered(t *testing.T, f *fsm) *fsm {
+	restarted := newFSM(NewFileStore(f.store.(*FileStore).Path()), hclog.NewNullLogger())
+	if err := restarted.load(context.Background()); err != nil {
+		t.Fatalf("load returned unexpected error: %s", err)
+	}
+
+	return restarted
+}
+
+func TestPersistEveryWrite(t *testing.T) {
+	f := newFSM(NewFileStore(filepath.Join(t.TempDir(), "data.json")), hclog.NewNullLogger())
+	f.persistence = PersistEveryWrite
+
+	f.Apply(setLog(t, 1, "k1", "v1"))
+	f.Apply(setLog(t, 2, "k2", "v2"))
+
+	restarted := recovered(t, f)
+	for _, key := range []string{"k1", "k2"} {
+		if e, _ := restarted.localGet(context.Background(), key); e.Value == "" {
+			t.Errorf("%s wasn't saved", key)
+		}
+	}
+}
+
+func TestPersistPeriodic(t *testing.T) {
+	f := newFSM(NewFileStore(filepath.Join(t.TempDir(), "data.json")), hclog.NewNullLogger())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		f.flushEvery(ctx, 10*time.Millisecond)
+		close(done)
+	}()
+
+	f.Apply(setLog(t, 1, "k1", "v1"))
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		if e, _ := recovered(t, f).localGet(ctx, "k1"); e.Value == "v1" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("k1 wasn't saved within a second")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Stopping saves what changed since the last tick
+	f.Apply(setLog(t, 2, "k2", "v2"))
+	cancel()
+	<-done
+
+	if e, _ := recovered(t, f).localGet(context.Background(), "k2"); e.Value != "v2" {
+		t.Errorf("k2 wasn't saved when stopping")
+	}
+}
+
+func TestPersistOnSnapshot(t *testing.T) {
+	ctx := context.Background()
+	f := newFSM(NewFileStore(filepath.Join(t.TempDir(), "data.json")), hclog.NewNullLogger())
+	f.persistence = PersistOnSnapshot
+
+	f.Apply(setLog(t, 1, "k1", "v1"))
+	if e, _ := recovered(t, f).localGet(ctx, "k1"); e.Value != "" {
+		t.Fatalf("k1 was saved before any snapshot")
+	}
+
+	snaps := raft.NewInmemSnapshotStore()
+	snap, err := f.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot returned unexpected error: %s", err)
+	}
+	sink, err := snaps.Create(raft.SnapshotVersionMax, 1, 1, raft.Configuration{}, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := snap.Persist(sink); err != nil {
+		t.Fatalf("Persist returned unexpected error: %s", err)
+	}
+	snap.Release()
+
+	f.Apply(setLog(t, 2, "k2", "v2"))
+
+	// Killed after the snapshot: the data file only has k1
+	restarted := recovered(t, f)
+	if e, _ := restarted.localGet(ctx, "k1"); e.Value != "v1" {
+		t.Errorf("k1 wasn't saved by the snapshot")
+	}
+	if e, _ := restarted.localGet(ctx, "k2"); e.Value != "" {
+		t.Errorf("k2 was saved without a snapshot")
+	}
+
+	// Raft restores the snapshot and replays the log after it
+	_, rc, err := snaps.Open(sink.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := restarted.Restore(rc); err != nil {
+		t.Fatalf("Restore returned unexpected error: %s", err)
+	}
+	restarted.Apply(setLog(t, 2, "k2", "v2"))
+
+	for _, key := range []string{"k1", "k2"} {
+		if e, _ := restarted.localGet(ctx, key); e.Value == "" {
+			t.Errorf("%s wasn't recovered", key)
+		}
+	}
+}
+
+func TestParsePersistence(t *testing.T) {
+	for _, s := range []string{"periodic", "every-write", "on-snapshot-only"} {
+		if p, err := ParsePersistence(s); err != nil || string(p) != s {
+			t.Errorf("ParsePersistence(%q) = %q, %v", s, p, err)
+		}
+	}
+
+	if _, err := ParsePersistence("never"); err == nil {
+		t.Errorf("ParsePersistence accepted an unknown policy")
+	}
+}
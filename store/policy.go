@@ -0,0 +1,122 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// WritePolicies are the rules the FSM enforces on every write. They are
+// checked inside fsm.Apply, so every node must run with the same policies or
+// their data diverges. A write breaking them fails with ErrPolicyViolation
+// and leaves the store untouched, even though its command is in the Raft log.
+// The zero value enforces nothing.
+type WritePolicies struct {
+	// RequireJSON rejects values that aren't valid JSON documents.
+	RequireJSON bool
+
+	// MaxValueSize rejects values longer than that many bytes, zero means
+	// no policy limit, leaving only the global MaxValueSize.
+	MaxValueSize int
+
+	// LowercaseKeys stores every key in lower case. Reads are looked up in
+	// lower case too, so keys are case insensitive.
+	LowercaseKeys bool
+}
+
+// ParseWritePolicies parses a comma separated list of policies: json,
+// max-size=<bytes> and lowercase-keys.
+func ParseWritePolicies(s string) (WritePolicies, error) {
+	var p WritePolicies
+	for _, policy := range strings.Split(s, ",") {
+		policy = strings.TrimSpace(policy)
+		name, arg := policy, ""
+		if i := strings.Index(policy, "="); i >= 0 {
+			name, arg = policy[:i], policy[i+1:]
+		}
+
+		switch name {
+		case "":
+		case "json":
+			p.RequireJSON = true
+		case "lowercase-keys":
+			p.LowercaseKeys = true
+		case "max-size":
+			size, err := strconv.Atoi(arg)
+			if err != nil || size <= 0 {
+				return WritePolicies{}, fmt.Errorf("invalid max-size %q", arg)
+			}
+			p.MaxValueSize = size
+		default:
+			return WritePolicies{}, fmt.Errorf("unknown write policy %q", name)
+		}
+	}
+
+	return p, nil
+}
+
+// key returns the key under which key is stored.
+func (p WritePolicies) key(key string) string {
+	if p.LowercaseKeys {
+		return strings.ToLower(key)
+	}
+
+	return key
+}
+
+// check fails if value can't be written at key.
+func (p WritePolicies) check(key, value string) error {
+	if p.MaxValueSize > 0 && len(value) > p.MaxValueSize {
+		return fmt.Errorf("%w: %q is %d bytes, maximum is %d", ErrPolicyViolation, key, len(value), p.MaxValueSize)
+	}
+
+	if p.RequireJSON && !json.Valid([]byte(value)) {
+		return fmt.Errorf("%w: %q isn't valid JSON", ErrPolicyViolation, key)
+	}
+
+	return nil
+}
+
+// normalize rewrites the keys of cmd and checks the values it writes.
+func (p WritePolicies) normalize(cmd *Command) error {
+	cmd.Key, cmd.To = p.key(cmd.Key), p.key(cmd.To)
+	for i := range cmd.Entries {
+		cmd.Entries[i].Key = p.key(cmd.Entries[i].Key)
+	}
+	for i := range cmd.Compares {
+		cmd.Compares[i].Key = p.key(cmd.Compares[i].Key)
+	}
+	for _, ops := range [][]TxnOp{cmd.Success, cmd.Failure} {
+		for i := range ops {
+			ops[i].Key, ops[i].End = p.key(ops[i].Key), p.key(ops[i].End)
+		}
+	}
+
+	switch cmd.Action {
+	case "set", "create", "cas":
+		return p.check(cmd.Key, cmd.value())
+	case "batch-if":
+		if err := p.check(cmd.Key, cmd.value()); err != nil {
+			return err
+		}
+		fallthrough
+	case "batch", "batch-nx":
+		for _, ce := range cmd.Entries {
+			if err := p.check(ce.Key, string(ce.Data)); err != nil {
+				return err
+			}
+		}
+	case "txn":
+		for _, op := range append(append([]TxnOp{}, cmd.Success...), cmd.Failure...) {
+			if op.Action != TxnPut {
+				continue
+			}
+			if err := p.check(op.Key, string(op.Value)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,76 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestParseWritePolicies(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		in    string
+		out   WritePolicies
+		valid bool
+	}{
+		{"", WritePolicies{}, true},
+		{"json", WritePolicies{RequireJSON: true}, true},
+		{"json, max-size=1024,lowercase-keys", WritePolicies{RequireJSON: true, MaxValueSize: 1024, LowercaseKeys: true}, true},
+		{"max-size=big", WritePolicies{}, false},
+		{"max-size=0", WritePolicies{}, false},
+		{"uppercase-keys", WritePolicies{}, false},
+	}
+
+	for _, test := range testCases {
+		got, err := ParseWritePolicies(test.in)
+		if (err == nil) != test.valid {
+			t.Errorf("%q: got error %v", test.in, err)
+		}
+
+		if got != test.out {
+			t.Errorf("%q: got %+v, expected %+v", test.in, got, test.out)
+		}
+	}
+}
+
+func TestWritePolicies(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.fsm.policies = WritePolicies{RequireJSON: true, MaxValueSize: 16, LowercaseKeys: true}
+	ctx := context.Background()
+
+	if err := cfg.Set(ctx, "Doc", `{"a": 1}`); err != nil {
+		t.Fatalf("Set returned unexpected error: %s", err)
+	}
+
+	if out, err := cfg.Get(ctx, "DOC"); err != nil || out != `{"a": 1}` {
+		t.Fatalf("Get returned out: %q, error: %v", out, err)
+	}
+
+	rejected := []struct {
+		name string
+		err  error
+	}{
+		{"not JSON", cfg.Set(ctx, "doc", "plain")},
+		{"too large", cfg.Set(ctx, "doc", `"0123456789abcdef"`)},
+		{"batch", func() error { _, err := cfg.SetBatch(ctx, map[string]string{"other": "1", "doc": "plain"}); return err }()},
+		{"patch", func() error { _, _, err := cfg.Patch(ctx, "doc", `{"b": "0123456789"}`); return err }()},
+	}
+	for _, test := range rejected {
+		if !errors.Is(test.err, ErrPolicyViolation) {
+			t.Errorf("%s: got error %v, expected %v", test.name, test.err, ErrPolicyViolation)
+		}
+	}
+
+	if out, err := cfg.Get(ctx, "doc"); err != nil || out != `{"a": 1}` {
+		t.Errorf("Rejected writes changed the value to %q, error: %v", out, err)
+	}
+
+	if exists, _ := cfg.Exists(ctx, []string{"other"}); exists["other"] {
+		t.Errorf("Rejected batch was partly written")
+	}
+
+	if err := cfg.Set(ctx, "__KV:lease", "{}"); !errors.Is(err, ErrReservedKey) {
+		t.Errorf("Got error %v, expected %v", err, ErrReservedKey)
+	}
+}
@@ -0,0 +1,108 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// Ready reports whether the FSM caught up with the log the node had on disk
+// when it started. Until then, Raft is still restoring the last snapshot or
+// replaying the log after it, and reads can miss keys that exist. A node
+// starting without a log is ready straight away; it stays ready once it is.
+func (cfg *Config) Ready() bool {
+	if atomic.LoadInt32(&cfg.ready) == 1 {
+		return true
+	}
+
+	if cfg.appliedIndex() < cfg.readyIndex {
+		return false
+	}
+	atomic.StoreInt32(&cfg.ready, 1)
+
+	return true
+}
+
+// checkReady fails with ErrNotReady when reads must wait for the node to be
+// ready and it isn't yet.
+func (cfg *Config) checkReady() error {
+	if !cfg.readsWaitReady || cfg.Ready() {
+		return nil
+	}
+
+	return fmt.Errorf("%w: applied index is %d, replaying up to %d", ErrNotReady, cfg.appliedIndex(), cfg.readyIndex)
+}
+
+// Health describes whether a node can serve traffic, as answered by
+// /healthz and /readyz.
+type Health struct {
+	// Ready is set when the node restored its data, is a member of the
+	// cluster, knows a leader and isn't draining: /readyz answers 200.
+	Ready bool `json:"ready"`
+
+	// Restored is set once the FSM caught up with the log the node had at
+	// startup, see Config.Ready.
+	Restored bool `json:"restored"`
+
+	// HasLeader is set when the node knows the leader of the cluster, a
+	// standalone node leads itself.
+	HasLeader bool `json:"has_leader"`
+
+	// Member is set when the node is in the Raft configuration, which
+	// reaches a joining node once the leader added it.
+	Member   bool `json:"member"`
+	Draining bool `json:"draining"`
+
+	// AppliedIndex is the index of the last command applied, and
+	// ReplayIndex the last index of the log the node had at startup.
+	AppliedIndex uint64 `json:"applied_index"`
+	ReplayIndex  uint64 `json:"replay_index"`
+
+	// LastLeaderContact is when a follower last heard from the leader,
+	// omitted on the leader and before the first contact.
+	LastLeaderContact *time.Time `json:"last_leader_contact,omitempty"`
+}
+
+// Health returns the health of this node.
+func (cfg *Config) Health() Health {
+	h := Health{
+		Restored:     cfg.Ready(),
+		HasLeader:    cfg.standalone() || cfg.leader() != "",
+		Member:       cfg.member(),
+		Draining:     cfg.Draining(),
+		AppliedIndex: cfg.appliedIndex(),
+		ReplayIndex:  cfg.readyIndex,
+
+		LastLeaderContact: cfg.lastLeaderContact(),
+	}
+	h.Ready = h.Restored && h.HasLeader && h.Member && !h.Draining
+
+	return h
+}
+
+// HealthHandler answers 200 as long as the process serves requests, for
+// liveness checks: a node waiting for a leader or restoring its data is
+// alive, restarting it wouldn't help. The body is the health of the node.
+func (cfg *Config) HealthHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(w).Encode(cfg.Health())
+	}
+}
+
+// ReadyHandler answers 200 once the node is ready, see Health, and 503 while
+// it restores its data, isn't a member, has no leader or is draining, so load balancers only
+// send it traffic it can serve.
+func (cfg *Config) ReadyHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h := cfg.Health()
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		if !h.Ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(h)
+	}
+}
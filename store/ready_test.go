@@ -0,0 +1,58 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReady(t *testing.T) {
+	cfg := newTestConfig(t)
+	ctx := context.Background()
+
+	// As if the node started with two more entries in its log to replay
+	cfg.readyIndex = cfg.appliedIndex() + 2
+	cfg.readsWaitReady = true
+
+	readyz := func() int {
+		recorder := httptest.NewRecorder()
+		cfg.ReadyHandler()(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		return recorder.Code
+	}
+
+	if cfg.Status().Ready || readyz() != http.StatusServiceUnavailable {
+		t.Errorf("the node is ready before replaying its log")
+	}
+	healthz := httptest.NewRecorder()
+	cfg.HealthHandler()(healthz, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	var h Health
+	json.NewDecoder(healthz.Body).Decode(&h)
+	if healthz.Code != http.StatusOK || h.Ready || h.Restored || !h.HasLeader || h.ReplayIndex != cfg.readyIndex {
+		t.Errorf("/healthz answered %d %+v, want 200 for a node replaying its log", healthz.Code, h)
+	}
+	if _, err := cfg.Get(ctx, "k"); !errors.Is(err, ErrNotReady) {
+		t.Errorf("Get before replay: Got error %v, expected %v", err, ErrNotReady)
+	}
+
+	cfg.Set(ctx, "k", "v1")
+	if cfg.Ready() {
+		t.Errorf("the node is ready halfway through its log")
+	}
+	cfg.Set(ctx, "k", "v2")
+
+	if !cfg.Status().Ready || readyz() != http.StatusOK {
+		t.Errorf("the node isn't ready after replaying its log")
+	}
+	if got, err := cfg.Get(ctx, "k"); err != nil || got != "v2" {
+		t.Errorf("Get after replay = %q, %v, expected v2", got, err)
+	}
+
+	// Draining takes the node out of the load balancers
+	cfg.Drain()
+	if readyz() != http.StatusServiceUnavailable {
+		t.Errorf("a draining node is ready")
+	}
+}
@@ -0,0 +1,84 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/hashicorp/raft"
+	raftbolt "github.com/hashicorp/raft-boltdb/v2"
+)
+
+// Shutdown stops the node. A leader first hands its leadership over to
+// another voter, so the cluster elects the next leader straight away rather
+// than after an election timeout, and with WithLeaveOnShutdown the node
+// leaves the cluster. Raft is then stopped, the data saved one last time and
+// the stores closed, releasing their files. Stop serving
+// requests before calling it, letting those in flight complete: the node
+// can't apply writes anymore once it returns.
+func (cfg *Config) Shutdown() error {
+	if !cfg.standalone() {
+		if cfg.state() == raft.Leader && cfg.hasOtherVoters() {
+			if err := cfg.raft.LeadershipTransfer().Error(); err != nil {
+				cfg.logger.Warn("couldn't transfer leadership", "error", err)
+			} else {
+				cfg.logger.Info("transferred leadership", "leader", cfg.leader())
+			}
+		}
+
+		if cfg.leaveOnShutdown {
+			if err := cfg.leave(); err != nil {
+				cfg.logger.Warn("couldn't leave the cluster", "error", err)
+			} else {
+				cfg.logger.Info("left the cluster")
+			}
+		}
+
+		if err := cfg.raft.Shutdown().Error(); err != nil {
+			return fmt.Errorf("shutting down Raft: %w", err)
+		}
+	}
+
+	// The first error is returned, the stores are closed regardless
+	var first error
+	keep := func(err error) {
+		if first == nil {
+			first = err
+		}
+	}
+	if err := cfg.fsm.flush(context.Background()); err != nil {
+		keep(fmt.Errorf("saving data: %w", err))
+	}
+	if closer, ok := cfg.fsm.store.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			keep(fmt.Errorf("closing data store: %w", err))
+		}
+	}
+	for _, s := range []*raftbolt.BoltStore{cfg.logStore, cfg.stableStore} {
+		if s == nil {
+			continue
+		}
+		if err := s.Close(); err != nil {
+			keep(fmt.Errorf("closing Raft store: %w", err))
+		}
+	}
+
+	return first
+}
+
+// hasOtherVoters reports whether the cluster has a voter other than this
+// node, which leadership can be transferred to.
+func (cfg *Config) hasOtherVoters() bool {
+	future := cfg.raft.GetConfiguration()
+	if err := future.Error(); err != nil {
+		return false
+	}
+
+	for _, server := range future.Configuration().Servers {
+		if server.ID != cfg.id && server.Suffrage == raft.Voter {
+			return true
+		}
+	}
+
+	return false
+}
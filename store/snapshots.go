@@ -0,0 +1,136 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// SnapshotInfo describes a snapshot held by the snapshot store.
+type SnapshotInfo struct {
+	ID    string `json:"id"`
+	Index uint64 `json:"index"`
+	Term  uint64 `json:"term"`
+	Size  int64  `json:"size"`
+
+	// CreatedAt is read from the ID given by the file snapshot store, it is
+	// omitted when the ID doesn't carry it.
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+}
+
+// Snapshots lists the snapshots kept by this node, newest first, and
+// reports whether one is being taken.
+func (cfg *Config) Snapshots() ([]SnapshotInfo, bool, error) {
+	// A standalone node has no log to compact
+	if cfg.snapshots == nil {
+		return []SnapshotInfo{}, false, nil
+	}
+
+	metas, err := cfg.snapshots.List()
+	if err != nil {
+		return nil, false, err
+	}
+
+	infos := make([]SnapshotInfo, 0, len(metas))
+	for _, meta := range metas {
+		infos = append(infos, snapshotInfo(meta))
+	}
+
+	return infos, atomic.LoadInt32(&cfg.fsm.snapshotting) > 0, nil
+}
+
+// Snapshot has the node take a Raft snapshot now, rather than waiting for
+// the snapshot threshold to be reached, and describes it. It fails with
+// ErrNothingToCompact when nothing was applied since the last snapshot.
+func (cfg *Config) Snapshot() (SnapshotInfo, error) {
+	if cfg.standalone() {
+		return SnapshotInfo{}, ErrStandalone
+	}
+
+	// Raft snapshots again when only its own entries were appended
+	last, _ := strconv.ParseUint(cfg.raft.Stats()["last_snapshot_index"], 10, 64)
+	if cfg.appliedIndex() <= last {
+		return SnapshotInfo{}, ErrNothingToCompact
+	}
+
+	future := cfg.raft.Snapshot()
+	if err := future.Error(); errors.Is(err, raft.ErrNothingNewToSnapshot) {
+		return SnapshotInfo{}, ErrNothingToCompact
+	} else if err != nil {
+		return SnapshotInfo{}, fmt.Errorf("taking snapshot: %w", err)
+	}
+
+	meta, snapshot, err := future.Open()
+	if err != nil {
+		return SnapshotInfo{}, fmt.Errorf("opening snapshot: %w", err)
+	}
+	snapshot.Close()
+	cfg.logger.Info("took snapshot", "id", meta.ID, "index", meta.Index)
+
+	return snapshotInfo(meta), nil
+}
+
+func snapshotInfo(meta *raft.SnapshotMeta) SnapshotInfo {
+	info := SnapshotInfo{ID: meta.ID, Index: meta.Index, Term: meta.Term, Size: meta.Size}
+
+	// File snapshots are named <term>-<index>-<unix milliseconds>
+	parts := strings.Split(meta.ID, "-")
+	if len(parts) == 3 {
+		if msec, err := strconv.ParseInt(parts[2], 10, 64); err == nil {
+			createdAt := time.Unix(0, msec*int64(time.Millisecond)).UTC()
+			info.CreatedAt = &createdAt
+		}
+	}
+
+	return info
+}
+
+// SnapshotsHandler serves the snapshots of the node it is sent to.
+func (cfg *Config) SnapshotsHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		jw := json.NewEncoder(w)
+
+		snapshots, inProgress, err := cfg.Snapshots()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			jw.Encode(map[string]string{"error": err.Error()})
+
+			return
+		}
+
+		jw.Encode(struct {
+			InProgress bool           `json:"in_progress"`
+			Snapshots  []SnapshotInfo `json:"snapshots"`
+		}{inProgress, snapshots})
+	}
+}
+
+// SnapshotHandler has the node answering the request, the leader unless it
+// is pinned to the node with local=true, take a snapshot and answers with its
+// SnapshotInfo.
+func (cfg *Config) SnapshotHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		jw := json.NewEncoder(w)
+
+		snapshot, err := cfg.Snapshot()
+		switch {
+		case errors.Is(err, ErrStandalone), errors.Is(err, ErrNothingToCompact):
+			w.WriteHeader(http.StatusConflict)
+			jw.Encode(map[string]string{"error": err.Error()})
+		case err != nil:
+			w.WriteHeader(http.StatusInternalServerError)
+			jw.Encode(map[string]string{"error": err.Error()})
+		default:
+			jw.Encode(snapshot)
+		}
+	}
+}
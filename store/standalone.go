@@ -0,0 +1,136 @@
+package store
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/google/uuid"
+	"github.com/hashicorp/raft"
+)
+
+// standaloneState is the state reported by a standalone node.
+const standaloneState = "Standalone"
+
+// localLog numbers the commands of a standalone node, which applies them
+// straight to its FSM instead of replicating them.
+type localLog struct {
+	mu    sync.Mutex
+	index uint64
+}
+
+// NewStandalone builds a single node store without Raft, for development: it
+// serves the same API as a cluster node, but commands are applied straight to
+// the FSM, nothing is replicated and there is no log to recover writes the
+// data file missed. The data file is the only copy of the data, so the
+// on-snapshot-only persistence, which would never write it, is refused.
+func NewStandalone(storagePath string, opts ...Option) (*Config, error) {
+	o := newOptions(opts)
+	cfg, err := newConfig(&o)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.readReplica {
+		return nil, fmt.Errorf("a standalone node can't be a read replica")
+	}
+	if o.store == nil && o.backend == BackendMemory {
+		return nil, fmt.Errorf("a standalone node has no log, backend %q would lose the data on restart", o.backend)
+	}
+	if o.persistence == PersistOnSnapshot {
+		return nil, fmt.Errorf("a standalone node never snapshots, persistence %q would never save the data", o.persistence)
+	}
+
+	cfg.id = raft.ServerID(uuid.New().URN())
+	cfg.local = &localLog{}
+
+	if err := os.MkdirAll(storagePath, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("setting up storage dire: %w", err)
+	}
+
+	o.defaultPaths(storagePath)
+	if err := prepareFile(o.dataFile); err != nil {
+		return nil, fmt.Errorf("setting up storage: %w", err)
+	}
+
+	if err := cfg.setupFSM(&o); err != nil {
+		return nil, err
+	}
+	// Revisions carry on from the ones of the data file
+	cfg.local.index = cfg.fsm.lastRevision()
+
+	go cfg.purgeExpired()
+
+	cfg.logger.Warn("running standalone, writes aren't replicated")
+
+	return cfg, nil
+}
+
+// standalone reports whether the node runs without Raft.
+func (cfg *Config) standalone() bool {
+	return cfg.local != nil
+}
+
+// applyLocally applies the command b to the FSM of a standalone node and
+// returns its response and index. Commands are applied one at a time, in the
+// order of their index, as Raft would.
+func (cfg *Config) applyLocally(b []byte) (interface{}, uint64) {
+	cfg.local.mu.Lock()
+	defer cfg.local.mu.Unlock()
+
+	index := cfg.local.index + 1
+	resp := cfg.fsm.Apply(&raft.Log{Index: index, Type: raft.LogCommand, Data: b})
+	atomic.StoreUint64(&cfg.local.index, index)
+
+	return resp, index
+}
+
+// state returns the Raft state of the node, a standalone node always leads.
+func (cfg *Config) state() raft.RaftState {
+	if cfg.standalone() {
+		return raft.Leader
+	}
+
+	return cfg.raft.State()
+}
+
+// leader returns the Raft address of the leader, empty when there is none or
+// the node is standalone.
+func (cfg *Config) leader() raft.ServerAddress {
+	if cfg.standalone() {
+		return ""
+	}
+
+	return cfg.raft.Leader()
+}
+
+// appliedIndex returns the index of the last command applied to the FSM.
+func (cfg *Config) appliedIndex() uint64 {
+	if cfg.standalone() {
+		return atomic.LoadUint64(&cfg.local.index)
+	}
+
+	return cfg.raft.AppliedIndex()
+}
+
+// lastIndex returns the index of the last command written to the log. A
+// standalone node has no log, its commands are applied as they are written.
+func (cfg *Config) lastIndex() uint64 {
+	if cfg.standalone() {
+		return cfg.appliedIndex()
+	}
+
+	return cfg.raft.LastIndex()
+}
+
+// commitIndex returns the index of the last log entry known to be committed.
+func (cfg *Config) commitIndex() uint64 {
+	if cfg.standalone() {
+		return cfg.appliedIndex()
+	}
+
+	index, _ := strconv.ParseUint(cfg.raft.Stats()["commit_index"], 10, 64)
+	return index
+}
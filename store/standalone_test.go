@@ -0,0 +1,96 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+func TestStandalone(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	cfg, err := NewStandalone(dir, WithLogger(hclog.NewNullLogger()), WithPersistence(PersistEveryWrite, 0))
+	if err != nil {
+		t.Fatalf("NewStandalone returned unexpected error: %s", err)
+	}
+
+	first, err := cfg.SetEntry(ctx, "k1", Entry{Value: "v1"})
+	if err != nil {
+		t.Fatalf("SetEntry returned unexpected error: %s", err)
+	}
+	second, err := cfg.SetEntry(ctx, "k2", Entry{Value: "v2"})
+	if err != nil {
+		t.Fatalf("SetEntry returned unexpected error: %s", err)
+	}
+	if second != first+1 {
+		t.Errorf("indexes are %d then %d, want consecutive", first, second)
+	}
+
+	if err := cfg.WaitForIndex(ctx, second, 0); err != nil {
+		t.Errorf("WaitForIndex returned unexpected error: %s", err)
+	}
+	if v, err := cfg.Get(ctx, "k1"); err != nil || v != "v1" {
+		t.Errorf("Get(k1) = %q, %v, want v1", v, err)
+	}
+
+	s := cfg.Status()
+	if s.State != standaloneState || s.Leader != "" || s.Term != 0 || s.AppliedIndex != second {
+		t.Errorf("Status() = %+v", s)
+	}
+
+	// FSM errors still reach the caller
+	if _, _, err := cfg.DeleteAndGet(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("DeleteAndGet(missing) returned %v, want ErrNotFound", err)
+	}
+
+	// The data file is all a restarted node has
+	restarted, err := NewStandalone(dir, WithLogger(hclog.NewNullLogger()))
+	if err != nil {
+		t.Fatalf("NewStandalone returned unexpected error: %s", err)
+	}
+	if v, err := restarted.Get(ctx, "k2"); err != nil || v != "v2" {
+		t.Errorf("Get(k2) after restart = %q, %v, want v2", v, err)
+	}
+}
+
+func TestStandaloneRejectsOnSnapshotPersistence(t *testing.T) {
+	_, err := NewStandalone(t.TempDir(), WithLogger(hclog.NewNullLogger()), WithPersistence(PersistOnSnapshot, 0))
+	if err == nil {
+		t.Errorf("NewStandalone accepted the on-snapshot-only persistence")
+	}
+}
+
+func TestStandaloneShutdown(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	opts := []Option{
+		WithLogger(hclog.NewNullLogger()),
+		WithBackend(BackendBolt),
+		WithPersistence(PersistPeriodic, time.Hour),
+	}
+
+	cfg, err := NewStandalone(dir, opts...)
+	if err != nil {
+		t.Fatalf("NewStandalone returned unexpected error: %s", err)
+	}
+	if err := cfg.Set(ctx, "k", "v"); err != nil {
+		t.Fatalf("Set returned unexpected error: %s", err)
+	}
+	if err := cfg.Shutdown(); err != nil {
+		t.Fatalf("Shutdown returned unexpected error: %s", err)
+	}
+
+	// The data was saved before the next periodic save and the bolt file
+	// released
+	reopened, err := NewStandalone(dir, opts...)
+	if err != nil {
+		t.Fatalf("NewStandalone after Shutdown returned unexpected error: %s", err)
+	}
+	if got, err := reopened.Get(ctx, "k"); err != nil || got != "v" {
+		t.Errorf("Get after restart = %q, %v, want v", got, err)
+	}
+}
@@ -0,0 +1,166 @@
+package store
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// Status describes a node as it sees itself.
+type Status struct {
+	ID    string `json:"id"`
+	State string `json:"state"`
+
+	// Leader is the HTTP address of the leader, empty when there is none,
+	// and LeaderID its ID.
+	Leader   string `json:"leader"`
+	LeaderID string `json:"leader_id"`
+
+	// ReadOnly is set on read replicas, which serve reads but never
+	// writes.
+	ReadOnly bool `json:"read_only"`
+
+	// Draining is set while the node rejects client requests before being
+	// removed, see Config.Drain.
+	Draining bool `json:"draining"`
+
+	// Ready is set once the node caught up with the log it had at
+	// startup, see Config.Ready.
+	Ready bool `json:"ready"`
+
+	Term         uint64 `json:"term"`
+	CommitIndex  uint64 `json:"commit_index"`
+	AppliedIndex uint64 `json:"applied_index"`
+	LastIndex    uint64 `json:"last_index"`
+
+	// LastLeaderContact is when a follower last heard from the leader,
+	// omitted on the leader and before the first contact.
+	LastLeaderContact *time.Time `json:"last_leader_contact,omitempty"`
+
+	// LeadershipAcquired and LeadershipLost count the leadership changes of
+	// the node since it started, LastLeadershipChange is omitted until the
+	// first one.
+	LeadershipAcquired   uint64     `json:"leadership_acquired"`
+	LeadershipLost       uint64     `json:"leadership_lost"`
+	LastLeadershipChange *time.Time `json:"last_leadership_change,omitempty"`
+
+	// LastCompaction is when the node last compacted its log, omitted until
+	// the first time, and CompactionReclaimedBytes the bytes of the log
+	// store that compaction freed, see Config.Compact.
+	LastCompaction           *time.Time `json:"last_compaction,omitempty"`
+	CompactionReclaimedBytes int64      `json:"compaction_reclaimed_bytes"`
+
+	// Peers are the members of the cluster, this node included, as in the
+	// Raft configuration this node knows. Standalone nodes have none.
+	Peers []PeerStatus `json:"peers,omitempty"`
+
+	// Followers are only reported by the leader.
+	Followers []FollowerStatus `json:"followers,omitempty"`
+}
+
+// PeerStatus describes a member of the cluster.
+type PeerStatus struct {
+	ID string `json:"id"`
+
+	// Address is the HTTP address of the member, RaftAddress the one of its
+	// Raft transport.
+	Address     string `json:"address"`
+	RaftAddress string `json:"raft_address"`
+
+	// Voter is set on the members taking part in elections and quorums, it
+	// is not on read replicas.
+	Voter  bool `json:"voter"`
+	Leader bool `json:"leader"`
+}
+
+// Status returns the status of this node.
+func (cfg *Config) Status() Status {
+	s := Status{
+		ID:           string(cfg.id),
+		State:        cfg.state().String(),
+		ReadOnly:     cfg.readReplica,
+		Draining:     cfg.Draining(),
+		Ready:        cfg.Ready(),
+		Term:         cfg.Term(),
+		CommitIndex:  cfg.commitIndex(),
+		AppliedIndex: cfg.appliedIndex(),
+		LastIndex:    cfg.lastIndex(),
+		Peers:        cfg.peers(),
+		Followers:    cfg.followers(),
+
+		LastLeaderContact: cfg.lastLeaderContact(),
+
+		LeadershipAcquired:   atomic.LoadUint64(&cfg.leadership.acquired),
+		LeadershipLost:       atomic.LoadUint64(&cfg.leadership.lost),
+		LastLeadershipChange: cfg.leadership.lastChangeTime(),
+
+		LastCompaction:           cfg.compaction.lastCompactionTime(),
+		CompactionReclaimedBytes: atomic.LoadInt64(&cfg.compaction.reclaimed),
+	}
+
+	if cfg.standalone() {
+		s.State = standaloneState
+	}
+
+	if ldr := cfg.leaderURL(); ldr != nil {
+		s.Leader = ldr.String()
+	}
+	for _, p := range s.Peers {
+		if p.Leader {
+			s.LeaderID = p.ID
+		}
+	}
+
+	return s
+}
+
+// peers returns the members of the cluster in the Raft configuration, nil on
+// a standalone node or when the configuration can't be read.
+func (cfg *Config) peers() []PeerStatus {
+	if cfg.standalone() {
+		return nil
+	}
+
+	future := cfg.raft.GetConfiguration()
+	if err := future.Error(); err != nil {
+		cfg.logger.Error("couldn't get configuration", "error", err)
+		return nil
+	}
+
+	_, leaderID := cfg.raft.LeaderWithID()
+	var peers []PeerStatus
+	for _, server := range future.Configuration().Servers {
+		peers = append(peers, PeerStatus{
+			ID:          string(server.ID),
+			Address:     cfg.memberURL(server.ID, server.Address).String(),
+			RaftAddress: string(server.Address),
+			Voter:       server.Suffrage == raft.Voter,
+			Leader:      server.ID == leaderID,
+		})
+	}
+
+	return peers
+}
+
+// Term returns the current Raft term of this node, always 0 when it is
+// standalone.
+func (cfg *Config) Term() uint64 {
+	if cfg.standalone() {
+		return 0
+	}
+
+	term, _ := strconv.ParseUint(cfg.raft.Stats()["term"], 10, 64)
+	return term
+}
+
+// StatusHandler serves the status of the node it is sent to.
+func (cfg *Config) StatusHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(w).Encode(cfg.Status())
+	}
+}
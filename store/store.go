@@ -3,74 +3,589 @@ package store
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
-	"math/rand"
 	"net"
 	"net/http"
-	"net/http/httputil"
+	"net/url"
 	"os"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
-	"github.com/google/uuid"
 	hclog "github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/raft"
-	raftbolt "github.com/hashicorp/raft-boltdb"
-	// log "github.com/sirupsen/logrus"
-)
-
-var (
-	log = hclog.Default()
+	raftbolt "github.com/hashicorp/raft-boltdb/v2"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type Config struct {
-	raft *raft.Raft
-	fsm  *fsm
+	raft   *raft.Raft
+	fsm    *fsm
+	logger hclog.Logger
+
+	id          raft.ServerID
+	readReplica bool
+
+	// followerMode is how requests for the leader are answered while
+	// following, and followerReads whether reads are served locally
+	// meanwhile.
+	followerMode  FollowerMode
+	followerReads bool
+
+	// httpAddress is the URL of the HTTP API of the node recorded in the
+	// cluster metadata, see WithHTTPAddress.
+	httpAddress string
+
+	// draining is 1 while the node is in drain mode, see Drain.
+	draining int32
+
+	// leaveOnShutdown is set when Shutdown removes the node from the
+	// cluster.
+	leaveOnShutdown bool
+
+	// ready is 1 once the FSM applied the log up to readyIndex, the last
+	// index on disk at startup, see Ready. With readsWaitReady, reads fail
+	// until then.
+	ready          int32
+	readyIndex     uint64
+	readsWaitReady bool
+
+	// hotKeys counts the accesses to keys, it is nil when tracking is off.
+	hotKeys *hotKeys
+
+	// contacts tracks the followers the leader fails to reach.
+	contacts *contactTracker
+
+	leadership leadership
+	compaction compaction
+
+	// httpClient sends the requests to the other nodes, see client.
+	httpClient *http.Client
+
+	// https is set when the HTTP API of the nodes is served over HTTPS.
+	https bool
+
+	// auth holds the tokens accepted by the node, it is nil when
+	// authentication is off.
+	auth *auth
+
+	// keyAllocator is how Create picks keys.
+	keyAllocator KeyAllocator
+
+	keySeparator   string
+	reservedPrefix string
+
+	snapshots raft.SnapshotStore
+
+	// local applies the commands of a standalone node, it is nil when
+	// they go through Raft.
+	local *localLog
+
+	// slots limits the number of commands being applied at once, it is nil
+	// when there is no limit. inflight counts them either way.
+	slots    chan struct{}
+	inflight int64
+
+	stableStore     *raftbolt.BoltStore
+	stableStorePath string
+	logStore        *raftbolt.BoltStore
+	logStorePath    string
 }
 
 type Command struct {
 	Action string
 	Key    string
-	Value  string
+
+	// Value is only read from log entries written before Data existed: JSON
+	// strings can't carry arbitrary bytes, so values now travel in Data.
+	Value       string `json:",omitempty"`
+	Data        []byte `json:",omitempty"`
+	ContentType string `json:",omitempty"`
+
+	// UserMetadata is the user metadata of the value of a set, cas or
+	// create command.
+	UserMetadata map[string]string `json:",omitempty"`
+
+	// To is the destination key of a rename or copy, and Overwrite whether it may
+	// replace an existing key.
+	To        string `json:",omitempty"`
+	Overwrite bool   `json:",omitempty"`
+
+	// Metadata is set when a copy keeps the content type and expiration
+	// of the source.
+	Metadata bool `json:",omitempty"`
+
+	// Entries are the values written by a batch command.
+	Entries []CommandEntry `json:",omitempty"`
+
+	// Expected is the value Key must hold for a batch-if or cas command to
+	// write, Data then holds the next value of Key.
+	Expected string `json:",omitempty"`
+
+	// Delta is what an incr command adds to the integer at Key.
+	Delta int64 `json:",omitempty"`
+
+	// Sequence is set when a create command stores its value under Key
+	// followed by the next number of the sequence of Key.
+	Sequence bool `json:",omitempty"`
+
+	// Now is the time, in Unix nanoseconds, at which an expire command
+	// purges expired entries. It is set by the leader so every node purges
+	// the same entries. Lease and lock commands count their expiration
+	// from it, and check against it whether leases and locks expired. An
+	// incr, patch, cas, batch-if, rename or copy command checks against it
+	// whether Key expired, a rename or copy whether To did, and a batch-nx
+	// or create command whether the keys it writes did. A delete command
+	// returns the entry it removes unless it expired at it. A txn command
+	// compares, reads and deletes the entries unexpired at it.
+	Now int64 `json:",omitempty"`
+
+	// Lease is the lease of a lease, lock or unlock command, or the lease
+	// a set command attaches Key to. TTL is the TTL of a lease-grant.
+	Lease uint64        `json:",omitempty"`
+	TTL   time.Duration `json:",omitempty"`
+
+	// Compares are the conditions of a txn command, which runs the Success
+	// operations when they all hold and the Failure ones otherwise.
+	Compares []TxnCompare `json:",omitempty"`
+	Success  []TxnOp      `json:",omitempty"`
+	Failure  []TxnOp      `json:",omitempty"`
+
+	// Principal is the name of the principal the write was authenticated
+	// as, empty when authentication is off, for the audit log.
+	Principal string `json:",omitempty"`
+
+	// Trace is the trace context of the write, so the span of the FSM
+	// applying the command joins the trace of the request.
+	Trace map[string]string `json:",omitempty"`
+}
+
+// CommandEntry is a value written by a batch command.
+type CommandEntry struct {
+	Key  string
+	Data []byte
+
+	// ExpiresAt is the expiration time of the entry in Unix nanoseconds.
+	ExpiresAt int64 `json:",omitempty"`
+}
+
+// entries returns the entries written by a batch command by key.
+func (c Command) entries() map[string]Entry {
+	entries := make(map[string]Entry, len(c.Entries))
+	for _, ce := range c.Entries {
+		e := Entry{Value: string(ce.Data)}
+		if ce.ExpiresAt != 0 {
+			e.ExpiresAt = time.Unix(0, ce.ExpiresAt)
+		}
+		entries[ce.Key] = e
+	}
+
+	return entries
+}
+
+// value returns the value carried by the command.
+func (c Command) value() string {
+	if c.Data != nil {
+		return string(c.Data)
+	}
+
+	return c.Value
+}
+
+// time returns Now, the time the leader wrote the command at: the FSM never
+// reads its own clock, so every node, and every replay of the log, decides
+// alike what expired. Commands written without it see nothing expired.
+func (c Command) time() time.Time {
+	return time.Unix(0, c.Now)
 }
 
 func (cfg *Config) Set(ctx context.Context, key, value string) error {
-	if cfg.raft.State() != raft.Leader {
-		return fmt.Errorf("not leader")
+	_, err := cfg.SetEntry(ctx, key, Entry{Value: value})
+	return err
+}
+
+// SetEntry stores e, the value and its metadata, at the specified key and
+// returns the Raft log index of the write
+func (cfg *Config) SetEntry(ctx context.Context, key string, e Entry) (_ uint64, err error) {
+	ctx, span := startSpan(ctx, "Config.SetEntry", attribute.String("kv.key", key))
+	defer func() { endSpan(span, err) }()
+
+	if err := cfg.validateKey(key); err != nil {
+		return 0, err
+	}
+
+	if err := validateValue(e.Value); err != nil {
+		return 0, err
+	}
+
+	if err := validateMetadata(e.Metadata); err != nil {
+		return 0, err
+	}
+
+	if err := cfg.writable(); err != nil {
+		return 0, err
+	}
+
+	_, index, err := cfg.apply(ctx, Command{
+		Action:       "set",
+		Key:          key,
+		Data:         []byte(e.Value),
+		ContentType:  e.ContentType,
+		UserMetadata: e.Metadata,
+	})
+	return index, err
+}
+
+// Patch applies a JSON merge patch (RFC 7386) to the document stored at key
+// and returns the merged document along with the Raft log index of the write.
+// The merge happens inside the FSM, so concurrent patches of different fields
+// don't overwrite each other.
+func (cfg *Config) Patch(ctx context.Context, key, patch string) (string, uint64, error) {
+	if err := cfg.validateKey(key); err != nil {
+		return "", 0, err
+	}
+
+	if !json.Valid([]byte(patch)) {
+		return "", 0, fmt.Errorf("%w: patch isn't valid JSON", ErrInvalidPatch)
+	}
+
+	if err := cfg.writable(); err != nil {
+		return "", 0, err
+	}
+
+	resp, index, err := cfg.apply(ctx, Command{Action: "patch", Key: key, Data: []byte(patch), Now: time.Now().UnixNano()})
+	if err != nil {
+		return "", 0, err
+	}
+
+	return resp.(string), index, nil
+}
+
+// apply replicates cmd through Raft and returns the response of the FSM and
+// the log index of the command, turning the response into an error when the
+// FSM failed to apply the command.
+func (cfg *Config) apply(ctx context.Context, cmd Command) (_ interface{}, _ uint64, err error) {
+	ctx, span := startSpan(ctx, "raft.Apply", attribute.String("kv.action", cmd.Action))
+	defer func() { endSpan(span, err) }()
+
+	injectTrace(ctx, &cmd)
+	if p, ok := PrincipalFrom(ctx); ok {
+		cmd.Principal = p.Name
+	}
+	b, err := json.Marshal(cmd)
+	if err != nil {
+		return nil, 0, fmt.Errorf("marshaling command: %w", err)
+	}
+
+	release, err := cfg.acquire()
+	if err != nil {
+		return nil, 0, err
+	}
+	defer release()
+
+	var resp interface{}
+	var index uint64
+	if cfg.standalone() {
+		resp, index = cfg.applyLocally(b)
+	} else {
+		l := cfg.raft.Apply(b, time.Minute)
+		if err := l.Error(); err != nil {
+			return nil, 0, err
+		}
+		resp, index = l.Response(), l.Index()
+	}
+
+	span.SetAttributes(attribute.Int64("raft.index", int64(index)))
+	if err, ok := resp.(error); ok {
+		return nil, 0, err
 	}
 
-	cmd, err := json.Marshal(Command{Action: "set", Key: key, Value: value})
+	return resp, index, nil
+}
+
+// acquire takes one of the slots of the commands being applied, failing with
+// ErrTooManyWrites rather than waiting when they are all taken. The returned
+// function gives the slot back.
+func (cfg *Config) acquire() (func(), error) {
+	if cfg.slots != nil {
+		select {
+		case cfg.slots <- struct{}{}:
+		default:
+			return nil, ErrTooManyWrites
+		}
+	}
+	atomic.AddInt64(&cfg.inflight, 1)
+
+	return func() {
+		atomic.AddInt64(&cfg.inflight, -1)
+		if cfg.slots != nil {
+			<-cfg.slots
+		}
+	}, nil
+}
+
+// Delete removes the specified key and returns the Raft log index of the write
+func (cfg *Config) Delete(ctx context.Context, key string) (_ uint64, err error) {
+	ctx, span := startSpan(ctx, "Config.Delete", attribute.String("kv.key", key))
+	defer func() { endSpan(span, err) }()
+
+	if err := cfg.validateKey(key); err != nil {
+		return 0, err
+	}
+
+	if err := cfg.writable(); err != nil {
+		return 0, err
+	}
+
+	_, index, err := cfg.apply(ctx, Command{Action: "delete", Key: key, Now: time.Now().UnixNano()})
+
+	return index, err
+}
+
+// DeleteAndGet removes the specified key and returns the entry it held along
+// with the Raft log index of the write. The entry is read by the FSM in the
+// same step that removes it, so no other write can slip in between. It fails
+// with ErrNotFound if the key doesn't exist.
+func (cfg *Config) DeleteAndGet(ctx context.Context, key string) (_ Entry, _ uint64, err error) {
+	ctx, span := startSpan(ctx, "Config.DeleteAndGet", attribute.String("kv.key", key))
+	defer func() { endSpan(span, err) }()
+
+	if err := cfg.validateKey(key); err != nil {
+		return Entry{}, 0, err
+	}
+
+	if err := cfg.writable(); err != nil {
+		return Entry{}, 0, err
+	}
+
+	resp, index, err := cfg.apply(ctx, Command{Action: "delete", Key: key, Now: time.Now().UnixNano()})
 	if err != nil {
-		return fmt.Errorf("marshaling command: %w", err)
+		return Entry{}, 0, err
+	}
+
+	e, ok := resp.(Entry)
+	if !ok {
+		return Entry{}, index, fmt.Errorf("%w: %q", ErrNotFound, key)
 	}
 
-	l := cfg.raft.Apply(cmd, time.Minute)
-	return l.Error()
+	return e, index, nil
 }
 
-func (cfg *Config) Delete(ctx context.Context, key string) error {
-	if cfg.raft.State() != raft.Leader {
-		return fmt.Errorf("not leader")
+// DeletePrefix removes every key starting with prefix in a single Raft log
+// entry, so the keys are all removed at once and no write can add a key with
+// the prefix while they are. It returns the number of keys removed and the
+// log index of the write. Keys are matched as stored, byte for byte, not in
+// the encoding of the data file. Keys of the reserved space are never removed.
+func (cfg *Config) DeletePrefix(ctx context.Context, prefix string) (int, uint64, error) {
+	if err := cfg.validateKey(prefix); err != nil {
+		return 0, 0, err
 	}
 
-	cmd, err := json.Marshal(Command{Action: "delete", Key: "key"})
+	if err := cfg.writable(); err != nil {
+		return 0, 0, err
+	}
+
+	resp, index, err := cfg.apply(ctx, Command{Action: "delete-prefix", Key: prefix})
 	if err != nil {
-		return fmt.Errorf("marshalling command: %w", err)
+		return 0, 0, err
+	}
+
+	n, _ := resp.(int)
+	return n, index, nil
+}
+
+// Rename atomically moves the value at from, along with its metadata and
+// expiration, to the key to. It fails with ErrNotFound if from doesn't exist
+// and, unless overwrite is set, with ErrKeyExists if to does.
+func (cfg *Config) Rename(ctx context.Context, from, to string, overwrite bool) (uint64, error) {
+	for _, key := range []string{from, to} {
+		if err := cfg.validateKey(key); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := cfg.writable(); err != nil {
+		return 0, err
+	}
+
+	_, index, err := cfg.apply(ctx, Command{Action: "rename", Key: from, To: to, Overwrite: overwrite, Now: time.Now().UnixNano()})
+	return index, err
+}
+
+// Copy atomically duplicates the value at from to the key to, along with its
+// metadata and expiration if metadata is set. The copy happens inside the FSM,
+// so it is the committed value that gets copied. It fails like Rename.
+func (cfg *Config) Copy(ctx context.Context, from, to string, overwrite, metadata bool) (uint64, error) {
+	for _, key := range []string{from, to} {
+		if err := cfg.validateKey(key); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := cfg.writable(); err != nil {
+		return 0, err
+	}
+
+	_, index, err := cfg.apply(ctx, Command{Action: "copy", Key: from, To: to, Overwrite: overwrite, Metadata: metadata, Now: time.Now().UnixNano()})
+	return index, err
+}
+
+// WaitForIndex blocks until the local FSM has applied the Raft log up to
+// index, so a read that follows sees every write up to that index. It returns
+// ErrIndexTimeout if that takes longer than timeout.
+func (cfg *Config) WaitForIndex(ctx context.Context, index uint64, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(5 * time.Millisecond)
+	defer ticker.Stop()
+
+	for cfg.appliedIndex() < index {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: applied index is %d, waiting for %d", ErrIndexTimeout, cfg.appliedIndex(), index)
+		case <-ticker.C:
+		}
 	}
 
-	l := cfg.raft.Apply(cmd, time.Minute)
-	return l.Error()
+	return nil
+}
+
+// writable fails unless this node can accept writes: it must be the leader,
+// which a read replica never is.
+func (cfg *Config) writable() error {
+	if cfg.readReplica {
+		return ErrReadOnly
+	}
+
+	if cfg.state() != raft.Leader {
+		return cfg.notLeader()
+	}
+
+	return nil
+}
+
+// notLeader builds the error returned by writes attempted on a follower.
+func (cfg *Config) notLeader() error {
+	ldr := cfg.leaderURL()
+	if ldr == nil {
+		return &NotLeaderError{}
+	}
+
+	return &NotLeaderError{Leader: ldr.String()}
 }
 
 func (cfg *Config) Get(ctx context.Context, key string) (string, error) {
+	e, err := cfg.GetEntry(ctx, key)
+	return e.Value, err
+}
+
+// GetEntry gets the value and metadata at the specified key
+func (cfg *Config) GetEntry(ctx context.Context, key string) (_ Entry, err error) {
+	ctx, span := startSpan(ctx, "Config.GetEntry", attribute.String("kv.key", key))
+	defer func() { endSpan(span, err) }()
+
+	if err := cfg.validateKey(key); err != nil {
+		return Entry{}, err
+	}
+	if err := cfg.checkReady(); err != nil {
+		return Entry{}, err
+	}
+	cfg.recordReads(key)
+
 	return cfg.fsm.localGet(ctx, key)
 }
 
+// LookupEntry is GetEntry also reporting whether key holds a value, which
+// tells a missing key from an empty value.
+func (cfg *Config) LookupEntry(ctx context.Context, key string) (_ Entry, _ bool, err error) {
+	ctx, span := startSpan(ctx, "Config.LookupEntry", attribute.String("kv.key", key))
+	defer func() { endSpan(span, err) }()
+
+	if err := cfg.validateKey(key); err != nil {
+		return Entry{}, false, err
+	}
+	if err := cfg.checkReady(); err != nil {
+		return Entry{}, false, err
+	}
+	cfg.recordReads(key)
+
+	return cfg.fsm.localLookup(ctx, key)
+}
+
+// GetMany gets the entries held by keys. They are all read under the same
+// lock of the FSM, so they reflect the same committed state: a write never
+// shows up in some of them and not in the others. Missing keys are left out
+// of the result.
+func (cfg *Config) GetMany(ctx context.Context, keys []string) (_ map[string]Entry, err error) {
+	ctx, span := startSpan(ctx, "Config.GetMany", attribute.Int("kv.keys", len(keys)))
+	defer func() { endSpan(span, err) }()
+
+	for _, key := range keys {
+		if err := cfg.validateKey(key); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.checkReady(); err != nil {
+		return nil, err
+	}
+	cfg.recordReads(keys...)
+
+	return cfg.fsm.localGetMany(ctx, keys)
+}
+
+// Exists reports, for each of keys, whether it holds a value, without reading
+// the values out. The keys are checked in a single read of the store, a key
+// given twice appears once in the result.
+func (cfg *Config) Exists(ctx context.Context, keys []string) (map[string]bool, error) {
+	for _, key := range keys {
+		if err := cfg.validateKey(key); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.checkReady(); err != nil {
+		return nil, err
+	}
+	cfg.recordReads(keys...)
+
+	return cfg.fsm.localExists(ctx, keys)
+}
+
+// AddServer adds the node id at the Raft address to the cluster, as a
+// non-voter when nonVoter is set. It must be called on the leader.
+func (cfg *Config) AddServer(id raft.ServerID, address raft.ServerAddress, nonVoter bool) error {
+	if cfg.standalone() {
+		return errors.New("a standalone node can't be joined")
+	}
+
+	var f raft.IndexFuture
+	if nonVoter {
+		f = cfg.raft.AddNonvoter(id, address, 0, time.Minute)
+	} else {
+		f = cfg.raft.AddVoter(id, address, 0, time.Minute)
+	}
+	if err := f.Error(); err != nil {
+		cfg.logger.Error("could not add server", "id", id, "error", err)
+		return err
+	}
+
+	return nil
+}
+
 func (cfg *Config) AddHandler() func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json; charset=utf-8")
 		jw := json.NewEncoder(w)
+		if cfg.standalone() {
+			w.WriteHeader(http.StatusConflict)
+			jw.Encode(map[string]string{"error": "a standalone node can't be joined"})
+
+			return
+		}
+
 		body, err := ioutil.ReadAll(r.Body)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
@@ -78,35 +593,84 @@ func (cfg *Config) AddHandler() func(w http.ResponseWriter, r *http.Request) {
 
 			return
 		}
-		log.Debug("got request", "body", string(body))
+		cfg.logger.Debug("got request", "body", string(body))
+
+		var s struct {
+			ID      raft.ServerID
+			Address raft.ServerAddress
+
+			// HTTPAddress is the URL of the HTTP API of the node, empty
+			// when it doesn't know it.
+			HTTPAddress string
 
-		var s *raft.Server
+			// NonVoter is set by read replicas and nodes joining with
+			// WithNonVoter, which don't take part in elections.
+			NonVoter bool
+		}
 		if err := json.Unmarshal(body, &s); err != nil {
-			log.Error("could not parse json", "error", err)
+			cfg.logger.Error("could not parse json", "error", err)
 			w.WriteHeader(http.StatusInternalServerError)
 			jw.Encode(map[string]string{"error": err.Error()})
 
 			return
 		}
 
-		cfg.raft.AddVoter(s.ID, s.Address, 0, time.Minute)
+		if err := cfg.AddServer(s.ID, s.Address, s.NonVoter); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			jw.Encode(map[string]string{"error": err.Error()})
+
+			return
+		}
+		if s.HTTPAddress != "" {
+			if err := cfg.recordMember(r.Context(), member{ID: s.ID, HTTPAddress: s.HTTPAddress}); err != nil {
+				cfg.logger.Warn("couldn't record the HTTP address of the server", "id", s.ID, "error", err)
+			}
+		}
 		jw.Encode(map[string]string{"status": "success"})
 	}
 }
 
 func (cfg *Config) Middleware(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if cfg.raft.State() != raft.Leader {
-			ldr := cfg.raft.Leader()
-			if ldr == "" {
-				log.Error("leader address is empty")
+		r, err := cfg.authorizeRequest(r)
+		if err != nil {
+			rejectUnauthorized(w, err)
+
+			return
+		}
+
+		if cfg.Draining() && clientRequest(r) {
+			rejectDraining(w)
+
+			return
+		}
+
+		// A read replica answers everything itself: reads from its own
+		// data, writes with ErrReadOnly.
+		if cfg.readReplica || cfg.servedLocally(r) {
+			h.ServeHTTP(w, r)
+
+			return
+		}
+
+		if cfg.state() != raft.Leader {
+			ldr := cfg.leaderURL()
+			if ldr == nil {
+				cfg.logger.Error("leader address is empty")
 				h.ServeHTTP(w, r)
 
 				return
 			}
 
-			prxy := httputil.NewSingleHostReverseProxy(RaftAddressToHTTP(ldr))
-			prxy.ServeHTTP(w, r)
+			// The node forwarding the request took us for the leader,
+			// it retries against the actual one.
+			if r.Header.Get(ForwardedHeader) != "" {
+				rejectFollower(w, http.StatusServiceUnavailable, ldr)
+
+				return
+			}
+
+			cfg.forward(w, r, ldr)
 
 			return
 		}
@@ -115,48 +679,268 @@ func (cfg *Config) Middleware(h http.Handler) http.Handler {
 	})
 }
 
-func NewRaftSetup(storagePath, host, raftPort, raftLeader string) (*Config, error) {
+// servedLocally reports whether r is answered by the node it was sent to
+// instead of being forwarded to the leader.
+func (cfg *Config) servedLocally(r *http.Request) bool {
+	// Diagnostics can pin a request to the node, reads are then served from
+	// its FSM, possibly stale, and writes fail on followers.
+	if noProxy(r) {
+		return true
+	}
+
+	// Drain mode is switched on the node being drained
+	if r.URL.Path == "/admin/drain" || r.URL.Path == "/admin/undrain" {
+		return true
+	}
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	// Reads asking for a minimum index are meant for followers, they wait
+	// for the index to be applied locally.
+	if r.URL.Query().Get("minindex") != "" {
+		return true
+	}
+
+	// Stale reads are served by whichever node gets them, and so are the
+	// reads not asking to be linearizable with WithFollowerReads.
+	consistency := Consistency(r.URL.Query().Get("consistency"))
+	if consistency == ConsistencyStale || cfg.followerReads && consistency != ConsistencyLinearizable {
+		return true
+	}
+
+	// Every node applies the changes watches stream
+	if strings.HasPrefix(r.URL.Path, "/watch/") {
+		return true
+	}
+
+	return nodePaths[r.URL.Path]
+}
+
+// nodePaths are the endpoints describing the node they are sent to.
+var nodePaths = map[string]bool{
+	"/metrics":        true,
+	"/raft/boltstats": true,
+	"/raft/snapshots": true,
+	"/raft/status":    true,
+	"/stats/ops":      true,
+	"/healthz":        true,
+	"/readyz":         true,
+	"/stats/hotkeys":  true,
+}
+
+// noProxy reports whether r asks not to be forwarded to the leader, with
+// local=true or an X-No-Proxy: true header.
+func noProxy(r *http.Request) bool {
+	for _, value := range []string{r.URL.Query().Get("local"), r.Header.Get("X-No-Proxy")} {
+		if b, err := strconv.ParseBool(value); err == nil && b {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RaftAddressToHTTP converts the Raft address of a node to the URL of its HTTP
+// API, which by convention listens on the port right below the Raft one. An
+// address without a numeric port is used as is. Nodes only fall back to it for
+// the members that recorded no HTTP address, see WithHTTPAddress.
+func RaftAddressToHTTP(addr raft.ServerAddress) *url.URL {
+	host, port, err := net.SplitHostPort(string(addr))
+	if err != nil {
+		return &url.URL{Scheme: "http", Host: string(addr)}
+	}
+
+	p, err := strconv.Atoi(port)
+	if err != nil {
+		return &url.URL{Scheme: "http", Host: string(addr)}
+	}
+
+	return &url.URL{Scheme: "http", Host: net.JoinHostPort(host, strconv.Itoa(p-1))}
+}
+
+// newOptions applies opts over the defaults.
+func newOptions(opts []Option) options {
+	o := options{
+		storageFormat:  FormatBase64,
+		logger:         hclog.Default(),
+		keySeparator:   DefaultKeySeparator,
+		reservedPrefix: DefaultReservedPrefix,
+		persistence:    PersistPeriodic,
+		flushInterval:  DefaultFlushInterval,
+		followerMode:   FollowerProxy,
+		keyAllocator:   AllocateSequence,
+		joinTimeout:    DefaultJoinTimeout,
+
+		transportMaxPool: DefaultTransportMaxPool,
+		transportTimeout: DefaultTransportTimeout,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return o
+}
+
+// newConfig builds the parts of a Config that don't depend on how commands
+// are applied.
+func newConfig(o *options) (*Config, error) {
 	cfg := &Config{}
+	cfg.logger = o.logger
+	cfg.readReplica = o.readReplica
+	cfg.followerMode = o.followerMode
+	cfg.followerReads = o.followerReads
+	cfg.httpAddress = o.httpAddress
+	cfg.readsWaitReady = o.readsWaitReady
+	cfg.leaveOnShutdown = o.leaveOnShutdown
+	cfg.keyAllocator = o.keyAllocator
+	cfg.httpClient = o.httpClient
+	cfg.https = o.https
+	cfg.auth = newAuth(o)
+	cfg.keySeparator, cfg.reservedPrefix = o.keySeparator, o.reservedPrefix
+
+	if o.keySeparator == "" || o.reservedPrefix == "" {
+		return nil, fmt.Errorf("the key separator and the reserved prefix can't be empty")
+	}
+	if o.maxInflightApplies > 0 {
+		cfg.slots = make(chan struct{}, o.maxInflightApplies)
+	}
+
+	return cfg, nil
+}
+
+// setupFSM loads the FSM from the data file and starts what consumes its
+// events.
+func (cfg *Config) setupFSM(o *options) error {
+	store, err := o.newStore()
+	if err != nil {
+		return fmt.Errorf("opening data file: %w", err)
+	}
+	cfg.fsm = newFSM(store, o.logger.Named("fsm"))
+	cfg.fsm.format = o.storageFormat
+	cfg.fsm.keyring = o.keyring
+	cfg.fsm.policies = o.writePolicies
+	cfg.fsm.persistence = o.persistence
+	cfg.fsm.quotas, cfg.fsm.separator = o.quotas, o.keySeparator
+	cfg.fsm.limits = o.namespaceLimits
+	cfg.fsm.reserved = o.reservedPrefix + o.keySeparator
+	cfg.fsm.historySize = o.historySize
+	if err := cfg.fsm.load(context.Background()); err != nil {
+		return fmt.Errorf("loading data file: %w", err)
+	}
+	if o.persistence == PersistPeriodic {
+		go cfg.fsm.flushEvery(context.Background(), o.flushInterval)
+	}
+
+	if o.webhookURL != "" {
+		wh := newWebhook(o.webhookURL, func() bool { return cfg.state() == raft.Leader }, o.logger.Named("webhook"))
+		go wh.run(cfg.fsm.events.subscribe(webhookQueueSize))
+	}
+
+	switch {
+	case o.auditPath != "":
+		audit, err := newAuditFile(o.auditPath, o.auditMaxSize, o.logger.Named("audit"))
+		if err != nil {
+			return err
+		}
+		go audit.run(cfg.fsm.events.subscribe(auditQueueSize))
+	case o.auditLogger != nil:
+		go newAuditLogger(o.auditLogger).run(cfg.fsm.events.subscribe(auditQueueSize))
+	}
+
+	if o.hotKeys > 0 {
+		cfg.hotKeys = newHotKeys(o.hotKeys)
+		go cfg.hotKeys.countWrites(cfg.fsm.events.subscribe(hotKeysQueueSize))
+	}
+
+	return nil
+}
+
+func NewRaftSetup(storagePath, host, raftPort, raftLeader string, opts ...Option) (*Config, error) {
+	o := newOptions(opts)
+	cfg, err := newConfig(&o)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.readReplica && len(splitSeeds(raftLeader)) == 0 && o.discovery == nil {
+		return nil, fmt.Errorf("a read replica needs a leader to join")
+	}
+	if o.discovery != nil && len(splitSeeds(raftLeader)) > 0 {
+		return nil, fmt.Errorf("a node joins either through a leader or through discovery")
+	}
+
+	// Validate the settings before touching the disk or the network
+	id, recorded, err := loadNodeID(storagePath, o.nodeID)
+	if err != nil {
+		return nil, err
+	}
+	raftSettings := raft.DefaultConfig()
+	raftSettings.LocalID = id
+	cfg.id = raftSettings.LocalID
+	raftSettings.Logger = o.logger.Named("raft")
+	o.applyElectionSettings(raftSettings)
+	o.applySnapshotSettings(raftSettings)
+
+	if err := raft.ValidateConfig(raftSettings); err != nil {
+		return nil, fmt.Errorf("could not validate config: %w", err)
+	}
+
+	if err := o.validateTransport(); err != nil {
+		return nil, err
+	}
 
 	if err := os.MkdirAll(storagePath, os.ModePerm); err != nil {
 		return nil, fmt.Errorf("setting up storage dire: %w", err)
 	}
+	if !recorded {
+		if err := saveNodeID(storagePath, id); err != nil {
+			return nil, err
+		}
+	}
 
-	cfg.fsm = &fsm{
-		dataFile: fmt.Sprintf("%s/data.json", storagePath),
+	o.defaultPaths(storagePath)
+	for _, path := range []string{o.stableStorePath, o.logStorePath, o.dataFile} {
+		if err := prepareFile(path); err != nil {
+			return nil, fmt.Errorf("setting up storage: %w", err)
+		}
+	}
+
+	if err := cfg.setupFSM(&o); err != nil {
+		return nil, err
 	}
 
-	ss, err := raftbolt.NewBoltStore(storagePath + "/stable")
+	ss, err := raftbolt.NewBoltStore(o.stableStorePath)
 	if err != nil {
 		return nil, fmt.Errorf("building stable store: %w", err)
 	}
+	cfg.stableStore, cfg.stableStorePath = ss, o.stableStorePath
 
-	ls, err := raftbolt.NewBoltStore(storagePath + "/log")
+	ls, err := raftbolt.NewBoltStore(o.logStorePath)
 	if err != nil {
 		return nil, fmt.Errorf("building log store: %w", err)
 	}
+	cfg.logStore, cfg.logStorePath = ls, o.logStorePath
 
-	snaps, err := raft.NewFileSnapshotStoreWithLogger(storagePath+"/snaps", 5, log)
+	snaps, err := raft.NewFileSnapshotStoreWithLogger(o.snapshotPath, 5, raftSettings.Logger)
 	if err != nil {
 		return nil, fmt.Errorf("building snapshotstore: %w", err)
 	}
+	cfg.snapshots = snaps
 
 	fullTarget := fmt.Sprintf("%s:%s", host, raftPort)
-	addr, err := net.ResolveTCPAddr("tcp", fullTarget)
-	if err != nil {
-		return nil, fmt.Errorf("getting address: %w", err)
+	bindAddress := o.bindAddress
+	if bindAddress == "" {
+		bindAddress = fullTarget
 	}
-
-	trans, err := raft.NewTCPTransportWithLogger(fullTarget, addr, 10, 10*time.Second, log)
-	if err != nil {
-		return nil, fmt.Errorf("building transport: %w", err)
+	if o.advertiseAddress != "" {
+		fullTarget = o.advertiseAddress
 	}
 
-	raftSettings := raft.DefaultConfig()
-	raftSettings.LocalID = raft.ServerID(uuid.New().URN())
-
-	if err := raft.ValidateConfig(raftSettings); err != nil {
-		return nil, fmt.Errorf("could not validate config: %w", err)
+	trans, err := o.newTransport(bindAddress, fullTarget, raftSettings.Logger)
+	if err != nil {
+		return nil, err
 	}
 
 	node, err := raft.NewRaft(raftSettings, cfg.fsm, ls, ss, snaps, trans)
@@ -164,60 +948,45 @@ func NewRaftSetup(storagePath, host, raftPort, raftLeader string) (*Config, erro
 		return nil, fmt.Errorf("could not create raft node: %w", err)
 	}
 	cfg.raft = node
+	cfg.readyIndex = node.LastIndex()
+	cfg.contacts = newContactTracker()
+	cfg.contacts.register(node)
 
-	if cfg.raft.Leader() != "" {
-		raftLeader = string(cfg.raft.Leader())
+	seeds := splitSeeds(raftLeader)
+	if ldr := cfg.leaderURL(); ldr != nil {
+		seeds = []string{ldr.String()}
 	}
 
 	// Make ourselves the leader!
-	if raftLeader == "" {
-		raftConfig := raft.Configuration{
-			Servers: []raft.Server{
-				{
-					ID:      raftSettings.LocalID,
-					Address: raft.ServerAddress(fullTarget),
-				},
-			},
-		}
+	self := raft.Server{ID: raftSettings.LocalID, Address: raft.ServerAddress(fullTarget)}
+	if len(seeds) == 0 && o.discovery == nil {
+		cfg.bootstrap(self)
+	}
 
-		cfg.raft.BootstrapCluster(raftConfig)
+	go cfg.purgeExpired()
+
+	if o.compactionInterval > 0 {
+		cfg.compaction.leading = make(chan bool, 1)
+		go cfg.compactWhileLeading(o.compactionInterval)
 	}
 
 	// Watch the leader election forever
-	leaderCh := cfg.raft.LeaderCh()
-	go func() {
-		for {
-			select {
-			case isLeader := <-leaderCh:
-				if isLeader {
-					log.Info("cluster leadership acquired")
-					// snapshot at random
-					chance := rand.Int() % 10
-					if chance == 0 {
-						cfg.raft.Snapshot()
-					}
-				}
-			}
-		}
-	}()
+	go cfg.watchLeadership()
 
 	// We're not the leader, tell them about us
-	if raftLeader != "" {
-		// Let's just chill for a bit until leader might be ready
-		time.Sleep(10 * time.Second)
-
-		postJSON := fmt.Sprintf(`{"ID": %q, "Address": %q}`, raftSettings.LocalID, fullTarget)
-		resp, err := http.Post(
-			raftLeader+"/raft/add",
-			"application/json; charset=utf-8",
-			strings.NewReader(postJSON),
-		)
-
-		if err != nil {
-			return nil, fmt.Errorf("failed adding self to leader %q: %w", raftLeader, err)
+	postJSON := fmt.Sprintf(`{"ID": %q, "Address": %q, "HTTPAddress": %q, "NonVoter": %t}`, raftSettings.LocalID, fullTarget, o.httpAddress, o.readReplica || o.nonVoter)
+	if len(seeds) > 0 {
+		if err := cfg.joinCluster(seeds, postJSON, o.joinTimeout); err != nil {
+			return nil, err
 		}
-
-		log.Debug("added self to leader", "leader", raftLeader, "response", resp)
+	} else if o.discovery != nil {
+		// The other nodes discover this one through its HTTP API, which
+		// only starts serving once the setup returns.
+		go func() {
+			if err := cfg.discoverCluster(o.discovery, self, postJSON, o.discoveryExpect, o.joinTimeout); err != nil {
+				cfg.logger.Error("couldn't discover the cluster", "error", err)
+			}
+		}()
 	}
 
 	return cfg, nil
@@ -0,0 +1,666 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/raft"
+)
+
+// newTestConfig starts a single node cluster using in-memory Raft stores and
+// transport, and waits for it to become the leader.
+func newTestConfig(tb testing.TB) *Config {
+	tb.Helper()
+
+	cfg := &Config{
+		fsm:    newFSM(NewFileStore(filepath.Join(tb.TempDir(), "data.json")), hclog.NewNullLogger()),
+		logger: hclog.NewNullLogger(),
+
+		keySeparator:   DefaultKeySeparator,
+		reservedPrefix: DefaultReservedPrefix,
+	}
+
+	raftSettings := raft.DefaultConfig()
+	raftSettings.LocalID = "test"
+	cfg.id = raftSettings.LocalID
+	raftSettings.HeartbeatTimeout = 50 * time.Millisecond
+	raftSettings.ElectionTimeout = 50 * time.Millisecond
+	raftSettings.LeaderLeaseTimeout = 50 * time.Millisecond
+	raftSettings.CommitTimeout = 5 * time.Millisecond
+	raftSettings.Logger = hclog.NewNullLogger()
+
+	addr, trans := raft.NewInmemTransport("")
+	logs := raft.NewInmemStore()
+	cfg.snapshots = raft.NewInmemSnapshotStore()
+	node, err := raft.NewRaft(raftSettings, cfg.fsm, logs, logs, cfg.snapshots, trans)
+	if err != nil {
+		tb.Fatalf("Couldn't create raft node: %s", err)
+	}
+	tb.Cleanup(func() { node.Shutdown().Error() })
+	cfg.raft = node
+
+	node.BootstrapCluster(raft.Configuration{
+		Servers: []raft.Server{{ID: raftSettings.LocalID, Address: addr}},
+	})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for node.State() != raft.Leader {
+		if time.Now().After(deadline) {
+			tb.Fatalf("Node didn't become leader")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return cfg
+}
+
+func TestGet(t *testing.T) {
+	t.Parallel()
+
+	cfg := newTestConfig(t)
+
+	kvStore := map[string]string{
+		"key1": "value1",
+		"key2": "value2",
+		"key4": "value4",
+	}
+	os.WriteFile(cfg.fsm.store.(*FileStore).Path(), encodedFixture(kvStore), 0644)
+	cfg.fsm.load(context.Background())
+
+	testCases := []struct {
+		in  string
+		out string
+		err error
+	}{
+		{"key1", "value1", nil},
+		{"key2", "value2", nil},
+		{"key3", "", nil},
+	}
+	for _, test := range testCases {
+		got, err := cfg.Get(context.Background(), test.in)
+		if err != test.err {
+			t.Errorf("Received unexpected error: %s", test.err)
+		}
+		if got != test.out {
+			t.Errorf("Got %s, expected %s", got, test.out)
+		}
+	}
+}
+
+func BenchmarkGet(b *testing.B) {
+	cfg := newTestConfig(b)
+
+	kvStore := map[string]string{
+		"key1": "value1",
+		"key2": "value2",
+		"key4": "value4",
+	}
+	os.WriteFile(cfg.fsm.store.(*FileStore).Path(), encodedFixture(kvStore), 0644)
+	cfg.fsm.load(context.Background())
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cfg.Get(context.Background(), "key1")
+	}
+}
+
+// BenchmarkGetDatasetSize reads a key out of datasets of growing sizes. The
+// data lives in memory, so a read takes the same time whatever the size.
+func BenchmarkGetDatasetSize(b *testing.B) {
+	for _, size := range []int{10, 10000, 100000} {
+		b.Run(strconv.Itoa(size), func(b *testing.B) {
+			cfg := newTestConfig(b)
+
+			data := make(map[string]Entry, size)
+			for i := 0; i < size; i++ {
+				data["key"+strconv.Itoa(i)] = Entry{Value: "value"}
+			}
+			cfg.fsm.mu.Lock()
+			cfg.fsm.reset(data)
+			cfg.fsm.mu.Unlock()
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				cfg.Get(context.Background(), "key1")
+			}
+		})
+	}
+}
+
+func TestGetCancelled(t *testing.T) {
+	t.Parallel()
+
+	cfg := newTestConfig(t)
+	if err := cfg.Set(context.Background(), "key1", "value1"); err != nil {
+		t.Fatalf("Set returned unexpected error: %s", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if v, err := cfg.Get(ctx, "key1"); !errors.Is(err, context.Canceled) || v != "" {
+		t.Errorf("Get with a cancelled context = %q, %v, expected %v", v, err, context.Canceled)
+	}
+	if _, err := cfg.GetMany(ctx, []string{"key1"}); !errors.Is(err, context.Canceled) {
+		t.Errorf("GetMany with a cancelled context: Got error %v, expected %v", err, context.Canceled)
+	}
+	if _, err := cfg.fsm.store.Snapshot(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("loading the data file with a cancelled context: Got error %v, expected %v", err, context.Canceled)
+	}
+}
+
+func TestGetSetDelete(t *testing.T) {
+	cfg := newTestConfig(t)
+	ctx := context.Background()
+
+	// Delete once removed "key" whatever key it was given, a test on
+	// "key" itself wouldn't notice
+	key := "greeting"
+	value := "value"
+
+	if out, err := cfg.Get(ctx, key); err != nil || out != "" {
+		t.Fatalf("First Get returned unexpected result, out: %q, error: %s", out, err)
+	}
+
+	if err := cfg.Set(ctx, key, value); err != nil {
+		t.Fatalf("Set returned unexpeced error: %s", err)
+	}
+
+	if out, err := cfg.Get(ctx, key); err != nil || out != value {
+		t.Fatalf("Second Get returned unexpecfted result, out: %q, error: %s", out, err)
+	}
+
+	if _, err := cfg.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete returned unexpected error: %s", err)
+	}
+
+	if out, err := cfg.Get(ctx, key); err != nil || out != "" {
+		t.Fatalf("Third Get returned unexpected result, out: %q, error: %s", out, err)
+	}
+}
+
+func TestSetValidation(t *testing.T) {
+	cfg := newTestConfig(t)
+	ctx := context.Background()
+
+	testCases := []struct {
+		key   string
+		value string
+		err   error
+	}{
+		{"", "value", ErrInvalidKey},
+		{strings.Repeat("k", MaxKeySize+1), "value", ErrInvalidKey},
+		{"key", strings.Repeat("v", MaxValueSize+1), ErrValueTooLarge},
+		{"key", "value", nil},
+	}
+	for _, test := range testCases {
+		if err := cfg.Set(ctx, test.key, test.value); !errors.Is(err, test.err) {
+			t.Errorf("Got error %v, expected %v", err, test.err)
+		}
+	}
+}
+
+func TestSetEntryBinary(t *testing.T) {
+	cfg := newTestConfig(t)
+	ctx := context.Background()
+
+	binary := Entry{
+		Value:       "\x00\xff\xfe\x80 not utf8 \xc3\x28",
+		ContentType: "application/octet-stream",
+		Metadata:    map[string]string{"filename": "blob.bin"},
+	}
+	if _, err := cfg.SetEntry(ctx, "binary", binary); err != nil {
+		t.Fatalf("SetEntry returned unexpected error: %s", err)
+	}
+
+	got, err := cfg.GetEntry(ctx, "binary")
+	if err != nil {
+		t.Fatalf("GetEntry returned unexpected error: %s", err)
+	}
+
+	got.Revision = 0
+	if !reflect.DeepEqual(got, binary) {
+		t.Errorf("Got %q, expected %q", got, binary)
+	}
+}
+
+func TestSetEntryMetadata(t *testing.T) {
+	cfg := newTestConfig(t)
+	ctx := context.Background()
+
+	testCases := []struct {
+		meta map[string]string
+		err  error
+	}{
+		{map[string]string{"owner": "me", "build-2": "ok"}, nil},
+		{map[string]string{"Owner": "me"}, ErrInvalidMetadata},
+		{map[string]string{"": "x"}, ErrInvalidMetadata},
+		{map[string]string{"big": strings.Repeat("x", MaxMetadataSize)}, ErrInvalidMetadata},
+	}
+
+	for _, test := range testCases {
+		if _, err := cfg.SetEntry(ctx, "key", Entry{Value: "v", Metadata: test.meta}); !errors.Is(err, test.err) {
+			t.Errorf("SetEntry(%v) returned error %v, expected %v", test.meta, err, test.err)
+		}
+	}
+}
+
+func TestApplyLegacyCommand(t *testing.T) {
+	f := newFSM(NewFileStore(filepath.Join(t.TempDir(), "data.json")), hclog.NewNullLogger())
+
+	// Log entries written before values moved to Command.Data
+	f.Apply(&raft.Log{Index: 1, Data: []byte(`{"Action":"set","Key":"key","Value":"value"}`)})
+
+	if got, err := f.localGet(context.Background(), "key"); err != nil || got.Value != "value" {
+		t.Errorf("Got %q (error: %v), expected %q", got.Value, err, "value")
+	}
+}
+
+func TestWaitForIndex(t *testing.T) {
+	cfg := newTestConfig(t)
+	ctx := context.Background()
+
+	index, err := cfg.SetEntry(ctx, "key", Entry{Value: "value"})
+	if err != nil {
+		t.Fatalf("SetEntry returned unexpected error: %s", err)
+	}
+
+	if err := cfg.WaitForIndex(ctx, index, time.Second); err != nil {
+		t.Errorf("WaitForIndex(%d) returned unexpected error: %s", index, err)
+	}
+
+	if err := cfg.WaitForIndex(ctx, index+100, 50*time.Millisecond); !errors.Is(err, ErrIndexTimeout) {
+		t.Errorf("Got error %v, expected %v", err, ErrIndexTimeout)
+	}
+}
+
+func TestDeleteAndGet(t *testing.T) {
+	cfg := newTestConfig(t)
+	ctx := context.Background()
+
+	if _, err := cfg.SetEntry(ctx, "lock", Entry{Value: "owner", ContentType: "text/plain"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Set(ctx, "flag", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		key   string
+		entry Entry
+		err   error
+	}{
+		{"lock", Entry{Value: "owner", ContentType: "text/plain"}, nil},
+		{"lock", Entry{}, ErrNotFound},
+		{"flag", Entry{}, nil},
+		{"missing", Entry{}, ErrNotFound},
+	}
+	for _, test := range testCases {
+		e, _, err := cfg.DeleteAndGet(ctx, test.key)
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s: got error %v, expected %v", test.key, err, test.err)
+		}
+
+		e.Revision = 0
+		if !reflect.DeepEqual(e, test.entry) {
+			t.Errorf("%s: got %+v, expected %+v", test.key, e, test.entry)
+		}
+	}
+
+	if out, err := cfg.Get(ctx, "flag"); err != nil || out != "" {
+		t.Fatalf("Get after DeleteAndGet returned out: %q, error: %s", out, err)
+	}
+}
+
+func TestLookupEntry(t *testing.T) {
+	cfg := newTestConfig(t)
+	ctx := context.Background()
+
+	cfg.Set(ctx, "empty", "")
+
+	if _, found, err := cfg.LookupEntry(ctx, "empty"); err != nil || !found {
+		t.Errorf("Got found %t (error: %v) for an empty value, expected true", found, err)
+	}
+
+	if _, found, err := cfg.LookupEntry(ctx, "missing"); err != nil || found {
+		t.Errorf("Got found %t (error: %v) for a missing key, expected false", found, err)
+	}
+}
+
+func TestExists(t *testing.T) {
+	cfg := newTestConfig(t)
+	ctx := context.Background()
+
+	if err := cfg.Set(ctx, "k1", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		keys []string
+		out  map[string]bool
+	}{
+		{[]string{"k1", "k2", "k1"}, map[string]bool{"k1": true, "k2": false}},
+		{[]string{}, map[string]bool{}},
+	}
+	for _, test := range testCases {
+		got, err := cfg.Exists(ctx, test.keys)
+		if err != nil {
+			t.Fatalf("Exists returned unexpected error: %s", err)
+		}
+
+		if !reflect.DeepEqual(got, test.out) {
+			t.Errorf("Got %v, expected %v", got, test.out)
+		}
+	}
+
+	if _, err := cfg.Exists(ctx, []string{""}); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("Got error %v, expected %v", err, ErrInvalidKey)
+	}
+}
+
+func TestServedLocally(t *testing.T) {
+	testCases := []struct {
+		method, target string
+		followerReads  bool
+		local          bool
+	}{
+		{http.MethodGet, "/raft/boltstats", false, true},
+		{http.MethodGet, "/key/k?minindex=3", false, true},
+		{http.MethodGet, "/key/k", false, false},
+		{http.MethodPost, "/raft/boltstats", false, false},
+		{http.MethodGet, "/key/k?local=true", false, true},
+		{http.MethodPost, "/key/k?local=1", false, true},
+		{http.MethodGet, "/key/k?local=false", false, false},
+		{http.MethodPost, "/admin/drain", false, true},
+		{http.MethodGet, "/key/k?consistency=stale", false, true},
+		{http.MethodGet, "/keys?consistency=stale", false, true},
+		{http.MethodGet, "/key/k?consistency=linearizable", false, false},
+		{http.MethodPost, "/key/k?consistency=stale", false, false},
+		{http.MethodGet, "/key/k", true, true},
+		{http.MethodHead, "/keys", true, true},
+		{http.MethodGet, "/key/k?consistency=linearizable", true, false},
+		{http.MethodPost, "/key/k", true, false},
+	}
+
+	for _, test := range testCases {
+		cfg := &Config{followerReads: test.followerReads}
+		if got := cfg.servedLocally(httptest.NewRequest(test.method, test.target, nil)); got != test.local {
+			t.Errorf("%s %s: got %t, expected %t", test.method, test.target, got, test.local)
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodDelete, "/key/k", nil)
+	r.Header.Set("X-No-Proxy", "true")
+	if !(&Config{}).servedLocally(r) {
+		t.Errorf("Got request with X-No-Proxy proxied")
+	}
+}
+
+func TestDrain(t *testing.T) {
+	cfg := newTestConfig(t)
+	handler := cfg.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	serve := func(method, target string) int {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(method, target, nil))
+		return recorder.Code
+	}
+
+	cfg.DrainHandler(true)(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/admin/drain", nil))
+	if !cfg.Status().Draining {
+		t.Fatalf("Status doesn't report drain mode")
+	}
+
+	for _, target := range []string{"/key/k", "/kv/mget"} {
+		if code := serve(http.MethodGet, target); code != http.StatusServiceUnavailable {
+			t.Errorf("%s: Got status %d while draining, expected %d", target, code, http.StatusServiceUnavailable)
+		}
+	}
+
+	for _, target := range []string{"/raft/status", "/metrics", "/admin/undrain"} {
+		if code := serve(http.MethodGet, target); code != http.StatusOK {
+			t.Errorf("%s: Got status %d while draining, expected %d", target, code, http.StatusOK)
+		}
+	}
+
+	cfg.DrainHandler(false)(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/admin/undrain", nil))
+	if code := serve(http.MethodGet, "/key/k"); code != http.StatusOK || cfg.Draining() {
+		t.Errorf("Got status %d after undrain, expected %d", code, http.StatusOK)
+	}
+}
+
+func TestReadReplica(t *testing.T) {
+	cfg := newTestConfig(t)
+	ctx := context.Background()
+
+	if err := cfg.Set(ctx, "k", "v"); err != nil {
+		t.Fatal(err)
+	}
+	cfg.readReplica = true
+
+	if _, err := cfg.SetEntry(ctx, "k", Entry{Value: "v2"}); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Got error %v, expected %v", err, ErrReadOnly)
+	}
+
+	if _, err := cfg.Delete(ctx, "k"); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Got error %v, expected %v", err, ErrReadOnly)
+	}
+
+	if out, err := cfg.Get(ctx, "k"); err != nil || out != "v" {
+		t.Errorf("Get returned out: %q, error: %v", out, err)
+	}
+
+	if status := cfg.Status(); !status.ReadOnly || status.Term == 0 {
+		t.Errorf("Got status %+v, expected read only with a term", status)
+	}
+}
+
+func TestMaxInflightApplies(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.slots = make(chan struct{}, 2)
+	ctx := context.Background()
+
+	// Hold every slot, as writes stuck in Raft would
+	var releases []func()
+	for i := 0; i < cap(cfg.slots); i++ {
+		release, err := cfg.acquire()
+		if err != nil {
+			t.Fatalf("acquire returned unexpected error: %s", err)
+		}
+		releases = append(releases, release)
+	}
+
+	if err := cfg.Set(ctx, "k", "v"); !errors.Is(err, ErrTooManyWrites) {
+		t.Errorf("Got error %v, expected %v", err, ErrTooManyWrites)
+	}
+
+	if _, err := cfg.Delete(ctx, "k"); !errors.Is(err, ErrTooManyWrites) {
+		t.Errorf("Got error %v, expected %v", err, ErrTooManyWrites)
+	}
+
+	recorder := httptest.NewRecorder()
+	cfg.MetricsHandler()(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if body := recorder.Body.String(); !strings.Contains(body, "\nkv_inflight_applies 2\n") {
+		t.Errorf("Got metrics %q, expected 2 inflight applies", body)
+	}
+
+	for _, release := range releases {
+		release()
+	}
+
+	if err := cfg.Set(ctx, "k", "v"); err != nil {
+		t.Errorf("Set returned unexpected error: %s", err)
+	}
+}
+
+func TestSnapshots(t *testing.T) {
+	cfg := newTestConfig(t)
+
+	if err := cfg.Set(context.Background(), "k", "v"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cfg.raft.Snapshot().Error(); err != nil {
+		t.Fatalf("Snapshot returned unexpected error: %s", err)
+	}
+
+	snapshots, inProgress, err := cfg.Snapshots()
+	if err != nil {
+		t.Fatalf("Snapshots returned unexpected error: %s", err)
+	}
+
+	if inProgress {
+		t.Errorf("Got a snapshot in progress after it completed")
+	}
+
+	if len(snapshots) != 1 || snapshots[0].Index != cfg.raft.LastIndex() || snapshots[0].Size == 0 {
+		t.Errorf("Got snapshots %+v, expected one at index %d", snapshots, cfg.raft.LastIndex())
+	}
+}
+
+func TestSnapshotInfo(t *testing.T) {
+	t.Parallel()
+
+	info := snapshotInfo(&raft.SnapshotMeta{ID: "2-42-1618912800000", Index: 42, Term: 2})
+	if info.CreatedAt == nil || !info.CreatedAt.Equal(time.Date(2021, 4, 20, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("Got creation time %v, expected 2021-04-20T10:00:00Z", info.CreatedAt)
+	}
+
+	if info := snapshotInfo(&raft.SnapshotMeta{ID: "opaque"}); info.CreatedAt != nil {
+		t.Errorf("Got creation time %v for an opaque ID", info.CreatedAt)
+	}
+}
+
+func TestReservedKeys(t *testing.T) {
+	cfg := newTestConfig(t)
+	ctx := context.Background()
+
+	reserved := cfg.internalKey("lease", "k")
+	if reserved != "__kv:lease:k" {
+		t.Fatalf("Got internal key %s, expected __kv:lease:k", reserved)
+	}
+
+	// Internal subsystems write straight to the FSM
+	if _, _, err := cfg.apply(ctx, Command{Action: "set", Key: reserved, Data: []byte("internal")}); err != nil {
+		t.Fatalf("apply returned unexpected error: %s", err)
+	}
+
+	if err := cfg.Set(ctx, "k", "v"); err != nil {
+		t.Fatal(err)
+	}
+
+	checks := []struct {
+		name string
+		err  error
+	}{
+		{"Set", cfg.Set(ctx, reserved, "v")},
+		{"BatchSet", func() error { _, err := cfg.SetBatch(ctx, map[string]string{"ok": "v", reserved: "v"}); return err }()},
+		{"Delete", func() error { _, err := cfg.Delete(ctx, reserved); return err }()},
+		{"DeleteAndGet", func() error { _, _, err := cfg.DeleteAndGet(ctx, reserved); return err }()},
+		{"Rename", func() error { _, err := cfg.Rename(ctx, "k", reserved, true); return err }()},
+		{"Get", func() error { _, err := cfg.Get(ctx, reserved); return err }()},
+	}
+	for _, check := range checks {
+		if !errors.Is(check.err, ErrReservedKey) {
+			t.Errorf("%s: got error %v, expected %v", check.name, check.err, ErrReservedKey)
+		}
+	}
+
+	if e, err := cfg.fsm.localGet(ctx, reserved); err != nil || e.Value != "internal" {
+		t.Errorf("Internal key holds %q, error: %v, expected it untouched", e.Value, err)
+	}
+
+	if err := cfg.Set(ctx, "__kv", "v"); err != nil {
+		t.Errorf("Set of the bare prefix returned unexpected error: %s", err)
+	}
+}
+
+func TestGetManyConsistent(t *testing.T) {
+	cfg := newTestConfig(t)
+	ctx := context.Background()
+
+	if _, err := cfg.SetBatch(ctx, map[string]string{"k1": "0", "k2": "0"}); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error)
+	go func() {
+		for i := 1; i <= 50; i++ {
+			v := strconv.Itoa(i)
+			if _, err := cfg.SetBatch(ctx, map[string]string{"k1": v, "k2": v}); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+
+	for {
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("SetBatch returned unexpected error: %s", err)
+			}
+			return
+		default:
+		}
+
+		entries, err := cfg.GetMany(ctx, []string{"k1", "k2", "missing"})
+		if err != nil {
+			t.Fatalf("GetMany returned unexpected error: %s", err)
+		}
+
+		if len(entries) != 2 || entries["k1"].Value != entries["k2"].Value {
+			t.Fatalf("Got torn view %+v", entries)
+		}
+	}
+}
+
+func TestDeletePrefix(t *testing.T) {
+	cfg := newTestConfig(t)
+	ctx := context.Background()
+
+	for _, key := range []string{"foo", "foo:1", "foo:2", "foobar", "fo", "bar:foo"} {
+		cfg.Set(ctx, key, "v")
+	}
+	cfg.fsm.localSet(cfg.internalKey("lock"), Entry{Value: "internal"})
+
+	deleted, _, err := cfg.DeletePrefix(ctx, "foo:")
+	if err != nil {
+		t.Fatalf("DeletePrefix returned unexpected error: %s", err)
+	}
+	if deleted != 2 {
+		t.Errorf("Got %d keys deleted, expected 2", deleted)
+	}
+
+	exists, _ := cfg.Exists(ctx, []string{"foo", "foo:1", "foo:2", "foobar", "fo", "bar:foo"})
+	expected := map[string]bool{"foo": true, "foo:1": false, "foo:2": false, "foobar": true, "fo": true, "bar:foo": true}
+	if !reflect.DeepEqual(exists, expected) {
+		t.Errorf("Got %v, expected %v", exists, expected)
+	}
+
+	if deleted, _, _ = cfg.DeletePrefix(ctx, "foo"); deleted != 2 {
+		t.Errorf("Got %d keys deleted, expected foo and foobar", deleted)
+	}
+
+	// The reserved space can't be reached through a shorter prefix
+	if _, _, err := cfg.DeletePrefix(ctx, "__"); err != nil {
+		t.Fatal(err)
+	}
+	if e, _ := cfg.fsm.localGet(ctx, cfg.internalKey("lock")); e.Value != "internal" {
+		t.Errorf("Reserved key was deleted")
+	}
+
+	if _, _, err := cfg.DeletePrefix(ctx, ""); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("Got error %v for an empty prefix, expected %v", err, ErrInvalidKey)
+	}
+}
@@ -0,0 +1,86 @@
+package store
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// WithHTTPS tells the node that the HTTP API of every node of the cluster is
+// served over HTTPS, so the URLs it builds from the Raft address of a node,
+// to forward requests or report the leader, are https ones. The certificates
+// of the nodes must then be trusted by the client of WithHTTPClient.
+func WithHTTPS() Option {
+	return func(o *options) {
+		o.https = true
+	}
+}
+
+// WithRaftTLS wraps the connections of the Raft transport in TLS with
+// tlsConfig, which must hold the certificate of the node. The nodes
+// authenticate each other: a node only accepts the connections of peers
+// presenting a certificate signed by the ClientCAs of tlsConfig, and only
+// replicates to peers whose certificate is signed by its RootCAs, the system
+// pools when they are nil. Every node of the cluster must use TLS.
+func WithRaftTLS(tlsConfig *tls.Config) Option {
+	return func(o *options) {
+		o.raftTLS = tlsConfig
+	}
+}
+
+// httpURL converts the Raft address of a node to the URL of its HTTP API, see
+// RaftAddressToHTTP, with the https scheme when the API is served over HTTPS.
+func (cfg *Config) httpURL(addr raft.ServerAddress) *url.URL {
+	u := RaftAddressToHTTP(addr)
+	if cfg.https {
+		u.Scheme = "https"
+	}
+
+	return u
+}
+
+// tlsStreamLayer is a raft.StreamLayer whose connections are wrapped in TLS.
+type tlsStreamLayer struct {
+	net.Listener
+	advertise net.Addr
+	config    *tls.Config
+}
+
+var _ raft.StreamLayer = (*tlsStreamLayer)(nil)
+
+// newTLSStreamLayer listens on bind for the TLS connections of the peers,
+// requiring their certificate, and advertises advertise to the cluster.
+func newTLSStreamLayer(bind string, advertise net.Addr, tlsConfig *tls.Config) (*tlsStreamLayer, error) {
+	if len(tlsConfig.Certificates) == 0 && tlsConfig.GetCertificate == nil {
+		return nil, errors.New("the Raft TLS configuration holds no certificate")
+	}
+
+	config := tlsConfig.Clone()
+	config.ClientAuth = tls.RequireAndVerifyClientCert
+	if config.MinVersion == 0 {
+		config.MinVersion = tls.VersionTLS12
+	}
+
+	listener, err := tls.Listen("tcp", bind, config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tlsStreamLayer{Listener: listener, advertise: advertise, config: config}, nil
+}
+
+// Addr returns the address advertised to the cluster.
+func (l *tlsStreamLayer) Addr() net.Addr {
+	return l.advertise
+}
+
+// Dial opens a TLS connection to the peer at address, presenting the
+// certificate of the node.
+func (l *tlsStreamLayer) Dial(address raft.ServerAddress, timeout time.Duration) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: timeout}
+	return tls.DialWithDialer(dialer, "tcp", string(address), l.config)
+}
@@ -0,0 +1,139 @@
+package store
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// newTestCA returns a CA and a function issuing certificates for localhost
+// signed by it.
+func newTestCA(t *testing.T) (*x509.CertPool, func() tls.Certificate) {
+	t.Helper()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Couldn't generate CA key: %s", err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("Couldn't create CA certificate: %s", err)
+	}
+	ca, _ := x509.ParseCertificate(caDER)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+
+	serial := int64(1)
+	issue := func() tls.Certificate {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatalf("Couldn't generate key: %s", err)
+		}
+		serial++
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: "node"},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+			IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+		if err != nil {
+			t.Fatalf("Couldn't create certificate: %s", err)
+		}
+
+		return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	}
+
+	return pool, issue
+}
+
+func TestTLSStreamLayer(t *testing.T) {
+	pool, issue := newTestCA(t)
+	newLayer := func(cert tls.Certificate) *tlsStreamLayer {
+		layer, err := newTLSStreamLayer("127.0.0.1:0", nil, &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			RootCAs:      pool,
+			ClientCAs:    pool,
+		})
+		if err != nil {
+			t.Fatalf("newTLSStreamLayer returned unexpected error: %s", err)
+		}
+		t.Cleanup(func() { layer.Close() })
+
+		return layer
+	}
+	server, client := newLayer(issue()), newLayer(issue())
+
+	go func() {
+		conn, err := server.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.Copy(conn, conn)
+	}()
+
+	conn, err := client.Dial(raft.ServerAddress(server.Listener.Addr().String()), time.Second)
+	if err != nil {
+		t.Fatalf("Dial returned unexpected error: %s", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatalf("Couldn't write to the peer: %s", err)
+	}
+	got := make([]byte, 4)
+	if _, err := io.ReadFull(conn, got); err != nil || string(got) != "ping" {
+		t.Errorf("Read %q, %v from the peer, want ping", got, err)
+	}
+
+	// A peer without a certificate is turned away
+	go func() {
+		if conn, err := server.Accept(); err == nil {
+			conn.Read(make([]byte, 1))
+			conn.Close()
+		}
+	}()
+	anonymous, err := tls.Dial("tcp", server.Listener.Addr().String(), &tls.Config{RootCAs: pool})
+	if err == nil {
+		defer anonymous.Close()
+		_, err = anonymous.Read(make([]byte, 1))
+	}
+	if err == nil {
+		t.Errorf("A peer without a certificate was accepted")
+	}
+}
+
+func TestHTTPURL(t *testing.T) {
+	cfg := &Config{}
+	if got := cfg.httpURL("10.0.0.1:8081").String(); got != "http://10.0.0.1:8080" {
+		t.Errorf("httpURL() = %s, want http://10.0.0.1:8080", got)
+	}
+
+	cfg.https = true
+	if got := cfg.httpURL("10.0.0.1:8081").String(); got != "https://10.0.0.1:8080" {
+		t.Errorf("httpURL() with HTTPS = %s, want https://10.0.0.1:8080", got)
+	}
+}
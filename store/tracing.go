@@ -0,0 +1,52 @@
+package store
+
+import (
+	"context"
+
+	"github.com/hashicorp/raft"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer records the spans of the store with the tracer provider registered
+// with otel.SetTracerProvider, it records nothing until one is.
+var tracer = otel.Tracer("github.com/maelfosso/key-value-store/store")
+
+// startSpan starts the span name as a child of the span of ctx.
+func startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// endSpan ends span, recording err.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// injectTrace sets the Trace of cmd to the trace context of ctx, with the
+// propagator registered with otel.SetTextMapPropagator.
+func injectTrace(ctx context.Context, cmd *Command) {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	if len(carrier) > 0 {
+		cmd.Trace = carrier
+	}
+}
+
+// startApplySpan starts the span of the FSM applying the command of l, as a
+// child of the span of the write it carries, if any.
+func startApplySpan(l *raft.Log, cmd Command) trace.Span {
+	ctx := otel.GetTextMapPropagator().Extract(context.Background(), propagation.MapCarrier(cmd.Trace))
+	_, span := startSpan(ctx, "fsm.Apply",
+		attribute.String("kv.action", cmd.Action),
+		attribute.Int64("raft.index", int64(l.Index)),
+	)
+
+	return span
+}
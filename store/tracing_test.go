@@ -0,0 +1,56 @@
+package store
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	prevProvider, prevPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer func() {
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+	}()
+
+	cfg, err := NewStandalone(t.TempDir(), WithLogger(hclog.NewNullLogger()))
+	if err != nil {
+		t.Fatalf("NewStandalone returned unexpected error: %s", err)
+	}
+
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "request")
+	if err := cfg.Set(ctx, "a", "1"); err != nil {
+		t.Fatalf("Set returned unexpected error: %s", err)
+	}
+	parent.End()
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	for _, name := range []string{"Config.SetEntry", "raft.Apply", "fsm.Apply"} {
+		if spans[name] == nil {
+			t.Fatalf("No %s span, got %v", name, spans)
+		}
+		if spans[name].SpanContext().TraceID() != parent.SpanContext().TraceID() {
+			t.Errorf("The %s span isn't in the trace of the request", name)
+		}
+	}
+
+	// The FSM gets the trace context through the command
+	if got, want := spans["fsm.Apply"].Parent().SpanID(), spans["raft.Apply"].SpanContext().SpanID(); got != want {
+		t.Errorf("The parent of fsm.Apply is %s, want raft.Apply %s", got, want)
+	}
+	if got, want := spans["raft.Apply"].Parent().SpanID(), spans["Config.SetEntry"].SpanContext().SpanID(); got != want {
+		t.Errorf("The parent of raft.Apply is %s, want Config.SetEntry %s", got, want)
+	}
+}
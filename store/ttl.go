@@ -0,0 +1,40 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// expiryInterval is how often the leader purges expired entries. Expired
+// entries are hidden from reads as soon as they expire, the purge only
+// reclaims their space.
+const expiryInterval = 30 * time.Second
+
+// purgeExpired runs forever, having the leader replicate an expire command
+// whenever entries expired.
+func (cfg *Config) purgeExpired() {
+	ticker := time.NewTicker(expiryInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		if cfg.state() != raft.Leader {
+			continue
+		}
+
+		expired, err := cfg.fsm.hasExpired(context.Background(), now)
+		if err != nil {
+			cfg.logger.Error("couldn't look for expired entries", "error", err)
+			continue
+		}
+
+		if !expired {
+			continue
+		}
+
+		if _, _, err := cfg.apply(context.Background(), Command{Action: "expire", Now: now.UnixNano()}); err != nil {
+			cfg.logger.Error("couldn't purge expired entries", "error", err)
+		}
+	}
+}
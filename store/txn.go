@@ -0,0 +1,284 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// EndOfKeys as the end of a range runs it to the last key.
+const EndOfKeys = "\x00"
+
+// CompareOp is how a TxnCompare checks its key.
+type CompareOp string
+
+const (
+	// CompareExists and CompareMissing check whether the key holds an
+	// entry.
+	CompareExists  CompareOp = "exists"
+	CompareMissing CompareOp = "missing"
+
+	// The other ops compare the value of the key with Value, byte by byte.
+	// They don't hold for a missing key.
+	CompareEqual    CompareOp = "="
+	CompareNotEqual CompareOp = "!="
+	CompareLess     CompareOp = "<"
+	CompareGreater  CompareOp = ">"
+)
+
+// TxnCompare is a condition of a transaction on the entry at Key.
+type TxnCompare struct {
+	Key   string
+	Op    CompareOp
+	Value []byte `json:",omitempty"`
+}
+
+// TxnAction is what a TxnOp does.
+type TxnAction string
+
+const (
+	TxnGet    TxnAction = "get"
+	TxnPut    TxnAction = "put"
+	TxnDelete TxnAction = "delete"
+)
+
+// TxnOp is an operation of a transaction. It reads or deletes the entry at
+// Key or, when End is set, the entries of the keys from Key up to End,
+// excluded, or to the last key when End is EndOfKeys. A put writes Value at
+// Key.
+type TxnOp struct {
+	Action TxnAction
+	Key    string
+	End    string `json:",omitempty"`
+	Value  []byte `json:",omitempty"`
+
+	// Limit bounds the entries a get reads, zero means all of them.
+	Limit int `json:",omitempty"`
+}
+
+// KeyEntry is an entry along with its key.
+type KeyEntry struct {
+	Key string
+	Entry
+}
+
+// OpResult is the outcome of a TxnOp, or of a Range. A get reads Entries, in
+// key order, Count being the number of keys in the range and More whether
+// Limit left some out. Prev are the entries a put replaced or a delete
+// removed.
+type OpResult struct {
+	Entries []KeyEntry
+	Count   int
+	More    bool
+	Prev    []KeyEntry
+}
+
+// TxnResult is the outcome of a transaction: whether its compares all held,
+// and the results of the operations it ran, in order.
+type TxnResult struct {
+	Succeeded bool
+	Results   []OpResult
+}
+
+// Range reads the entries of the keys from key up to end, excluded, or of key
+// alone when end is empty, see TxnOp. It also returns the index of the last
+// command applied to the data read.
+func (cfg *Config) Range(ctx context.Context, key, end string, limit int) (OpResult, uint64, error) {
+	if err := cfg.validateRange(key, end); err != nil {
+		return OpResult{}, 0, err
+	}
+	if err := cfg.checkReady(); err != nil {
+		return OpResult{}, 0, err
+	}
+	if err := readable(ctx); err != nil {
+		return OpResult{}, 0, err
+	}
+
+	cfg.fsm.mu.RLock()
+	defer cfg.fsm.mu.RUnlock()
+
+	p := cfg.fsm.policies
+	return cfg.fsm.localRange(p.key(key), p.key(end), limit, time.Now()), cfg.fsm.applied, nil
+}
+
+// Txn runs the success operations if every compare holds and the failure
+// ones otherwise, in a single Raft log entry: no other write can slip in
+// between the compares and the operations. The gets read what the previous
+// operations left. It returns the log index of the transaction.
+func (cfg *Config) Txn(ctx context.Context, compares []TxnCompare, success, failure []TxnOp) (TxnResult, uint64, error) {
+	for _, c := range compares {
+		if err := cfg.validateKey(c.Key); err != nil {
+			return TxnResult{}, 0, err
+		}
+	}
+	for _, op := range append(append([]TxnOp{}, success...), failure...) {
+		switch {
+		case op.Action == TxnPut && op.End != "":
+			return TxnResult{}, 0, fmt.Errorf("%w: a put writes a single key, %q has a range end", ErrInvalidTxn, op.Key)
+		case op.Action == TxnPut:
+			if err := cfg.validateKey(op.Key); err != nil {
+				return TxnResult{}, 0, err
+			}
+			if err := validateValue(string(op.Value)); err != nil {
+				return TxnResult{}, 0, err
+			}
+		case op.Action == TxnGet, op.Action == TxnDelete:
+			if err := cfg.validateRange(op.Key, op.End); err != nil {
+				return TxnResult{}, 0, err
+			}
+		default:
+			return TxnResult{}, 0, fmt.Errorf("%w: unknown operation %q", ErrInvalidTxn, op.Action)
+		}
+	}
+
+	if err := cfg.writable(); err != nil {
+		return TxnResult{}, 0, err
+	}
+
+	resp, index, err := cfg.apply(ctx, Command{
+		Action:   "txn",
+		Compares: compares,
+		Success:  success,
+		Failure:  failure,
+		Now:      time.Now().UnixNano(),
+	})
+	if err != nil {
+		return TxnResult{}, 0, err
+	}
+
+	result, _ := resp.(TxnResult)
+	return result, index, nil
+}
+
+// validateRange checks the key of a range is valid, any key can start one
+// with an end.
+func (cfg *Config) validateRange(key, end string) error {
+	if end != "" {
+		return nil
+	}
+
+	return cfg.validateKey(key)
+}
+
+// localTxn applies a txn command, the entries expired at its time counting as
+// missing. The caller holds the write lock.
+func (f *fsm) localTxn(cmd Command) (TxnResult, []Event, error) {
+	now := cmd.time()
+	result := TxnResult{Succeeded: true}
+	for _, c := range cmd.Compares {
+		if !f.holds(c, now) {
+			result.Succeeded = false
+			break
+		}
+	}
+	ops := cmd.Success
+	if !result.Succeeded {
+		ops = cmd.Failure
+	}
+
+	written := map[string]int{}
+	var removed []string
+	for _, op := range ops {
+		switch op.Action {
+		case TxnPut:
+			written[op.Key] = len(op.Value)
+		case TxnDelete:
+			removed = append(removed, f.rangeKeys(op.Key, op.End, now)...)
+		}
+	}
+	if err := f.checkQuotas(written, removed...); err != nil {
+		return TxnResult{}, nil, err
+	}
+
+	var events []Event
+	for _, op := range ops {
+		var r OpResult
+		switch op.Action {
+		case TxnGet:
+			r = f.localRange(op.Key, op.End, op.Limit, now)
+		case TxnPut:
+			if e, ok := f.data[op.Key]; ok && !e.expired(now) {
+				r.Prev = []KeyEntry{{Key: op.Key, Entry: e}}
+			}
+			f.put(op.Key, Entry{Value: string(op.Value)})
+			events = append(events, Event{Action: "set", Key: op.Key, Value: string(op.Value)})
+		case TxnDelete:
+			for _, key := range f.rangeKeys(op.Key, op.End, now) {
+				if e, found := f.localDelete(key, now); found {
+					r.Prev = append(r.Prev, KeyEntry{Key: key, Entry: e})
+					events = append(events, Event{Action: "delete", Key: key})
+				}
+			}
+		}
+		result.Results = append(result.Results, r)
+	}
+
+	return result, events, nil
+}
+
+// holds reports whether the compare c holds at now.
+func (f *fsm) holds(c TxnCompare, now time.Time) bool {
+	e, found := f.data[c.Key]
+	found = found && !e.expired(now)
+
+	switch c.Op {
+	case CompareExists:
+		return found
+	case CompareMissing:
+		return !found
+	}
+	if !found {
+		return false
+	}
+
+	switch cmp := bytes.Compare([]byte(e.Value), c.Value); c.Op {
+	case CompareEqual:
+		return cmp == 0
+	case CompareNotEqual:
+		return cmp != 0
+	case CompareLess:
+		return cmp < 0
+	case CompareGreater:
+		return cmp > 0
+	default:
+		return false
+	}
+}
+
+// rangeKeys returns the keys of a range holding an entry unexpired at now,
+// see TxnOp. The caller holds the lock.
+func (f *fsm) rangeKeys(key, end string, now time.Time) []string {
+	if end == "" {
+		if e, ok := f.data[key]; ok && !e.expired(now) {
+			return []string{key}
+		}
+		return nil
+	}
+
+	keys := f.sortedKeys()
+	var inRange []string
+	for i := sort.SearchStrings(keys, key); i < len(keys) && (end == EndOfKeys || keys[i] < end); i++ {
+		if !f.data[keys[i]].expired(now) {
+			inRange = append(inRange, keys[i])
+		}
+	}
+
+	return inRange
+}
+
+// localRange reads the entries of a range, up to limit of them unless it is
+// zero. The caller holds the lock.
+func (f *fsm) localRange(key, end string, limit int, now time.Time) OpResult {
+	keys := f.rangeKeys(key, end, now)
+	r := OpResult{Entries: []KeyEntry{}, Count: len(keys)}
+	if limit > 0 && len(keys) > limit {
+		keys, r.More = keys[:limit], true
+	}
+	for _, key := range keys {
+		r.Entries = append(r.Entries, KeyEntry{Key: key, Entry: f.data[key]})
+	}
+
+	return r
+}
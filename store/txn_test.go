@@ -0,0 +1,114 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/raft"
+)
+
+func TestTxn(t *testing.T) {
+	cfg := newTestConfig(t)
+	ctx := context.Background()
+
+	for _, k := range []string{"app/a", "app/b", "app/c", "other"} {
+		if err := cfg.Set(ctx, k, "v-"+k); err != nil {
+			t.Fatalf("Set returned unexpected error: %s", err)
+		}
+	}
+
+	compares := []TxnCompare{
+		{Key: "app/a", Op: CompareEqual, Value: []byte("v-app/a")},
+		{Key: "lock", Op: CompareMissing},
+	}
+	success := []TxnOp{
+		{Action: TxnPut, Key: "lock", Value: []byte("held")},
+		{Action: TxnDelete, Key: "app/b", End: "app/c"},
+		{Action: TxnGet, Key: "app/", End: "app0"},
+	}
+	failure := []TxnOp{{Action: TxnGet, Key: "lock"}}
+
+	result, _, err := cfg.Txn(ctx, compares, success, failure)
+	if err != nil {
+		t.Fatalf("Txn returned unexpected error: %s", err)
+	}
+	if !result.Succeeded || len(result.Results) != 3 {
+		t.Fatalf("Txn = %+v, expected the success operations run", result)
+	}
+	if prev := result.Results[1].Prev; len(prev) != 1 || prev[0].Key != "app/b" {
+		t.Errorf("Txn deleted %+v, expected app/b alone", prev)
+	}
+	if got := result.Results[2]; got.Count != 2 || got.Entries[0].Key != "app/a" || got.Entries[1].Key != "app/c" {
+		t.Errorf("Txn read %+v, expected app/a and app/c", got)
+	}
+
+	// The lock is held now, the failure operations run
+	result, _, err = cfg.Txn(ctx, compares, success, failure)
+	if err != nil {
+		t.Fatalf("Txn returned unexpected error: %s", err)
+	}
+	if result.Succeeded || len(result.Results) != 1 || result.Results[0].Entries[0].Value != "held" {
+		t.Errorf("Txn = %+v, expected the failure get of the lock", result)
+	}
+
+	r, _, err := cfg.Range(ctx, "", EndOfKeys, 2)
+	if err != nil {
+		t.Fatalf("Range returned unexpected error: %s", err)
+	}
+	if r.Count != 4 || !r.More || len(r.Entries) != 2 || r.Entries[0].Key != "app/a" {
+		t.Errorf("Range = %+v, expected the first 2 of 4 keys", r)
+	}
+
+	if _, _, err := cfg.Txn(ctx, nil, []TxnOp{{Action: TxnPut, Key: "a", End: "b"}}, nil); !errors.Is(err, ErrInvalidTxn) {
+		t.Errorf("Txn putting a range returned %v, expected ErrInvalidTxn", err)
+	}
+}
+
+func TestTxnReplay(t *testing.T) {
+	// The session expires shortly after the txn was written: a replica
+	// applying it right away and one applying it once the session expired by
+	// its clock must agree
+	now := time.Now()
+	batch, _ := json.Marshal(Command{Action: "batch", Entries: []CommandEntry{
+		{Key: "app/a", Data: []byte("1")},
+		{Key: "app/session", Data: []byte("s"), ExpiresAt: now.Add(200 * time.Millisecond).UnixNano()},
+	}})
+	txn, _ := json.Marshal(Command{
+		Action:   "txn",
+		Compares: []TxnCompare{{Key: "app/session", Op: CompareExists}},
+		Success: []TxnOp{
+			{Action: TxnGet, Key: "app/", End: "app0"},
+			{Action: TxnPut, Key: "app/session", Value: []byte("t")},
+			{Action: TxnDelete, Key: "app/a"},
+		},
+		Now: now.UnixNano(),
+	})
+
+	var results []interface{}
+	var replicas []*fsm
+	for i := 0; i < 2; i++ {
+		if i == 1 {
+			time.Sleep(time.Until(now.Add(300 * time.Millisecond)))
+		}
+		f := newFSM(NewFileStore(filepath.Join(t.TempDir(), "data.json")), hclog.NewNullLogger())
+		f.Apply(&raft.Log{Index: 1, Data: batch})
+		results = append(results, f.Apply(&raft.Log{Index: 2, Data: txn}))
+		replicas = append(replicas, f)
+	}
+
+	if r, ok := results[0].(TxnResult); !ok || !r.Succeeded {
+		t.Fatalf("Got %+v, expected the txn to succeed", results[0])
+	}
+	if !reflect.DeepEqual(results[0], results[1]) {
+		t.Errorf("The replicas got different results:\n%+v\n%+v", results[0], results[1])
+	}
+	if !reflect.DeepEqual(replicas[0].data, replicas[1].data) {
+		t.Errorf("The replicas hold different data:\n%v\n%v", replicas[0].data, replicas[1].data)
+	}
+}
@@ -0,0 +1,79 @@
+package store
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// PromoteServer makes the non-voter id a voter, taking part in elections and
+// counted in the quorum. A node can join as a non-voter, see
+// WithNonVoter, and be promoted once it caught up with the log, so adding it
+// doesn't slow down writes while it does. It must be called on the leader and
+// fails with ErrReadReplica for read replicas, which reject writes. Promoting
+// a voter does nothing.
+func (cfg *Config) PromoteServer(id raft.ServerID) error {
+	server, err := cfg.server(id)
+	if err != nil || server.Suffrage == raft.Voter {
+		return err
+	}
+
+	s, err := cfg.nodeStatus(cfg.memberURL(server.ID, server.Address).String())
+	if err != nil {
+		return fmt.Errorf("getting status of node %q: %w", id, err)
+	}
+	if s.ReadOnly {
+		return fmt.Errorf("%w: restart node %q without READ_REPLICA to promote it", ErrReadReplica, id)
+	}
+
+	if err := cfg.raft.AddVoter(id, server.Address, 0, time.Minute).Error(); err != nil {
+		cfg.logger.Error("could not promote server", "id", id, "error", err)
+		return err
+	}
+	cfg.logger.Info("promoted server", "id", id)
+
+	return nil
+}
+
+// DemoteServer makes the voter id a non-voter, which keeps replicating the
+// log but no longer takes part in elections nor counts in the quorum. It must
+// be called on the leader; a leader demoting itself steps down. Demoting a
+// non-voter does nothing.
+func (cfg *Config) DemoteServer(id raft.ServerID) error {
+	server, err := cfg.server(id)
+	if err != nil || server.Suffrage != raft.Voter {
+		return err
+	}
+
+	if err := cfg.raft.DemoteVoter(id, 0, time.Minute).Error(); err != nil {
+		cfg.logger.Error("could not demote server", "id", id, "error", err)
+		return err
+	}
+	cfg.logger.Info("demoted server", "id", id)
+
+	return nil
+}
+
+// server returns the member id of the cluster, failing with ErrNotFound when
+// there is none. It must be called on the leader.
+func (cfg *Config) server(id raft.ServerID) (raft.Server, error) {
+	if cfg.standalone() {
+		return raft.Server{}, ErrStandalone
+	}
+	if cfg.state() != raft.Leader {
+		return raft.Server{}, cfg.notLeader()
+	}
+
+	future := cfg.raft.GetConfiguration()
+	if err := future.Error(); err != nil {
+		return raft.Server{}, fmt.Errorf("getting configuration: %w", err)
+	}
+	for _, server := range future.Configuration().Servers {
+		if server.ID == id {
+			return server, nil
+		}
+	}
+
+	return raft.Server{}, fmt.Errorf("%w: node %q", ErrNotFound, id)
+}
@@ -0,0 +1,50 @@
+package store
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/hashicorp/raft"
+)
+
+func TestPromoteServer(t *testing.T) {
+	cfg := newTestConfig(t)
+
+	// The replica's status is served one port below its Raft address
+	replica := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"state": "Follower", "read_only": true}`))
+	}))
+	defer replica.Close()
+	host, port, _ := net.SplitHostPort(replica.Listener.Addr().String())
+	p, _ := strconv.Atoi(port)
+	address := raft.ServerAddress(net.JoinHostPort(host, strconv.Itoa(p+1)))
+
+	if err := cfg.AddServer("replica", address, true); err != nil {
+		t.Fatalf("AddServer returned unexpected error: %s", err)
+	}
+	if err := cfg.PromoteServer("replica"); !errors.Is(err, ErrReadReplica) {
+		t.Errorf("PromoteServer() of a read replica = %v, want ErrReadReplica", err)
+	}
+	for _, peer := range cfg.Status().Peers {
+		if peer.ID == "replica" && peer.Voter {
+			t.Errorf("Got peer %+v, expected the read replica to stay a non-voter", peer)
+		}
+	}
+
+	if err := cfg.PromoteServer("test"); err != nil {
+		t.Errorf("PromoteServer() of a voter returned unexpected error: %s", err)
+	}
+	if err := cfg.DemoteServer("replica"); err != nil {
+		t.Errorf("DemoteServer() of a non-voter returned unexpected error: %s", err)
+	}
+	if err := cfg.PromoteServer("unknown"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("PromoteServer() of an unknown node = %v, want ErrNotFound", err)
+	}
+	if err := cfg.DemoteServer("unknown"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("DemoteServer() of an unknown node = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,62 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	// waitQueueSize is the buffer of the events watched by WaitForKey.
+	waitQueueSize = 64
+
+	// waitRecheckInterval is how often WaitForKey looks the key up on its
+	// own, in case the event creating it was dropped.
+	waitRecheckInterval = time.Second
+)
+
+// WaitForKey returns the entry at key as soon as it holds a value: straight
+// away if it already does, otherwise once a write creates it, within timeout.
+// It fails with ErrWaitTimeout when the key is still missing by then or ctx is
+// done first. The subscription to the changes is dropped on return.
+func (cfg *Config) WaitForKey(ctx context.Context, key string, timeout time.Duration) (Entry, error) {
+	if err := cfg.validateKey(key); err != nil {
+		return Entry{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// Subscribe before looking the key up, so a write landing in between
+	// isn't missed
+	events := cfg.fsm.events.subscribe(waitQueueSize)
+	defer cfg.fsm.events.unsubscribe(events)
+
+	ticker := time.NewTicker(waitRecheckInterval)
+	defer ticker.Stop()
+
+	stored := cfg.fsm.policies.key(key)
+	for {
+		e, found, err := cfg.LookupEntry(ctx, key)
+		if err != nil && ctx.Err() != nil {
+			return Entry{}, fmt.Errorf("%w: %q", ErrWaitTimeout, key)
+		}
+		if err != nil || found {
+			return e, err
+		}
+
+	wait:
+		for {
+			select {
+			case <-ctx.Done():
+				return Entry{}, fmt.Errorf("%w: %q", ErrWaitTimeout, key)
+			case <-ticker.C:
+				break wait
+			case ev := <-events:
+				if ev.Key == stored && ev.Action == "set" {
+					break wait
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWaitForKey(t *testing.T) {
+	cfg := newTestConfig(t)
+	ctx := context.Background()
+
+	cfg.Set(ctx, "present", "v")
+	if e, err := cfg.WaitForKey(ctx, "present", time.Second); err != nil || e.Value != "v" {
+		t.Errorf("Got %q (error: %v), expected %q", e.Value, err, "v")
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cfg.Set(ctx, "later", "created")
+	}()
+	start := time.Now()
+	if e, err := cfg.WaitForKey(ctx, "later", 5*time.Second); err != nil || e.Value != "created" {
+		t.Errorf("Got %q (error: %v), expected %q", e.Value, err, "created")
+	}
+	if elapsed := time.Since(start); elapsed >= waitRecheckInterval {
+		t.Errorf("Returned after %s, expected to be woken up by the write", elapsed)
+	}
+
+	if _, err := cfg.WaitForKey(ctx, "never", 50*time.Millisecond); !errors.Is(err, ErrWaitTimeout) {
+		t.Errorf("Got error %v, expected %v", err, ErrWaitTimeout)
+	}
+
+	// A client going away ends the wait too
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := cfg.WaitForKey(cancelled, "never", time.Minute); !errors.Is(err, ErrWaitTimeout) {
+		t.Errorf("Got error %v, expected %v", err, ErrWaitTimeout)
+	}
+
+	cfg.fsm.events.mu.Lock()
+	defer cfg.fsm.events.mu.Unlock()
+	if n := len(cfg.fsm.events.subs); n != 0 {
+		t.Errorf("Got %d subscriptions left, expected none", n)
+	}
+}
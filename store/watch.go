@@ -0,0 +1,53 @@
+package store
+
+import (
+	"context"
+	"strings"
+)
+
+// watchQueueSize is the buffer of the events received by a watch.
+const watchQueueSize = 256
+
+// Watch returns the changes to key applied by this node from now on, set,
+// patch, delete and expire events, until ctx is done and the channel is
+// closed. With prefix, the changes to every key starting with key are
+// returned, to all keys when key is empty. Every node applies every committed
+// change, so followers can be watched as well as the leader. Events are
+// dropped rather than hold up the FSM when the watcher falls behind.
+func (cfg *Config) Watch(ctx context.Context, key string, prefix bool) (<-chan Event, error) {
+	if !prefix {
+		if err := cfg.validateKey(key); err != nil {
+			return nil, err
+		}
+	}
+
+	stored := cfg.fsm.policies.key(key)
+	events := cfg.fsm.events.subscribe(watchQueueSize)
+	watched := make(chan Event)
+	go func() {
+		defer close(watched)
+		defer cfg.fsm.events.unsubscribe(events)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case ev, ok := <-events:
+				if !ok {
+					return
+				}
+				if ev.Key != stored && !(prefix && strings.HasPrefix(ev.Key, stored)) {
+					continue
+				}
+
+				select {
+				case watched <- ev:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return watched, nil
+}
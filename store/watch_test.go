@@ -0,0 +1,63 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	cfg := newTestConfig(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	key, err := cfg.Watch(ctx, "k", false)
+	if err != nil {
+		t.Fatalf("Watch returned unexpected error: %s", err)
+	}
+	prefix, err := cfg.Watch(ctx, "app/", true)
+	if err != nil {
+		t.Fatalf("Watch returned unexpected error: %s", err)
+	}
+
+	for _, k := range []string{"k2", "app/a", "k"} {
+		if err := cfg.Set(ctx, k, "v"); err != nil {
+			t.Fatalf("Set returned unexpected error: %s", err)
+		}
+	}
+
+	next := func(events <-chan Event) Event {
+		t.Helper()
+		select {
+		case ev := <-events:
+			return ev
+		case <-time.After(time.Second):
+			t.Fatal("Got no event")
+			return Event{}
+		}
+	}
+	if ev := next(key); ev.Action != "set" || ev.Key != "k" || ev.Value != "v" {
+		t.Errorf("Got event %+v watching k, expected the set of k", ev)
+	}
+	if ev := next(prefix); ev.Key != "app/a" {
+		t.Errorf("Got event %+v watching app/, expected the set of app/a", ev)
+	}
+
+	if _, err := cfg.Watch(ctx, "", false); err == nil {
+		t.Error("Watch of an empty key succeeded, expected an error")
+	}
+
+	// Watches end with their context
+	cancel()
+	if _, ok := <-key; ok {
+		t.Error("Got an event after the watch ended, expected the channel closed")
+	}
+	if _, ok := <-prefix; ok {
+		t.Error("Got an event after the watch ended, expected the channel closed")
+	}
+	cfg.fsm.events.mu.Lock()
+	defer cfg.fsm.events.mu.Unlock()
+	if n := len(cfg.fsm.events.subs); n != 0 {
+		t.Errorf("%d subscriptions left after the watches ended, expected none", n)
+	}
+}
@@ -0,0 +1,91 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+const (
+	webhookQueueSize = 1024
+	webhookAttempts  = 5
+	webhookBackoff   = 100 * time.Millisecond
+)
+
+// webhook delivers committed changes to an external URL as JSON events.
+//
+// Only the leader delivers, so each change is sent by a single node. Delivery
+// is best-effort: a failed POST is retried with exponential backoff, so the
+// endpoint may see an event more than once, but events are only queued in
+// memory. They are dropped once more than webhookQueueSize are waiting, when
+// all attempts fail, and when leadership changes: the old leader stops
+// sending its queue, the events it hadn't sent yet are lost.
+type webhook struct {
+	url      string
+	client   *http.Client
+	isLeader func() bool
+	backoff  time.Duration
+	logger   hclog.Logger
+}
+
+func newWebhook(url string, isLeader func() bool, logger hclog.Logger) *webhook {
+	return &webhook{
+		url:      url,
+		client:   &http.Client{Timeout: 5 * time.Second},
+		isLeader: isLeader,
+		backoff:  webhookBackoff,
+		logger:   logger,
+	}
+}
+
+// run delivers the events received on queue until it is closed.
+func (wh *webhook) run(queue <-chan Event) {
+	for ev := range queue {
+		// Leadership is checked for every event so a node that lost or
+		// gained it since the last one behaves accordingly.
+		if !wh.isLeader() {
+			continue
+		}
+
+		if err := wh.deliver(ev); err != nil {
+			wh.logger.Error("couldn't deliver webhook event", "url", wh.url, "key", ev.Key, "error", err)
+		}
+	}
+}
+
+func (wh *webhook) deliver(ev Event) error {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return fmt.Errorf("marshaling event: %w", err)
+	}
+
+	backoff := wh.backoff
+	for attempt := 1; ; attempt++ {
+		err = wh.post(body)
+		if err == nil || attempt == webhookAttempts {
+			return err
+		}
+
+		wh.logger.Warn("webhook delivery failed, retrying", "attempt", attempt, "error", err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func (wh *webhook) post(body []byte) error {
+	resp, err := wh.client.Post(wh.url, "application/json; charset=utf-8", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return nil
+}
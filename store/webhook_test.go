@@ -0,0 +1,93 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+func TestWebhook(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		attempts int
+		received []Event
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		// Fail the first attempt to exercise the retries
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		var ev Event
+		if err := json.NewDecoder(r.Body).Decode(&ev); err != nil {
+			t.Errorf("Couldn't decode event: %s", err)
+		}
+		received = append(received, ev)
+	}))
+	defer server.Close()
+
+	cfg := newTestConfig(t)
+	wh := newWebhook(server.URL, func() bool { return true }, hclog.NewNullLogger())
+	wh.backoff = time.Millisecond
+	queue := cfg.fsm.events.subscribe(webhookQueueSize)
+	defer cfg.fsm.events.unsubscribe(queue)
+	go wh.run(queue)
+
+	if err := cfg.Set(context.Background(), "key", "value"); err != nil {
+		t.Fatalf("Set returned unexpected error: %s", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		n := len(received)
+		mu.Unlock()
+		if n > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Webhook wasn't called")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if ev := received[0]; ev.Action != "set" || ev.Key != "key" || ev.Value != "value" || ev.Timestamp.IsZero() {
+		t.Errorf("Got unexpected event %+v", ev)
+	}
+	if attempts != 2 {
+		t.Errorf("Got %d attempts, expected 2", attempts)
+	}
+}
+
+func TestWebhookFollowerDoesNotDeliver(t *testing.T) {
+	called := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called <- struct{}{}
+	}))
+	defer server.Close()
+
+	queue := make(chan Event, 1)
+	queue <- Event{Action: "set", Key: "key"}
+	close(queue)
+
+	newWebhook(server.URL, func() bool { return false }, hclog.NewNullLogger()).run(queue)
+
+	select {
+	case <-called:
+		t.Errorf("Follower delivered an event")
+	default:
+	}
+}